@@ -1,112 +1,6 @@
 -- Create Databases
+-- 表结构由各服务内嵌的迁移脚本维护 (services/*/migrations/mysql)，
+-- 容器启动时执行 "<service> migrate up"，这里只负责创建数据库。
 CREATE DATABASE IF NOT EXISTS order_db;
 CREATE DATABASE IF NOT EXISTS inventory_db;
 CREATE DATABASE IF NOT EXISTS payment_db;
-
--- ==========================================
--- 1. Order Service Setup
--- ==========================================
-USE order_db;
-
-CREATE TABLE IF NOT EXISTS orders (
-    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    order_id VARCHAR(255) NOT NULL UNIQUE,
-    user_id BIGINT NOT NULL,
-    status VARCHAR(50),
-    total_amount BIGINT,
-    trace_id VARCHAR(255),
-    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
-    updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
-    INDEX idx_trace_id (trace_id)
-);
-
-CREATE TABLE IF NOT EXISTS outbox_events (
-    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    aggregate_type VARCHAR(255) NOT NULL,
-    aggregate_id VARCHAR(255) NOT NULL,
-    event_type VARCHAR(255) NOT NULL,
-    payload JSON NOT NULL,
-    status VARCHAR(50) DEFAULT 'PENDING',
-    trace_id VARCHAR(255),
-    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
-    updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
-    INDEX idx_status (status),
-    INDEX idx_created_at (created_at)
-);
-
--- ==========================================
--- 2. Inventory Service Setup
--- ==========================================
-USE inventory_db;
-
-CREATE TABLE IF NOT EXISTS inventories (
-    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    product_id BIGINT UNSIGNED,
-    sku VARCHAR(255) NOT NULL UNIQUE,
-    quantity INT,
-    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
-    updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3)
-);
-
-CREATE TABLE IF NOT EXISTS inventory_deduction_logs (
-    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    order_id VARCHAR(255),
-    request_id VARCHAR(255) NOT NULL UNIQUE,
-    sku VARCHAR(255),
-    trace_id VARCHAR(255),
-    quantity INT,
-    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
-    INDEX idx_order_id (order_id),
-    INDEX idx_sku (sku),
-    INDEX idx_trace_id (trace_id)
-);
-
-CREATE TABLE IF NOT EXISTS outbox_events (
-    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    aggregate_type VARCHAR(255) NOT NULL,
-    aggregate_id VARCHAR(255) NOT NULL,
-    event_type VARCHAR(255) NOT NULL,
-    payload JSON NOT NULL,
-    status VARCHAR(50) DEFAULT 'PENDING',
-    trace_id VARCHAR(255),
-    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
-    updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
-    INDEX idx_status (status),
-    INDEX idx_created_at (created_at)
-);
-
--- Seed Initial Inventory Data
-INSERT INTO inventories (product_id, sku, quantity) 
-VALUES (1, 'PHONE-001', 100) 
-ON DUPLICATE KEY UPDATE quantity = quantity;
-
--- ==========================================
--- 3. Payment Service Setup
--- ==========================================
-USE payment_db;
-
-CREATE TABLE IF NOT EXISTS payments (
-    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    order_id VARCHAR(255) NOT NULL UNIQUE,
-    amount BIGINT,
-    status VARCHAR(50),
-    transaction_id VARCHAR(255),
-    trace_id VARCHAR(255),
-    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
-    updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
-    INDEX idx_trace_id (trace_id)
-);
-
-CREATE TABLE IF NOT EXISTS outbox_events (
-    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    aggregate_type VARCHAR(255) NOT NULL,
-    aggregate_id VARCHAR(255) NOT NULL,
-    event_type VARCHAR(255) NOT NULL,
-    payload JSON NOT NULL,
-    status VARCHAR(50) DEFAULT 'PENDING',
-    trace_id VARCHAR(255),
-    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
-    updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
-    INDEX idx_status (status),
-    INDEX idx_created_at (created_at)
-);
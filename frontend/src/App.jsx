@@ -1,8 +1,74 @@
 import { useState, useEffect } from 'react'
 import './App.css'
 
+// The gateway requires a JWT for orders and payments; the user ID comes from the token's subject
+const TOKEN_KEY = 'accessToken'
+
+function apiFetch(url, options = {}) {
+  const token = localStorage.getItem(TOKEN_KEY)
+  const headers = { ...options.headers }
+  if (token) headers.Authorization = `Bearer ${token}`
+  return fetch(url, { ...options, headers })
+}
+
+// Streams an order's status changes (SSE). EventSource cannot send the Authorization header,
+// so the stream is read with fetch; reconnects send Last-Event-ID to replay missed changes
+async function watchOrder(orderId, onStatus, signal) {
+  let lastEventId = ''
+  let retry = 3000
+  while (!signal.aborted) {
+    try {
+      const headers = lastEventId ? { 'Last-Event-ID': lastEventId } : {}
+      const res = await apiFetch(`/api/v1/orders/${orderId}/events`, { headers, signal })
+      // Not allowed or gone: retrying will not help
+      if ([401, 403, 404].includes(res.status)) return
+      if (!res.ok) throw new Error(`Server error: ${res.status}`)
+      const reader = res.body.pipeThrough(new TextDecoderStream()).getReader()
+      let buffer = ''
+      for (;;) {
+        const { value, done } = await reader.read()
+        if (done) break
+        buffer += value
+        let end
+        while ((end = buffer.indexOf('\n\n')) >= 0) {
+          const event = parseEvent(buffer.slice(0, end))
+          buffer = buffer.slice(end + 2)
+          if (event.retry) retry = event.retry
+          if (event.id) lastEventId = event.id
+          if (event.event === 'status') onStatus(JSON.parse(event.data))
+        }
+      }
+    } catch (err) {
+      if (signal.aborted) return
+      console.warn('Order event stream interrupted:', err)
+    }
+    await new Promise(resolve => setTimeout(resolve, retry))
+  }
+}
+
+// Parses one SSE event block; comment lines (heartbeats) are skipped
+function parseEvent(block) {
+  const event = { data: '' }
+  for (const line of block.split('\n')) {
+    if (line.startsWith(':')) continue
+    const i = line.indexOf(':')
+    const field = i < 0 ? line : line.slice(0, i)
+    const value = i < 0 ? '' : line.slice(i + 1).replace(/^ /, '')
+    if (field === 'data') event.data += (event.data ? '\n' : '') + value
+    else if (field === 'retry') event.retry = Number(value)
+    else event[field] = value
+  }
+  return event
+}
+
 function App() {
   const [activeTab, setActiveTab] = useState('orders')
+  const [token, setToken] = useState(localStorage.getItem(TOKEN_KEY) || '')
+
+  const saveToken = value => {
+    setToken(value)
+    localStorage.setItem(TOKEN_KEY, value.trim())
+  }
 
   return (
     <div className="container">
@@ -28,6 +94,10 @@ function App() {
             💳 Payments
           </button>
         </div>
+        <label>
+          Access token:
+          <input type="password" value={token} placeholder="JWT" onChange={e => saveToken(e.target.value)} />
+        </label>
       </header>
 
       <main className="content">
@@ -42,9 +112,9 @@ function App() {
 // --- Order Component ---
 function OrdersPanel() {
   const [orders, setOrders] = useState([])
+  const [details, setDetails] = useState(null)
   const [loading, setLoading] = useState(false)
   const [createForm, setCreateForm] = useState({
-    user_id: 1,
     product_id: "PHONE-001",
     quantity: 1,
     price: 100
@@ -53,7 +123,7 @@ function OrdersPanel() {
   const fetchOrders = async () => {
     setLoading(true)
     try {
-      const res = await fetch('/api/v1/orders')
+      const res = await apiFetch('/api/v1/orders')
       if (!res.ok) {
         // Now backend returns 200 [] for empty list, so !res.ok is a real error
         const errData = await res.json().catch(() => ({}))
@@ -72,11 +142,10 @@ function OrdersPanel() {
 
   const createOrder = async () => {
     try {
-      const res = await fetch('/api/v1/orders', {
+      const res = await apiFetch('/api/v1/orders', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
-          user_id: Number(createForm.user_id),
           sku: createForm.product_id,
           quantity: Number(createForm.quantity),
           price: Number(createForm.price)
@@ -91,17 +160,38 @@ function OrdersPanel() {
     }
   }
 
+  // One gateway call returns the order, its payment and the SKUs it reserved
+  const fetchDetails = async (orderId) => {
+    try {
+      const res = await apiFetch(`/api/v1/orders/${orderId}/details`)
+      const data = await res.json()
+      if (!res.ok) throw new Error(data.message || `Server error: ${res.status}`)
+      setDetails(data.data)
+    } catch (err) {
+      alert(`Failed to fetch order details: ${err.message}`)
+    }
+  }
+
   useEffect(() => { fetchOrders() }, [])
 
+  // While the details card is open, status changes are pushed by the server
+  const watchedId = details?.order.order_id
+  useEffect(() => {
+    if (!watchedId) return
+    const controller = new AbortController()
+    watchOrder(watchedId, ev => {
+      const update = o => o.order_id === ev.order_id ? { ...o, status: ev.status, version: ev.version } : o
+      setDetails(d => d && { ...d, order: update(d.order) })
+      setOrders(list => list.map(update))
+    }, controller.signal)
+    return () => controller.abort()
+  }, [watchedId])
+
   return (
     <div className="panel">
       <div className="card">
         <h2>New Order</h2>
         <div className="form-grid">
-          <label>
-            User ID:
-            <input type="number" value={createForm.user_id} onChange={e => setCreateForm({ ...createForm, user_id: e.target.value })} />
-          </label>
           <label>
             Product ID:
             <input type="text" value={createForm.product_id} onChange={e => setCreateForm({ ...createForm, product_id: e.target.value })} />
@@ -130,6 +220,7 @@ function OrdersPanel() {
               <th>User</th>
               <th>Amount</th>
               <th>Status</th>
+              <th></th>
             </tr>
           </thead>
           <tbody>
@@ -139,12 +230,23 @@ function OrdersPanel() {
                 <td>{o.user_id}</td>
                 <td>${(o.total_amount / 100).toFixed(2)}</td>
                 <td><span className={`status ${o.status}`}>{o.status}</span></td>
+                <td><button onClick={() => fetchDetails(o.order_id)}>Details</button></td>
               </tr>
             ))}
-            {orders.length === 0 && <tr><td colSpan="4">No orders</td></tr>}
+            {orders.length === 0 && <tr><td colSpan="5">No orders</td></tr>}
           </tbody>
         </table>
       </div>
+
+      {details && (
+        <div className="card">
+          <h2>Order {details.order.order_id}</h2>
+          <p>Status: <span className={`status ${details.order.status}`}>{details.order.status}</span></p>
+          <p>Items: {details.items ? details.items.map(i => `${i.sku} x${i.quantity} (${i.status})`).join(', ') || '-' : 'unavailable'}</p>
+          <p>Payment: {details.payment ? `${details.payment.status} $${(details.payment.amount / 100).toFixed(2)}` : (details.errors?.payment ? 'unavailable' : 'not paid')}</p>
+          {details.partial && <p>Some sections could not be loaded: {Object.keys(details.errors).join(', ')}</p>}
+        </div>
+      )}
     </div>
   )
 }
@@ -163,7 +265,7 @@ function InventoryPanel() {
     if (!skuCheck) return
     try {
       // API Gateway maps /api/v1/products/:sku -> /inventory/sku?sku=:sku
-      const res = await fetch(`/api/v1/products/${skuCheck}`)
+      const res = await apiFetch(`/api/v1/products/${skuCheck}`)
       if (!res.ok) throw new Error('Not found or error')
       const data = await res.json()
       setInventoryData(data.data)
@@ -176,7 +278,7 @@ function InventoryPanel() {
   const createInventory = async () => {
     try {
       // API Gateway maps /api/v1/inventory/create -> /inventory/create
-      const res = await fetch('/api/v1/inventory/create', {
+      const res = await apiFetch('/api/v1/inventory/create', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
@@ -249,7 +351,7 @@ function PaymentsPanel() {
   const checkPayment = async () => {
     if (!orderIdCheck) return
     try {
-      const res = await fetch(`/api/v1/payments?order_id=${orderIdCheck}`)
+      const res = await apiFetch(`/api/v1/payments?order_id=${orderIdCheck}`)
       if (!res.ok) throw new Error('Not found')
       const data = await res.json()
       setPaymentData(data.data)
@@ -261,7 +363,7 @@ function PaymentsPanel() {
 
   const createPayment = async () => {
     try {
-      const res = await fetch('/api/v1/payments', {
+      const res = await apiFetch('/api/v1/payments', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
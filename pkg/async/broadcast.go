@@ -0,0 +1,147 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"vv-ecommerce/pkg/logging"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+// Broadcaster 是发布/订阅：每个订阅者 (通常每个服务实例一个) 都收到每条消息的一份，
+// 而 MessageQueue.Subscribe 是工作队列，一条消息只由一个订阅者处理。
+// 广播的消息不持久化，订阅之前发布的、订阅者断开期间发布的消息都会丢失，只适合可以从数据库补齐的通知
+type Broadcaster interface {
+	Broadcast(ctx context.Context, topic string, payload []byte) error
+	SubscribeBroadcast(topic string, handler Handler) error
+}
+
+var (
+	_ Broadcaster = (*MemoryQueue)(nil)
+	_ Broadcaster = (*RabbitMQ)(nil)
+)
+
+// Broadcast 在当前 goroutine 中依次调用本进程的所有订阅者 (保持消息顺序)，handler 不应阻塞
+func (q *MemoryQueue) Broadcast(ctx context.Context, topic string, payload []byte) (err error) {
+	span, headers := startPublish(ctx, systemMemory, topic)
+	defer func() { endSpan(span, err) }()
+
+	select {
+	case <-q.done:
+		return errors.New("queue is closed")
+	default:
+	}
+
+	q.mu.RLock()
+	handlers := q.broadcast[topic]
+	q.mu.RUnlock()
+	for _, handler := range handlers {
+		if err := consume(systemMemory, topic, headers, payload, handler); err != nil {
+			slog.Warn("failed to handle broadcast message", logging.KeyComponent, "mq", "topic", topic, logging.Err(err))
+		}
+	}
+	return nil
+}
+
+func (q *MemoryQueue) SubscribeBroadcast(topic string, handler Handler) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.broadcast[topic] = append(q.broadcast[topic], handler)
+	return nil
+}
+
+// Broadcast 发布到名为 topic 的 fanout exchange
+func (r *RabbitMQ) Broadcast(ctx context.Context, topic string, payload []byte) (err error) {
+	span, headers := startPublish(ctx, semconv.MessagingSystemRabbitMQ, topic)
+	defer func() { endSpan(span, err) }()
+
+	if err := r.declareFanout(topic); err != nil {
+		return err
+	}
+
+	table := amqp.Table{}
+	for k, v := range headers {
+		table[k] = v
+	}
+
+	err = r.channel.PublishWithContext(
+		ctx,
+		topic, // exchange
+		"",    // routing key (fanout 忽略)
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			Headers:      table,
+			Body:         payload,
+			DeliveryMode: amqp.Transient,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// SubscribeBroadcast 为本实例声明一个独占的临时队列并绑定到 fanout exchange，连接断开时队列自动删除
+func (r *RabbitMQ) SubscribeBroadcast(topic string, handler Handler) error {
+	if err := r.declareFanout(topic); err != nil {
+		return err
+	}
+
+	q, err := r.channel.QueueDeclare(
+		"",    // name (由服务器生成)
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue: %w", err)
+	}
+	if err := r.channel.QueueBind(q.Name, "", topic, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue: %w", err)
+	}
+
+	msgs, err := r.channel.Consume(
+		q.Name, // queue
+		"",     // consumer
+		true,   // auto-ack (消息丢失可以接受，见 Broadcaster)
+		true,   // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register consumer: %w", err)
+	}
+
+	go func() {
+		for d := range msgs {
+			if err := consume(semconv.MessagingSystemRabbitMQ, topic, headersFromTable(d.Headers), d.Body, handler); err != nil {
+				slog.Warn("failed to handle broadcast message", logging.KeyComponent, "mq", "topic", topic, logging.Err(err))
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *RabbitMQ) declareFanout(topic string) error {
+	err := r.channel.ExchangeDeclare(
+		topic,    // name
+		"fanout", // kind
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare exchange: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package async
+
+import "time"
+
+// TopicCacheInvalidate 服务通知网关丢弃缓存的响应 (通过 Broadcaster，每个网关实例都收到)，消息体为 CacheInvalidation
+const TopicCacheInvalidate = "cache_invalidate"
+
+// CacheInvalidation 按标签使网关的响应缓存失效，标签见 api-gateway 的 configs/routes.yaml
+type CacheInvalidation struct {
+	Tags []string `json:"tags"`
+}
+
+// TopicOrderStatus order-service 广播订单状态的变化 (通过 Broadcaster，每个实例都收到)，消息体为 OrderStatusChanged
+const TopicOrderStatus = "order_status"
+
+// OrderStatusChanged 订单的状态变为 Status；Version 是变化后的订单版本号，同一订单内单调递增
+type OrderStatusChanged struct {
+	OrderID string    `json:"order_id"`
+	UserID  int64     `json:"user_id"`
+	Status  string    `json:"status"`
+	Version int64     `json:"version"`
+	At      time.Time `json:"at"`
+}
@@ -1,7 +1,8 @@
 package async
 
 import (
-	"log"
+	"log/slog"
+	"vv-ecommerce/pkg/logging"
 )
 
 // NewRabbitMQOrMemory attempts to connect to RabbitMQ at the given URL.
@@ -10,9 +11,9 @@ import (
 func NewRabbitMQOrMemory(url string) MessageQueue {
 	mq, err := NewRabbitMQ(url)
 	if err != nil {
-		log.Printf("Warning: Failed to connect to RabbitMQ: %v. Falling back to In-Memory Queue.", err)
+		slog.Warn("failed to connect to RabbitMQ, falling back to in-memory queue", logging.KeyComponent, "mq", logging.Err(err))
 		return NewMemoryQueue()
 	}
-	log.Println("Success: Connected to RabbitMQ.")
+	slog.Info("connected to RabbitMQ", logging.KeyComponent, "mq")
 	return mq
 }
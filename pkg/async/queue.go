@@ -1,48 +1,77 @@
 package async
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
+	"vv-ecommerce/pkg/logging"
 )
 
+// Handler processes one message. ctx carries the producer's trace context and TraceID.
+type Handler func(ctx context.Context, payload []byte) error
+
 // MessageQueue defines the interface for a simple message queue
 type MessageQueue interface {
-	Publish(topic string, payload []byte) error
-	Subscribe(topic string, handler func(payload []byte) error) error
+	Publish(ctx context.Context, topic string, payload []byte) error
+	Subscribe(topic string, handler Handler) error
 	Close() error
 }
 
 // Ensure MemoryQueue implements MessageQueue interface at compile time
 var _ MessageQueue = (*MemoryQueue)(nil)
 
+// memoryMessage 是内存队列中的消息，headers 携带 trace 上下文
+type memoryMessage struct {
+	headers map[string]string
+	payload []byte
+}
+
 // MemoryQueue is a simple in-memory implementation of MessageQueue using channels
 type MemoryQueue struct {
-	topics map[string]chan []byte
-	mu     sync.RWMutex
-	done   chan struct{}
+	topics map[string]chan memoryMessage
+	// pending 是每个 topic 已发布但尚未处理成功的消息数 (包括正在重试的)
+	pending map[string]*atomic.Int64
+	// broadcast 是每个 topic 的广播订阅者 (见 Broadcaster)
+	broadcast map[string][]Handler
+	mu        sync.RWMutex
+	done      chan struct{}
 }
 
 func NewMemoryQueue() *MemoryQueue {
 	return &MemoryQueue{
-		topics: make(map[string]chan []byte),
-		done:   make(chan struct{}),
+		topics:    make(map[string]chan memoryMessage),
+		pending:   make(map[string]*atomic.Int64),
+		broadcast: make(map[string][]Handler),
+		done:      make(chan struct{}),
 	}
 }
 
-func (q *MemoryQueue) Publish(topic string, payload []byte) error {
+// topic 返回 topic 对应的 channel 和积压计数，不存在时创建
+func (q *MemoryQueue) topic(name string) (chan memoryMessage, *atomic.Int64) {
 	q.mu.Lock()
-	ch, ok := q.topics[topic]
+	defer q.mu.Unlock()
+	ch, ok := q.topics[name]
 	if !ok {
 		// Buffer size of 100 for simplicity
-		ch = make(chan []byte, 100)
-		q.topics[topic] = ch
+		ch = make(chan memoryMessage, 100)
+		q.topics[name] = ch
+		q.pending[name] = new(atomic.Int64)
 	}
-	q.mu.Unlock()
+	return ch, q.pending[name]
+}
+
+func (q *MemoryQueue) Publish(ctx context.Context, topic string, payload []byte) (err error) {
+	span, headers := startPublish(ctx, systemMemory, topic)
+	defer func() { endSpan(span, err) }()
+
+	ch, pending := q.topic(topic)
 
 	select {
-	case ch <- payload:
+	case ch <- memoryMessage{headers: headers, payload: payload}:
+		pending.Add(1)
 		return nil
 	case <-q.done:
 		return errors.New("queue is closed")
@@ -51,14 +80,8 @@ func (q *MemoryQueue) Publish(topic string, payload []byte) error {
 	}
 }
 
-func (q *MemoryQueue) Subscribe(topic string, handler func(payload []byte) error) error {
-	q.mu.Lock()
-	ch, ok := q.topics[topic]
-	if !ok {
-		ch = make(chan []byte, 100)
-		q.topics[topic] = ch
-	}
-	q.mu.Unlock()
+func (q *MemoryQueue) Subscribe(topic string, handler Handler) error {
+	ch, pending := q.topic(topic)
 
 	// Start a worker for this topic
 	go func() {
@@ -66,15 +89,16 @@ func (q *MemoryQueue) Subscribe(topic string, handler func(payload []byte) error
 			select {
 			case msg := <-ch:
 				// Simple retry logic for the handler
-				go func(m []byte) {
+				go func(m memoryMessage) {
 					// Try indefinitely until success or critical failure
 					// In real world, we'd have DLQ (Dead Letter Queue)
 					backoff := 1 * time.Second
 					for {
-						if err := handler(m); err == nil {
+						if err := consume(systemMemory, topic, m.headers, m.payload, handler); err == nil {
+							pending.Add(-1)
 							return
 						} else {
-							fmt.Printf("Error handling message on topic %s: %v. Retrying in %v...\n", topic, err, backoff)
+							slog.Warn("failed to handle message, retrying", logging.KeyComponent, "mq", "topic", topic, "backoff", backoff, logging.Err(err))
 							time.Sleep(backoff)
 							if backoff < 60*time.Second {
 								backoff *= 2
@@ -91,6 +115,27 @@ func (q *MemoryQueue) Subscribe(topic string, handler func(payload []byte) error
 	return nil
 }
 
+// ConsumerLag 返回各 topic 已发布但尚未处理成功的消息数
+func (q *MemoryQueue) ConsumerLag() (map[string]int, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	lag := make(map[string]int, len(q.pending))
+	for topic, n := range q.pending {
+		lag[topic] = int(n.Load())
+	}
+	return lag, nil
+}
+
+// Ping 在队列关闭后返回错误
+func (q *MemoryQueue) Ping(ctx context.Context) error {
+	select {
+	case <-q.done:
+		return errors.New("memory queue is closed")
+	default:
+		return nil
+	}
+}
+
 func (q *MemoryQueue) Close() error {
 	close(q.done)
 	return nil
@@ -1,10 +1,15 @@
 package async
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+	"vv-ecommerce/pkg/logging"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
 )
 
 // Ensure RabbitMQ implements MessageQueue interface at compile time
@@ -14,6 +19,9 @@ var _ MessageQueue = (*RabbitMQ)(nil)
 type RabbitMQ struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
+
+	mu     sync.Mutex
+	topics []string // 已订阅的 topic，用于统计积压
 }
 
 func NewRabbitMQ(url string) (*RabbitMQ, error) {
@@ -34,7 +42,10 @@ func NewRabbitMQ(url string) (*RabbitMQ, error) {
 	}, nil
 }
 
-func (r *RabbitMQ) Publish(topic string, payload []byte) error {
+func (r *RabbitMQ) Publish(ctx context.Context, topic string, payload []byte) (err error) {
+	span, headers := startPublish(ctx, semconv.MessagingSystemRabbitMQ, topic)
+	defer func() { endSpan(span, err) }()
+
 	// Declare the queue to ensure it exists
 	q, err := r.channel.QueueDeclare(
 		topic, // name
@@ -48,13 +59,20 @@ func (r *RabbitMQ) Publish(topic string, payload []byte) error {
 		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
-	err = r.channel.Publish(
+	table := amqp.Table{}
+	for k, v := range headers {
+		table[k] = v
+	}
+
+	err = r.channel.PublishWithContext(
+		ctx,
 		"",     // exchange
 		q.Name, // routing key
 		false,  // mandatory
 		false,  // immediate
 		amqp.Publishing{
 			ContentType:  "application/json",
+			Headers:      table,
 			Body:         payload,
 			DeliveryMode: amqp.Persistent, // Make message persistent
 		})
@@ -64,7 +82,7 @@ func (r *RabbitMQ) Publish(topic string, payload []byte) error {
 	return nil
 }
 
-func (r *RabbitMQ) Subscribe(topic string, handler func(payload []byte) error) error {
+func (r *RabbitMQ) Subscribe(topic string, handler Handler) error {
 	// Declare the queue
 	q, err := r.channel.QueueDeclare(
 		topic, // name
@@ -78,6 +96,10 @@ func (r *RabbitMQ) Subscribe(topic string, handler func(payload []byte) error) e
 		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
+	r.mu.Lock()
+	r.topics = append(r.topics, q.Name)
+	r.mu.Unlock()
+
 	msgs, err := r.channel.Consume(
 		q.Name, // queue
 		"",     // consumer
@@ -94,10 +116,10 @@ func (r *RabbitMQ) Subscribe(topic string, handler func(payload []byte) error) e
 	go func() {
 		for d := range msgs {
 			// Call handler
-			err := handler(d.Body)
+			err := consume(semconv.MessagingSystemRabbitMQ, topic, headersFromTable(d.Headers), d.Body, handler)
 			if err != nil {
 				// Requeue logic or Dead Letter Queue could be here
-				log.Printf("Error processing message: %v", err)
+				slog.Error("failed to process message", logging.KeyComponent, "mq", "topic", topic, logging.Err(err))
 				d.Ack(false) // Ack to avoid loop for now
 			} else {
 				d.Ack(false)
@@ -108,6 +130,41 @@ func (r *RabbitMQ) Subscribe(topic string, handler func(payload []byte) error) e
 	return nil
 }
 
+// ConsumerLag 返回各订阅队列中等待投递的消息数 (不含已投递未 ack 的消息)
+func (r *RabbitMQ) ConsumerLag() (map[string]int, error) {
+	r.mu.Lock()
+	topics := append([]string(nil), r.topics...)
+	r.mu.Unlock()
+
+	// 使用独立的 channel：被动声明失败会关闭所在 channel，不能影响收发消息的主 channel
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	lag := make(map[string]int, len(topics))
+	for _, topic := range topics {
+		q, err := ch.QueueDeclarePassive(topic, true, false, false, false, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect queue %s: %w", topic, err)
+		}
+		lag[topic] = q.Messages
+	}
+	return lag, nil
+}
+
+// Ping 检查连接和 channel 是否仍然打开 (供就绪检查使用)
+func (r *RabbitMQ) Ping(ctx context.Context) error {
+	if r.conn == nil || r.conn.IsClosed() {
+		return errors.New("rabbitmq connection is closed")
+	}
+	if r.channel == nil || r.channel.IsClosed() {
+		return errors.New("rabbitmq channel is closed")
+	}
+	return nil
+}
+
 func (r *RabbitMQ) Close() error {
 	if r.channel != nil {
 		r.channel.Close()
@@ -117,3 +174,14 @@ func (r *RabbitMQ) Close() error {
 	}
 	return nil
 }
+
+// headersFromTable 取出 AMQP 消息头中的字符串值 (trace 上下文)
+func headersFromTable(table amqp.Table) map[string]string {
+	headers := make(map[string]string, len(table))
+	for k, v := range table {
+		if s, ok := v.(string); ok {
+			headers[k] = s
+		}
+	}
+	return headers
+}
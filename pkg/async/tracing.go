@@ -0,0 +1,58 @@
+package async
+
+import (
+	"context"
+	"vv-ecommerce/pkg/common/traceid"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceIDHeader 在消息头中携带业务 TraceID (与 HTTP 的 X-Trace-ID 一致)，traceparent 由 tracing.Inject 写入
+const traceIDHeader = "x-trace-id"
+
+var systemMemory = semconv.MessagingSystemKey.String("memory")
+
+// startPublish 创建 producer span，并返回需要随消息发送的头 (traceparent + TraceID)
+func startPublish(ctx context.Context, system attribute.KeyValue, topic string) (trace.Span, map[string]string) {
+	ctx, span := tracing.Tracer().Start(ctx, "send "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(system, semconv.MessagingDestinationName(topic), semconv.MessagingOperationTypeSend),
+	)
+
+	headers := map[string]string{}
+	tracing.Inject(ctx, headers)
+	if traceID := traceid.FromContext(ctx); traceID != "" {
+		headers[traceIDHeader] = traceID
+	}
+	return span, headers
+}
+
+// endSpan 记录错误并结束 span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// consume 从消息头恢复 trace 上下文，在 consumer span 中执行一次 handler
+func consume(system attribute.KeyValue, topic string, headers map[string]string, payload []byte, handler Handler) error {
+	ctx := tracing.Extract(context.Background(), headers)
+	if traceID := headers[traceIDHeader]; traceID != "" {
+		ctx = logging.With(traceid.NewContext(ctx, traceID), logging.KeyTraceID, traceID)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "process "+topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(system, semconv.MessagingDestinationName(topic), semconv.MessagingOperationTypeProcess),
+	)
+	err := handler(ctx, payload)
+	endSpan(span, err)
+	return err
+}
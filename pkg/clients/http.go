@@ -0,0 +1,52 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+	"vv-ecommerce/pkg/common/traceid"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	// TraceIDHeader 与 middleware.TraceIDHeader 一致，业务 TraceID 随请求透传到下游
+	TraceIDHeader = "X-Trace-ID"
+	// IdempotencyKeyHeader 与 middleware.IdempotencyKeyHeader 一致
+	IdempotencyKeyHeader = "Idempotency-Key"
+)
+
+// newHTTPClient 创建带 OpenTelemetry 埋点的 http.Client：每次调用生成 client span 并注入 traceparent
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
+}
+
+// newRequest 创建绑定 ctx 的请求，body 非 nil 时编码为 JSON，并透传 ctx 中的 TraceID
+func newRequest(ctx context.Context, method, url string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if traceID := traceid.FromContext(ctx); traceID != "" {
+		req.Header.Set(TraceIDHeader, traceID)
+	}
+	return req, nil
+}
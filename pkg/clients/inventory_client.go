@@ -1,8 +1,7 @@
 package clients
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"net/http"
 	"time"
 )
@@ -15,84 +14,47 @@ type InventoryClient struct {
 func NewInventoryClient(url string) *InventoryClient {
 	return &InventoryClient{
 		baseURL: url,
-		client:  &http.Client{Timeout: 2 * time.Second},
+		client:  newHTTPClient(2 * time.Second),
 	}
 }
 
-func (c *InventoryClient) HealthCheck() error {
-	resp, err := c.client.Get(c.baseURL + "/health")
-	if err != nil {
-		return WrapClientError(err, "failed to connect to inventory service")
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return HandleHTTPError(resp)
-	}
-	return nil
+// HealthCheck 查询 inventory-service 的就绪状态 (/readyz)
+func (c *InventoryClient) HealthCheck(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/readyz", nil)
 }
 
-func (c *InventoryClient) Increase(sku string, qty int64) error {
-	body, _ := json.Marshal(map[string]interface{}{
+func (c *InventoryClient) Increase(ctx context.Context, sku string, qty int64) error {
+	return c.do(ctx, http.MethodPost, "/inventory/increase", map[string]interface{}{
 		"sku":      sku,
 		"quantity": qty,
 	})
-
-	resp, err := c.client.Post(
-		c.baseURL+"/inventory/increase",
-		"application/json",
-		bytes.NewBuffer(body),
-	)
-	if err != nil {
-		return WrapClientError(err, "failed to connect to inventory service")
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return HandleHTTPError(resp)
-	}
-
-	return nil
 }
 
-func (c *InventoryClient) Rollback(sku string, qty int64, traceID string) error {
-	body, _ := json.Marshal(map[string]interface{}{
+func (c *InventoryClient) Rollback(ctx context.Context, sku string, qty int64, traceID string) error {
+	return c.do(ctx, http.MethodPost, "/inventory/rollback", map[string]interface{}{
 		"sku":      sku,
 		"quantity": qty,
 		"trace_id": traceID,
 	})
-
-	resp, err := c.client.Post(
-		c.baseURL+"/inventory/rollback",
-		"application/json",
-		bytes.NewBuffer(body),
-	)
-	if err != nil {
-		return WrapClientError(err, "failed to connect to inventory service")
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return HandleHTTPError(resp)
-	}
-
-	return nil
 }
 
-func (c *InventoryClient) Decrease(sku, reqID, orderID, traceID string, qty int64) error {
-	body, _ := json.Marshal(map[string]interface{}{
+func (c *InventoryClient) Decrease(ctx context.Context, sku, reqID, orderID, traceID string, qty int64) error {
+	return c.do(ctx, http.MethodPost, "/inventory/decrease", map[string]interface{}{
 		"sku":        sku,
 		"quantity":   qty,
 		"request_id": reqID,
 		"order_id":   orderID,
 		"trace_id":   traceID,
 	})
+}
+
+func (c *InventoryClient) do(ctx context.Context, method, path string, body interface{}) error {
+	req, err := newRequest(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return WrapClientError(err, "failed to create request")
+	}
 
-	resp, err := c.client.Post(
-		c.baseURL+"/inventory/decrease",
-		"application/json",
-		bytes.NewBuffer(body),
-	)
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return WrapClientError(err, "failed to connect to inventory service")
 	}
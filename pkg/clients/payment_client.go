@@ -1,11 +1,10 @@
 package clients
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 	"vv-ecommerce/pkg/common/apperror"
 )
@@ -18,12 +17,13 @@ type PaymentClient struct {
 func NewPaymentClient(url string) *PaymentClient {
 	return &PaymentClient{
 		baseURL: url,
-		client:  &http.Client{Timeout: 5 * time.Second},
+		client:  newHTTPClient(5 * time.Second),
 	}
 }
 
 type PaymentRequest struct {
 	OrderID string `json:"order_id"`
+	UserID  int64  `json:"user_id"`
 	Amount  int64  `json:"amount"`
 }
 
@@ -37,21 +37,40 @@ type PaymentResponse struct {
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
-func (c *PaymentClient) ProcessPayment(ctx context.Context, orderID string, amount int64, traceID string) (*PaymentResponse, error) {
+// HealthCheck 查询 payment-service 的就绪状态 (/readyz)
+func (c *PaymentClient) HealthCheck(ctx context.Context) error {
+	req, err := newRequest(ctx, http.MethodGet, c.baseURL+"/readyz", nil)
+	if err != nil {
+		return WrapClientError(err, "failed to create request")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return WrapClientError(err, "failed to call payment service")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return HandleHTTPError(resp)
+	}
+
+	return nil
+}
+
+// ProcessPayment 为 userID 的订单发起支付，支付记录归属该用户
+func (c *PaymentClient) ProcessPayment(ctx context.Context, orderID string, userID int64, amount int64) (*PaymentResponse, error) {
 	reqBody := PaymentRequest{
 		OrderID: orderID,
+		UserID:  userID,
 		Amount:  amount,
 	}
-	body, _ := json.Marshal(reqBody)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/payments", bytes.NewBuffer(body))
+	req, err := newRequest(ctx, http.MethodPost, c.baseURL+"/payments", reqBody)
 	if err != nil {
 		return nil, WrapClientError(err, "failed to create request")
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if traceID != "" {
-		req.Header.Set("X-Trace-ID", traceID)
-	}
+	// 以订单号作为幂等键：超时后的重试不会重复扣款，而是拿到第一次的结果
+	req.Header.Set(IdempotencyKeyHeader, "payment:"+orderID)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -64,25 +83,20 @@ func (c *PaymentClient) ProcessPayment(ctx context.Context, orderID string, amou
 	}
 
 	var paymentResp PaymentResponse
-	if err := json.NewDecoder(resp.Body).Decode(&paymentResp); err != nil {
+	if err := DecodeData(resp, &paymentResp); err != nil {
 		return nil, apperror.Internal("failed to decode payment response", err)
 	}
 
 	return &paymentResp, nil
 }
 
-func (c *PaymentClient) Refund(ctx context.Context, orderID string, traceID string) error {
+func (c *PaymentClient) Refund(ctx context.Context, orderID string) error {
 	reqBody := map[string]string{"order_id": orderID}
-	body, _ := json.Marshal(reqBody)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/payments/refund", bytes.NewBuffer(body))
+	req, err := newRequest(ctx, http.MethodPost, c.baseURL+"/payments/refund", reqBody)
 	if err != nil {
 		return WrapClientError(err, "failed to create request")
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if traceID != "" {
-		req.Header.Set("X-Trace-ID", traceID)
-	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -97,8 +111,13 @@ func (c *PaymentClient) Refund(ctx context.Context, orderID string, traceID stri
 	return nil
 }
 
-func (c *PaymentClient) GetPayment(orderID string) (*PaymentResponse, error) {
-	resp, err := c.client.Get(fmt.Sprintf("%s/payments?order_id=%s", c.baseURL, orderID))
+func (c *PaymentClient) GetPayment(ctx context.Context, orderID string) (*PaymentResponse, error) {
+	req, err := newRequest(ctx, http.MethodGet, fmt.Sprintf("%s/payments?order_id=%s", c.baseURL, url.QueryEscape(orderID)), nil)
+	if err != nil {
+		return nil, WrapClientError(err, "failed to create request")
+	}
+
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, WrapClientError(err, "failed to call payment service")
 	}
@@ -113,7 +132,7 @@ func (c *PaymentClient) GetPayment(orderID string) (*PaymentResponse, error) {
 	}
 
 	var paymentResp PaymentResponse
-	if err := json.NewDecoder(resp.Body).Decode(&paymentResp); err != nil {
+	if err := DecodeData(resp, &paymentResp); err != nil {
 		return nil, apperror.Internal("failed to decode payment response", err)
 	}
 
@@ -16,18 +16,38 @@ import (
 func HandleHTTPError(resp *http.Response) error {
 	// 尝试解析标准错误响应
 	var res response.ErrorResponse
+	// 保留下游的传播路径，并把下游服务本身追加为最后一跳
 	if err := json.NewDecoder(resp.Body).Decode(&res); err == nil && res.Code != 0 {
-		return apperror.New(apperror.ErrorType(res.Type), res.Code, res.Message, nil)
+		// type 决定状态码和是否重试，不认识的类型 (如下游的兜底错误 INTERNAL_ERROR) 按内部错误处理
+		errType := apperror.ErrorType(res.Type)
+		if !errType.Known() {
+			errType = apperror.TypeInternal
+		}
+		appErr := apperror.New(errType, res.Code, res.Message, nil)
+		appErr.Origins = append(appErr.Origins, res.Origins...)
+		return appErr.WithOrigin(apperror.Origin{
+			Service: res.Service,
+			Code:    res.Code,
+			Message: res.Message,
+			TraceID: res.Meta.TraceID,
+			Cause:   res.Cause,
+		})
 	}
 
 	// Fallback: 根据状态码推断
 	switch resp.StatusCode {
 	case http.StatusBadRequest:
 		return apperror.InvalidInput("invalid input", nil)
+	case http.StatusUnauthorized:
+		return apperror.Unauthorized("unauthorized", nil)
+	case http.StatusForbidden:
+		return apperror.Forbidden("forbidden", nil)
 	case http.StatusNotFound:
 		return apperror.NotFound("resource not found", nil)
 	case http.StatusConflict:
 		return apperror.Conflict("resource conflict", nil)
+	case http.StatusTooManyRequests:
+		return apperror.TooManyRequests("too many requests", nil)
 	case http.StatusRequestTimeout, http.StatusGatewayTimeout, http.StatusServiceUnavailable:
 		return apperror.ServiceUnavailable("service unavailable", nil)
 	default:
@@ -35,6 +55,22 @@ func HandleHTTPError(resp *http.Response) error {
 	}
 }
 
+// DecodeData 解析统一响应结构 {code, message, data, meta}，把 data 反序列化到 v
+func DecodeData(resp *http.Response, v interface{}) error {
+	var env struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return err
+	}
+	if len(env.Data) == 0 || string(env.Data) == "null" {
+		return errors.New("response data is empty")
+	}
+	return json.Unmarshal(env.Data, v)
+}
+
 // WrapClientError 处理 http.Client.Do/Get/Post 返回的错误
 // 专门检查 context error 和网络错误
 func WrapClientError(err error, message string) error {
@@ -0,0 +1,34 @@
+package clients
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"vv-ecommerce/pkg/common/apperror"
+)
+
+func TestHandleHTTPErrorType(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		want   apperror.ErrorType
+		code   int
+	}{
+		{name: "known type", status: http.StatusConflict, body: `{"code":40901,"message":"insufficient stock","type":"CONFLICT","service":"inventory-service"}`, want: apperror.TypeConflict, code: 40901},
+		{name: "fallback error of response.Error", status: http.StatusInternalServerError, body: `{"code":50000,"message":"internal server error","type":"INTERNAL_ERROR"}`, want: apperror.TypeInternal, code: 50000},
+		{name: "unknown type", status: http.StatusBadRequest, body: `{"code":40000,"message":"bad","type":"SOMETHING_NEW"}`, want: apperror.TypeInternal, code: 40000},
+		{name: "missing type", status: http.StatusNotFound, body: `{"code":40400,"message":"not found"}`, want: apperror.TypeInternal, code: 40400},
+		{name: "not the standard envelope", status: http.StatusServiceUnavailable, body: `upstream connect error`, want: apperror.TypeServiceUnavailable, code: 50300},
+	} {
+		resp := &http.Response{StatusCode: tc.status, Body: io.NopCloser(strings.NewReader(tc.body))}
+		appErr, ok := apperror.As(HandleHTTPError(resp))
+		if !ok {
+			t.Fatalf("%s: not an AppError", tc.name)
+		}
+		if appErr.Type != tc.want || appErr.Code != tc.code {
+			t.Errorf("%s: type %s, code %d; want %s, %d", tc.name, appErr.Type, appErr.Code, tc.want, tc.code)
+		}
+	}
+}
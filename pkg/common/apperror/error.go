@@ -1,8 +1,12 @@
 package apperror
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
 )
 
 type ErrorType string
@@ -13,15 +17,66 @@ const (
 	TypeConflict           ErrorType = "CONFLICT"            // 冲突，如库存不足 (通常不可重试，除非是并发锁)
 	TypeInternal           ErrorType = "INTERNAL"            // 内部错误 (部分可重试)
 	TypeServiceUnavailable ErrorType = "SERVICE_UNAVAILABLE" // 下游挂了 (可重试)
+	TypeBadGateway         ErrorType = "BAD_GATEWAY"         // 网关连不上上游或连接被重置 (可重试)
 	TypeTimeout            ErrorType = "TIMEOUT"             // 超时 (可重试)
+	TypePayloadTooLarge    ErrorType = "PAYLOAD_TOO_LARGE"   // 请求体超过上限 (不可重试)
+	TypeUnauthorized       ErrorType = "UNAUTHORIZED"        // 未认证或令牌无效 (不可重试)
+	TypeForbidden          ErrorType = "FORBIDDEN"           // 已认证但无权限 (不可重试)
+	TypeTooManyRequests    ErrorType = "TOO_MANY_REQUESTS"   // 超过限流配额 (按 Retry-After 稍后重试)
 )
 
+// Known 报告 t 是否是上面定义的错误类型 (如从下游响应中解析出的类型)
+func (t ErrorType) Known() bool {
+	switch t {
+	case TypeNotFound, TypeInvalidInput, TypeConflict, TypeInternal, TypeServiceUnavailable, TypeBadGateway,
+		TypeTimeout, TypePayloadTooLarge, TypeUnauthorized, TypeForbidden, TypeTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// Origin 记录错误跨越服务边界时经过的一跳
+// 例如 inventory-service 返回的错误在 order-service 中被重建时，会追加一条 inventory-service 的 Origin
+type Origin struct {
+	Service string `json:"service"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	TraceID string `json:"trace_id,omitempty"`
+	Cause   string `json:"cause,omitempty"` // 下游原始错误的描述 (如 DB 错误)
+}
+
 // AppError 是我们自定义的错误结构
 type AppError struct {
 	Type    ErrorType
-	Code    int    // 具体的业务错误码，如 10001
-	Message string // 错误描述
-	Cause   error  // 原始错误
+	Code    int      // 具体的业务错误码，如 10001
+	Message string   // 错误描述
+	Cause   error    // 原始错误
+	Origins []Origin // 跨服务传播路径，最下游的服务在前
+
+	stack []uintptr // 创建时的调用栈 (仅在 EnableStackTrace(true) 时采集)
+}
+
+var (
+	serviceName  atomic.Value // string
+	captureStack atomic.Bool
+)
+
+// SetServiceName 设置当前进程的服务名，用于在错误响应中标记错误来源
+func SetServiceName(name string) {
+	serviceName.Store(name)
+}
+
+// ServiceName 返回当前进程的服务名
+func ServiceName() string {
+	if name, ok := serviceName.Load().(string); ok {
+		return name
+	}
+	return ""
+}
+
+// EnableStackTrace 开启/关闭创建 AppError 时的调用栈采集 (有一定开销，建议仅在开发环境开启)
+func EnableStackTrace(enabled bool) {
+	captureStack.Store(enabled)
 }
 
 func (e *AppError) Error() string {
@@ -31,14 +86,89 @@ func (e *AppError) Error() string {
 	return fmt.Sprintf("[%s] %d: %s", e.Type, e.Code, e.Message)
 }
 
+// Unwrap 让 errors.Is / errors.As 可以穿透 AppError 检查原始错误
+func (e *AppError) Unwrap() error {
+	return e.Cause
+}
+
+// WithOrigin 追加一跳来源信息
+func (e *AppError) WithOrigin(o Origin) *AppError {
+	e.Origins = append(e.Origins, o)
+	return e
+}
+
+// StackTrace 返回创建时采集的调用栈，未开启采集时返回空字符串
+func (e *AppError) StackTrace() string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		// 跳过 apperror 包自身的工厂方法
+		if !strings.HasPrefix(frame.Function, "vv-ecommerce/pkg/common/apperror.") {
+			fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// Chain 返回完整的失败路径，按 "最下游 -> 当前" 的顺序，例如:
+// inventory-service[50000 transaction failed: Error 1213: Deadlock found] -> order-service[50000 failed to decrease inventory]
+func (e *AppError) Chain() string {
+	parts := make([]string, 0, len(e.Origins)+1)
+	for _, o := range e.Origins {
+		hop := fmt.Sprintf("%s[%d %s", o.Service, o.Code, o.Message)
+		if o.Cause != "" {
+			hop += ": " + o.Cause
+		}
+		parts = append(parts, hop+"]")
+	}
+
+	// 仅透传下游错误 (HandleHTTPError 重建的) 时，不重复记录本服务这一跳
+	if n := len(e.Origins); n > 0 && e.Cause == nil && e.Origins[n-1].Code == e.Code && e.Origins[n-1].Message == e.Message {
+		return strings.Join(parts, " -> ")
+	}
+
+	self := ServiceName()
+	if self == "" {
+		self = "local"
+	}
+	hop := fmt.Sprintf("%s[%d %s", self, e.Code, e.Message)
+	if e.Cause != nil {
+		hop += ": " + e.Cause.Error()
+	}
+	parts = append(parts, hop+"]")
+	return strings.Join(parts, " -> ")
+}
+
 // 工厂方法
 func New(errType ErrorType, code int, msg string, cause error) *AppError {
-	return &AppError{
+	e := &AppError{
 		Type:    errType,
 		Code:    code,
 		Message: msg,
 		Cause:   cause,
 	}
+	if captureStack.Load() {
+		pcs := make([]uintptr, 32)
+		n := runtime.Callers(2, pcs)
+		e.stack = pcs[:n]
+	}
+	return e
+}
+
+// As 从错误链中提取 AppError
+func As(err error) (*AppError, bool) {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
 }
 
 // Helper functions for common errors
@@ -63,15 +193,36 @@ func ServiceUnavailable(msg string, cause error) *AppError {
 	return New(TypeServiceUnavailable, 50300, msg, cause)
 }
 
+// BadGateway 的错误码 50200 表示错误发生在网关到上游之间
+func BadGateway(msg string, cause error) *AppError {
+	return New(TypeBadGateway, 50200, msg, cause)
+}
+
 func Timeout(msg string, cause error) *AppError {
 	return New(TypeTimeout, 50400, msg, cause)
 }
 
+func PayloadTooLarge(msg string, cause error) *AppError {
+	return New(TypePayloadTooLarge, 41300, msg, cause)
+}
+
+func Unauthorized(msg string, cause error) *AppError {
+	return New(TypeUnauthorized, 40100, msg, cause)
+}
+
+func Forbidden(msg string, cause error) *AppError {
+	return New(TypeForbidden, 40300, msg, cause)
+}
+
+func TooManyRequests(msg string, cause error) *AppError {
+	return New(TypeTooManyRequests, 42900, msg, cause)
+}
+
 // 快速判断是否可重试
 func IsRetryable(err error) bool {
-	if e, ok := err.(*AppError); ok {
+	if e, ok := As(err); ok {
 		switch e.Type {
-		case TypeServiceUnavailable, TypeTimeout, TypeInternal:
+		case TypeServiceUnavailable, TypeBadGateway, TypeTimeout, TypeInternal:
 			return true
 		}
 	}
@@ -87,8 +238,18 @@ func (e *AppError) HTTPStatus() int {
 		return http.StatusBadRequest
 	case TypeConflict:
 		return http.StatusConflict
+	case TypePayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case TypeUnauthorized:
+		return http.StatusUnauthorized
+	case TypeForbidden:
+		return http.StatusForbidden
+	case TypeTooManyRequests:
+		return http.StatusTooManyRequests
 	case TypeServiceUnavailable:
 		return http.StatusServiceUnavailable
+	case TypeBadGateway:
+		return http.StatusBadGateway
 	case TypeTimeout:
 		return http.StatusGatewayTimeout
 	default:
@@ -0,0 +1,96 @@
+package response
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"vv-ecommerce/pkg/common/apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag 把资源的乐观锁版本号格式化为强 ETag，例如 "3"
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// SetETag 在响应头中写入资源版本，客户端更新时通过 If-Match 带回
+func SetETag(c *gin.Context, version int64) {
+	c.Header("ETag", ETag(version))
+}
+
+// IfMatch 解析 If-Match 请求头中的版本号，按 RFC 9110 的强比较：弱校验器 W/"3" 永远不匹配
+// 未提供或为 "*" 时返回 0 (不做版本检查)；可以是逗号分隔的多个 ETag，其中的弱校验器被忽略。
+// 只有弱 ETag 时没有任何版本能匹配，与版本不一致一样返回 Conflict；
+// 格式不合法、或列出了多个不同的版本 (条件更新只能检查一个版本) 时返回 InvalidInput
+func IfMatch(c *gin.Context) (int64, error) {
+	raw := strings.TrimSpace(c.GetHeader("If-Match"))
+	if raw == "" || raw == "*" {
+		return 0, nil
+	}
+	tags, err := parseETags(raw)
+	if err != nil {
+		return 0, apperror.InvalidInput("invalid If-Match header, expected an ETag returned by a previous response", err)
+	}
+	var version int64
+	for _, tag := range tags {
+		if tag.weak {
+			continue
+		}
+		v, err := strconv.ParseInt(tag.opaque, 10, 64)
+		if err != nil || v <= 0 {
+			return 0, apperror.InvalidInput("invalid If-Match header, expected an ETag returned by a previous response", err)
+		}
+		if version != 0 && v != version {
+			return 0, apperror.InvalidInput("If-Match lists more than one version", nil)
+		}
+		version = v
+	}
+	if version == 0 {
+		return 0, apperror.Conflict("If-Match lists only weak ETags (W/), which never match, reload and retry with the ETag of the resource", nil)
+	}
+	return version, nil
+}
+
+type entityTag struct {
+	opaque string
+	weak   bool
+}
+
+// parseETags 解析逗号分隔的 entity-tag 列表；引号中的 opaque-tag 可以包含逗号，所以不能按逗号切分
+func parseETags(s string) ([]entityTag, error) {
+	var tags []entityTag
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+		// 列表中允许空元素，如 `"1", , "2"`
+		if s[0] == ',' {
+			s = s[1:]
+			continue
+		}
+		var tag entityTag
+		if strings.HasPrefix(s, "W/") {
+			tag.weak = true
+			s = s[2:]
+		}
+		if s == "" || s[0] != '"' {
+			return nil, errors.New("entity tag must be quoted")
+		}
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return nil, errors.New("unterminated entity tag")
+		}
+		tag.opaque = s[1 : end+1]
+		s = strings.TrimLeft(s[end+2:], " \t")
+		if s != "" && s[0] != ',' {
+			return nil, errors.New("entity tags must be separated by commas")
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return nil, errors.New("empty entity tag list")
+	}
+	return tags, nil
+}
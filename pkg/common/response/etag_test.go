@@ -0,0 +1,58 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"vv-ecommerce/pkg/common/apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		header  string
+		want    int64
+		wantErr apperror.ErrorType
+	}{
+		{header: "", want: 0},
+		{header: "*", want: 0},
+		{header: ` "3" `, want: 3},
+		{header: ETag(42), want: 42},
+		// 强比较：弱校验器永远不匹配，与版本不一致一样是冲突
+		{header: `W/"3"`, wantErr: apperror.TypeConflict},
+		{header: `W/"3", W/"4"`, wantErr: apperror.TypeConflict},
+		{header: `W/"2", "3"`, want: 3},
+		{header: `"3", "3"`, want: 3},
+		{header: `"3",,"3"`, want: 3},
+		{header: `"3", "4"`, wantErr: apperror.TypeInvalidInput},
+		// "*" 只能单独出现
+		{header: `*, "3"`, wantErr: apperror.TypeInvalidInput},
+		{header: `"3", *`, wantErr: apperror.TypeInvalidInput},
+		{header: `3`, wantErr: apperror.TypeInvalidInput},
+		{header: `"3`, wantErr: apperror.TypeInvalidInput},
+		{header: `"3" "4"`, wantErr: apperror.TypeInvalidInput},
+		{header: `","`, wantErr: apperror.TypeInvalidInput},
+		{header: `"abc"`, wantErr: apperror.TypeInvalidInput},
+		{header: `"0"`, wantErr: apperror.TypeInvalidInput},
+		{header: `"-1"`, wantErr: apperror.TypeInvalidInput},
+		{header: `,`, wantErr: apperror.TypeInvalidInput},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPatch, "/", nil)
+		if tc.header != "" {
+			c.Request.Header.Set("If-Match", tc.header)
+		}
+		got, err := IfMatch(c)
+		var errType apperror.ErrorType
+		if appErr, ok := apperror.As(err); ok {
+			errType = appErr.Type
+		} else if err != nil {
+			errType = "not an AppError"
+		}
+		if errType != tc.wantErr || got != tc.want {
+			t.Errorf("IfMatch(%q) = %d, %v; want %d, error %q", tc.header, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
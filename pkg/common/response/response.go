@@ -1,33 +1,135 @@
 package response
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"vv-ecommerce/pkg/common/apperror"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Meta 定义响应的元信息 (成功与失败共用)
+type Meta struct {
+	TraceID    string      `json:"trace_id,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination 定义游标分页信息
+// NextCursor 为空表示没有更多数据
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
 // SuccessResponse 定义统一的成功返回结构
+// 所有服务的响应都是 {code, message, data, meta}，网关原样透传
 type SuccessResponse struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	Meta    Meta        `json:"meta"`
 }
 
 // Success 200 OK，返回统一结构
 func Success(c *gin.Context, data interface{}) {
+	SuccessWithMeta(c, data, Meta{})
+}
+
+// SuccessWithMeta 200 OK，附带额外的元信息 (如分页)
+func SuccessWithMeta(c *gin.Context, data interface{}, meta Meta) {
+	if meta.TraceID == "" {
+		meta.TraceID = c.GetString(traceIDKey)
+	}
 	c.JSON(http.StatusOK, SuccessResponse{
 		Code:    0,
 		Message: "success",
 		Data:    data,
+		Meta:    meta,
 	})
 }
 
+// Paginated 200 OK，返回列表数据和分页信息
+func Paginated(c *gin.Context, data interface{}, page Pagination) {
+	SuccessWithMeta(c, data, Meta{Pagination: &page})
+}
+
 // ErrorResponse 定义统一的错误返回结构
+// 与 SuccessResponse 同构 (code/message/data/meta)，data 恒为 null
+// Type/Service/Cause/Origins 用于跨服务传播错误来源，见 clients.HandleHTTPError
 type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Type    string `json:"type"`
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    interface{}       `json:"data"`
+	Meta    Meta              `json:"meta"`
+	Type    string            `json:"type"`
+	Service string            `json:"service,omitempty"`
+	Cause   string            `json:"cause,omitempty"`
+	Origins []apperror.Origin `json:"origins,omitempty"`
+}
+
+// traceIDKey 与 middleware.TraceIDKey 保持一致 (避免 response 依赖 middleware)
+const traceIDKey = "trace_id"
+
+// exposeDetails 错误响应是否带 cause / origins：服务之间靠它们传播错误来源 (见 clients.HandleHTTPError)，
+// 但其中可能有 SQL、连接地址等内部信息，面向客户端的网关应关闭
+var exposeDetails atomic.Bool
+
+func init() {
+	exposeDetails.Store(true)
+}
+
+// ExposeErrorDetails 开启/关闭错误响应中的 cause / origins (默认开启)；关闭后它们只记录在访问日志中
+func ExposeErrorDetails(enabled bool) {
+	exposeDetails.Store(enabled)
+}
+
+// ErrorDetailsExposed 报告错误响应是否带 cause / origins
+func ErrorDetailsExposed() bool {
+	return exposeDetails.Load()
+}
+
+// StripErrorDetails 删除错误响应体中的 cause / origins，用于网关透传上游的错误响应；
+// body 不是统一的错误结构时返回 false
+func StripErrorDetails(body []byte) ([]byte, bool) {
+	var res ErrorResponse
+	if err := json.Unmarshal(body, &res); err != nil || res.Type == "" {
+		return nil, false
+	}
+	res.Cause = ""
+	res.Origins = nil
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// ReplaceTraceID 把统一成功结构的 meta.trace_id 换成 traceID (为空时删除)，用于网关缓存的响应；
+// body 不是统一的成功结构时返回 false
+func ReplaceTraceID(body []byte, traceID string) ([]byte, bool) {
+	// Data 保持原样，避免解码成 interface{} 后丢失数字精度和字段顺序
+	var res struct {
+		Code    *int            `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+		Meta    Meta            `json:"meta"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.Code == nil {
+		return nil, false
+	}
+	res.Meta.TraceID = traceID
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
 }
 
 // Error 处理错误返回
@@ -35,23 +137,75 @@ type ErrorResponse struct {
 // 否则默认返回 500
 func Error(c *gin.Context, err error) {
 	if err == nil {
-		c.JSON(http.StatusOK, gin.H{"success": true})
+		Success(c, nil)
 		return
 	}
 
-	if appErr, ok := err.(*apperror.AppError); ok {
-		c.JSON(appErr.HTTPStatus(), ErrorResponse{
+	meta := Meta{TraceID: c.GetString(traceIDKey)}
+	expose := exposeDetails.Load()
+
+	// 请求 deadline (middleware.Timeout) 已过时，handler 包装出的内部错误实际是超时，返回 504
+	if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		if appErr, ok := apperror.As(err); !ok || appErr.Type == apperror.TypeInternal {
+			err = apperror.Timeout("request timed out", err)
+		}
+	}
+
+	if appErr, ok := apperror.As(err); ok {
+		// 完整的错误 (含 cause 和来源) 由 middleware.Logger 记录
+		logged := c.Error(err)
+		if len(appErr.Origins) > 0 {
+			logged.SetMeta(appErr.Origins)
+		}
+		res := ErrorResponse{
 			Code:    appErr.Code,
 			Message: appErr.Message,
+			Meta:    meta,
 			Type:    string(appErr.Type),
-		})
+			Service: apperror.ServiceName(),
+		}
+		if expose {
+			res.Origins = appErr.Origins
+			if appErr.Cause != nil {
+				res.Cause = appErr.Cause.Error()
+			}
+		}
+		c.JSON(appErr.HTTPStatus(), res)
 		return
 	}
 
 	// 默认兜底
+	c.Error(err)
+	message := "internal server error"
+	if expose {
+		message = err.Error()
+	}
 	c.JSON(http.StatusInternalServerError, ErrorResponse{
 		Code:    50000,
-		Message: err.Error(),
+		Message: message,
+		Meta:    meta,
 		Type:    "INTERNAL_ERROR",
+		Service: apperror.ServiceName(),
 	})
 }
+
+// EncodeCursor 把最后一条记录的自增 ID 编码为不透明游标
+func EncodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+// DecodeCursor 解析 EncodeCursor 生成的游标，空游标返回 0
+func DecodeCursor(cursor string) (uint, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, apperror.InvalidInput("invalid cursor", err)
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, apperror.InvalidInput("invalid cursor", err)
+	}
+	return uint(id), nil
+}
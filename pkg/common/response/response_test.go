@@ -0,0 +1,99 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"vv-ecommerce/pkg/common/apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+func errorBody(t *testing.T, err error) (ErrorResponse, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	Error(c, err)
+
+	var res ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode error body: %v", err)
+	}
+	return res, c.Errors.String()
+}
+
+func TestErrorHidesDetailsWhenNotExposed(t *testing.T) {
+	ExposeErrorDetails(false)
+	t.Cleanup(func() { ExposeErrorDetails(true) })
+
+	err := apperror.Internal("database error", errors.New("dial tcp 10.0.0.5:3306: connection refused"))
+	err.Origins = []apperror.Origin{{Service: "inventory-service", Code: 50000, Message: "db down"}}
+	res, logged := errorBody(t, err)
+	if res.Cause != "" || res.Origins != nil {
+		t.Fatalf("cause/origins exposed: %+v", res)
+	}
+	if res.Code != 50000 || res.Message != "database error" {
+		t.Fatalf("unexpected body: %+v", res)
+	}
+	if !strings.Contains(logged, "10.0.0.5:3306") || !strings.Contains(logged, "inventory-service") {
+		t.Fatalf("cause and origins should be recorded for the access log, got %q", logged)
+	}
+
+	res, _ = errorBody(t, errors.New("raw driver error"))
+	if res.Message != "internal server error" {
+		t.Fatalf("raw error message exposed: %q", res.Message)
+	}
+}
+
+func TestErrorExposesDetailsByDefault(t *testing.T) {
+	res, _ := errorBody(t, apperror.Internal("database error", errors.New("boom")))
+	if res.Cause != "boom" {
+		t.Fatalf("cause = %q, want boom", res.Cause)
+	}
+}
+
+func TestStripErrorDetails(t *testing.T) {
+	body := `{"code":50000,"message":"failed","data":null,"meta":{"trace_id":"t1"},"type":"INTERNAL","service":"order-service","cause":"Error 1062: Duplicate entry","origins":[{"service":"inventory-service","code":50000,"message":"x"}]}`
+	out, ok := StripErrorDetails([]byte(body))
+	if !ok {
+		t.Fatal("error envelope not recognized")
+	}
+	if strings.Contains(string(out), "cause") || strings.Contains(string(out), "origins") {
+		t.Fatalf("details not stripped: %s", out)
+	}
+	if !strings.Contains(string(out), `"trace_id":"t1"`) || !strings.Contains(string(out), `"service":"order-service"`) {
+		t.Fatalf("other fields lost: %s", out)
+	}
+
+	if _, ok := StripErrorDetails([]byte(`not json`)); ok {
+		t.Fatal("non-JSON body should not be rewritten")
+	}
+}
+
+func TestReplaceTraceID(t *testing.T) {
+	body := `{"code":0,"message":"success","data":{"id":9007199254740993,"b":1,"a":2},"meta":{"trace_id":"t1","pagination":{"limit":10,"has_more":false}}}`
+	out, ok := ReplaceTraceID([]byte(body), "t2")
+	if !ok {
+		t.Fatal("success envelope not recognized")
+	}
+	want := `{"code":0,"message":"success","data":{"id":9007199254740993,"b":1,"a":2},"meta":{"trace_id":"t2","pagination":{"limit":10,"has_more":false}}}`
+	if string(out) != want {
+		t.Fatalf("got %s, want %s", out, want)
+	}
+
+	out, _ = ReplaceTraceID([]byte(body), "")
+	if strings.Contains(string(out), "trace_id") {
+		t.Fatalf("trace_id not removed: %s", out)
+	}
+
+	for _, body := range []string{`not json`, `[1,2]`, `{"data":{}}`} {
+		if _, ok := ReplaceTraceID([]byte(body), "t2"); ok {
+			t.Fatalf("%s should not be rewritten", body)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Package traceid 在 context 中传递 TraceID (X-Trace-ID)，供数据库、MQ 等不依赖 gin 的包读取
+package traceid
+
+import "context"
+
+type key struct{}
+
+// NewContext 返回携带 traceID 的 ctx
+func NewContext(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, key{}, traceID)
+}
+
+// FromContext 读取 ctx 中的 TraceID，不存在时返回空字符串
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
@@ -0,0 +1,489 @@
+// Package audit 是一个 GORM 插件：为嵌入了 Fields 的模型自动填充 created_by / updated_by，
+// 并在同一个事务中把每次 create / update / delete 前后的差异写入 audit_log 表
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"vv-ecommerce/pkg/logging"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// TableName 是审计日志表名，每个服务在自己的库中通过迁移脚本创建
+const TableName = "audit_log"
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+const (
+	createdByColumn = "created_by"
+	updatedByColumn = "updated_by"
+
+	// maxSnapshotRows 限制单条 UPDATE/DELETE 为了记录差异而读取的行数，避免批量操作拖垮数据库
+	maxSnapshotRows = 500
+	snapshotKey     = "vv:audit:before"
+	setKey          = "vv:audit:set"
+)
+
+// ignoredDiffColumns 每次更新都会变化，记录它们只会产生噪音
+var ignoredDiffColumns = map[string]bool{
+	"updated_at":    true,
+	updatedByColumn: true,
+}
+
+// Fields 嵌入到模型中开启审计
+type Fields struct {
+	CreatedBy string `gorm:"type:varchar(255)" json:"created_by"`
+	UpdatedBy string `gorm:"type:varchar(255)" json:"updated_by"`
+}
+
+// Entry 是 audit_log 中的一条记录，Before/After 只包含发生变化的列
+type Entry struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	EntityType string          `gorm:"type:varchar(255)" json:"entity_type"` // 表名
+	EntityID   string          `gorm:"type:varchar(255)" json:"entity_id"`   // 主键
+	Action     string          `gorm:"type:varchar(20)" json:"action"`
+	Actor      string          `gorm:"type:varchar(255)" json:"actor"`
+	TraceID    string          `gorm:"type:varchar(255)" json:"trace_id"`
+	Before     json.RawMessage `gorm:"column:before_json" json:"before"`
+	After      json.RawMessage `gorm:"column:after_json" json:"after"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+func (Entry) TableName() string { return TableName }
+
+// Config 是插件配置
+type Config struct {
+	// System 是 ctx 中没有操作者时记录的名字 (如后台任务、服务间调用)，通常为服务名
+	System string
+}
+
+// Plugin 实现 gorm.Plugin
+type Plugin struct {
+	cfg Config
+}
+
+func New(cfg Config) *Plugin {
+	return &Plugin{cfg: cfg}
+}
+
+func (p *Plugin) Name() string { return "vv:audit" }
+
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("vv:audit:before_create", p.beforeCreate); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("vv:audit:after_create", p.afterCreate); err != nil {
+		return err
+	}
+	// 放在 BeforeUpdate 钩子和关联保存之后，此时要更新的列已经确定
+	if err := cb.Update().After("gorm:save_before_associations").Before("gorm:update").Register("vv:audit:before_update", p.beforeUpdate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("vv:audit:after_update", p.afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("vv:audit:before_delete", p.beforeDelete); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("vv:audit:after_delete", p.afterDelete)
+}
+
+// History 按时间倒序返回某个实体的变更记录
+func History(ctx context.Context, db *gorm.DB, entityType, entityID string, limit int) ([]Entry, error) {
+	var entries []Entry
+	err := db.WithContext(ctx).
+		Where("entity_type = ? AND entity_id = ?", entityType, entityID).
+		Order("id desc").Limit(limit).
+		Find(&entries).Error
+	return entries, err
+}
+
+// audited 只处理嵌入了 Fields 的模型 (Table(...) 直接操作表时没有 Schema，无法审计)
+func audited(db *gorm.DB) bool {
+	s := db.Statement.Schema
+	return db.Error == nil && s != nil && s.Table != TableName && s.LookUpField(updatedByColumn) != nil
+}
+
+func (p *Plugin) actor(db *gorm.DB) Actor {
+	actor, _ := ActorFromContext(db.Statement.Context)
+	if actor.ID == "" {
+		actor.ID = p.cfg.System
+	}
+	return actor
+}
+
+func (p *Plugin) beforeCreate(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	actor := p.actor(db).ID
+	eachModel(db, func(rv reflect.Value) {
+		for _, column := range []string{createdByColumn, updatedByColumn} {
+			field := db.Statement.Schema.LookUpField(column)
+			if _, zero := field.ValueOf(db.Statement.Context, rv); zero {
+				if err := field.Set(db.Statement.Context, rv, actor); err != nil {
+					db.AddError(err)
+				}
+			}
+		}
+	})
+}
+
+func (p *Plugin) afterCreate(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	var entries []Entry
+	eachModel(db, func(rv reflect.Value) {
+		after := snapshot(db, rv)
+		entries = append(entries, p.entry(db, ActionCreate, after, nil, after))
+	})
+	p.save(db, entries)
+}
+
+// beforeUpdate 只在 UPDATE 之前读取一次受影响的行 (加行锁)：更新后的值由 SET 子句推出，
+// gorm.Expr 等表达式 (如 quantity - ?) 在同一条 SELECT 中按当前行求值，不再在更新后重新读取
+func (p *Plugin) beforeUpdate(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	stmt := db.Statement
+	stmt.SetColumn(updatedByColumn, p.actor(db).ID, true)
+
+	// 提前生成 SET 子句 (gorm:update 发现已有 SET 时直接使用)，afterUpdate 中再移除
+	c, ok := stmt.Clauses["SET"]
+	set, _ := c.Expression.(clause.Set)
+	if !ok {
+		set = callbacks.ConvertToAssignments(stmt)
+		if len(set) == 0 {
+			return
+		}
+		stmt.AddClause(set)
+		stmt.Settings.Store(setKey, true)
+	}
+
+	state := &snapshotState{set: set}
+	for _, a := range set {
+		if ignoredDiffColumns[a.Column.Name] || literal(a.Value) {
+			continue
+		}
+		if stmt.Schema.LookUpField(a.Column.Name) == nil {
+			state.reload = true
+			continue
+		}
+		state.exprs = append(state.exprs, a)
+	}
+	p.loadBefore(db, state)
+}
+
+func (p *Plugin) afterUpdate(db *gorm.DB) {
+	if added, _ := db.Statement.Settings.LoadAndDelete(setKey); added == true {
+		delete(db.Statement.Clauses, "SET")
+	}
+	v, _ := db.Statement.Settings.LoadAndDelete(snapshotKey)
+	state, _ := v.(*snapshotState)
+	if !audited(db) || state == nil || len(state.rows) == 0 || db.RowsAffected == 0 {
+		return
+	}
+
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	var after []map[string]interface{}
+	if state.reload || db.RowsAffected != int64(len(state.rows)) {
+		// 读到的行与实际更新的行数不一致 (并发修改、超过 maxSnapshotRows 等)，按主键重新读取
+		var err error
+		if after, err = p.reload(db, state.rows); err != nil {
+			db.AddError(fmt.Errorf("audit: failed to load rows after update: %w", err))
+			return
+		}
+	} else {
+		after = make([]map[string]interface{}, 0, len(state.rows))
+		for i, row := range state.rows {
+			var evaluated map[string]interface{}
+			if i < len(state.evaluated) {
+				evaluated = state.evaluated[i]
+			}
+			after = append(after, state.apply(row, evaluated))
+		}
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[fmt.Sprint(row[pk.DBName])] = row
+	}
+
+	var entries []Entry
+	for _, row := range state.rows {
+		id := fmt.Sprint(row[pk.DBName])
+		b, a := diff(row, afterByID[id])
+		if len(a) == 0 {
+			continue
+		}
+		entries = append(entries, p.entry(db, ActionUpdate, row, b, a))
+	}
+	p.save(db, entries)
+}
+
+// reload 按主键重新读取更新后的行
+func (p *Plugin) reload(db *gorm.DB, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	ids := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row[pk.DBName])
+	}
+	state := &snapshotState{}
+	if err := p.query(db, func(q *gorm.DB) *gorm.DB {
+		return q.Where(clause.IN{Column: clause.Column{Name: pk.DBName}, Values: ids})
+	}, state); err != nil {
+		return nil, err
+	}
+	return state.rows, nil
+}
+
+func (p *Plugin) beforeDelete(db *gorm.DB) {
+	if audited(db) {
+		p.loadBefore(db, &snapshotState{})
+	}
+}
+
+func (p *Plugin) afterDelete(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	v, _ := db.Statement.Settings.LoadAndDelete(snapshotKey)
+	state, _ := v.(*snapshotState)
+	if state == nil {
+		return
+	}
+	entries := make([]Entry, 0, len(state.rows))
+	for _, row := range state.rows {
+		entries = append(entries, p.entry(db, ActionDelete, row, row, nil))
+	}
+	p.save(db, entries)
+}
+
+// snapshotState 是 UPDATE/DELETE 之前读取到的行，在 before / after 回调之间传递
+type snapshotState struct {
+	rows []map[string]interface{}
+
+	set       clause.Set
+	exprs     []clause.Assignment      // SET 中需要数据库求值的列
+	evaluated []map[string]interface{} // 与 rows 一一对应：exprs 在更新前按当前行求出的值
+	reload    bool                     // SET 中有无法推算的列，更新后需要重新读取
+}
+
+// apply 用 SET 子句推出一行更新后的值
+func (s *snapshotState) apply(row, evaluated map[string]interface{}) map[string]interface{} {
+	after := make(map[string]interface{}, len(row))
+	for column, v := range row {
+		after[column] = v
+	}
+	for _, a := range s.set {
+		if v, ok := evaluated[a.Column.Name]; ok {
+			after[a.Column.Name] = v
+		} else if literal(a.Value) {
+			after[a.Column.Name] = a.Value
+		}
+	}
+	return after
+}
+
+// literal 判断 SET 的值能否直接作为更新后的值，表达式、子查询等需要数据库求值
+func literal(v interface{}) bool {
+	switch v.(type) {
+	case clause.Expression, gorm.Valuer, *gorm.DB, []interface{}:
+		return false
+	}
+	return true
+}
+
+// loadBefore 在 UPDATE/DELETE 执行前按相同的条件读取受影响的行
+func (p *Plugin) loadBefore(db *gorm.DB, state *snapshotState) {
+	stmt := db.Statement
+	var conds []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			conds = append(conds, where.Exprs...)
+		}
+	}
+	// Save/Delete(&obj) 的主键条件在 gorm:update 中才会加入，这里需要自己补上
+	if stmt.ReflectValue.Kind() == reflect.Struct {
+		for _, field := range stmt.Schema.PrimaryFields {
+			if v, zero := field.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+				conds = append(conds, clause.Eq{Column: clause.Column{Name: field.DBName}, Value: v})
+			}
+		}
+	}
+	if len(conds) == 0 {
+		// 没有条件的全表操作会被 GORM 拒绝 (ErrMissingWhereClause)
+		return
+	}
+
+	// SELECT ... FOR UPDATE：在语句的事务 (GORM 默认事务或调用方的事务) 中锁住这些行，
+	// 并发的 quantity = quantity - ? 只能依次读到上一次提交后的值，前后镜像才能首尾相接
+	// (SQLite 方言忽略 Locking，它只有一个连接，事务本身就是串行的)
+	err := p.query(db, func(q *gorm.DB) *gorm.DB {
+		return q.Clauses(clause.Where{Exprs: conds}, clause.Locking{Strength: clause.LockingStrengthUpdate})
+	}, state)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: failed to load rows before change: %w", err))
+		return
+	}
+	if len(state.rows) == maxSnapshotRows {
+		logging.FromContext(stmt.Context).WarnContext(stmt.Context, "change affects too many rows, only the first ones are recorded",
+			logging.KeyComponent, "audit",
+			"table", stmt.Table,
+			"recorded", maxSnapshotRows,
+		)
+	}
+	stmt.Settings.Store(snapshotKey, state)
+}
+
+// query 在当前语句的连接 (事务) 上读取模型，结果 (列名 -> 值) 写入 state.rows；
+// state.exprs 作为额外的列一起查询，求出的值写入 state.evaluated
+func (p *Plugin) query(db *gorm.DB, scope func(*gorm.DB) *gorm.DB, state *snapshotState) error {
+	s := db.Statement.Schema
+	q := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Clauses(dbresolver.Write).
+		Table(db.Statement.Table).
+		Limit(maxSnapshotRows)
+
+	// 有表达式时扫描到 struct { Row Model; After0 T0; ... }，每个表达式一列
+	rowType := s.ModelType
+	if len(state.exprs) > 0 {
+		fields := []reflect.StructField{{Name: "Row", Type: s.ModelType, Tag: `gorm:"embedded"`}}
+		selects := []string{"*"}
+		vars := make([]interface{}, 0, len(state.exprs))
+		for i, a := range state.exprs {
+			alias := fmt.Sprintf("vv_audit_after_%d", i)
+			fields = append(fields, reflect.StructField{
+				Name: fmt.Sprintf("After%d", i),
+				Type: s.LookUpField(a.Column.Name).FieldType,
+				Tag:  reflect.StructTag(fmt.Sprintf(`gorm:"column:%s"`, alias)),
+			})
+			selects = append(selects, "(?) AS "+alias)
+			vars = append(vars, a.Value)
+		}
+		rowType = reflect.StructOf(fields)
+		q = q.Select(strings.Join(selects, ", "), vars...)
+	}
+
+	dest := reflect.New(reflect.SliceOf(rowType))
+	if err := scope(q).Find(dest.Interface()).Error; err != nil {
+		return err
+	}
+
+	slice := dest.Elem()
+	state.rows = make([]map[string]interface{}, 0, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		elem := slice.Index(i)
+		if len(state.exprs) == 0 {
+			state.rows = append(state.rows, snapshot(db, elem))
+			continue
+		}
+		state.rows = append(state.rows, snapshot(db, elem.Field(0)))
+		evaluated := make(map[string]interface{}, len(state.exprs))
+		for j, a := range state.exprs {
+			evaluated[a.Column.Name] = elem.Field(j + 1).Interface()
+		}
+		state.evaluated = append(state.evaluated, evaluated)
+	}
+	return nil
+}
+
+func (p *Plugin) entry(db *gorm.DB, action string, row, before, after map[string]interface{}) Entry {
+	actor := p.actor(db)
+	return Entry{
+		EntityType: db.Statement.Table,
+		EntityID:   fmt.Sprint(row[db.Statement.Schema.PrioritizedPrimaryField.DBName]),
+		Action:     action,
+		Actor:      actor.ID,
+		TraceID:    actor.TraceID,
+		Before:     marshal(before),
+		After:      marshal(after),
+	}
+}
+
+// save 在同一个连接 (事务) 中写入审计记录，写入失败会让业务操作一起回滚
+func (p *Plugin) save(db *gorm.DB, entries []Entry) {
+	if len(entries) == 0 || db.Error != nil {
+		return
+	}
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Clauses(dbresolver.Write).
+		Create(&entries).Error
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: failed to write %s: %w", TableName, err))
+	}
+}
+
+// eachModel 对 Create 的目标 (单个结构体或切片) 逐个调用 fn
+func eachModel(db *gorm.DB, fn func(rv reflect.Value)) {
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elem := reflect.Indirect(rv.Index(i))
+			if elem.Kind() == reflect.Struct {
+				fn(elem)
+			}
+		}
+	case reflect.Struct:
+		fn(rv)
+	}
+}
+
+func snapshot(db *gorm.DB, rv reflect.Value) map[string]interface{} {
+	row := make(map[string]interface{}, len(db.Statement.Schema.DBNames))
+	for _, field := range db.Statement.Schema.Fields {
+		if field.DBName == "" || !field.Readable {
+			continue
+		}
+		v, _ := field.ValueOf(db.Statement.Context, rv)
+		row[field.DBName] = v
+	}
+	return row
+}
+
+// diff 返回发生变化的列在变更前后的值
+func diff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	b := make(map[string]interface{})
+	a := make(map[string]interface{})
+	for column, newValue := range after {
+		if ignoredDiffColumns[column] {
+			continue
+		}
+		oldValue := before[column]
+		if !bytes.Equal(marshal(oldValue), marshal(newValue)) {
+			b[column] = oldValue
+			a[column] = newValue
+		}
+	}
+	return b, a
+}
+
+func marshal(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf("%q", fmt.Sprint(v)))
+	}
+	return b
+}
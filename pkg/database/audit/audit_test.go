@@ -0,0 +1,223 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"vv-ecommerce/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type item struct {
+	ID       uint   `gorm:"primaryKey"`
+	SKU      string `gorm:"column:sku"`
+	Quantity int
+	Status   string
+	Fields
+}
+
+func (item) TableName() string { return "items" }
+
+// openTestDB 打开内存 SQLite，并统计对 items 表的 SELECT 次数
+func openTestDB(t *testing.T) (*gorm.DB, *int) {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	if err := db.AutoMigrate(&item{}, &Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(New(Config{System: "test"})); err != nil {
+		t.Fatal(err)
+	}
+
+	selects := new(int)
+	err = db.Callback().Query().After("gorm:query").Register("test:count", func(db *gorm.DB) {
+		if db.Statement.Table == "items" {
+			*selects++
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, selects
+}
+
+func latest(t *testing.T, db *gorm.DB, id uint) (Entry, map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	entries, err := History(context.Background(), db, "items", jsonID(id), 1)
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("history: %v, %v", entries, err)
+	}
+	var before, after map[string]interface{}
+	json.Unmarshal(entries[0].Before, &before)
+	json.Unmarshal(entries[0].After, &after)
+	return entries[0], before, after
+}
+
+func jsonID(id uint) string {
+	b, _ := json.Marshal(id)
+	return string(b)
+}
+
+func TestExprUpdateReadsRowsOnce(t *testing.T) {
+	db, selects := openTestDB(t)
+	it := &item{SKU: "S1", Quantity: 10}
+	db.Create(it)
+
+	*selects = 0
+	res := db.Model(&item{}).Where("sku = ? AND quantity >= ?", "S1", 3).
+		Updates(map[string]interface{}{"quantity": gorm.Expr("quantity - ?", 3)})
+	if res.Error != nil || res.RowsAffected != 1 {
+		t.Fatalf("update: %d, %v", res.RowsAffected, res.Error)
+	}
+	if *selects != 1 {
+		t.Fatalf("%d SELECTs for one audited update, want 1", *selects)
+	}
+
+	entry, before, after := latest(t, db, it.ID)
+	if entry.Action != ActionUpdate || before["quantity"] != float64(10) || after["quantity"] != float64(7) {
+		t.Fatalf("entry %s: before %v, after %v", entry.Action, before, after)
+	}
+}
+
+func TestLiteralUpdateReadsRowsOnce(t *testing.T) {
+	db, selects := openTestDB(t)
+	it := &item{SKU: "S1", Quantity: 10, Status: "new"}
+	db.Create(it)
+
+	*selects = 0
+	ctx := WithActor(context.Background(), Actor{ID: "7"})
+	if err := db.WithContext(ctx).Model(&item{}).Where("id = ?", it.ID).Update("status", "paid").Error; err != nil {
+		t.Fatal(err)
+	}
+	if *selects != 1 {
+		t.Fatalf("%d SELECTs for one audited update, want 1", *selects)
+	}
+
+	entry, before, after := latest(t, db, it.ID)
+	if before["status"] != "new" || after["status"] != "paid" || len(after) != 1 || entry.Actor != "7" {
+		t.Fatalf("entry by %s: before %v, after %v", entry.Actor, before, after)
+	}
+	var got item
+	db.First(&got, it.ID)
+	if got.UpdatedBy != "7" {
+		t.Fatalf("updated_by = %q", got.UpdatedBy)
+	}
+}
+
+func TestSaveRecordsChangedColumns(t *testing.T) {
+	db, _ := openTestDB(t)
+	it := &item{SKU: "S1", Quantity: 10, Status: "new"}
+	db.Create(it)
+
+	it.Quantity = 4
+	if err := db.Save(it).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, before, after := latest(t, db, it.ID)
+	if before["quantity"] != float64(10) || after["quantity"] != float64(4) || len(after) != 1 {
+		t.Fatalf("before %v, after %v", before, after)
+	}
+}
+
+func TestUpdateMatchingNothingIsNotRecorded(t *testing.T) {
+	db, _ := openTestDB(t)
+	it := &item{SKU: "S1", Quantity: 2}
+	db.Create(it)
+
+	res := db.Model(&item{}).Where("sku = ? AND quantity >= ?", "S1", 5).
+		Updates(map[string]interface{}{"quantity": gorm.Expr("quantity - ?", 5)})
+	if res.Error != nil || res.RowsAffected != 0 {
+		t.Fatalf("update: %d, %v", res.RowsAffected, res.Error)
+	}
+	entries, _ := History(context.Background(), db, "items", jsonID(it.ID), 10)
+	if len(entries) != 1 || entries[0].Action != ActionCreate {
+		t.Fatalf("entries = %+v", entries)
+	}
+}
+
+func TestBatchExprUpdate(t *testing.T) {
+	db, _ := openTestDB(t)
+	a, b := &item{SKU: "A", Quantity: 1}, &item{SKU: "B", Quantity: 5}
+	db.Create(a)
+	db.Create(b)
+
+	if err := db.Model(&item{}).Where("quantity > 0").Update("quantity", gorm.Expr("quantity * 2")).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		id            uint
+		before, after float64
+	}{{a.ID, 1, 2}, {b.ID, 5, 10}} {
+		_, before, after := latest(t, db, tc.id)
+		if before["quantity"] != tc.before || after["quantity"] != tc.after {
+			t.Fatalf("item %d: before %v, after %v", tc.id, before, after)
+		}
+	}
+}
+
+func TestDeleteRecordsBeforeImage(t *testing.T) {
+	db, _ := openTestDB(t)
+	it := &item{SKU: "S1", Quantity: 3}
+	db.Create(it)
+
+	if err := db.Delete(&item{}, it.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	entry, before, after := latest(t, db, it.ID)
+	if entry.Action != ActionDelete || before["sku"] != "S1" || after != nil {
+		t.Fatalf("entry %s: before %v, after %v", entry.Action, before, after)
+	}
+}
+
+// TestConcurrentDecrementsChain 并发扣减时每条审计记录的前镜像都等于上一条的后镜像，没有缺口或重复
+func TestConcurrentDecrementsChain(t *testing.T) {
+	db, _ := openTestDB(t)
+	it := &item{SKU: "S1", Quantity: 100}
+	db.Create(it)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := db.Model(&item{}).Where("sku = ? AND quantity >= ?", "S1", 1).
+				Updates(map[string]interface{}{"quantity": gorm.Expr("quantity - ?", 1)})
+			if res.Error != nil || res.RowsAffected != 1 {
+				t.Errorf("update: %d, %v", res.RowsAffected, res.Error)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := History(context.Background(), db, "items", jsonID(it.ID), workers+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := float64(100)
+	updates := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Action != ActionUpdate {
+			continue
+		}
+		var before, after map[string]interface{}
+		json.Unmarshal(entries[i].Before, &before)
+		json.Unmarshal(entries[i].After, &after)
+		if before["quantity"] != want || after["quantity"] != want-1 {
+			t.Fatalf("update %d: before %v, after %v, want %v -> %v", updates, before, after, want, want-1)
+		}
+		want--
+		updates++
+	}
+	var got item
+	db.First(&got, it.ID)
+	if updates != workers || float64(got.Quantity) != want {
+		t.Fatalf("%d updates recorded, chain ends at %v, row has %d", updates, want, got.Quantity)
+	}
+}
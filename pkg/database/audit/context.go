@@ -0,0 +1,22 @@
+package audit
+
+import "context"
+
+// Actor 描述发起变更的一方，由 HTTP 中间件从请求头注入到 context
+type Actor struct {
+	ID      string // 用户 ID (X-User-ID)，为空时记录为 Config.System
+	TraceID string
+}
+
+type actorKey struct{}
+
+// WithActor 把操作者写入 ctx，之后通过 GetDB(ctx, db) 执行的写操作都会记录该操作者
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext 读取 ctx 中的操作者
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
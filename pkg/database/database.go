@@ -0,0 +1,138 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
+)
+
+// 支持的数据库驱动
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// Config holds database configuration
+type Config struct {
+	// Driver 为 "mysql" (默认) 或 "sqlite"
+	Driver string
+
+	User     string
+	Password string
+	Host     string
+	Port     string
+	// DBName 在 MySQL 下是库名，在 SQLite 下是数据库文件路径 (":memory:" 表示内存库)
+	DBName string
+
+	// ReplicaDSNs 是只读从库的 DSN 列表，为空时所有查询都走主库 (仅 MySQL)
+	ReplicaDSNs []string
+
+	// Pool 连接池配置，从库使用相同的配置
+	Pool PoolConfig
+	// SlowThreshold 超过该耗时的 SQL 会带着 trace_id 以 WARN 记录，默认 200ms
+	SlowThreshold time.Duration
+	// LogLevel 为 silent / error / warn / info，默认 warn (只记录慢查询和错误)；info 会打印每条 SQL
+	LogLevel string
+}
+
+// PoolConfig 连接池配置，零值字段使用默认值
+type PoolConfig struct {
+	MaxIdleConns    int           `mapstructure:"MaxIdleConns"`
+	MaxOpenConns    int           `mapstructure:"MaxOpenConns"`
+	ConnMaxLifetime time.Duration `mapstructure:"ConnMaxLifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"ConnMaxIdleTime"`
+}
+
+const (
+	defaultMaxIdleConns    = 10
+	defaultMaxOpenConns    = 100
+	defaultConnMaxLifetime = time.Hour
+)
+
+// Open 根据 cfg.Driver 创建 GORM 连接
+func Open(cfg Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case "", DriverMySQL:
+		dialector = mysqlDialector(cfg)
+	case DriverSQLite:
+		if len(cfg.ReplicaDSNs) > 0 {
+			return nil, fmt.Errorf("read replicas are not supported by the %s driver", DriverSQLite)
+		}
+		dialector = sqliteDialector(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+
+	// Configure GORM
+	gormConfig := &gorm.Config{
+		Logger: newQueryLogger(cfg.LogLevel, cfg.SlowThreshold),
+		// 唯一约束冲突等转换为 gorm.ErrDuplicatedKey，与驱动无关
+		TranslateError: true,
+	}
+
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Configure connection pool
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	configurePool(sqlDB, cfg.Pool)
+	if Dialect(db) == DriverSQLite {
+		// SQLite 只允许单个写者；内存库每个连接都是独立的数据库，因此只保留一个连接
+		// 所以事务内不能再开启 PropagationRequiresNew 的独立事务 (Transaction 会返回错误而不是一直等待连接)
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	// Read/write splitting
+	if len(cfg.ReplicaDSNs) > 0 {
+		if err := registerReplicas(db, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Metrics: 每条语句的耗时直方图 + 连接池状态
+	if err := db.Use(newMetricsPlugin(dbLabel(cfg))); err != nil {
+		return nil, fmt.Errorf("failed to register db metrics: %w", err)
+	}
+
+	// Tracing: 每条语句作为当前请求 span 的子 span (需要通过 WithContext 传入 ctx)
+	// 指标由上面的 metricsPlugin 负责；不记录参数值，避免敏感数据进入 trace
+	if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics(), gormtracing.WithoutQueryVariables())); err != nil {
+		return nil, fmt.Errorf("failed to register db tracing: %w", err)
+	}
+
+	return db, nil
+}
+
+// Dialect 返回连接的方言名 ("mysql" / "sqlite")，用于选择迁移脚本等
+func Dialect(db *gorm.DB) string {
+	return db.Dialector.Name()
+}
+
+func configurePool(sqlDB *sql.DB, pool PoolConfig) {
+	if pool.MaxIdleConns <= 0 {
+		pool.MaxIdleConns = defaultMaxIdleConns
+	}
+	if pool.MaxOpenConns <= 0 {
+		pool.MaxOpenConns = defaultMaxOpenConns
+	}
+	if pool.ConnMaxLifetime <= 0 {
+		pool.ConnMaxLifetime = defaultConnMaxLifetime
+	}
+	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	// SetMaxOpenConns sets the maximum number of open connections to the database.
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
+	sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	// SetConnMaxIdleTime 为 0 时空闲连接不会因为空闲时间被关闭
+	sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+}
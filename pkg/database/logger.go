@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"vv-ecommerce/pkg/logging"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const defaultSlowThreshold = 200 * time.Millisecond
+
+// queryLogger 替代 GORM 默认 logger：默认只记录慢查询和错误
+// 通过 ctx 中的 logger 输出，带上 trace_id / order_id 等字段便于和请求日志关联
+type queryLogger struct {
+	level logger.LogLevel
+	slow  time.Duration
+}
+
+func newQueryLogger(level string, slow time.Duration) logger.Interface {
+	if slow <= 0 {
+		slow = defaultSlowThreshold
+	}
+	return &queryLogger{level: parseLogLevel(level), slow: slow}
+}
+
+func parseLogLevel(level string) logger.LogLevel {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "info":
+		return logger.Info
+	default:
+		return logger.Warn
+	}
+}
+
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	clone := *l
+	clone.level = level
+	return &clone
+}
+
+func (l *queryLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		l.print(ctx, slog.LevelInfo, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *queryLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		l.print(ctx, slog.LevelWarn, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *queryLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		l.print(ctx, slog.LevelError, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		l.print(ctx, slog.LevelError, "query failed", query(fc, elapsed, logging.Err(err))...)
+	case elapsed > l.slow && l.level >= logger.Warn:
+		l.print(ctx, slog.LevelWarn, "slow query", query(fc, elapsed, slog.Duration("slow_threshold", l.slow))...)
+	case l.level >= logger.Info:
+		l.print(ctx, slog.LevelInfo, "query", query(fc, elapsed)...)
+	}
+}
+
+// query 组装一条 SQL 日志的字段
+func query(fc func() (string, int64), elapsed time.Duration, extra ...slog.Attr) []slog.Attr {
+	sql, rows := fc()
+	return append([]slog.Attr{
+		slog.String("caller", caller()),
+		slog.Float64("latency_ms", ms(elapsed)),
+		slog.Int64("rows", rows),
+		slog.String("sql", sql),
+	}, extra...)
+}
+
+func (l *queryLogger) print(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	logging.FromContext(ctx).LogAttrs(ctx, level, msg, append(attrs, slog.String(logging.KeyComponent, "db"))...)
+}
+
+// caller 返回触发 SQL 的业务代码位置 (跳过 GORM 和本包，包括审计/指标插件)
+func caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.File, "gorm.io/") && !strings.Contains(frame.File, "pkg/database/") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"time"
+	"vv-ecommerce/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const (
+	metricsPluginName = "vv:metrics"
+	metricsStartKey   = "vv:metrics:start"
+)
+
+// queryDuration 是每条语句的耗时，按操作类型和表区分
+var queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Latency of SQL statements executed through GORM.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"db", "operation", "table", "status"})
+
+func init() {
+	metrics.MustRegister(queryDuration)
+}
+
+// registerPoolStats 以 go_sql_* 指标导出 sql.DBStats (打开/空闲/使用中的连接数、等待次数与时长等)
+func registerPoolStats(name string, sqlDB *sql.DB) {
+	metrics.MustRegister(collectors.NewDBStatsCollector(sqlDB, name))
+}
+
+// dbLabel 是指标中的 db 标签：MySQL 为库名，SQLite 为文件名
+func dbLabel(cfg Config) string {
+	if cfg.Driver == DriverSQLite {
+		if cfg.DBName == "" || cfg.DBName == ":memory:" {
+			return "memory"
+		}
+		return filepath.Base(cfg.DBName)
+	}
+	return cfg.DBName
+}
+
+// metricsPlugin 在每个 GORM 操作前后记录耗时
+type metricsPlugin struct {
+	db string
+}
+
+func newMetricsPlugin(db string) *metricsPlugin {
+	return &metricsPlugin{db: db}
+}
+
+func (p *metricsPlugin) Name() string { return metricsPluginName }
+
+func (p *metricsPlugin) Initialize(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	registerPoolStats(p.db, sqlDB)
+
+	// Before("*") / After("*") 保证计时覆盖整个回调链 (包括审计等其他插件)
+	type register func(name string, fn func(*gorm.DB)) error
+	cb := db.Callback()
+	processors := []struct {
+		op            string
+		before, after register
+	}{
+		{"create", cb.Create().Before("*").Register, cb.Create().After("*").Register},
+		{"query", cb.Query().Before("*").Register, cb.Query().After("*").Register},
+		{"update", cb.Update().Before("*").Register, cb.Update().After("*").Register},
+		{"delete", cb.Delete().Before("*").Register, cb.Delete().After("*").Register},
+		{"row", cb.Row().Before("*").Register, cb.Row().After("*").Register},
+		{"raw", cb.Raw().Before("*").Register, cb.Raw().After("*").Register},
+	}
+	for _, proc := range processors {
+		if err := proc.before("vv:metrics:before_"+proc.op, p.before); err != nil {
+			return err
+		}
+		if err := proc.after("vv:metrics:after_"+proc.op, p.after(proc.op)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *metricsPlugin) before(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func (p *metricsPlugin) after(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		start, _ := v.(time.Time)
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "none"
+		}
+		status := "ok"
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			status = "error"
+		}
+		queryDuration.WithLabelValues(p.db, op, table, status).Observe(time.Since(start).Seconds())
+	}
+}
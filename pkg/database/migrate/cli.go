@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `usage: <service> migrate <command>
+
+commands:
+  up              apply all pending migrations
+  down [N]        revert the last N migrations (default 1)
+  status          show applied / pending migrations
+  create <name>   create a new pair of up/down files in every dialect dir`
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// Create 在磁盘上的 dir 目录中生成下一个版本的 up/down 文件 (开发时使用，运行时读取的是 embed.FS)
+func Create(dir, name string) (up, down string, err error) {
+	if !namePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q: only letters, digits and '_' are allowed", name)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read migrations dir %s: %w", dir, err)
+	}
+	var next int64 = 1
+	for _, entry := range entries {
+		if m := fileNamePattern.FindStringSubmatch(entry.Name()); m != nil {
+			if v, _ := strconv.ParseInt(m[1], 10, 64); v >= next {
+				next = v + 1
+			}
+		}
+	}
+
+	base := fmt.Sprintf("%06d_%s", next, name)
+	up = filepath.Join(dir, base+".up.sql")
+	down = filepath.Join(dir, base+".down.sql")
+	if err := os.WriteFile(up, []byte("-- "+base+" up\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- "+base+" down\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
+
+// Run 执行 migrate 子命令，args 为 "migrate" 之后的参数
+// createDirs 是 create 命令写入的目录 (每个方言一个，保证脚本不会漏写)
+// newRunner 延迟创建 Runner，使 create 命令不需要连接数据库
+func Run(ctx context.Context, args []string, createDirs []string, newRunner func() (*Runner, error)) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", usage)
+	}
+
+	if args[0] == "create" {
+		if len(args) < 2 {
+			return fmt.Errorf("missing migration name\n%s", usage)
+		}
+		for _, dir := range createDirs {
+			up, down, err := Create(dir, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("created %s\ncreated %s\n", up, down)
+		}
+		return nil
+	}
+
+	r, err := newRunner()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := r.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		n, err := r.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migration(s)\n", n)
+	case "status":
+		statuses, err := r.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, st := range statuses {
+			state, at := "pending", ""
+			if st.Applied {
+				state = "applied"
+				at = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.Dirty {
+				state = "dirty"
+			}
+			if st.AppliedAs != "" {
+				state += " as " + st.AppliedAs
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\t%s\n", st.Version, st.Name, state, at)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", strings.Join(args, " "), usage)
+	}
+	return nil
+}
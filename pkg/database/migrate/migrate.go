@@ -0,0 +1,329 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vv-ecommerce/pkg/logging"
+)
+
+// lockName 是 MySQL advisory lock 的名字，保证多个实例同时启动时只有一个在执行迁移
+// SQLite 是单写者的本地文件，不需要额外加锁
+const (
+	lockName    = "schema_migrations"
+	lockTimeout = 60 // 秒
+)
+
+const (
+	dialectMySQL  = "mysql"
+	dialectSQLite = "sqlite"
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration 表示一个版本的 up/down 脚本
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status 表示某个版本的迁移状态
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	Dirty     bool
+	AppliedAt *time.Time
+	// AppliedAs 是 schema_migrations 中记录的名字，与 Name 不同时说明脚本在应用后被重新编号或改名
+	AppliedAs string
+}
+
+// Runner 基于 schema_migrations 表执行版本化迁移
+type Runner struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New 从 src (通常是 embed.FS) 的 dir 目录加载迁移脚本
+// dialect 为 "mysql" 或 "sqlite"，决定是否使用 advisory lock
+func New(db *sql.DB, dialect string, src fs.FS, dir string) (*Runner, error) {
+	if dialect != dialectMySQL && dialect != dialectSQLite {
+		return nil, fmt.Errorf("unsupported migration dialect %q", dialect)
+	}
+	migrations, err := load(src, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+func load(src fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(src, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations dir %s: %w", dir, err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := fileNamePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(src, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("duplicate migration version %d (%s, %s)", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up 执行所有未应用的迁移，返回本次应用的版本数
+func (r *Runner) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		state, err := r.state(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range r.migrations {
+			if _, ok := state[mig.Version]; ok {
+				continue
+			}
+			slog.InfoContext(ctx, "applying migration", logging.KeyComponent, "migrate", "version", mig.Version, "name", mig.Name)
+			if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, ?, ?)",
+				mig.Version, mig.Name, true, time.Now()); err != nil {
+				return err
+			}
+			if err := execScript(ctx, conn, mig.Up); err != nil {
+				return fmt.Errorf("migration %d_%s failed (left dirty): %w", mig.Version, mig.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = ? WHERE version = ?", false, mig.Version); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down 回滚最近的 steps 个版本
+func (r *Runner) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		state, err := r.state(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(r.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			mig := r.migrations[i]
+			if _, ok := state[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", mig.Version, mig.Name)
+			}
+			slog.InfoContext(ctx, "reverting migration", logging.KeyComponent, "migrate", "version", mig.Version, "name", mig.Name)
+			if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = ? WHERE version = ?", true, mig.Version); err != nil {
+				return err
+			}
+			if err := execScript(ctx, conn, mig.Down); err != nil {
+				return fmt.Errorf("revert %d_%s failed (left dirty): %w", mig.Version, mig.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status 返回每个已知版本的状态 (包括数据库中存在但代码里已删除的版本)
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := r.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	state, err := r.rows(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(r.migrations))
+	for _, mig := range r.migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if row, ok := state[mig.Version]; ok {
+			st.Applied, st.Dirty, st.AppliedAt = true, row.Dirty, row.AppliedAt
+			if row.Name != mig.Name {
+				st.AppliedAs = row.Name
+			}
+			delete(state, mig.Version)
+		}
+		result = append(result, st)
+	}
+	for _, row := range state {
+		result = append(result, row)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// withLock 在独占连接上获取 advisory lock 后执行 fn (GET_LOCK 是 session 级别的)
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if r.dialect == dialectMySQL {
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&got); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if !got.Valid || got.Int64 != 1 {
+			return errors.New("failed to acquire migration lock: timeout")
+		}
+		defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+	}
+
+	if err := r.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// state 返回已应用的版本，如果存在 dirty 版本，或已应用的版本与同版本号的脚本名字不同则拒绝继续
+func (r *Runner) state(ctx context.Context, conn *sql.Conn) (map[int64]Status, error) {
+	rows, err := r.rows(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.Dirty {
+			return nil, fmt.Errorf("database is dirty at version %d (%s), fix it manually and delete the row from schema_migrations", row.Version, row.Name)
+		}
+	}
+	// 脚本被重新编号或改名后，按版本号匹配会把旧记录当成新脚本已经应用过
+	for _, mig := range r.migrations {
+		if row, ok := rows[mig.Version]; ok && row.Name != mig.Name {
+			return nil, fmt.Errorf("version %d was applied as %s but the script is now %d_%s, applied migrations must not be renumbered or renamed", mig.Version, row.Name, mig.Version, mig.Name)
+		}
+	}
+	return rows, nil
+}
+
+func (r *Runner) rows(ctx context.Context, conn *sql.Conn) (map[int64]Status, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64]Status)
+	for rows.Next() {
+		var st Status
+		var appliedAt time.Time
+		if err := rows.Scan(&st.Version, &st.Name, &st.Dirty, &appliedAt); err != nil {
+			return nil, err
+		}
+		st.Applied = true
+		st.AppliedAt = &appliedAt
+		result[st.Version] = st
+	}
+	return result, rows.Err()
+}
+
+// ensureTable 创建 schema_migrations 表
+// SQLite 驱动只把声明类型恰好为 DATETIME 的列解析为 time.Time，因此不能带精度
+func (r *Runner) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	appliedAt := "DATETIME(3)"
+	if r.dialect == dialectSQLite {
+		appliedAt = "DATETIME"
+	}
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT FALSE,
+    applied_at `+appliedAt+` NOT NULL
+)`)
+	return err
+}
+
+// execScript 按语句逐条执行脚本 (不依赖驱动的 multiStatements 参数)
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%w\n--- statement ---\n%s", err, stmt)
+		}
+	}
+	return nil
+}
+
+// splitStatements 以行尾的 ';' 作为语句分隔符，并忽略 '--' 注释行
+// 迁移脚本约定每条语句以 ';' 结尾单独成行，不支持存储过程等包含 ';' 的复杂语句
+func splitStatements(script string) []string {
+	var stmts []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
@@ -0,0 +1,223 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/glebarez/sqlite"
+)
+
+// openSQLite 打开临时目录中的 SQLite 文件 (内存库在连接池的每个连接上各是一个库)
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// scripts 由 "文件名 -> 内容" 组成迁移目录 migrations/
+func newRunner(t *testing.T, db *sql.DB, scripts map[string]string) *Runner {
+	t.Helper()
+	src := fstest.MapFS{}
+	for name, body := range scripts {
+		src["migrations/"+name] = &fstest.MapFile{Data: []byte(body)}
+	}
+	r, err := New(db, dialectSQLite, src, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+var baseScripts = map[string]string{
+	"000001_init.up.sql":          "CREATE TABLE items (\n    id INTEGER PRIMARY KEY,\n    name TEXT\n);\n",
+	"000001_init.down.sql":        "DROP TABLE items;\n",
+	"000002_add_version.up.sql":   "-- 乐观锁版本号\nALTER TABLE items ADD COLUMN version INTEGER NOT NULL DEFAULT 1;\n",
+	"000002_add_version.down.sql": "ALTER TABLE items DROP COLUMN version;\n",
+}
+
+func withScripts(extra map[string]string) map[string]string {
+	scripts := make(map[string]string, len(baseScripts)+len(extra))
+	for k, v := range baseScripts {
+		scripts[k] = v
+	}
+	for k, v := range extra {
+		scripts[k] = v
+	}
+	return scripts
+}
+
+// states 把 Status 简化为 "版本_名字=状态"
+func states(t *testing.T, r *Runner) []string {
+	t.Helper()
+	statuses, err := r.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, st := range statuses {
+		state := "pending"
+		if st.Applied {
+			state = "applied"
+		}
+		if st.Dirty {
+			state = "dirty"
+		}
+		out = append(out, st.Name+"="+state)
+	}
+	return out
+}
+
+func TestUpDownStatus(t *testing.T) {
+	db := openSQLite(t)
+	r := newRunner(t, db, baseScripts)
+	ctx := context.Background()
+
+	if got := states(t, r); !reflect.DeepEqual(got, []string{"init=pending", "add_version=pending"}) {
+		t.Fatalf("status before up = %v", got)
+	}
+	if n, err := r.Up(ctx); err != nil || n != 2 {
+		t.Fatalf("up = %d, %v; want 2", n, err)
+	}
+	if _, err := db.Exec(`INSERT INTO items (name, version) VALUES ('a', 3)`); err != nil {
+		t.Fatalf("schema after up: %v", err)
+	}
+	if n, err := r.Up(ctx); err != nil || n != 0 {
+		t.Fatalf("second up = %d, %v; want nothing to apply", n, err)
+	}
+
+	if n, err := r.Down(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("down = %d, %v; want 1", n, err)
+	}
+	if got := states(t, r); !reflect.DeepEqual(got, []string{"init=applied", "add_version=pending"}) {
+		t.Fatalf("status after down = %v", got)
+	}
+	if _, err := db.Exec(`SELECT version FROM items`); err == nil {
+		t.Fatal("version column still exists after down")
+	}
+
+	// 新增的脚本在下一次 up 时应用
+	r = newRunner(t, db, withScripts(map[string]string{"000003_add_sku.up.sql": "ALTER TABLE items ADD COLUMN sku TEXT;"}))
+	if n, err := r.Up(ctx); err != nil || n != 2 {
+		t.Fatalf("up after adding a script = %d, %v; want 2", n, err)
+	}
+	if n, err := r.Down(ctx, 5); err == nil || n != 0 || !strings.Contains(err.Error(), "no down script") {
+		t.Fatalf("down without a down script = %d, %v", n, err)
+	}
+}
+
+func TestFailedMigrationLeavesDirty(t *testing.T) {
+	db := openSQLite(t)
+	r := newRunner(t, db, withScripts(map[string]string{
+		"000003_broken.up.sql": "ALTER TABLE items ADD COLUMN sku TEXT;\nALTER TABLE no_such_table ADD COLUMN x TEXT;\n",
+	}))
+	ctx := context.Background()
+
+	n, err := r.Up(ctx)
+	if err == nil || n != 2 || !strings.Contains(err.Error(), "migration 3_broken failed (left dirty)") || !strings.Contains(err.Error(), "no_such_table") {
+		t.Fatalf("up = %d, %v; want 2 applied and the failing statement", n, err)
+	}
+	if got := states(t, r); !reflect.DeepEqual(got, []string{"init=applied", "add_version=applied", "broken=dirty"}) {
+		t.Fatalf("status = %v", got)
+	}
+	// dirty 之后 up 和 down 都拒绝执行，直到手动修复
+	if _, err := r.Up(ctx); err == nil || !strings.Contains(err.Error(), "dirty at version 3") {
+		t.Fatalf("up on a dirty database: %v", err)
+	}
+	if _, err := r.Down(ctx, 1); err == nil || !strings.Contains(err.Error(), "dirty at version 3") {
+		t.Fatalf("down on a dirty database: %v", err)
+	}
+
+	// 手动修复：撤销执行了一半的脚本，删除 dirty 记录
+	if _, err := db.Exec(`ALTER TABLE items DROP COLUMN sku`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DELETE FROM schema_migrations WHERE version = 3`); err != nil {
+		t.Fatal(err)
+	}
+	r = newRunner(t, db, withScripts(map[string]string{"000003_broken.up.sql": "ALTER TABLE items ADD COLUMN sku TEXT;\n"}))
+	if n, err := r.Up(ctx); err != nil || n != 1 {
+		t.Fatalf("up after the fix = %d, %v", n, err)
+	}
+}
+
+// TestRenumberedMigrationIsRejected 已应用的版本号换成了另一个脚本，不能当作已应用跳过
+func TestRenumberedMigrationIsRejected(t *testing.T) {
+	db := openSQLite(t)
+	ctx := context.Background()
+	if _, err := newRunner(t, db, baseScripts).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 在 000002 插入新脚本，原来的 000002_add_version 改为 000003
+	r := newRunner(t, db, map[string]string{
+		"000001_init.up.sql":        baseScripts["000001_init.up.sql"],
+		"000002_add_status.up.sql":  "ALTER TABLE items ADD COLUMN status TEXT;",
+		"000003_add_version.up.sql": baseScripts["000002_add_version.up.sql"],
+	})
+	for name, run := range map[string]func() error{
+		"up":   func() error { _, err := r.Up(ctx); return err },
+		"down": func() error { _, err := r.Down(ctx, 1); return err },
+	} {
+		if err := run(); err == nil || !strings.Contains(err.Error(), "version 2 was applied as add_version but the script is now 2_add_status") {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := statuses[1]; st.Name != "add_status" || st.AppliedAs != "add_version" {
+		t.Fatalf("status of version 2 = %+v", st)
+	}
+	if _, err := db.Exec(`SELECT status FROM items`); err == nil {
+		t.Fatal("renumbered migration was applied")
+	}
+}
+
+func TestLoadRejectsInvalidDirectories(t *testing.T) {
+	for name, scripts := range map[string]map[string]string{
+		"duplicate version": {"000001_a.up.sql": "SELECT 1;", "000001_b.up.sql": "SELECT 1;"},
+		"down only":         {"000001_a.down.sql": "SELECT 1;"},
+	} {
+		src := fstest.MapFS{}
+		for file, body := range scripts {
+			src["migrations/"+file] = &fstest.MapFile{Data: []byte(body)}
+		}
+		if _, err := New(openSQLite(t), dialectSQLite, src, "migrations"); err == nil {
+			t.Errorf("%s: New succeeded", name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "empty", script: "\n-- only a comment\n\n", want: nil},
+		{name: "one per line", script: "CREATE TABLE a (id INT);\nDROP TABLE b;\n", want: []string{"CREATE TABLE a (id INT)", "DROP TABLE b"}},
+		{
+			name:   "multi-line with comments",
+			script: "-- header\nCREATE TABLE a (\n    id INT,\n    -- inline comment line\n    name TEXT\n);\n\nCREATE INDEX i ON a (name);",
+			want:   []string{"CREATE TABLE a (\n    id INT,\n    name TEXT\n)", "CREATE INDEX i ON a (name)"},
+		},
+		{name: "missing final semicolon", script: "SELECT 1;\nSELECT 2", want: []string{"SELECT 1", "SELECT 2"}},
+		// ';' 只有在行尾才结束语句
+		{name: "semicolon inside a line", script: "INSERT INTO a VALUES ('x;y');\n", want: []string{"INSERT INTO a VALUES ('x;y')"}},
+		{name: "indented", script: "  UPDATE a SET n = 1;  \n", want: []string{"UPDATE a SET n = 1"}},
+	} {
+		if got := splitStatements(tc.script); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: splitStatements = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -2,24 +2,19 @@ package database
 
 import (
 	"fmt"
-	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-// Config holds database configuration
-type Config struct {
-	User     string
-	Password string
-	Host     string
-	Port     string
-	DBName   string
-}
-
 // NewMySQLConnection creates a new GORM connection to MySQL
+// 等价于 Driver 为 "mysql" 的 Open
 func NewMySQLConnection(cfg Config) (*gorm.DB, error) {
+	cfg.Driver = DriverMySQL
+	return Open(cfg)
+}
+
+func mysqlDialector(cfg Config) gorm.Dialector {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		cfg.User,
 		cfg.Password,
@@ -27,29 +22,5 @@ func NewMySQLConnection(cfg Config) (*gorm.DB, error) {
 		cfg.Port,
 		cfg.DBName,
 	)
-
-	// Configure GORM
-	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	}
-
-	db, err := gorm.Open(mysql.Open(dsn), gormConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
-	}
-
-	// Configure connection pool
-	sqlDB, err := db.DB()
-	if err != nil {
-		return nil, err
-	}
-
-	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
-	sqlDB.SetMaxIdleConns(10)
-	// SetMaxOpenConns sets the maximum number of open connections to the database.
-	sqlDB.SetMaxOpenConns(100)
-	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	return db, nil
+	return mysql.Open(dsn)
 }
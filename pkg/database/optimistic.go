@@ -0,0 +1,77 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// VersionColumn 是乐观锁版本号的列名
+const VersionColumn = "version"
+
+// ErrVersionConflict 用于 errors.Is 判断，具体信息见 VersionConflictError
+var ErrVersionConflict = errors.New("version conflict")
+
+// Versioned 嵌入到模型中开启乐观锁，新记录的版本号从 1 开始
+// 版本号 0 因此可以表示 "调用方没有提供版本" (不做检查)
+type Versioned struct {
+	Version int64 `gorm:"not null;default:1" json:"version"`
+}
+
+func (v *Versioned) BeforeCreate(tx *gorm.DB) error {
+	if v.Version == 0 {
+		v.Version = 1
+	}
+	return nil
+}
+
+// VersionConflictError 表示条件更新时记录已被其他请求修改
+type VersionConflictError struct {
+	Table    string
+	Expected int64
+	Actual   int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: %s modified concurrently (expected version %d, current %d)", ErrVersionConflict, e.Table, e.Expected, e.Actual)
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// IncrementVersion 返回 "version + 1" 表达式，用于不做版本检查的原子更新 (如库存扣减)，保证旧的 ETag 失效
+func IncrementVersion() clause.Expr {
+	return gorm.Expr(VersionColumn + " + 1")
+}
+
+// UpdateWithVersion 执行 UPDATE ... SET <updates>, version = version + 1 WHERE <query> AND version = expected
+// 成功时返回新版本号；记录不存在返回 gorm.ErrRecordNotFound；版本不匹配返回 *VersionConflictError
+func UpdateWithVersion(db *gorm.DB, model interface{}, expected int64, updates map[string]interface{}, query interface{}, args ...interface{}) (int64, error) {
+	values := make(map[string]interface{}, len(updates)+1)
+	for k, v := range updates {
+		values[k] = v
+	}
+	values[VersionColumn] = IncrementVersion()
+
+	result := db.Model(model).Where(query, args...).Where(VersionColumn+" = ?", expected).Updates(values)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return expected + 1, nil
+	}
+
+	// 没有更新到行：区分记录不存在和版本冲突；从主库读，从库可能还没有这一行或是旧版本
+	var actual []int64
+	if err := db.Clauses(dbresolver.Write).Model(model).Where(query, args...).Limit(1).Pluck(VersionColumn, &actual).Error; err != nil {
+		return 0, err
+	}
+	if len(actual) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return 0, &VersionConflictError{Table: result.Statement.Table, Expected: expected, Actual: actual[0]}
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+	"vv-ecommerce/pkg/logging"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	replicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout  = 2 * time.Second
+)
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites 标记 ctx 中的读操作必须走主库 (例如刚写入后立即读取，不能容忍复制延迟)
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+// IsReadYourWrites 判断 ctx 是否被标记为必须读主库
+func IsReadYourWrites(ctx context.Context) bool {
+	v, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return v
+}
+
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// replicaSet 是 dbresolver 的 Policy：在健康的从库间轮询，全部不可用时回退到主库
+// 同时作为 GORM 插件注册，便于 Close 时找到并关闭从库连接
+type replicaSet struct {
+	primary  gorm.ConnPool
+	replicas []*replica
+	next     atomic.Uint64
+	stop     chan struct{}
+}
+
+const replicaPluginName = "vv:replicas"
+
+func (s *replicaSet) Name() string { return replicaPluginName }
+
+func (s *replicaSet) Initialize(db *gorm.DB) error {
+	s.checkAll()
+	go s.healthLoop()
+	return nil
+}
+
+// Resolve 实现 dbresolver.Policy
+func (s *replicaSet) Resolve([]gorm.ConnPool) gorm.ConnPool {
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := s.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+	return s.primary
+}
+
+func (s *replicaSet) healthLoop() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkAll()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *replicaSet) checkAll() {
+	for _, r := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				slog.Info("replica is healthy again", logging.KeyComponent, "db", "replica", r.name)
+			} else {
+				slog.Warn("replica is unhealthy, reads fall back to other replicas/primary", logging.KeyComponent, "db", "replica", r.name, logging.Err(err))
+			}
+		}
+	}
+}
+
+func (s *replicaSet) close() error {
+	close(s.stop)
+	var firstErr error
+	for _, r := range s.replicas {
+		if err := r.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// registerReplicas 为 db 注册读写分离：普通读走从库，写、事务内的读以及 WithReadYourWrites 的读走主库
+func registerReplicas(db *gorm.DB, cfg Config) error {
+	return useReplicas(db, cfg, "mysql", func(conn *sql.DB) gorm.Dialector {
+		// 跳过版本探测，避免从库暂时不可用时导致服务无法启动
+		return mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true})
+	})
+}
+
+// useReplicas 用 driver 打开 cfg.ReplicaDSNs 中的从库并注册到 db，dialector 把连接包装成 GORM 方言
+func useReplicas(db *gorm.DB, cfg Config, driver string, dialector func(*sql.DB) gorm.Dialector) error {
+	primary, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	set := &replicaSet{primary: primary, stop: make(chan struct{})}
+	// dbresolver 只有一个从库时不调用 Policy 而是直接使用它，从库不健康时也不会回退；
+	// 把主库也放进 Replicas，读操作总是经过 Resolve (Resolve 只从 s.replicas 和 s.primary 中选择)
+	dialectors := []gorm.Dialector{dialector(primary)}
+	for i, dsn := range cfg.ReplicaDSNs {
+		sqlDB, err := sql.Open(driver, dsn)
+		if err != nil {
+			set.close()
+			return fmt.Errorf("failed to open replica #%d: %w", i, err)
+		}
+		configurePool(sqlDB, cfg.Pool)
+		registerPoolStats(fmt.Sprintf("%s-replica-%d", dbLabel(cfg), i), sqlDB)
+		set.replicas = append(set.replicas, &replica{name: fmt.Sprintf("#%d", i), db: sqlDB})
+		dialectors = append(dialectors, dialector(sqlDB))
+	}
+
+	if err := db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   set,
+	})); err != nil {
+		set.close()
+		return fmt.Errorf("failed to register db resolver: %w", err)
+	}
+	return db.Use(set)
+}
+
+// Close 关闭主库以及已注册的从库连接
+func Close(db *gorm.DB) error {
+	if plugin, ok := db.Config.Plugins[replicaPluginName]; ok {
+		if err := plugin.(*replicaSet).close(); err != nil {
+			slog.Error("failed to close replica connections", logging.KeyComponent, "db", logging.Err(err))
+		}
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// seedSource 在 path 创建 items 表并写入一行 name，用于判断读操作落在哪个库
+func seedSource(t *testing.T, path, name string) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer sqlDB.Close()
+	if _, err := sqlDB.Exec(`CREATE TABLE items (name TEXT)`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if _, err := sqlDB.Exec(`INSERT INTO items (name) VALUES (?)`, name); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+}
+
+// openWithReplica 打开两个 SQLite 文件分别作为主库和从库，返回 db 和它的 replicaSet
+func openWithReplica(t *testing.T) (*gorm.DB, *replicaSet) {
+	t.Helper()
+	dir := t.TempDir()
+	primaryPath := filepath.Join(dir, "primary.db")
+	replicaPath := filepath.Join(dir, "replica.db")
+	seedSource(t, primaryPath, "primary")
+	seedSource(t, replicaPath, "replica")
+
+	cfg := Config{Driver: DriverSQLite, DBName: primaryPath, LogLevel: "silent"}
+	db, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("open primary: %v", err)
+	}
+	cfg.ReplicaDSNs = []string{replicaPath}
+	err = useReplicas(db, cfg, "sqlite", func(conn *sql.DB) gorm.Dialector {
+		return sqlite.Dialector{Conn: conn}
+	})
+	if err != nil {
+		t.Fatalf("register replica: %v", err)
+	}
+	t.Cleanup(func() { Close(db) })
+	return db, db.Config.Plugins[replicaPluginName].(*replicaSet)
+}
+
+type item struct {
+	Name string
+}
+
+// readFrom 返回 ctx 下的一次读操作落在哪个库
+func readFrom(t *testing.T, ctx context.Context, db *gorm.DB) string {
+	t.Helper()
+	var it item
+	if err := GetDB(ctx, db).Table("items").First(&it).Error; err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return it.Name
+}
+
+func TestReadsGoToReplicaByDefault(t *testing.T) {
+	db, _ := openWithReplica(t)
+	if got := readFrom(t, context.Background(), db); got != "replica" {
+		t.Fatalf("read went to %s, want replica", got)
+	}
+}
+
+func TestWritesGoToPrimary(t *testing.T) {
+	db, _ := openWithReplica(t)
+	ctx := context.Background()
+	if err := GetDB(ctx, db).Table("items").Where("name = ?", "primary").Update("name", "written").Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got := readFrom(t, WithReadYourWrites(ctx), db); got != "written" {
+		t.Fatalf("primary has %s, want written", got)
+	}
+	if got := readFrom(t, ctx, db); got != "replica" {
+		t.Fatalf("replica has %s, want it untouched", got)
+	}
+}
+
+func TestReadsInsideTransactionGoToPrimary(t *testing.T) {
+	db, _ := openWithReplica(t)
+	tm := NewTransactionManager(db)
+	var got string
+	err := tm.Transaction(context.Background(), func(ctx context.Context) error {
+		got = readFrom(t, ctx, db)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	if got != "primary" {
+		t.Fatalf("read in transaction went to %s, want primary", got)
+	}
+}
+
+func TestReadYourWritesGoesToPrimary(t *testing.T) {
+	db, _ := openWithReplica(t)
+	if got := readFrom(t, WithReadYourWrites(context.Background()), db); got != "primary" {
+		t.Fatalf("read-your-writes went to %s, want primary", got)
+	}
+}
+
+func TestReadsFallBackToPrimaryWhenReplicaUnhealthy(t *testing.T) {
+	db, set := openWithReplica(t)
+	ctx := context.Background()
+
+	// 从库连接关闭后健康检查失败
+	set.replicas[0].db.Close()
+	set.checkAll()
+	if set.replicas[0].healthy.Load() {
+		t.Fatal("replica should be marked unhealthy")
+	}
+	if got := readFrom(t, ctx, db); got != "primary" {
+		t.Fatalf("read went to %s, want primary while the replica is down", got)
+	}
+}
+
+// TestUpdateWithVersionReadsConflictFromPrimary 更新没有命中时，冲突的版本号要从主库读：从库可能还没有这一行
+func TestUpdateWithVersionReadsConflictFromPrimary(t *testing.T) {
+	db, set := openWithReplica(t)
+	ctx := context.Background()
+	if err := db.Exec(`ALTER TABLE items ADD COLUMN version INTEGER NOT NULL DEFAULT 3`).Error; err != nil {
+		t.Fatalf("alter primary: %v", err)
+	}
+	if _, err := set.replicas[0].db.Exec(`ALTER TABLE items ADD COLUMN version INTEGER NOT NULL DEFAULT 1`); err != nil {
+		t.Fatalf("alter replica: %v", err)
+	}
+
+	_, err := UpdateWithVersion(GetDB(ctx, db), &item{}, 2, map[string]interface{}{"name": "written"}, "name = ?", "primary")
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Actual != 3 {
+		t.Fatalf("err = %v, want a conflict with the primary's version 3", err)
+	}
+}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// sqliteDialector 使用纯 Go 实现的 SQLite (无需 CGO)，便于本地开发和测试时不依赖 MySQL
+func sqliteDialector(cfg Config) gorm.Dialector {
+	dsn := cfg.DBName
+	if dsn == "" {
+		dsn = ":memory:"
+	}
+	// busy_timeout 避免并发写入时立即返回 SQLITE_BUSY；开启外键约束与 MySQL 行为保持一致
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + "_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	return sqlite.Open(dsn)
+}
@@ -2,20 +2,96 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+	"vv-ecommerce/pkg/logging"
 
+	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 type txKey struct{}
 
+// txOptionsKey 保存最外层事务的选项，加入它的内层事务据此检查选项是否兼容
+type txOptionsKey struct{}
+
+// ErrIncompatibleTxOptions 加入外层事务 (Required / Nested) 时要求了外层事务没有的只读或隔离级别
+var ErrIncompatibleTxOptions = errors.New("transaction options are incompatible with the outer transaction")
+
+// Propagation 定义当 context 中已经存在事务时，新事务如何处理
+type Propagation int
+
+const (
+	// PropagationRequired 已有事务则加入，否则新建 (默认)
+	PropagationRequired Propagation = iota
+	// PropagationRequiresNew 总是在新连接上开启独立事务，与外层事务互不影响
+	// SQLite 只有一个连接 (见 Open)，外层事务占着它时新事务永远拿不到连接，因此返回错误
+	PropagationRequiresNew
+	// PropagationNested 已有事务时通过 SAVEPOINT 开启嵌套事务，失败只回滚到保存点；否则新建
+	PropagationNested
+)
+
+// MySQL 可重试的锁错误
+const (
+	errLockWaitTimeout = 1205
+	errDeadlock        = 1213
+)
+
+const (
+	defaultMaxRetries = 3
+	retryBaseBackoff  = 20 * time.Millisecond
+)
+
+// TxOptions 是事务选项，通过 TxOption 设置
+type TxOptions struct {
+	Propagation Propagation
+	ReadOnly    bool
+	Isolation   sql.IsolationLevel
+	// MaxRetries 是遇到死锁 (1213) / 锁等待超时 (1205) 时整个闭包的最大重试次数，0 表示不重试
+	// 只有最外层事务会重试 (MySQL 死锁会回滚整个事务，嵌套层重试没有意义)
+	MaxRetries int
+}
+
+// TxOption 设置事务选项。加入外层事务 (Required / Nested) 时：
+//   - ReadOnly 和 Isolation 无法改变外层事务，与外层不一致时返回 ErrIncompatibleTxOptions
+//   - MaxRetries 被忽略，锁错误由最外层事务重试
+type TxOption func(*TxOptions)
+
+// WithPropagation 设置传播行为
+func WithPropagation(p Propagation) TxOption {
+	return func(o *TxOptions) { o.Propagation = p }
+}
+
+// ReadOnly 开启只读事务 (START TRANSACTION READ ONLY)
+func ReadOnly() TxOption {
+	return func(o *TxOptions) { o.ReadOnly = true }
+}
+
+// WithIsolation 设置隔离级别，如 sql.LevelReadCommitted
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *TxOptions) { o.Isolation = level }
+}
+
+// WithMaxRetries 设置锁错误的最大重试次数
+func WithMaxRetries(n int) TxOption {
+	return func(o *TxOptions) { o.MaxRetries = n }
+}
+
 // TransactionManager 定义了管理数据库事务的接口
+// 注意：闭包可能因为锁错误被整体重试，闭包内不应有数据库以外的副作用 (如调用下游服务)
 type TransactionManager interface {
-	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	Transaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error
 }
 
 // GormTransactionManager 是基于 GORM 的实现
 type GormTransactionManager struct {
-	db *gorm.DB
+	db        *gorm.DB
+	savepoint atomic.Uint64
 }
 
 func NewTransactionManager(db *gorm.DB) *GormTransactionManager {
@@ -23,19 +99,107 @@ func NewTransactionManager(db *gorm.DB) *GormTransactionManager {
 }
 
 // Transaction 开启一个事务，并将事务对象注入到 context 中
-func (m *GormTransactionManager) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
-	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 将 tx 注入到 context 中
-		txCtx := context.WithValue(ctx, txKey{}, tx)
-		return fn(txCtx)
-	})
+func (m *GormTransactionManager) Transaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	o := TxOptions{MaxRetries: defaultMaxRetries}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		if o.Propagation == PropagationRequiresNew {
+			if Dialect(m.db) == DriverSQLite {
+				return fmt.Errorf("%s: PropagationRequiresNew inside a transaction needs a second connection", DriverSQLite)
+			}
+			// 落到下面，在新连接上开启独立事务
+		} else {
+			outer, _ := ctx.Value(txOptionsKey{}).(TxOptions)
+			if (o.ReadOnly && !outer.ReadOnly) || (o.Isolation != sql.LevelDefault && o.Isolation != outer.Isolation) {
+				return ErrIncompatibleTxOptions
+			}
+			if o.Propagation == PropagationNested {
+				return m.nested(ctx, tx, fn)
+			}
+			// 加入外层事务
+			return fn(ctx)
+		}
+	}
+
+	return m.withRetry(ctx, o, fn)
+}
+
+// nested 在外层事务中创建 SAVEPOINT，fn 失败时只回滚到保存点
+func (m *GormTransactionManager) nested(ctx context.Context, tx *gorm.DB, fn func(ctx context.Context) error) error {
+	name := fmt.Sprintf("sp_%d", m.savepoint.Add(1))
+	if err := tx.SavePoint(name).Error; err != nil {
+		return err
+	}
+
+	err := fn(ctx)
+	if err == nil {
+		return nil
+	}
+	// 死锁/锁超时会回滚整个事务，保存点已失效，直接交给最外层处理
+	if IsRetryableLockError(err) {
+		return err
+	}
+	if rbErr := tx.RollbackTo(name).Error; rbErr != nil {
+		return errors.Join(err, fmt.Errorf("rollback to savepoint %s: %w", name, rbErr))
+	}
+	return err
+}
+
+func (m *GormTransactionManager) withRetry(ctx context.Context, o TxOptions, fn func(ctx context.Context) error) error {
+	txOpts := &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		// 总是从原始 db 开启，RequiresNew 时不会复用外层事务的连接
+		err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// 将 tx 和它的选项注入到 context 中
+			txCtx := context.WithValue(context.WithValue(ctx, txKey{}, tx), txOptionsKey{}, o)
+			return fn(txCtx)
+		}, txOpts)
+
+		if err == nil || !IsRetryableLockError(err) || attempt >= o.MaxRetries {
+			return err
+		}
+
+		backoff := retryBaseBackoff << attempt
+		backoff += time.Duration(rand.Int63n(int64(backoff)))
+		logging.FromContext(ctx).WarnContext(ctx, "transaction hit retryable lock error, retrying",
+			logging.KeyComponent, "db",
+			"attempt", attempt+1,
+			"max_retries", o.MaxRetries,
+			"backoff", backoff,
+			logging.Err(err),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+	}
+}
+
+// IsRetryableLockError 判断是否是 MySQL 死锁 (1213) 或锁等待超时 (1205)
+func IsRetryableLockError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == errDeadlock || mysqlErr.Number == errLockWaitTimeout
+	}
+	return false
 }
 
 // GetDB 尝试从 context 中获取事务 DB，如果不存在则返回默认 DB
+// 配置了从库时：事务内的操作始终在主库上；ctx 标记了 WithReadYourWrites 的读操作强制走主库；其余读操作走从库
 func GetDB(ctx context.Context, defaultDB *gorm.DB) *gorm.DB {
 	tx, ok := ctx.Value(txKey{}).(*gorm.DB)
 	if ok {
 		return tx
 	}
+	if IsReadYourWrites(ctx) {
+		return defaultDB.WithContext(ctx).Clauses(dbresolver.Write)
+	}
 	return defaultDB.WithContext(ctx)
 }
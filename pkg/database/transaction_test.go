@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := Open(Config{Driver: DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { Close(db) })
+	if err := db.Exec(`CREATE TABLE items (name TEXT)`).Error; err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	return db
+}
+
+func countItems(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Table("items").Count(&n).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return n
+}
+
+func insertItem(ctx context.Context, db *gorm.DB, name string) error {
+	return GetDB(ctx, db).Exec(`INSERT INTO items (name) VALUES (?)`, name).Error
+}
+
+func TestRequiredJoinsOuterTransaction(t *testing.T) {
+	db := openSQLite(t)
+	tm := NewTransactionManager(db)
+	errInner := errors.New("inner failed")
+
+	err := tm.Transaction(context.Background(), func(ctx context.Context) error {
+		if err := insertItem(ctx, db, "outer"); err != nil {
+			return err
+		}
+		return tm.Transaction(ctx, func(ctx context.Context) error {
+			if err := insertItem(ctx, db, "inner"); err != nil {
+				return err
+			}
+			return errInner
+		})
+	})
+	if !errors.Is(err, errInner) {
+		t.Fatalf("err = %v, want %v", err, errInner)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Fatalf("%d rows committed, want the whole transaction rolled back", n)
+	}
+}
+
+func TestNestedRollsBackToSavepoint(t *testing.T) {
+	db := openSQLite(t)
+	tm := NewTransactionManager(db)
+
+	err := tm.Transaction(context.Background(), func(ctx context.Context) error {
+		if err := insertItem(ctx, db, "outer"); err != nil {
+			return err
+		}
+		nestedErr := tm.Transaction(ctx, func(ctx context.Context) error {
+			if err := insertItem(ctx, db, "nested"); err != nil {
+				return err
+			}
+			return errors.New("nested failed")
+		}, WithPropagation(PropagationNested))
+		if nestedErr == nil {
+			t.Error("nested transaction should fail")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Fatalf("%d rows committed, want only the outer row", n)
+	}
+}
+
+func TestJoinRejectsIncompatibleOptions(t *testing.T) {
+	db := openSQLite(t)
+	tm := NewTransactionManager(db)
+
+	cases := map[string][]TxOption{
+		"read only":         {ReadOnly()},
+		"isolation":         {WithIsolation(sql.LevelSerializable)},
+		"nested, read only": {WithPropagation(PropagationNested), ReadOnly()},
+	}
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tm.Transaction(context.Background(), func(ctx context.Context) error {
+				return tm.Transaction(ctx, func(ctx context.Context) error { return nil }, opts...)
+			})
+			if !errors.Is(err, ErrIncompatibleTxOptions) {
+				t.Fatalf("err = %v, want ErrIncompatibleTxOptions", err)
+			}
+		})
+	}
+
+	// 与外层一致的选项可以加入
+	err := tm.Transaction(context.Background(), func(ctx context.Context) error {
+		return tm.Transaction(ctx, func(ctx context.Context) error { return nil }, WithIsolation(sql.LevelSerializable))
+	}, WithIsolation(sql.LevelSerializable))
+	if err != nil {
+		t.Fatalf("matching isolation: %v", err)
+	}
+}
+
+func TestRequiresNewInsideTransactionFailsOnSQLite(t *testing.T) {
+	db := openSQLite(t)
+	tm := NewTransactionManager(db)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tm.Transaction(context.Background(), func(ctx context.Context) error {
+			return tm.Transaction(ctx, func(ctx context.Context) error { return nil }, WithPropagation(PropagationRequiresNew))
+		})
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("RequiresNew inside a transaction should fail on SQLite")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RequiresNew inside a transaction deadlocked")
+	}
+}
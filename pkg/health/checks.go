@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Pinger 由能报告连接状态的依赖实现 (如 async.RabbitMQ)
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DB 对主库执行 Ping
+func DB(db *gorm.DB) CheckFunc {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// Ping 检查实现了 Pinger 的依赖
+func Ping(p Pinger) CheckFunc {
+	return p.Ping
+}
+
+// OutboxBacklog 在待发布事件超过 threshold 时失败
+// 积压说明事件发不出去 (MQ 不可用或处理器卡住)，此时继续接单只会让积压更大；
+// 从主库计数，从库的复制延迟不算积压
+func OutboxBacklog(db *gorm.DB, table, pending string, threshold int64) CheckFunc {
+	return func(ctx context.Context) error {
+		var count int64
+		if err := db.WithContext(ctx).Clauses(dbresolver.Write).Table(table).Where("status = ?", pending).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > threshold {
+			return fmt.Errorf("%d pending outbox events exceed threshold %d", count, threshold)
+		}
+		return nil
+	}
+}
+
+// HTTP 请求 url (通常是下游的 /readyz)，非 2xx 视为失败
+func HTTP(client *http.Client, url string) CheckFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
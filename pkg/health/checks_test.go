@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vv-ecommerce/pkg/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// openOutbox 在 path 创建 outbox_events 表并写入 pending 个待发布事件
+func openOutbox(t *testing.T, path string, pending int) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, DBName: path, LogLevel: "silent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	if err := db.Exec(`CREATE TABLE outbox_events (id INTEGER PRIMARY KEY, status TEXT)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < pending; i++ {
+		if err := db.Exec(`INSERT INTO outbox_events (status) VALUES ('PENDING')`).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// TestOutboxBacklogCountsOnPrimary 从库落后时仍有已经发布的事件处于 PENDING，不能算作积压
+func TestOutboxBacklogCountsOnPrimary(t *testing.T) {
+	dir := t.TempDir()
+	db := openOutbox(t, filepath.Join(dir, "primary.db"), 1)
+	openOutbox(t, filepath.Join(dir, "replica.db"), 5)
+	if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: []gorm.Dialector{sqlite.Open(filepath.Join(dir, "replica.db"))}})); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := OutboxBacklog(db, "outbox_events", "PENDING", 2)(ctx); err != nil {
+		t.Fatalf("backlog check failed on the replica's count: %v", err)
+	}
+	if err := OutboxBacklog(db, "outbox_events", "PENDING", 0)(ctx); err == nil || !strings.Contains(err.Error(), "1 pending") {
+		t.Fatalf("err = %v, want the primary's backlog of 1", err)
+	}
+}
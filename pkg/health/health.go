@@ -0,0 +1,190 @@
+// Package health 提供 /livez 与 /readyz 探针
+// 就绪检查 (DB、MQ、outbox 积压、下游服务) 注册到 Checker，带超时并发执行，结果按 CacheTTL 缓存，
+// 避免探针频繁打到依赖；优雅关闭开始后就绪检查立即失败，负载均衡先摘流量再停止服务
+package health
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"vv-ecommerce/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// ErrShuttingDown 优雅关闭期间就绪检查返回的错误
+var ErrShuttingDown = errors.New("shutting down")
+
+// Config 是探针配置，各服务通过 mapstructure 直接嵌入
+type Config struct {
+	// Timeout 单个检查的超时时间
+	Timeout time.Duration `mapstructure:"Timeout"`
+	// CacheTTL 检查结果的缓存时间，0 表示每次探针都重新检查
+	CacheTTL time.Duration `mapstructure:"CacheTTL"`
+	// ShutdownDelay 收到退出信号后，/readyz 返回 503 到真正停止接收请求之间的等待时间
+	ShutdownDelay time.Duration `mapstructure:"ShutdownDelay"`
+}
+
+// CheckFunc 检查一个依赖，返回 nil 表示可用；ctx 带有 Config.Timeout
+type CheckFunc func(ctx context.Context) error
+
+// Option 配置单个检查
+type Option func(*check)
+
+// Optional 标记非关键检查：失败时报告为 degraded，但不影响就绪状态
+// 用于下游服务，避免一个服务故障时调用链上所有服务都被摘除
+func Optional() Option {
+	return func(c *check) { c.optional = true }
+}
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	optional bool
+
+	mu     sync.Mutex
+	result Result
+	at     time.Time
+}
+
+// Result 是单个检查的结果
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// Report 是 /readyz 的响应体
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker 是就绪检查的注册表
+type Checker struct {
+	cfg          Config
+	checks       []*check
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(cfg Config) *Checker {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	return &Checker{cfg: cfg}
+}
+
+// Register 注册一个就绪检查，需在开始处理请求前调用
+func (c *Checker) Register(name string, fn CheckFunc, opts ...Option) {
+	ch := &check{name: name, fn: fn}
+	for _, opt := range opts {
+		opt(ch)
+	}
+	c.checks = append(c.checks, ch)
+}
+
+// Shutdown 标记服务正在关闭，之后 /readyz 一律返回 503
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Drain 标记关闭并等待 ShutdownDelay，让负载均衡在 http.Server.Shutdown 之前摘除本实例
+func (c *Checker) Drain() {
+	c.Shutdown()
+	if c.cfg.ShutdownDelay > 0 {
+		slog.Info("readiness set to failing, waiting for load balancers to drain", "delay", c.cfg.ShutdownDelay.String())
+		time.Sleep(c.cfg.ShutdownDelay)
+	}
+}
+
+// Check 并发执行所有检查并汇总；任一关键检查失败即为 down
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusDown, Checks: map[string]Result{
+			"shutdown": {Status: StatusDown, Error: ErrShuttingDown.Error()},
+		}}
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, ch)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(c.checks))}
+	for i, ch := range c.checks {
+		res := results[i]
+		report.Checks[ch.name] = res
+		switch {
+		case res.Status == StatusUp:
+		case ch.optional:
+			if report.Status == StatusUp {
+				report.Status = StatusDegraded
+			}
+		default:
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// run 执行单个检查；缓存未过期时直接返回上次结果，同一检查同时只有一个在执行
+// 结果会缓存给之后的所有探针，所以检查不跟随本次探针请求取消，只受 Config.Timeout 限制
+func (c *Checker) run(ctx context.Context, ch *check) Result {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if !ch.at.IsZero() && time.Since(ch.at) < c.cfg.CacheTTL {
+		return ch.result
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := ch.fn(ctx)
+
+	res := Result{Status: StatusUp, Duration: time.Since(start).String()}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	// 只在状态变化 (以及首次即失败) 时记录，探针本身很频繁，不逐次打日志
+	if ch.result.Status != res.Status && (err != nil || !ch.at.IsZero()) {
+		if err != nil {
+			slog.Warn("health check failed", "check", ch.name, logging.Err(err))
+		} else {
+			slog.Info("health check recovered", "check", ch.name)
+		}
+	}
+	ch.result, ch.at = res, time.Now()
+	return res
+}
+
+// Live 是 /livez：进程能响应即存活，不检查依赖，避免依赖故障导致服务被反复重启
+func (c *Checker) Live(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, Report{Status: StatusUp})
+}
+
+// Ready 是 /readyz：down 返回 503，degraded 仍返回 200
+func (c *Checker) Ready(ctx *gin.Context) {
+	report := c.Check(ctx.Request.Context())
+	code := http.StatusOK
+	if report.Status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, report)
+}
@@ -0,0 +1,181 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// counting 返回一个记录调用次数的检查，err 为其返回值
+func counting(calls *atomic.Int32, err error) CheckFunc {
+	return func(ctx context.Context) error {
+		calls.Add(1)
+		return err
+	}
+}
+
+// ready 请求 /readyz 并返回状态码
+func ready(c *Checker) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/readyz", c.Ready)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return w.Code
+}
+
+func TestCacheTTL(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	c := NewChecker(Config{CacheTTL: time.Hour})
+	c.Register("db", counting(&calls, nil))
+	for i := 0; i < 3; i++ {
+		if report := c.Check(ctx); report.Status != StatusUp {
+			t.Fatalf("report = %+v", report)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("check ran %d times within the TTL, want 1", n)
+	}
+
+	// 缓存过期后重新检查
+	c.checks[0].at = time.Now().Add(-2 * time.Hour)
+	c.Check(ctx)
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("check ran %d times after the TTL, want 2", n)
+	}
+
+	// CacheTTL 为 0 时每次都检查
+	calls.Store(0)
+	c = NewChecker(Config{})
+	c.Register("db", counting(&calls, nil))
+	c.Check(ctx)
+	c.Check(ctx)
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("check ran %d times without a cache, want 2", n)
+	}
+}
+
+func TestOptional(t *testing.T) {
+	failed := errors.New("connection refused")
+	for _, tc := range []struct {
+		name       string
+		register   func(c *Checker)
+		wantStatus string
+		wantCode   int
+	}{
+		{
+			name: "all up",
+			register: func(c *Checker) {
+				c.Register("db", func(context.Context) error { return nil })
+				c.Register("payment-service", func(context.Context) error { return nil }, Optional())
+			},
+			wantStatus: StatusUp, wantCode: http.StatusOK,
+		},
+		{
+			name: "optional down",
+			register: func(c *Checker) {
+				c.Register("db", func(context.Context) error { return nil })
+				c.Register("payment-service", func(context.Context) error { return failed }, Optional())
+			},
+			wantStatus: StatusDegraded, wantCode: http.StatusOK,
+		},
+		{
+			name: "required down",
+			register: func(c *Checker) {
+				c.Register("db", func(context.Context) error { return failed })
+				c.Register("payment-service", func(context.Context) error { return failed }, Optional())
+			},
+			wantStatus: StatusDown, wantCode: http.StatusServiceUnavailable,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewChecker(Config{})
+			tc.register(c)
+			report := c.Check(context.Background())
+			if report.Status != tc.wantStatus {
+				t.Fatalf("status = %s, want %s: %+v", report.Status, tc.wantStatus, report)
+			}
+			if res := report.Checks["payment-service"]; tc.wantStatus != StatusUp && res.Error != failed.Error() {
+				t.Fatalf("payment-service = %+v", res)
+			}
+			if code := ready(c); code != tc.wantCode {
+				t.Fatalf("/readyz = %d, want %d", code, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestDrain(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(Config{ShutdownDelay: 50 * time.Millisecond})
+	c.Register("db", counting(&calls, nil))
+	if code := ready(c); code != http.StatusOK {
+		t.Fatalf("/readyz before drain = %d", code)
+	}
+
+	start := time.Now()
+	c.Drain()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Drain returned after %s, want at least the shutdown delay", elapsed)
+	}
+	report := c.Check(context.Background())
+	if report.Status != StatusDown || report.Checks["shutdown"].Error != ErrShuttingDown.Error() {
+		t.Fatalf("report after drain = %+v", report)
+	}
+	if code := ready(c); code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz after drain = %d, want 503", code)
+	}
+	// 关闭期间不再检查依赖
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("check ran %d times, want only the one before drain", n)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	c := NewChecker(Config{Timeout: 20 * time.Millisecond, CacheTTL: time.Hour})
+	c.Register("db", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	start := time.Now()
+	report := c.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("check took %s, want it bounded by the timeout", elapsed)
+	}
+	if res := report.Checks["db"]; res.Status != StatusDown || !strings.Contains(res.Error, context.DeadlineExceeded.Error()) {
+		t.Fatalf("db = %+v", res)
+	}
+}
+
+// TestCancelledProbeIsNotCached 探针请求取消 (客户端超时断开) 不能让检查失败并缓存给之后的探针
+func TestCancelledProbeIsNotCached(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(Config{Timeout: time.Second, CacheTTL: time.Hour})
+	c.Register("db", func(ctx context.Context) error {
+		calls.Add(1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+			return nil
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := c.Check(ctx); report.Status != StatusUp {
+		t.Fatalf("report for a cancelled probe = %+v", report)
+	}
+	if report := c.Check(context.Background()); report.Status != StatusUp || calls.Load() != 1 {
+		t.Fatalf("next probe = %+v after %d checks", report, calls.Load())
+	}
+}
@@ -0,0 +1,71 @@
+// Package idempotency 存储 Idempotency-Key 对应的请求指纹和最终响应，供 middleware.Idempotency 重放
+// 提供 SQL (GORM，MySQL / SQLite) 和 Redis 两种实现
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StoreSQL   = "sql"
+	StoreRedis = "redis"
+)
+
+// Config 是幂等配置，各服务通过 mapstructure 直接嵌入
+type Config struct {
+	// Store 为 sql (默认，使用服务自己的数据库) 或 redis
+	Store string `mapstructure:"Store"`
+	// TTL 响应保存多久，超过后同一个 key 视为新请求
+	TTL time.Duration `mapstructure:"TTL"`
+	// LockTTL 处理中的 key 最长占用时间，超过后认为持有者已崩溃，其他请求可以接管
+	LockTTL time.Duration `mapstructure:"LockTTL"`
+}
+
+// Response 是保存下来用于重放的响应
+type Response struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   []byte            `json:"body,omitempty"`
+}
+
+// Record 是一个 key 的当前状态；Response 为 nil 表示第一个请求仍在处理中
+type Record struct {
+	Key         string
+	Fingerprint string
+	Response    *Response
+}
+
+// ErrNotOwner 表示 key 已经不属于这个 token：持有者超过 LockTTL 后被其他请求接管，或者已被删除
+var ErrNotOwner = errors.New("idempotency key is no longer held by this request")
+
+// Store 持久化 Idempotency-Key
+type Store interface {
+	// Acquire 原子地占用 key：成功时返回本次占用的 token，Complete / Release 需要带上它；
+	// key 已存在 (处理中或已完成) 时 token 为空，返回已有记录
+	Acquire(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (rec *Record, token string, err error)
+	// Complete 保存最终响应，保留 ttl；key 已被其他请求接管时返回 ErrNotOwner，不覆盖对方的记录
+	Complete(ctx context.Context, key, token string, resp Response, ttl time.Duration) error
+	// Release 删除 key (请求失败且可以安全重试时)，之后的重试会重新执行；
+	// key 已被其他请求接管时返回 ErrNotOwner，不删除对方的记录
+	Release(ctx context.Context, key, token string) error
+}
+
+// newToken 生成一次占用的 token
+func newToken() string {
+	return uuid.NewString()
+}
+
+// Validate 检查配置
+func (c Config) Validate() error {
+	switch c.Store {
+	case "", StoreSQL, StoreRedis:
+		return nil
+	default:
+		return fmt.Errorf("unsupported idempotency store %q", c.Store)
+	}
+}
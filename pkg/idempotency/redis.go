@@ -0,0 +1,110 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisValue 是保存在 Redis 中的记录；Response 为 nil 表示处理中，Token 是当前持有者
+type redisValue struct {
+	Fingerprint string    `json:"fingerprint"`
+	Token       string    `json:"token"`
+	Response    *Response `json:"response,omitempty"`
+}
+
+// RedisStore 把 key 存在 Redis 中 (多个实例共享，过期由 Redis TTL 处理)
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore prefix 用于区分服务，如 "idempotency:order-service:"
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Acquire(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Record, string, error) {
+	token := newToken()
+	value, err := json.Marshal(redisValue{Fingerprint: fingerprint, Token: token})
+	if err != nil {
+		return nil, "", err
+	}
+
+	for range acquireAttempts {
+		// 处理中的 key 以 LockTTL 过期，持有者崩溃后自动释放
+		ok, err := s.client.SetNX(ctx, s.prefix+key, value, lockTTL).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		if ok {
+			return nil, token, nil
+		}
+
+		raw, err := s.client.Get(ctx, s.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue // 刚过期或被 Release
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		var existing redisValue
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			return nil, "", err
+		}
+		return &Record{Key: key, Fingerprint: existing.Fingerprint, Response: existing.Response}, "", nil
+	}
+	return nil, "", fmt.Errorf("idempotency key %q is contended", key)
+}
+
+// completeScript 只有 token 仍是当前持有者时才写入响应；ARGV: token、响应 (JSON)、保留毫秒数 (0 表示不过期)
+var completeScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then return 0 end
+local value = cjson.decode(raw)
+if value.token ~= ARGV[1] then return 0 end
+value.response = cjson.decode(ARGV[2])
+if tonumber(ARGV[3]) > 0 then
+  redis.call('SET', KEYS[1], cjson.encode(value), 'PX', ARGV[3])
+else
+  redis.call('SET', KEYS[1], cjson.encode(value))
+end
+return 1
+`)
+
+// releaseScript 只有 token 仍是当前持有者时才删除；ARGV: token
+var releaseScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then return 0 end
+if cjson.decode(raw).token ~= ARGV[1] then return 0 end
+return redis.call('DEL', KEYS[1])
+`)
+
+// Complete 和 Release 在 Lua 脚本中比较 token 后再写入：超过 LockTTL 被接管后，原持有者不能覆盖或删除新持有者的记录
+func (s *RedisStore) Complete(ctx context.Context, key, token string, resp Response, ttl time.Duration) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	n, err := completeScript.Run(ctx, s.client, []string{s.prefix + key}, token, data, ttl.Milliseconds()).Int()
+	return ownedReply(n, err)
+}
+
+func (s *RedisStore) Release(ctx context.Context, key, token string) error {
+	n, err := releaseScript.Run(ctx, s.client, []string{s.prefix + key}, token).Int()
+	return ownedReply(n, err)
+}
+
+func ownedReply(n int, err error) error {
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotOwner
+	}
+	return nil
+}
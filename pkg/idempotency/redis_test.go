@@ -0,0 +1,78 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client, "idempotency:test:"), m
+}
+
+func TestRedisStoreCompleteAndReplay(t *testing.T) {
+	store, m := newRedisStore(t)
+	ctx := context.Background()
+
+	_, token, err := store.Acquire(ctx, "k", "fp", time.Minute)
+	if err != nil || token == "" {
+		t.Fatalf("acquire: %q, %v", token, err)
+	}
+	resp := Response{Status: 201, Header: map[string]string{"Content-Type": "application/json"}, Body: []byte(`{"id":1}`)}
+	if err := store.Complete(ctx, "k", token, resp, time.Hour); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if ttl := m.TTL("idempotency:test:k"); ttl != time.Hour {
+		t.Fatalf("ttl = %s, want 1h", ttl)
+	}
+
+	rec, again, err := store.Acquire(ctx, "k", "fp", time.Minute)
+	if err != nil || again != "" || rec.Response == nil {
+		t.Fatalf("replay acquire = %+v, %q, %v", rec, again, err)
+	}
+	got := rec.Response
+	if got.Status != 201 || got.Header["Content-Type"] != "application/json" || string(got.Body) != `{"id":1}` {
+		t.Fatalf("replayed response = %+v", got)
+	}
+}
+
+// TestRedisStoreTakeover 持有者的锁过期被接管后，不能覆盖或删除新持有者的记录
+func TestRedisStoreTakeover(t *testing.T) {
+	store, m := newRedisStore(t)
+	ctx := context.Background()
+
+	_, stale, err := store.Acquire(ctx, "k", "fp", time.Second)
+	if err != nil || stale == "" {
+		t.Fatalf("first acquire: %q, %v", stale, err)
+	}
+	m.FastForward(2 * time.Second)
+	_, current, err := store.Acquire(ctx, "k", "fp", time.Minute)
+	if err != nil || current == "" || current == stale {
+		t.Fatalf("takeover: %q, %v", current, err)
+	}
+
+	if err := store.Complete(ctx, "k", stale, Response{Status: 200}, time.Hour); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("stale Complete: err = %v, want ErrNotOwner", err)
+	}
+	if err := store.Release(ctx, "k", stale); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("stale Release: err = %v, want ErrNotOwner", err)
+	}
+	if rec, _, _ := store.Acquire(ctx, "k", "fp", time.Minute); rec == nil || rec.Response != nil {
+		t.Fatalf("record after stale writes = %+v, want still in progress", rec)
+	}
+
+	if err := store.Release(ctx, "k", current); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, token, err := store.Acquire(ctx, "k", "fp", time.Minute); err != nil || token == "" {
+		t.Fatalf("acquire after release: %q, %v", token, err)
+	}
+}
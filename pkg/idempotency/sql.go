@@ -0,0 +1,148 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// TableName 是 SQL 实现使用的表，各服务的迁移中创建
+const TableName = "idempotency_keys"
+
+// acquireAttempts 与并发请求竞争同一个 key 的最大轮数 (插入冲突后对方恰好释放或过期)
+const acquireAttempts = 3
+
+// sqlRecord 对应 idempotency_keys 表；StatusCode 为 0 表示处理中，LockToken 是当前持有者
+type sqlRecord struct {
+	IdempotencyKey string `gorm:"primaryKey"`
+	Fingerprint    string
+	LockToken      string
+	StatusCode     int
+	Header         []byte
+	Body           []byte
+	LockedUntil    time.Time
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+func (sqlRecord) TableName() string { return TableName }
+
+// SQLStore 把 key 存在服务自己的数据库中，不需要额外的基础设施
+type SQLStore struct {
+	db *gorm.DB
+}
+
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// primary 所有读写都走主库：从库延迟时读不到处理中的 key，两个请求会都执行一次
+func (s *SQLStore) primary(ctx context.Context) *gorm.DB {
+	return s.db.WithContext(ctx).Clauses(dbresolver.Write)
+}
+
+func (s *SQLStore) Acquire(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Record, string, error) {
+	for range acquireAttempts {
+		rec, token, err := s.tryAcquire(ctx, key, fingerprint, lockTTL)
+		if err != nil || token != "" || rec != nil {
+			return rec, token, err
+		}
+	}
+	return nil, "", fmt.Errorf("idempotency key %q is contended", key)
+}
+
+// tryAcquire 返回 (nil, "", nil) 表示本轮竞争失败，需要重试
+func (s *SQLStore) tryAcquire(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Record, string, error) {
+	now := time.Now()
+	token := newToken()
+	row := sqlRecord{
+		IdempotencyKey: key,
+		Fingerprint:    fingerprint,
+		LockToken:      token,
+		LockedUntil:    now.Add(lockTTL),
+		ExpiresAt:      now.Add(lockTTL),
+	}
+	// 主键冲突说明 key 已存在 (依赖 gorm.Config.TranslateError)
+	err := s.primary(ctx).Create(&row).Error
+	if err == nil {
+		return nil, token, nil
+	}
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, "", err
+	}
+
+	var existing sqlRecord
+	if err := s.primary(ctx).Where("idempotency_key = ?", key).Take(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", nil // 刚被 Release
+		}
+		return nil, "", err
+	}
+
+	// 已过期的响应或持有者崩溃留下的锁：条件更新接管，并发时只有一个请求能更新成功
+	if existing.ExpiresAt.Before(now) || (existing.StatusCode == 0 && existing.LockedUntil.Before(now)) {
+		res := s.primary(ctx).Model(&sqlRecord{}).
+			Where("idempotency_key = ? AND (expires_at < ? OR (status_code = 0 AND locked_until < ?))", key, now, now).
+			Updates(map[string]interface{}{
+				"fingerprint":  fingerprint,
+				"lock_token":   token,
+				"status_code":  0,
+				"header":       nil,
+				"body":         nil,
+				"locked_until": now.Add(lockTTL),
+				"expires_at":   now.Add(lockTTL),
+			})
+		if res.Error != nil {
+			return nil, "", res.Error
+		}
+		if res.RowsAffected != 1 {
+			return nil, "", nil
+		}
+		return nil, token, nil
+	}
+
+	rec := &Record{Key: key, Fingerprint: existing.Fingerprint}
+	if existing.StatusCode != 0 {
+		rec.Response = &Response{Status: existing.StatusCode, Body: existing.Body}
+		if len(existing.Header) > 0 {
+			if err := json.Unmarshal(existing.Header, &rec.Response.Header); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	return rec, "", nil
+}
+
+// Complete 和 Release 都以 lock_token 为条件：超过 LockTTL 被接管后，原持有者不能覆盖或删除新持有者的记录
+func (s *SQLStore) Complete(ctx context.Context, key, token string, resp Response, ttl time.Duration) error {
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+	res := s.primary(ctx).Model(&sqlRecord{}).Where("idempotency_key = ? AND lock_token = ?", key, token).Updates(map[string]interface{}{
+		"status_code": resp.Status,
+		"header":      header,
+		"body":        resp.Body,
+		"expires_at":  time.Now().Add(ttl),
+	})
+	return ownedResult(res)
+}
+
+func (s *SQLStore) Release(ctx context.Context, key, token string) error {
+	return ownedResult(s.primary(ctx).Where("idempotency_key = ? AND lock_token = ?", key, token).Delete(&sqlRecord{}))
+}
+
+func ownedResult(res *gorm.DB) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotOwner
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// openSQLStore 打开 SQLite 文件作为主库并创建 idempotency_keys 表
+func openSQLStore(t *testing.T) (*SQLStore, *gorm.DB) {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, DBName: filepath.Join(t.TempDir(), "primary.db"), LogLevel: "silent"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	if err := db.AutoMigrate(&sqlRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLStore(db), db
+}
+
+// TestSQLStoreReadsFromPrimary 从库还没有同步到处理中的 key 时，第二个请求仍然要看到它
+func TestSQLStoreReadsFromPrimary(t *testing.T) {
+	store, db := openSQLStore(t)
+
+	// 一个空的从库，模拟复制延迟
+	replicaPath := filepath.Join(t.TempDir(), "replica.db")
+	replica, err := gorm.Open(sqlite.Open(replicaPath), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.AutoMigrate(&sqlRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := replica.DB()
+	sqlDB.Close()
+	if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: []gorm.Dialector{sqlite.Open(replicaPath)}})); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, token, err := store.Acquire(ctx, "k", "fp", time.Minute); err != nil || token == "" {
+		t.Fatalf("first acquire: %q, %v", token, err)
+	}
+	rec, token, err := store.Acquire(ctx, "k", "fp", time.Minute)
+	if err != nil || token != "" || rec == nil || rec.Response != nil {
+		t.Fatalf("second acquire = %+v, %q, %v; want the in-progress record", rec, token, err)
+	}
+}
+
+// TestSQLStoreTakeover 持有者超过 LockTTL 被接管后，不能覆盖或删除新持有者的记录
+func TestSQLStoreTakeover(t *testing.T) {
+	store, _ := openSQLStore(t)
+	ctx := context.Background()
+
+	_, stale, err := store.Acquire(ctx, "k", "fp", 10*time.Millisecond)
+	if err != nil || stale == "" {
+		t.Fatalf("first acquire: %q, %v", stale, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	_, current, err := store.Acquire(ctx, "k", "fp", time.Minute)
+	if err != nil || current == "" || current == stale {
+		t.Fatalf("takeover: %q, %v", current, err)
+	}
+
+	if err := store.Complete(ctx, "k", stale, Response{Status: 500}, time.Hour); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("stale Complete: err = %v, want ErrNotOwner", err)
+	}
+	if err := store.Release(ctx, "k", stale); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("stale Release: err = %v, want ErrNotOwner", err)
+	}
+	if rec, _, _ := store.Acquire(ctx, "k", "fp", time.Minute); rec == nil || rec.Response != nil {
+		t.Fatalf("record after stale writes = %+v, want still in progress", rec)
+	}
+
+	if err := store.Complete(ctx, "k", current, Response{Status: 201, Body: []byte("ok")}, time.Hour); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	rec, _, err := store.Acquire(ctx, "k", "fp", time.Minute)
+	if err != nil || rec == nil || rec.Response == nil || rec.Response.Status != 201 {
+		t.Fatalf("record = %+v, %v; want the new holder's response", rec, err)
+	}
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultMaxBodyBytes 调试日志中请求体 / 响应体的默认最大记录长度
+const DefaultMaxBodyBytes = 8 << 10
+
+// AccessConfig 是访问日志的采样和调试配置
+type AccessConfig struct {
+	// SampleRate 2xx/3xx 访问日志的默认采样率 (0~1)，0 表示只记录 4xx/5xx；4xx/5xx 和调试请求总是记录
+	SampleRate float64 `mapstructure:"SampleRate"`
+	// Routes 按 "METHOD 路由模板" 覆盖采样率，如 "GET /orders/:id": 0.1
+	Routes map[string]float64 `mapstructure:"Routes"`
+	// DebugTraceIDs 这些 trace 的请求额外记录脱敏后的请求头、请求体和响应体 (默认为空，即不记录任何请求体)
+	DebugTraceIDs []string `mapstructure:"DebugTraceIDs"`
+	// MaxBodyBytes 调试日志中请求体 / 响应体的最大记录长度，默认 8KiB
+	MaxBodyBytes int `mapstructure:"MaxBodyBytes"`
+}
+
+// DefaultAccessRoutes 默认不记录成功的探针和指标抓取请求 (每几秒一次，只有失败时有价值)
+func DefaultAccessRoutes() map[string]float64 {
+	return map[string]float64{"GET /livez": 0, "GET /readyz": 0, "GET /health": 0, "GET /metrics": 0}
+}
+
+// AccessPolicy 是 Init 生效后的访问日志策略，供 middleware.Logger 使用
+type AccessPolicy struct {
+	Redactor     *Redactor
+	MaxBodyBytes int
+
+	sampleRate float64
+	routes     map[string]float64
+	debug      map[string]bool
+}
+
+var access atomic.Pointer[AccessPolicy]
+
+func init() {
+	access.Store(NewAccessPolicy(AccessConfig{SampleRate: 1}, RedactConfig{}))
+}
+
+// NewAccessPolicy 预处理配置 (路由 key 不区分大小写，viper 读出的 map key 是小写)
+func NewAccessPolicy(cfg AccessConfig, redact RedactConfig) *AccessPolicy {
+	p := &AccessPolicy{
+		Redactor:     NewRedactor(redact),
+		MaxBodyBytes: cfg.MaxBodyBytes,
+		sampleRate:   cfg.SampleRate,
+		routes:       make(map[string]float64, len(cfg.Routes)),
+		debug:        make(map[string]bool, len(cfg.DebugTraceIDs)),
+	}
+	if p.MaxBodyBytes <= 0 {
+		p.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	for k, v := range cfg.Routes {
+		p.routes[accessRouteKey(k)] = v
+	}
+	for _, id := range cfg.DebugTraceIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			p.debug[id] = true
+		}
+	}
+	return p
+}
+
+// Access 返回当前的访问日志策略 (Init 之前为全量采样 + 内置脱敏规则)
+func Access() *AccessPolicy {
+	return access.Load()
+}
+
+// Debug 报告该 trace 是否开启了请求体记录
+func (p *AccessPolicy) Debug(traceID string) bool {
+	return traceID != "" && p.debug[traceID]
+}
+
+// Sampled 决定是否记录一条成功请求的访问日志
+// 有 trace ID 时按其哈希决定，同一条链路在各服务上的采样结果一致
+func (p *AccessPolicy) Sampled(method, route, traceID string) bool {
+	rate := p.sampleRate
+	if r, ok := p.routes[accessRouteKey(method+" "+route)]; ok {
+		rate = r
+	}
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	case traceID == "":
+		return rand.Float64() < rate
+	}
+	h := fnv.New64a()
+	h.Write([]byte(traceID))
+	return float64(h.Sum64()%10000) < rate*10000
+}
+
+func accessRouteKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
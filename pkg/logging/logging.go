@@ -0,0 +1,136 @@
+// Package logging 基于 log/slog 的结构化日志：JSON 输出、级别控制，以及放在 context 中的 logger
+// ctx 中的 logger 携带 service / trace_id / order_id 等字段，日志聚合时可以直接按订单或链路过滤
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"vv-ecommerce/pkg/common/apperror"
+)
+
+// 统一的字段名，各服务都用这些 key，聚合查询时才能跨服务过滤
+const (
+	KeyService = "service"
+	KeyTraceID = "trace_id"
+	KeyOrderID = "order_id"
+	KeyError   = "error"
+	KeyStack   = "stack"
+	// KeyComponent 区分同一服务内的模块 (db、mq、outbox 等)
+	KeyComponent = "component"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Config 是日志配置，各服务通过 mapstructure 直接嵌入
+type Config struct {
+	// Level 为 debug / info (默认) / warn / error
+	Level string `mapstructure:"Level"`
+	// Format 为 json (默认) / text (本地调试更易读)
+	Format string `mapstructure:"Format"`
+	// PanicFile 非空时，HTTP 请求中的 panic 额外以 JSON 行写入该文件 (本地开发代替错误追踪系统，见 middleware.FilePanicReporter)
+	PanicFile string `mapstructure:"PanicFile"`
+	// Redact 脱敏规则，在内置规则 (password、card_token、Authorization 等) 之上追加
+	Redact RedactConfig `mapstructure:"Redact"`
+	// Access 访问日志的按路由采样和按 trace 的请求体调试
+	Access AccessConfig `mapstructure:"Access"`
+}
+
+// Init 创建带 service 字段的 logger 并设为 slog 默认 logger
+// 标准库 log 的输出也会经由它输出，遗留的 log.Printf 同样是 JSON
+// 同时生效 Access / Redact 策略 (见 Access)
+func Init(service string, cfg Config) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatJSON:
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", cfg.Format)
+	}
+
+	logger := slog.New(handler).With(KeyService, service)
+	slog.SetDefault(logger)
+	access.Store(NewAccessPolicy(cfg.Access, cfg.Redact))
+	return logger, nil
+}
+
+// ParseLevel 解析日志级别，空字符串为 info
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
+
+type loggerKey struct{}
+
+// NewContext 把 logger 放入 ctx
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext 返回 ctx 中的 logger，没有时返回默认 logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With 在 ctx 的 logger 上追加字段，如 logging.With(ctx, logging.KeyOrderID, orderID)
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
+
+// Err 记录错误；AppError 输出完整的跨服务传播路径 (Chain)
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.String(KeyError, "")
+	}
+	if appErr, ok := apperror.As(err); ok {
+		return slog.String(KeyError, appErr.Chain())
+	}
+	return slog.String(KeyError, err.Error())
+}
+
+// Stack 记录当前 goroutine 的调用栈 (用于 panic 等必须定位代码位置的场景)
+func Stack() slog.Attr {
+	return slog.String(KeyStack, string(debug.Stack()))
+}
+
+// LevelForStatus 按 HTTP 状态码选择访问日志级别：5xx 为 error，4xx 为 warn，其余为 info
+func LevelForStatus(status int) slog.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return slog.LevelError
+	case status >= http.StatusBadRequest:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Fatal 以 error 级别记录后退出进程，替代 log.Fatalf (默认 logger 接管标准库 log 后，log.Fatalf 只会是 info 级别)
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,172 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultMask 是脱敏后的占位值
+const DefaultMask = "[REDACTED]"
+
+// 内置的脱敏规则，配置中的规则在此基础上追加 (不能通过配置关闭)
+var (
+	defaultRedactFields = []string{
+		"password", "token", "access_token", "refresh_token", "secret",
+		"card_number", "card_token", "cvv", "email", "phone", "address",
+	}
+	defaultRedactHeaders = []string{
+		"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-Api-Key",
+	}
+	defaultRedactQuery = []string{"token", "access_token", "email", "phone"}
+)
+
+// RedactConfig 是日志脱敏规则 (在内置规则之上追加)
+type RedactConfig struct {
+	// Fields JSON 字段：不带点的名字 (如 user_id) 匹配任意层级的同名字段；
+	// 带点的是从根开始的路径 (如 payment.card.last4)，* 匹配任意一个字段名，数组对路径透明
+	Fields []string `mapstructure:"Fields"`
+	// Headers 调试日志中需要屏蔽的请求 / 响应头
+	Headers []string `mapstructure:"Headers"`
+	// QueryParams 访问日志 path 中需要屏蔽的查询参数
+	QueryParams []string `mapstructure:"QueryParams"`
+	// Mask 替换值，默认 [REDACTED]
+	Mask string `mapstructure:"Mask"`
+}
+
+// Redactor 按 RedactConfig 屏蔽 JSON 字段、请求头和查询参数，字段名与参数名都不区分大小写
+type Redactor struct {
+	names   map[string]bool // 任意层级匹配的字段名
+	paths   [][]string      // 从根开始的路径
+	headers map[string]bool
+	query   map[string]bool
+	mask    string
+}
+
+func NewRedactor(cfg RedactConfig) *Redactor {
+	r := &Redactor{
+		names:   map[string]bool{},
+		headers: map[string]bool{},
+		query:   map[string]bool{},
+		mask:    cfg.Mask,
+	}
+	if r.mask == "" {
+		r.mask = DefaultMask
+	}
+	for _, f := range append(append([]string{}, defaultRedactFields...), cfg.Fields...) {
+		f = strings.ToLower(strings.TrimSpace(f))
+		switch {
+		case f == "":
+		case strings.Contains(f, "."):
+			r.paths = append(r.paths, strings.Split(f, "."))
+		default:
+			r.names[f] = true
+		}
+	}
+	for _, h := range append(append([]string{}, defaultRedactHeaders...), cfg.Headers...) {
+		r.headers[http.CanonicalHeaderKey(strings.TrimSpace(h))] = true
+	}
+	for _, q := range append(append([]string{}, defaultRedactQuery...), cfg.QueryParams...) {
+		r.query[strings.ToLower(strings.TrimSpace(q))] = true
+	}
+	return r
+}
+
+// JSON 返回脱敏后的 JSON；body 不是 JSON 时返回 false，调用方不应记录原文
+func (r *Redactor) JSON(body []byte) ([]byte, bool) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body, true
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber() // 金额等数字原样输出
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	out, err := json.Marshal(r.walk(v, nil))
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func (r *Redactor) walk(v interface{}, path []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			p := append(path[:len(path):len(path)], strings.ToLower(k))
+			if r.match(p) {
+				t[k] = r.mask
+				continue
+			}
+			t[k] = r.walk(child, p)
+		}
+		return t
+	case []interface{}:
+		for i, child := range t {
+			t[i] = r.walk(child, path)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) match(path []string) bool {
+	if r.names[path[len(path)-1]] {
+		return true
+	}
+	for _, rule := range r.paths {
+		if len(rule) != len(path) {
+			continue
+		}
+		ok := true
+		for i := range rule {
+			if rule[i] != "*" && rule[i] != path[i] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers 返回屏蔽后的请求头 (多个值以逗号连接)
+func (r *Redactor) Headers(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			out[k] = r.mask
+		} else {
+			out[k] = strings.Join(v, ", ")
+		}
+	}
+	return out
+}
+
+// Query 屏蔽查询字符串中的敏感参数；无法解析时整体屏蔽
+func (r *Redactor) Query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return r.mask
+	}
+	changed := false
+	for k := range values {
+		if r.query[strings.ToLower(k)] {
+			values[k] = []string{r.mask}
+			changed = true
+		}
+	}
+	if !changed {
+		return rawQuery
+	}
+	return values.Encode()
+}
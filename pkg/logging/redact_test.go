@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRedactorJSON(t *testing.T) {
+	r := NewRedactor(RedactConfig{Fields: []string{"user_id", "payment.card.last4", "items.note", "*.internal"}})
+	for _, tc := range []struct {
+		name, body, want string
+	}{
+		{name: "built-in fields", body: `{"email":"a@b.c","password":"p","amount":12.50}`, want: `{"amount":12.50,"email":"[REDACTED]","password":"[REDACTED]"}`},
+		{name: "case insensitive", body: `{"Password":"p","TOKEN":"t"}`, want: `{"Password":"[REDACTED]","TOKEN":"[REDACTED]"}`},
+		{name: "configured name at any depth", body: `{"user_id":7,"order":{"user_id":7,"id":"o-1"}}`, want: `{"order":{"id":"o-1","user_id":"[REDACTED]"},"user_id":"[REDACTED]"}`},
+		{name: "nested object is replaced as a whole", body: `{"address":{"city":"x","zip":"1"}}`, want: `{"address":"[REDACTED]"}`},
+		{name: "arrays", body: `[{"phone":"1"},{"phone":"2","sku":"S1"}]`, want: `[{"phone":"[REDACTED]"},{"phone":"[REDACTED]","sku":"S1"}]`},
+		{name: "path from the root", body: `{"payment":{"card":{"last4":"4242","brand":"visa"}},"card":{"last4":"1111"}}`, want: `{"card":{"last4":"1111"},"payment":{"card":{"brand":"visa","last4":"[REDACTED]"}}}`},
+		{name: "arrays are transparent to paths", body: `{"items":[{"note":"n1","sku":"S1"},{"note":"n2"}]}`, want: `{"items":[{"note":"[REDACTED]","sku":"S1"},{"note":"[REDACTED]"}]}`},
+		{name: "wildcard matches one field name", body: `{"internal":"i","order":{"internal":"i"},"a":{"b":{"internal":"i"}}}`, want: `{"a":{"b":{"internal":"i"}},"internal":"i","order":{"internal":"[REDACTED]"}}`},
+		{name: "large numbers keep their precision", body: `{"id":12345678901234567890}`, want: `{"id":12345678901234567890}`},
+		{name: "empty", body: ` `, want: ` `},
+	} {
+		got, ok := r.JSON([]byte(tc.body))
+		if !ok || string(got) != tc.want {
+			t.Errorf("%s: JSON = %s, %v; want %s", tc.name, got, ok, tc.want)
+		}
+	}
+}
+
+// TestRedactorJSONRejectsNonJSON 不是 JSON 时不返回原文，调用方只记录长度
+func TestRedactorJSONRejectsNonJSON(t *testing.T) {
+	r := NewRedactor(RedactConfig{})
+	for _, body := range []string{
+		`password=p&email=a@b.c`,
+		`{"password":"p"`,
+		`<xml><password>p</password></xml>`,
+	} {
+		if got, ok := r.JSON([]byte(body)); ok || got != nil {
+			t.Errorf("JSON(%q) = %q, %v; want nothing", body, got, ok)
+		}
+	}
+}
+
+func TestRedactorHeaders(t *testing.T) {
+	r := NewRedactor(RedactConfig{Headers: []string{"x-internal-token"}, Mask: "***"})
+	got := r.Headers(http.Header{
+		"Authorization":    {"Bearer abc"},
+		"Cookie":           {"session=1", "theme=dark"},
+		"Set-Cookie":       {"session=2"},
+		"X-Internal-Token": {"t"},
+		"Accept":           {"text/html", "application/json"},
+		"X-Trace-Id":       {"trace-1"},
+	})
+	want := map[string]string{
+		"Authorization":    "***",
+		"Cookie":           "***",
+		"Set-Cookie":       "***",
+		"X-Internal-Token": "***",
+		"Accept":           "text/html, application/json",
+		"X-Trace-Id":       "trace-1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Headers = %v, want %v", got, want)
+	}
+}
+
+func TestRedactorQuery(t *testing.T) {
+	r := NewRedactor(RedactConfig{QueryParams: []string{"code"}})
+	for _, tc := range []struct {
+		raw  string
+		want url.Values
+	}{
+		{raw: "order_id=o-1&limit=20", want: url.Values{"order_id": {"o-1"}, "limit": {"20"}}},
+		{raw: "access_token=abc&order_id=o-1", want: url.Values{"access_token": {DefaultMask}, "order_id": {"o-1"}}},
+		{raw: "Token=a&token=b&EMAIL=x%40y.z", want: url.Values{"Token": {DefaultMask}, "token": {DefaultMask}, "EMAIL": {DefaultMask}}},
+		{raw: "code=123&code=456", want: url.Values{"code": {DefaultMask}}},
+	} {
+		got, err := url.ParseQuery(r.Query(tc.raw))
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Query(%q) = %v, %v; want %v", tc.raw, got, err, tc.want)
+		}
+	}
+	// 无法解析时整体屏蔽，不能把原文写进日志
+	if got := r.Query("token=abc%zz"); got != DefaultMask {
+		t.Errorf("Query of an invalid query = %q", got)
+	}
+	if got := r.Query(""); got != "" {
+		t.Errorf("Query of an empty query = %q", got)
+	}
+}
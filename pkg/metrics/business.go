@@ -0,0 +1,55 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// 订单失败阶段 (OrdersFailed 的 stage 标签)
+const (
+	StageInventory   = "inventory"
+	StagePayment     = "payment"
+	StagePersistence = "persistence"
+)
+
+// 补偿动作 (OrdersCompensated 的 action 标签)
+const (
+	ActionInventoryRollback = "inventory_rollback"
+	ActionPaymentRefund     = "payment_refund"
+)
+
+// Saga 结果与业务计数，各服务只会递增自己负责的部分
+var (
+	OrdersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders persisted by order-service.",
+	})
+
+	OrdersFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_failed_total",
+		Help: "Orders that failed, by the saga stage that failed.",
+	}, []string{"stage"})
+
+	OrdersCompensated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_compensated_total",
+		Help: "Compensating actions completed for failed orders.",
+	}, []string{"action"})
+
+	PaymentsDeclined = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "payments_declined_total",
+		Help: "Payments rejected by the payment gateway.",
+	})
+
+	Stockouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "inventory_stockouts_total",
+		Help: "Inventory decreases rejected for insufficient stock, by SKU.",
+	}, []string{"sku"})
+)
+
+// OrderEventStreams order-service 当前打开的订单状态推送连接 (SSE)
+var OrderEventStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "order_event_streams",
+	Help: "Open order status event streams (SSE) on this order-service instance.",
+})
+
+func init() {
+	MustRegister(OrdersCreated, OrdersFailed, OrdersCompensated, PaymentsDeclined, Stockouts)
+	MustRegister(OrderEventStreams)
+}
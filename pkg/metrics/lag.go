@@ -0,0 +1,35 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var consumerLagDesc = prometheus.NewDesc("mq_consumer_lag_messages",
+	"Messages published to a subscribed topic that have not been processed yet.", []string{"topic"}, nil)
+
+// LagSource 由能报告积压的消息队列实现 (async.MemoryQueue / async.RabbitMQ)
+type LagSource interface {
+	ConsumerLag() (map[string]int, error)
+}
+
+// ConsumerLagCollector 在每次抓取时读取各订阅 topic 的积压消息数
+type ConsumerLagCollector struct {
+	source LagSource
+}
+
+func NewConsumerLagCollector(source LagSource) *ConsumerLagCollector {
+	return &ConsumerLagCollector{source: source}
+}
+
+func (c *ConsumerLagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- consumerLagDesc
+}
+
+func (c *ConsumerLagCollector) Collect(ch chan<- prometheus.Metric) {
+	lag, err := c.source.ConsumerLag()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(consumerLagDesc, err)
+		return
+	}
+	for topic, n := range lag {
+		ch <- prometheus.MustNewConstMetric(consumerLagDesc, prometheus.GaugeValue, float64(n), topic)
+	}
+}
@@ -0,0 +1,113 @@
+// Package metrics 定义各服务共用的 Prometheus 指标，全部注册到默认 registry，由 Handler 在 /metrics 暴露
+// (pkg/database 的 SQL 指标也在默认 registry 中)
+package metrics
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"vv-ecommerce/pkg/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// RED 指标：按路由模板 (如 /orders/:id) 统计，避免 path 参数导致标签基数爆炸
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	HTTPInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+)
+
+// 过载保护 (middleware.LoadShed / middleware.Timeout)
+var (
+	HTTPConcurrencyLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_concurrency_limit",
+		Help: "Current adaptive concurrency limit; requests above it are shed.",
+	})
+
+	HTTPShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_requests_shed_total",
+		Help: "Requests rejected with 503 because the concurrency limit was reached.",
+	})
+
+	HTTPTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_request_timeouts_total",
+		Help: "Requests whose deadline expired before the handler finished, by route.",
+	}, []string{"method", "route"})
+)
+
+// 限流 (middleware.RateLimit)
+var (
+	HTTPRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_rate_limited_total",
+		Help: "Requests rejected with 429, by route and the dimension (ip/user/apikey) whose quota ran out.",
+	}, []string{"method", "route", "dimension"})
+
+	RateLimitDegraded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ratelimit_degraded",
+		Help: "1 while the shared rate limit store is unavailable and per-instance in-memory limits are used.",
+	})
+)
+
+// HTTPCache 网关响应缓存的查找结果：hit / miss / coalesced (等待同一个 key 的未命中) / bypass
+var HTTPCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_cache_requests_total",
+	Help: "Gateway response cache lookups by route and result (hit, miss, coalesced, bypass).",
+}, []string{"route", "result"})
+
+// 网关到上游 (api-gateway internal/upstream)
+var (
+	// UpstreamRetries result 为 retried，或者重试预算用完后放弃的 budget_exhausted；reason 为 connect / timeout / error / 502 / 503 / 504
+	UpstreamRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_retries_total",
+		Help: "Failed upstream attempts the gateway retried or gave up on because the retry budget was exhausted.",
+	}, []string{"upstream", "reason", "result"})
+
+	UpstreamEjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_ejections_total",
+		Help: "Upstream instances ejected from load balancing by outlier detection.",
+	}, []string{"upstream", "instance"})
+)
+
+// Panics 被 middleware.Recovery 捕获的 panic
+var Panics = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_panics_total",
+	Help: "Panics recovered while handling HTTP requests, by route.",
+}, []string{"method", "route"})
+
+func init() {
+	MustRegister(HTTPRequests, HTTPDuration, HTTPInFlight)
+	MustRegister(HTTPConcurrencyLimit, HTTPShed, HTTPTimeouts, Panics)
+	MustRegister(HTTPRateLimited, RateLimitDegraded, HTTPCache)
+	MustRegister(UpstreamRetries, UpstreamEjections)
+}
+
+// MustRegister 注册到默认 registry；重复注册时忽略，其他错误只记录日志，指标问题不应该让服务起不来
+func MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := prometheus.Register(c); err != nil {
+			var are prometheus.AlreadyRegisteredError
+			if !errors.As(err, &are) {
+				slog.Error("failed to register metrics collector", logging.KeyComponent, "metrics", logging.Err(err))
+			}
+		}
+	}
+}
+
+// Handler 返回 /metrics 的 HTTP handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const outboxQueryTimeout = 2 * time.Second
+
+var (
+	outboxPendingDesc = prometheus.NewDesc("outbox_pending_events",
+		"Outbox events waiting to be published.", nil, nil)
+	outboxOldestDesc = prometheus.NewDesc("outbox_oldest_pending_age_seconds",
+		"Age of the oldest unpublished outbox event (0 when none are pending).", nil, nil)
+)
+
+// OutboxCollector 在每次抓取时查询 outbox 表，得到积压数量和最老事件的等待时间
+// 发布落后 (MQ 不可用、处理器卡住) 时，oldest age 会持续上涨
+type OutboxCollector struct {
+	db      *gorm.DB
+	table   string
+	pending string
+}
+
+// NewOutboxCollector table 为 outbox 表名，pending 为待发布状态的值 (如 "PENDING")
+func NewOutboxCollector(db *gorm.DB, table, pending string) *OutboxCollector {
+	return &OutboxCollector{db: db, table: table, pending: pending}
+}
+
+func (c *OutboxCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- outboxPendingDesc
+	ch <- outboxOldestDesc
+}
+
+func (c *OutboxCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxQueryTimeout)
+	defer cancel()
+	db := c.db.WithContext(ctx).Table(c.table).Where("status = ?", c.pending)
+
+	var count int64
+	if err := db.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		ch <- prometheus.NewInvalidMetric(outboxPendingDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(outboxPendingDesc, prometheus.GaugeValue, float64(count))
+
+	// 直接读列而不是 MIN(created_at)：聚合结果在 SQLite 中是字符串，无法扫描为 time.Time
+	var oldest []time.Time
+	if err := db.Session(&gorm.Session{}).Order("created_at").Limit(1).Pluck("created_at", &oldest).Error; err != nil {
+		ch <- prometheus.NewInvalidMetric(outboxOldestDesc, err)
+		return
+	}
+	age := 0.0
+	if len(oldest) > 0 {
+		age = time.Since(oldest[0]).Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(outboxOldestDesc, prometheus.GaugeValue, age)
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/database/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 由网关在认证 (JWT) 后注入的身份头；网关会删除客户端自带的同名头，下游服务可以直接信任
+const (
+	// UserIDHeader 标识发起请求的用户
+	UserIDHeader = "X-User-ID"
+	// UserRolesHeader 用户角色，逗号分隔
+	UserRolesHeader = "X-User-Roles"
+)
+
+// AdminRole 可以查看所有用户的数据
+const AdminRole = "admin"
+
+// UserID 返回网关注入的用户 ID，缺失或无效时返回 Unauthorized
+func UserID(c *gin.Context) (int64, error) {
+	userID, err := strconv.ParseInt(c.GetHeader(UserIDHeader), 10, 64)
+	if err != nil || userID <= 0 {
+		return 0, apperror.Unauthorized("missing or invalid authenticated user", err)
+	}
+	return userID, nil
+}
+
+// IsAdmin 判断当前用户是否有 admin 角色
+func IsAdmin(c *gin.Context) bool {
+	return slices.Contains(strings.Split(c.GetHeader(UserRolesHeader), ","), AdminRole)
+}
+
+// OwnerFilter 返回查询时限定数据归属的用户 ID：管理员返回 0 (不限制)，其他用户返回自己的 ID。
+// 看不到的数据按不存在处理，不暴露它是否存在
+func OwnerFilter(c *gin.Context) (int64, error) {
+	userID, err := UserID(c)
+	if err != nil {
+		return 0, err
+	}
+	if IsAdmin(c) {
+		return 0, nil
+	}
+	return userID, nil
+}
+
+// Actor 把请求的用户和 TraceID 写入 request context，供审计插件记录 created_by / updated_by
+// 需要注册在 TraceID 之后
+func Actor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := audit.WithActor(c.Request.Context(), audit.Actor{
+			ID:      c.GetHeader(UserIDHeader),
+			TraceID: GetTraceID(c),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimit 限制请求体大小，maxBytes <= 0 表示不限制
+// Content-Length 超限直接返回 413；没有 Content-Length (chunked) 的请求读到上限后报错，由 handler 的参数绑定返回 400
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > maxBytes {
+			response.Error(c, apperror.PayloadTooLarge(fmt.Sprintf("request body exceeds %d bytes", maxBytes), nil))
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/idempotency"
+	"vv-ecommerce/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader 标记响应是重放的
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+	// idempotencyPollInterval 同一个 key 的请求正在处理时，轮询其结果的间隔
+	idempotencyPollInterval = 50 * time.Millisecond
+)
+
+// replayedHeaders 重放时恢复的响应头
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Idempotency 处理带 Idempotency-Key 头的请求 (没有该头的请求直接放行)：
+//   - 第一个请求正常执行，保存最终状态码和响应体；5xx 不保存，重试会重新执行
+//   - 相同 key + 相同请求的重试直接重放保存的响应 (Idempotent-Replayed: true)
+//   - 相同 key 但请求体不同返回 409
+//   - 并发的相同 key 请求等待第一个完成后重放，直到请求 deadline
+//
+// key 按用户 (X-User-ID) 和路由隔离；需要注册在 BodyLimit / Timeout 之后
+func Idempotency(store idempotency.Store, cfg idempotency.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			abortWithError(c, apperror.InvalidInput("Idempotency-Key is too long", nil))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				abortWithError(c, apperror.PayloadTooLarge("request body is too large", err))
+			} else {
+				abortWithError(c, apperror.InvalidInput("failed to read request body", err))
+			}
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		storeKey := hash(c.GetHeader(UserIDHeader), c.Request.Method, c.FullPath(), key)
+		fingerprint := hash(c.Request.Method, c.Request.URL.RequestURI(), string(body))
+
+		ctx := c.Request.Context()
+		var token string // 占用 key 后由 Acquire 返回，保存或释放时用它证明仍是持有者
+		for {
+			var rec *idempotency.Record
+			rec, token, err = store.Acquire(ctx, storeKey, fingerprint, cfg.LockTTL)
+			if err != nil {
+				abortWithError(c, apperror.ServiceUnavailable("idempotency store unavailable", err))
+				return
+			}
+			if token != "" {
+				break
+			}
+			if rec.Fingerprint != fingerprint {
+				abortWithError(c, apperror.Conflict("Idempotency-Key was already used with a different request", nil))
+				return
+			}
+			if rec.Response != nil {
+				replay(c, rec.Response)
+				return
+			}
+			if err := wait(ctx, idempotencyPollInterval); err != nil {
+				abortWithError(c, apperror.Conflict("a request with the same Idempotency-Key is still in progress", err))
+				return
+			}
+		}
+
+		// 保存结果不受请求 deadline 影响，否则超时的请求会一直占着 key 直到 LockTTL
+		storeCtx := context.WithoutCancel(ctx)
+		defer func() {
+			if rec := recover(); rec != nil {
+				release(storeCtx, store, storeKey, token)
+				panic(rec)
+			}
+		}()
+
+		rw := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = rw
+		c.Next()
+
+		status := rw.Status()
+		if status >= http.StatusInternalServerError {
+			release(storeCtx, store, storeKey, token)
+			return
+		}
+		resp := idempotency.Response{Status: status, Header: map[string]string{}, Body: rw.body.Bytes()}
+		for _, h := range replayedHeaders {
+			if v := rw.Header().Get(h); v != "" {
+				resp.Header[h] = v
+			}
+		}
+		if err := store.Complete(storeCtx, storeKey, token, resp, cfg.TTL); err != nil {
+			if errors.Is(err, idempotency.ErrNotOwner) {
+				// 处理超过了 LockTTL，key 已被重试接管，保存结果的是新的持有者
+				logging.FromContext(ctx).WarnContext(ctx, "idempotency key was taken over before the response was saved")
+				return
+			}
+			// 响应已经发出；保存失败时释放 key，重试会重新执行 (由业务层的唯一约束兜底)
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to save idempotent response", logging.Err(err))
+			release(storeCtx, store, storeKey, token)
+		}
+	}
+}
+
+func replay(c *gin.Context, resp *idempotency.Response) {
+	for k, v := range resp.Header {
+		c.Header(k, v)
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Status(resp.Status)
+	c.Writer.Write(resp.Body)
+	c.Abort()
+}
+
+func release(ctx context.Context, store idempotency.Store, key, token string) {
+	if err := store.Release(ctx, key, token); err != nil && !errors.Is(err, idempotency.ErrNotOwner) {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to release idempotency key", logging.Err(err))
+	}
+}
+
+func abortWithError(c *gin.Context, err error) {
+	response.Error(c, err)
+	c.Abort()
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// bodyRecorder 在写出响应的同时保留一份响应体
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoadShedConfig 是自适应并发限制配置
+type LoadShedConfig struct {
+	// InitialLimit 初始并发上限
+	InitialLimit int `mapstructure:"InitialLimit"`
+	// MinLimit / MaxLimit 上限的调整范围；MaxLimit 为 0 时不做限流
+	MinLimit int `mapstructure:"MinLimit"`
+	MaxLimit int `mapstructure:"MaxLimit"`
+	// LatencyTarget 请求耗时超过它 (或超时、返回 503/504) 视为过载信号，上限乘性减小
+	LatencyTarget time.Duration `mapstructure:"LatencyTarget"`
+	// RetryAfter 被拒绝时返回给客户端的 Retry-After
+	RetryAfter time.Duration `mapstructure:"RetryAfter"`
+}
+
+// backoffRatio 每个过载信号把上限乘以该比例
+const backoffRatio = 0.9
+
+// LoadShed 按 AIMD 调整并发上限：正常完成的请求让上限缓慢增长 (每轮 +1)，过载信号让上限乘性减小
+// 超过上限的请求立即返回 503 + Retry-After，而不是排队把延迟拖垮
+func LoadShed(cfg LoadShedConfig) gin.HandlerFunc {
+	if cfg.MaxLimit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	l := newAIMDLimiter(cfg)
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(cfg.RetryAfter.Seconds()))))
+
+	return func(c *gin.Context) {
+		if !l.acquire() {
+			metrics.HTTPShed.Inc()
+			c.Header("Retry-After", retryAfter)
+			response.Error(c, apperror.ServiceUnavailable("server overloaded, retry later", nil))
+			c.Abort()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		overloaded := time.Since(start) > cfg.LatencyTarget ||
+			status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout ||
+			errors.Is(c.Request.Context().Err(), context.DeadlineExceeded)
+		l.release(overloaded)
+	}
+}
+
+type aimdLimiter struct {
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	min, max float64
+}
+
+func newAIMDLimiter(cfg LoadShedConfig) *aimdLimiter {
+	l := &aimdLimiter{
+		limit: float64(cfg.InitialLimit),
+		min:   float64(max(cfg.MinLimit, 1)),
+		max:   float64(cfg.MaxLimit),
+	}
+	l.limit = math.Min(math.Max(l.limit, l.min), l.max)
+	metrics.HTTPConcurrencyLimit.Set(l.limit)
+	return l
+}
+
+func (l *aimdLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight >= int(l.limit) {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+func (l *aimdLimiter) release(overloaded bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// 只有接近上限时才增长，空闲时上限不会无限上涨
+	busy := float64(l.inflight)*2 >= l.limit
+	l.inflight--
+
+	switch {
+	case overloaded:
+		l.limit = math.Max(l.min, l.limit*backoffRatio)
+	case busy:
+		l.limit = math.Min(l.max, l.limit+1/l.limit)
+	default:
+		return
+	}
+	metrics.HTTPConcurrencyLimit.Set(l.limit)
+}
@@ -1,35 +1,123 @@
 package middleware
 
 import (
-	"log"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
 	"time"
+	"vv-ecommerce/pkg/logging"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Logger middleware logs request details with TraceID
+// Logger middleware writes one structured access log per request
+// 使用请求 ctx 中的 logger，自动带上 service / trace_id；需要注册在 TraceID 之后
+//   - query 中的敏感参数按 logging.Config.Redact 屏蔽
+//   - 2xx/3xx 按 logging.Config.Access 的路由采样率记录，4xx/5xx 总是记录
+//   - trace ID 在 Access.DebugTraceIDs 中的请求额外记录脱敏后的请求头、请求体和响应体
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
-		path := c.Request.URL.Path
-		raw := c.Request.URL.RawQuery
+		policy := logging.Access()
+		traceID := GetTraceID(c)
+
+		var reqBody []byte
+		var rw *limitedRecorder
+		debug := policy.Debug(traceID)
+		if debug {
+			reqBody = peekBody(c, policy.MaxBodyBytes)
+			rw = &limitedRecorder{ResponseWriter: c.Writer, limit: policy.MaxBodyBytes}
+			c.Writer = rw
+		}
 
 		c.Next()
 
-		traceID := GetTraceID(c)
-		latency := time.Since(start)
+		status := c.Writer.Status()
+		if status < 400 && !debug && !policy.Sampled(c.Request.Method, c.FullPath(), traceID) {
+			return
+		}
 
-		if raw != "" {
+		path := c.Request.URL.Path
+		if raw := policy.Redactor.Query(c.Request.URL.RawQuery); raw != "" {
 			path = path + "?" + raw
 		}
 
-		log.Printf("[HTTP] %s | %3d | %13v | %-7s | %s | TraceID: %s",
-			start.Format("2006/01/02 - 15:04:05"),
-			c.Writer.Status(),
-			latency,
-			c.Request.Method,
-			path,
-			traceID,
-		)
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String(logging.KeyError, c.Errors.String()))
+		}
+		if debug {
+			attrs = append(attrs,
+				slog.Any("request_headers", policy.Redactor.Headers(c.Request.Header)),
+				slog.String("request_body", redactBody(policy.Redactor, reqBody, c.Request.Header.Get("Content-Type"), policy.MaxBodyBytes)),
+				slog.Any("response_headers", policy.Redactor.Headers(rw.Header())),
+				slog.String("response_body", redactBody(policy.Redactor, rw.body.Bytes(), rw.Header().Get("Content-Type"), policy.MaxBodyBytes)),
+			)
+		}
+
+		ctx := c.Request.Context()
+		logging.FromContext(ctx).LogAttrs(ctx, logging.LevelForStatus(status), "http request", attrs...)
+	}
+}
+
+// peekBody 读取请求体的前 limit+1 字节用于记录，并把读过的部分放回，不影响后续 BodyLimit / handler
+func peekBody(c *gin.Context, limit int) []byte {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return nil
+	}
+	buf, _ := io.ReadAll(io.LimitReader(c.Request.Body, int64(limit)+1))
+	c.Request.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(buf), c.Request.Body), Closer: c.Request.Body}
+	return buf
+}
+
+// redactBody 只记录能解析的 JSON (脱敏后)；被截断或非 JSON 的请求体只记录长度和类型，避免原文泄露
+func redactBody(r *logging.Redactor, body []byte, contentType string, limit int) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) <= limit && strings.Contains(contentType, "json") {
+		if out, ok := r.JSON(body); ok {
+			return string(out)
+		}
+	}
+	if len(body) > limit {
+		return fmt.Sprintf("[omitted: more than %d bytes of %q]", limit, contentType)
+	}
+	return fmt.Sprintf("[omitted: %d bytes of %q]", len(body), contentType)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedRecorder 在写出响应的同时最多保留 limit+1 字节响应体 (多出的 1 字节用于判断是否截断)
+type limitedRecorder struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+}
+
+func (w *limitedRecorder) Write(b []byte) (int, error) {
+	if room := w.limit + 1 - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(len(b), room)])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *limitedRecorder) WriteString(s string) (int, error) {
+	if room := w.limit + 1 - w.body.Len(); room > 0 {
+		w.body.WriteString(s[:min(len(s), room)])
 	}
+	return w.ResponseWriter.WriteString(s)
 }
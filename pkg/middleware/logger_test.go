@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+	"vv-ecommerce/pkg/logging"
+)
+
+// TestRedactBodyNeverLogsRawBodies 只有能解析的 JSON 才以脱敏后的形式记录，其余只记录长度和类型
+func TestRedactBodyNeverLogsRawBodies(t *testing.T) {
+	r := logging.NewRedactor(logging.RedactConfig{})
+	for _, tc := range []struct {
+		name, body, contentType string
+		limit                   int
+		want                    string
+	}{
+		{name: "json", body: `{"password":"hunter2","sku":"S1"}`, contentType: "application/json", limit: 100, want: `{"password":"[REDACTED]","sku":"S1"}`},
+		{name: "form", body: "password=hunter2", contentType: "application/x-www-form-urlencoded", limit: 100, want: `[omitted: 16 bytes of "application/x-www-form-urlencoded"]`},
+		{name: "invalid json", body: `{"password":"hunter2"`, contentType: "application/json", limit: 100, want: `[omitted: 21 bytes of "application/json"]`},
+		{name: "json without a content type", body: `{"password":"hunter2"}`, contentType: "", limit: 100, want: `[omitted: 22 bytes of ""]`},
+		// 截断后的 JSON 无法解析，脱敏规则可能漏掉被截断的字段
+		{name: "truncated json", body: `{"sku":"S1","password":"hunter2"}`, contentType: "application/json", limit: 10, want: `[omitted: more than 10 bytes of "application/json"]`},
+		{name: "empty", body: "", contentType: "application/json", limit: 100, want: ""},
+	} {
+		got := redactBody(r, []byte(tc.body), tc.contentType, tc.limit)
+		if got != tc.want || strings.Contains(got, "hunter2") {
+			t.Errorf("%s: redactBody = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
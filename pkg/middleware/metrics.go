@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+	"vv-ecommerce/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute 是未命中任何路由 (404) 的请求的 route 标签，避免把任意 path 写进标签
+const unmatchedRoute = "unmatched"
+
+// Metrics middleware records RED metrics (rate, errors, duration) per route template
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.HTTPInFlight.Inc()
+		defer metrics.HTTPInFlight.Dec()
+
+		c.Next()
+
+		route := routeLabel(c)
+		method := c.Request.Method
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// routeLabel 返回指标用的路由模板
+func routeLabel(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return unmatchedRoute
+}
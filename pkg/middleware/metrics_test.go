@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"vv-ecommerce/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scrape 请求 metrics.Handler，返回文本格式的全部指标
+func scrape(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(metrics.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetricsExportRouteTemplates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Metrics())
+	r.GET("/orders/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/orders/:id/cancel", func(c *gin.Context) { c.Status(http.StatusConflict) })
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/orders/ord-5f3a91", nil),
+		httptest.NewRequest(http.MethodPost, "/orders/ord-77c2e0/cancel", nil),
+		httptest.NewRequest(http.MethodGet, "/no/such/path-d41d8c", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrape(t)
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/orders/:id",status="200"} `,
+		`http_requests_total{method="POST",route="/orders/:id/cancel",status="409"} `,
+		`http_requests_total{method="GET",route="unmatched",status="404"} `,
+		`http_request_duration_seconds_bucket{method="GET",route="/orders/:id",le="0.005"} `,
+		`http_request_duration_seconds_count{method="GET",route="/orders/:id"} `,
+		"# TYPE http_requests_in_flight gauge",
+		"# TYPE orders_created_total counter",
+		"# TYPE payments_declined_total counter",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape is missing %q", want)
+		}
+	}
+	// 原始 path 和其中的 ID 不能出现在任何标签中
+	for _, unbounded := range []string{"ord-5f3a91", "ord-77c2e0", "path-d41d8c", "/no/such"} {
+		if strings.Contains(body, unbounded) {
+			t.Errorf("scrape contains unbounded label value %q", unbounded)
+		}
+	}
+}
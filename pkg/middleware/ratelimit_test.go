@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/ratelimit"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRateLimitRejectsWithRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := miniredis.RunT(t)
+	m.SetTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := RateLimitConfig{
+		Default: map[string]ratelimit.Quota{
+			ratelimit.DimensionIP:   {Limit: 10, Period: time.Minute},
+			ratelimit.DimensionUser: {Limit: 2, Period: time.Minute},
+		},
+	}
+	r := gin.New()
+	r.Use(RateLimit(ratelimit.NewRedisLimiter(client, "ratelimit:"), cfg, func(c *gin.Context) string {
+		return c.GetHeader(UserIDHeader)
+	}))
+	r.GET("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set(UserIDHeader, userID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := do("7")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, w.Code)
+		}
+		// 剩余最少的是用户维度的桶
+		if got := w.Header().Get("RateLimit-Remaining"); got != []string{"1", "0"}[i] {
+			t.Fatalf("request %d: RateLimit-Remaining = %q", i, got)
+		}
+	}
+
+	w := do("7")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	// 每 30s 补充一个令牌
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("Retry-After = %q, want 30", got)
+	}
+	if got := w.Header().Get("RateLimit-Policy"); got != "2;w=60" {
+		t.Fatalf("RateLimit-Policy = %q", got)
+	}
+	if !strings.Contains(w.Body.String(), "user quota") {
+		t.Fatalf("body = %s", w.Body.String())
+	}
+
+	// 其他用户有自己的桶
+	if w := do("8"); w.Code != http.StatusOK {
+		t.Fatalf("another user: status %d", w.Code)
+	}
+}
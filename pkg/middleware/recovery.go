@@ -1,22 +1,131 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Recovery middleware recovers from panics and logs with TraceID
+// PanicReport 描述一次被 Recovery 捕获的 panic
+type PanicReport struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	TraceID string    `json:"trace_id"`
+	Method  string    `json:"method"`
+	Route   string    `json:"route"`
+	Path    string    `json:"path"`
+	Value   string    `json:"panic"`
+	Stack   string    `json:"stack"`
+}
+
+// PanicReporter 把 panic 转发到错误追踪系统 (Sentry 等)，由 RegisterPanicReporter 注册
+// 在请求 goroutine 中同步调用，耗时操作应自行异步处理
+type PanicReporter func(ctx context.Context, report PanicReport)
+
+var (
+	reportersMu sync.RWMutex
+	reporters   []PanicReporter
+)
+
+// RegisterPanicReporter 注册 panic reporter，对进程内所有 Recovery 生效 (与 apperror.SetServiceName 一样在启动时调用)
+func RegisterPanicReporter(r PanicReporter) {
+	reportersMu.Lock()
+	defer reportersMu.Unlock()
+	reporters = append(reporters, r)
+}
+
+// Recovery middleware recovers from panics: logs them with TraceID and stack, counts them,
+// forwards them to the registered reporters, and responds with the standard ErrorResponse
 func Recovery() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				traceID := GetTraceID(c)
-				log.Printf("[PANIC] TraceID: %s | Error: %v", traceID, err)
-				c.AbortWithStatus(http.StatusInternalServerError)
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// ReverseProxy 等用 ErrAbortHandler 主动中断连接，不是程序错误
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
 			}
+
+			ctx := c.Request.Context()
+			report := PanicReport{
+				Time:    time.Now(),
+				Service: apperror.ServiceName(),
+				TraceID: c.GetString(TraceIDKey),
+				Method:  c.Request.Method,
+				Route:   c.FullPath(),
+				Path:    c.Request.URL.Path,
+				Value:   fmt.Sprint(rec),
+				Stack:   string(debug.Stack()),
+			}
+			logging.FromContext(ctx).ErrorContext(ctx, "panic recovered",
+				logging.Err(fmt.Errorf("%v", rec)),
+				slog.String(logging.KeyStack, report.Stack),
+				"route", report.Route,
+			)
+			metrics.Panics.WithLabelValues(report.Method, routeLabel(c)).Inc()
+			reportPanic(ctx, report)
+
+			// 已经开始写响应时无法再改状态码，只能中断
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			response.Error(c, apperror.Internal("internal server error", nil))
+			c.Abort()
 		}()
 		c.Next()
 	}
 }
+
+// reportPanic 调用所有 reporter；reporter 自身 panic 不能影响响应
+func reportPanic(ctx context.Context, report PanicReport) {
+	reportersMu.RLock()
+	defer reportersMu.RUnlock()
+	for _, r := range reporters {
+		func() {
+			defer func() {
+				if rec := recover(); rec != nil {
+					slog.ErrorContext(ctx, "panic reporter failed", logging.Err(fmt.Errorf("%v", rec)))
+				}
+			}()
+			r(ctx, report)
+		}()
+	}
+}
+
+// FilePanicReporter 把 panic 以 JSON 行追加到文件，本地开发时代替错误追踪系统
+func FilePanicReporter(path string) (PanicReporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create panic log dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open panic log: %w", err)
+	}
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(f)
+	return func(ctx context.Context, report PanicReport) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(report); err != nil {
+			slog.ErrorContext(ctx, "failed to write panic log", "path", path, logging.Err(err))
+		}
+	}, nil
+}
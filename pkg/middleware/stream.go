@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+	"vv-ecommerce/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Streams 管理长连接路由 (SSE)。这类路由不能挂在 LoadShed / Timeout 之后：
+// 连接会一直占用并发名额、结束时被当成慢请求，也不应该有请求 deadline
+type Streams struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewStreams() *Streams {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Streams{ctx: ctx, cancel: cancel}
+}
+
+// Handler 取消 http.Server 的 WriteTimeout (否则连接在 WriteTimeout 后被断开)，并在 Close 时取消请求 ctx
+func (s *Streams) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+			slog.WarnContext(c.Request.Context(), "failed to clear write deadline for stream", logging.Err(err))
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		stop := context.AfterFunc(s.ctx, cancel)
+		defer stop()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// Close 结束所有长连接，客户端会重连到其他实例；通过 http.Server.RegisterOnShutdown 注册，
+// 否则 Shutdown 要等到 ShutdownTimeout 才能返回
+func (s *Streams) Close() {
+	s.cancel()
+}
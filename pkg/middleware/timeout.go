@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeoutConfig 是请求 deadline 配置
+type TimeoutConfig struct {
+	// Default 所有路由的默认 deadline，0 表示不限制
+	Default time.Duration `mapstructure:"Default"`
+	// Routes 按 "METHOD 路由模板" 覆盖默认值，如 "POST /orders": 15s (不区分大小写，viper 会把 key 转成小写)
+	Routes map[string]time.Duration `mapstructure:"Routes"`
+}
+
+// Timeout 给请求 ctx 设置 deadline，下游调用、SQL、MQ 都会随之取消
+// 不另起 goroutine 强行中断 handler (gin.Context 不是并发安全的)，而是在 handler 返回后，
+// 如果 deadline 已过且还没有写响应，补一个 504
+func Timeout(cfg TimeoutConfig) gin.HandlerFunc {
+	routes := make(map[string]time.Duration, len(cfg.Routes))
+	for k, v := range cfg.Routes {
+		routes[routeKey(k)] = v
+	}
+
+	return func(c *gin.Context) {
+		d := cfg.Default
+		if rd, ok := routes[routeKey(c.Request.Method+" "+c.FullPath())]; ok {
+			d = rd
+		}
+		if d <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			metrics.HTTPTimeouts.WithLabelValues(c.Request.Method, routeLabel(c)).Inc()
+			if !c.Writer.Written() {
+				response.Error(c, apperror.Timeout("request timed out", ctx.Err()))
+			}
+		}
+	}
+}
+
+func routeKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
@@ -1,6 +1,10 @@
 package middleware
 
 import (
+	"vv-ecommerce/pkg/common/traceid"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/tracing"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -10,16 +14,24 @@ const (
 	TraceIDKey    = "trace_id"
 )
 
-// TraceID middleware checks for X-Trace-ID header or generates a new one
+// TraceID middleware checks for X-Trace-ID header, then the OpenTelemetry trace (see Tracing),
+// or generates a new one
 func TraceID() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		traceID := c.GetHeader(TraceIDHeader)
+		if traceID == "" {
+			traceID = tracing.TraceID(c.Request.Context())
+		}
 		if traceID == "" {
 			traceID = uuid.New().String()
 		}
 
 		// Set in Gin context
 		c.Set(TraceIDKey, traceID)
+		// Set in request context (数据库、MQ 等只拿得到 ctx 的地方使用)
+		// 以及带 trace_id 字段的 logger (logging.FromContext)
+		ctx := traceid.NewContext(c.Request.Context(), traceID)
+		c.Request = c.Request.WithContext(logging.With(ctx, logging.KeyTraceID, traceID))
 
 		// Set in Response Header
 		c.Writer.Header().Set(TraceIDHeader, traceID)
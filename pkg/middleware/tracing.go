@@ -0,0 +1,12 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// Tracing 为每个请求创建 server span，并从 traceparent 头继承上游的 trace
+// 需要注册在 TraceID 之前，TraceID 会复用这里的 OpenTelemetry TraceID
+func Tracing(serviceName string) gin.HandlerFunc {
+	return otelgin.Middleware(serviceName)
+}
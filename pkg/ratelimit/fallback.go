@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
+)
+
+// fallbackCooldown Redis 出错后直接使用进程内限流的时间，避免每个请求都等 Redis 超时
+const fallbackCooldown = 5 * time.Second
+
+// Fallback 优先使用 primary (Redis)，出错时降级到 local (进程内)，而不是放行或拒绝所有请求
+// 降级期间每个实例各自计数，总配额会放大为实例数倍
+type Fallback struct {
+	primary Limiter
+	local   Limiter
+
+	mu       sync.Mutex
+	degraded bool
+	until    time.Time
+}
+
+func NewFallback(primary, local Limiter) *Fallback {
+	return &Fallback{primary: primary, local: local}
+}
+
+func (f *Fallback) Allow(ctx context.Context, key string, q Quota) (Result, error) {
+	f.mu.Lock()
+	skip := f.degraded && time.Now().Before(f.until)
+	f.mu.Unlock()
+
+	if !skip {
+		res, err := f.primary.Allow(ctx, key, q)
+		if err == nil {
+			f.setDegraded(ctx, false, nil)
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return Result{}, err // 请求本身已取消，不是 Redis 的问题
+		}
+		f.setDegraded(ctx, true, err)
+	}
+	return f.local.Allow(ctx, key, q)
+}
+
+func (f *Fallback) setDegraded(ctx context.Context, degraded bool, err error) {
+	f.mu.Lock()
+	changed := f.degraded != degraded
+	f.degraded = degraded
+	if degraded {
+		f.until = time.Now().Add(fallbackCooldown)
+	}
+	f.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	logger := logging.FromContext(ctx).With(logging.KeyComponent, "ratelimit")
+	if degraded {
+		logger.WarnContext(ctx, "rate limiter store unavailable, falling back to in-memory limits", logging.Err(err))
+		metrics.RateLimitDegraded.Set(1)
+	} else {
+		logger.InfoContext(ctx, "rate limiter store recovered")
+		metrics.RateLimitDegraded.Set(0)
+	}
+}
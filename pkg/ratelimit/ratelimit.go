@@ -0,0 +1,161 @@
+// Package ratelimit 是令牌桶限流：Redis 实现 (Lua 脚本原子更新，多个网关实例共享配额)、
+// 进程内实现，以及 Redis 不可用时降级到进程内的 Fallback
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 限流维度
+const (
+	DimensionIP     = "ip"
+	DimensionUser   = "user"
+	DimensionAPIKey = "apikey"
+)
+
+// Quota 是一个令牌桶：每 Period 补充 Limit 个令牌，最多积累 Burst 个 (默认等于 Limit)
+type Quota struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// ParseQuota 解析 "100/1m"、"10/1s" 或带突发量的 "100/1m:200"
+func ParseQuota(s string) (Quota, error) {
+	var q Quota
+	spec, burst, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	limit, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return q, fmt.Errorf("invalid quota %q, want LIMIT/PERIOD such as 100/1m", s)
+	}
+	var err error
+	if q.Limit, err = strconv.Atoi(limit); err != nil {
+		return q, fmt.Errorf("invalid quota %q: %w", s, err)
+	}
+	if q.Period, err = time.ParseDuration(period); err != nil {
+		return q, fmt.Errorf("invalid quota %q: %w", s, err)
+	}
+	if hasBurst {
+		if q.Burst, err = strconv.Atoi(burst); err != nil {
+			return q, fmt.Errorf("invalid quota %q: %w", s, err)
+		}
+	}
+	return q, q.Validate()
+}
+
+// Validate 检查配额；桶按毫秒补充令牌，Period 至少为 1ms
+func (q Quota) Validate() error {
+	if q.Limit <= 0 || q.Period < time.Millisecond || q.Burst < 0 {
+		return fmt.Errorf("invalid quota %d/%s:%d", q.Limit, q.Period, q.Burst)
+	}
+	return nil
+}
+
+func (q Quota) String() string {
+	return fmt.Sprintf("%d/%s", q.Limit, q.Period)
+}
+
+func (q Quota) burst() float64 {
+	if q.Burst > 0 {
+		return float64(q.Burst)
+	}
+	return float64(q.Limit)
+}
+
+// ratePerMs 每毫秒补充的令牌数
+func (q Quota) ratePerMs() float64 {
+	return float64(q.Limit) / (float64(q.Period) / float64(time.Millisecond))
+}
+
+// Result 是一次限流判断的结果，用于生成 RateLimit-* 响应头
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset 桶补满还需要多久
+	Reset time.Duration
+	// RetryAfter 被拒绝时，下一个令牌可用还需要多久
+	RetryAfter time.Duration
+}
+
+// Limiter 从 key 对应的桶中取一个令牌
+type Limiter interface {
+	Allow(ctx context.Context, key string, q Quota) (Result, error)
+}
+
+func newResult(q Quota, allowed bool, tokens float64, retryAfterMs, resetMs float64) Result {
+	return Result{
+		Allowed:    allowed,
+		Limit:      q.Limit,
+		Remaining:  int(math.Floor(tokens)),
+		Reset:      time.Duration(math.Ceil(resetMs)) * time.Millisecond,
+		RetryAfter: time.Duration(math.Ceil(retryAfterMs)) * time.Millisecond,
+	}
+}
+
+// MemoryLimiter 是进程内的令牌桶 (多实例时每个实例各自计数)
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+	idle   time.Duration // 桶从空到满的时间，之后可以回收
+}
+
+// sweepInterval 回收已补满 (等价于不存在) 的桶的间隔
+const sweepInterval = time.Minute
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+func (l *MemoryLimiter) Allow(_ context.Context, key string, q Quota) (Result, error) {
+	now := time.Now()
+	burst, rate := q.burst(), q.ratePerMs()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, ts: now}
+		l.buckets[key] = b
+	}
+	b.idle = time.Duration(burst/rate) * time.Millisecond
+	if elapsed := float64(now.Sub(b.ts).Milliseconds()); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+		b.ts = now
+	}
+
+	allowed, retry := false, 0.0
+	if b.tokens >= 1 {
+		b.tokens--
+		allowed = true
+	} else {
+		retry = (1 - b.tokens) / rate
+	}
+	return newResult(q, allowed, b.tokens, retry, (burst-b.tokens)/rate), nil
+}
+
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		if now.Sub(b.ts) > b.idle {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/metrics"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedis 启动 miniredis，TIME 返回固定的时间，测试通过 SetTime 推进时钟
+func newRedis(t *testing.T) (*miniredis.Miniredis, time.Time) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.SetTime(now)
+	return m, now
+}
+
+func newRedisLimiter(t *testing.T, m *miniredis.Miniredis) *RedisLimiter {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: m.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisLimiter(client, "ratelimit:")
+}
+
+func allow(t *testing.T, l Limiter, key string, q Quota) Result {
+	t.Helper()
+	res, err := l.Allow(context.Background(), key, q)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	return res
+}
+
+func TestRedisLimiterBurst(t *testing.T) {
+	m, _ := newRedis(t)
+	l := newRedisLimiter(t, m)
+	q := Quota{Limit: 2, Period: time.Second, Burst: 5}
+
+	for i := 0; i < 5; i++ {
+		if res := allow(t, l, "ip:1", q); !res.Allowed || res.Remaining != 4-i {
+			t.Fatalf("request %d: %+v, want allowed with %d remaining", i, res, 4-i)
+		}
+	}
+	res := allow(t, l, "ip:1", q)
+	if res.Allowed {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	// 每 500ms 补充一个令牌
+	if res.RetryAfter != 500*time.Millisecond || res.Reset != 2500*time.Millisecond {
+		t.Fatalf("retry after %s, reset %s; want 500ms, 2.5s", res.RetryAfter, res.Reset)
+	}
+}
+
+func TestRedisLimiterRefill(t *testing.T) {
+	m, now := newRedis(t)
+	l := newRedisLimiter(t, m)
+	q := Quota{Limit: 2, Period: time.Second}
+
+	allow(t, l, "ip:1", q)
+	allow(t, l, "ip:1", q)
+	if allow(t, l, "ip:1", q).Allowed {
+		t.Fatal("empty bucket allowed a request")
+	}
+
+	m.SetTime(now.Add(500 * time.Millisecond))
+	if !allow(t, l, "ip:1", q).Allowed {
+		t.Fatal("no token after one refill interval")
+	}
+	if allow(t, l, "ip:1", q).Allowed {
+		t.Fatal("more than one token after one refill interval")
+	}
+
+	// 补充不会超过桶容量
+	m.SetTime(now.Add(time.Minute))
+	if res := allow(t, l, "ip:1", q); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("after a long idle period: %+v, want a full bucket", res)
+	}
+}
+
+// TestRedisLimiterSharedQuota 两个网关实例 (各自的 Redis 连接) 共享同一个桶
+func TestRedisLimiterSharedQuota(t *testing.T) {
+	m, _ := newRedis(t)
+	a, b := newRedisLimiter(t, m), newRedisLimiter(t, m)
+	q := Quota{Limit: 3, Period: time.Minute}
+
+	for i, l := range []*RedisLimiter{a, b, a} {
+		if !allow(t, l, "user:7", q).Allowed {
+			t.Fatalf("request %d was rejected", i)
+		}
+	}
+	if allow(t, b, "user:7", q).Allowed {
+		t.Fatal("instances do not share the quota")
+	}
+	if !allow(t, b, "user:8", q).Allowed {
+		t.Fatal("another key shares the bucket")
+	}
+}
+
+func TestFallbackToMemoryWhenRedisDown(t *testing.T) {
+	m, _ := newRedis(t)
+	f := NewFallback(newRedisLimiter(t, m), NewMemoryLimiter())
+	q := Quota{Limit: 1, Period: time.Minute}
+
+	if !allow(t, f, "ip:1", q).Allowed {
+		t.Fatal("first request was rejected")
+	}
+	if testutil.ToFloat64(metrics.RateLimitDegraded) != 0 {
+		t.Fatal("degraded while Redis is up")
+	}
+
+	m.Close()
+	// Redis 的桶已经用完，但降级后由进程内的桶计数
+	if !allow(t, f, "ip:1", q).Allowed {
+		t.Fatal("request was rejected after falling back to memory")
+	}
+	if allow(t, f, "ip:1", q).Allowed {
+		t.Fatal("in-memory fallback does not enforce the quota")
+	}
+	if testutil.ToFloat64(metrics.RateLimitDegraded) != 1 {
+		t.Fatal("ratelimit_degraded was not set")
+	}
+}
+
+func TestMemoryLimiterRefill(t *testing.T) {
+	l := NewMemoryLimiter()
+	q := Quota{Limit: 1, Period: 20 * time.Millisecond}
+
+	if !allow(t, l, "ip:1", q).Allowed {
+		t.Fatal("first request was rejected")
+	}
+	if res := allow(t, l, "ip:1", q); res.Allowed || res.RetryAfter <= 0 {
+		t.Fatalf("empty bucket: %+v", res)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !allow(t, l, "ip:1", q).Allowed {
+		t.Fatal("no token after the refill period")
+	}
+}
+
+// TestRatePerMsKeepsFractionalMilliseconds 周期不是整毫秒时速率不能被截断
+func TestRatePerMsKeepsFractionalMilliseconds(t *testing.T) {
+	q := Quota{Limit: 3, Period: 1500 * time.Microsecond}
+	if got := q.ratePerMs(); got != 2 {
+		t.Fatalf("ratePerMs = %v, want 2", got)
+	}
+}
+
+func TestParseQuota(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    Quota
+		wantErr bool
+	}{
+		{in: "100/1m", want: Quota{Limit: 100, Period: time.Minute}},
+		{in: " 10/1s:20 ", want: Quota{Limit: 10, Period: time.Second, Burst: 20}},
+		{in: "100", wantErr: true},
+		{in: "0/1s", wantErr: true},
+		{in: "10/0s", wantErr: true},
+		// 不到 1ms 的周期换算成每毫秒的速率会得到 +Inf
+		{in: "10/500us", wantErr: true},
+		{in: "10/1500us", want: Quota{Limit: 10, Period: 1500 * time.Microsecond}},
+		{in: "10/1s:x", wantErr: true},
+	} {
+		got, err := ParseQuota(tc.in)
+		if (err != nil) != tc.wantErr || (!tc.wantErr && got != tc.want) {
+			t.Errorf("ParseQuota(%q) = %+v, %v", tc.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript 原子地补充并扣减令牌；时间取 Redis 的 TIME，多个网关实例之间没有时钟偏差问题
+// KEYS[1] 桶；ARGV: 每毫秒补充的令牌数、桶容量
+// 返回 {allowed, 剩余令牌, 重试等待 ms, 补满所需 ms}，数字以字符串返回避免 Lua number 被截断为整数
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+if now > ts then
+  tokens = math.min(burst, tokens + (now - ts) * rate)
+  ts = now
+end
+
+local allowed, retry = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = (1 - tokens) / rate
+end
+
+local reset = (burst - tokens) / rate
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], math.ceil(reset) + 1000)
+return {allowed, tostring(tokens), tostring(retry), tostring(reset)}
+`)
+
+// RedisLimiter 把桶存在 Redis 中，所有网关实例共享配额
+type RedisLimiter struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisLimiter prefix 如 "ratelimit:"
+func NewRedisLimiter(client redis.UniversalClient, prefix string) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, q Quota) (Result, error) {
+	vals, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key}, q.ratePerMs(), q.burst()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(vals) != 4 {
+		return Result{}, fmt.Errorf("unexpected rate limit script reply: %v", vals)
+	}
+	allowed, _ := vals[0].(int64)
+	var nums [3]float64
+	for i := range nums {
+		s, _ := vals[i+1].(string)
+		if nums[i], err = strconv.ParseFloat(s, 64); err != nil {
+			return Result{}, fmt.Errorf("unexpected rate limit script reply: %v", vals)
+		}
+	}
+	return newResult(q, allowed == 1, nums[0], nums[1], nums[2]), nil
+}
@@ -0,0 +1,56 @@
+// Package server 是各服务共用的 HTTP 服务器配置：http.Server 的读写超时，以及请求 deadline、请求体上限和过载保护
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	"vv-ecommerce/pkg/middleware"
+)
+
+// Config 各服务通过 mapstructure 嵌入为 Server，如 SERVER_READTIMEOUT=10s SERVER_MAXBODYBYTES=1048576
+type Config struct {
+	// http.Server 超时：ReadHeaderTimeout 防止慢速客户端占住连接，WriteTimeout 需大于最长的请求 deadline
+	ReadHeaderTimeout time.Duration `mapstructure:"ReadHeaderTimeout"`
+	ReadTimeout       time.Duration `mapstructure:"ReadTimeout"`
+	WriteTimeout      time.Duration `mapstructure:"WriteTimeout"`
+	IdleTimeout       time.Duration `mapstructure:"IdleTimeout"`
+	// ShutdownTimeout 优雅关闭时等待进行中请求的最长时间
+	ShutdownTimeout time.Duration `mapstructure:"ShutdownTimeout"`
+
+	RequestTimeout middleware.TimeoutConfig  `mapstructure:"RequestTimeout"`
+	MaxBodyBytes   int64                     `mapstructure:"MaxBodyBytes"`
+	LoadShed       middleware.LoadShedConfig `mapstructure:"LoadShed"`
+}
+
+// Defaults 返回默认配置，供没有使用 viper 的网关和各服务的 SetDefault 参考
+func Defaults() Config {
+	return Config{
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   10 * time.Second,
+		RequestTimeout:    middleware.TimeoutConfig{Default: 10 * time.Second},
+		MaxBodyBytes:      1 << 20,
+		LoadShed: middleware.LoadShedConfig{
+			InitialLimit:  100,
+			MinLimit:      10,
+			MaxLimit:      1000,
+			LatencyTarget: time.Second,
+			RetryAfter:    time.Second,
+		},
+	}
+}
+
+// New 创建带超时配置的 http.Server
+func New(port int, handler http.Handler, cfg Config) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
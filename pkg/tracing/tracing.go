@@ -0,0 +1,134 @@
+// Package tracing 初始化 OpenTelemetry：W3C traceparent 传播 + span 导出 (OTLP/HTTP 或 stdout)
+// 即使不导出 (Exporter 为 none) 也会安装 SDK TracerProvider，保证 TraceID 在服务间一致地生成和传递
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// instrumentationName 是本仓库手动创建的 span (如 MQ) 使用的 tracer 名
+const instrumentationName = "vv-ecommerce/pkg"
+
+const traceParentKey = "traceparent"
+
+// Config 是 tracing 配置，各服务通过 mapstructure 直接嵌入
+type Config struct {
+	// Exporter 为 none (默认) / stdout / otlp
+	Exporter string `mapstructure:"Exporter"`
+	// Endpoint 是 OTLP/HTTP collector 地址 (host:port)，为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 或 localhost:4318
+	Endpoint string `mapstructure:"Endpoint"`
+	// Insecure 使用 http 而不是 https 连接 collector
+	Insecure bool `mapstructure:"Insecure"`
+	// SampleRatio 是根 span 的采样比例 (0~1]，默认 1；下游服务跟随上游的采样决定
+	SampleRatio float64 `mapstructure:"SampleRatio"`
+}
+
+// Init 安装全局 TracerProvider 和 propagator，返回的 shutdown 会刷新尚未导出的 span
+func Init(ctx context.Context, serviceName string, cfg Config) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}
+
+	switch strings.ToLower(cfg.Exporter) {
+	case "", ExporterNone:
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exp, err := otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q", cfg.Exporter)
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	slog.Info("tracing initialized", "exporter", cfg.Exporter, "sample_ratio", ratio)
+
+	return tp.Shutdown, nil
+}
+
+// Tracer 返回本仓库手动埋点使用的 tracer
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// TraceID 返回 ctx 中当前 span 的 TraceID，没有有效 span 时返回空字符串
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Inject 把 ctx 中的 trace 上下文写入 carrier (HTTP header、MQ 消息头等)
+func Inject(ctx context.Context, carrier map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(carrier))
+}
+
+// Extract 从 carrier 中恢复 trace 上下文
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// TraceParent 返回 ctx 对应的 W3C traceparent 头，用于需要持久化 trace 上下文的场景 (如 outbox)
+func TraceParent(ctx context.Context) string {
+	carrier := map[string]string{}
+	Inject(ctx, carrier)
+	return carrier[traceParentKey]
+}
+
+// ContextWithTraceParent 用持久化的 traceparent 恢复 trace 上下文，traceParent 为空时原样返回 ctx
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return Extract(ctx, map[string]string{traceParentKey: traceParent})
+}
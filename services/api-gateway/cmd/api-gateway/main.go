@@ -1,38 +1,206 @@
 package main
 
 import (
+	"api-gateway/internal/auth"
+	"api-gateway/internal/cache"
 	"api-gateway/internal/config"
 	"api-gateway/internal/handler"
 	"api-gateway/internal/router"
-	"fmt"
-	"log"
+	"api-gateway/internal/routes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"vv-ecommerce/pkg/async"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/middleware"
+	"vv-ecommerce/pkg/ratelimit"
+	"vv-ecommerce/pkg/server"
+	"vv-ecommerce/pkg/tracing"
+
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
-	log.Println("Starting API Gateway...")
+	apperror.SetServiceName("api-gateway")
 
 	// 1. Load Config
 	cfg := config.Load()
-	log.Printf("Config loaded: Port=%d, Order=%s, Inventory=%s, Payment=%s",
-		cfg.ServerPort, cfg.OrderServiceURL, cfg.InventoryServiceURL, cfg.PaymentServiceURL)
+	// 网关面向客户端：错误的 cause / origins 可能包含 SQL、上游地址等内部信息，默认不返回
+	response.ExposeErrorDetails(cfg.ErrorDetails)
 
-	// 2. Initialize Handlers
-	h := handler.NewGatewayHandler(
-		cfg.OrderServiceURL,
-		cfg.InventoryServiceURL,
-		cfg.PaymentServiceURL,
+	// Logging: JSON 结构化日志，之后所有 log/slog 输出都带 service 字段
+	if _, err := logging.Init("api-gateway", cfg.Log); err != nil {
+		logging.Fatal("failed to init logging", logging.Err(err))
+	}
+	// Panic reporter: 开发环境把 panic 额外写入本地文件
+	if cfg.Log.PanicFile != "" {
+		reporter, err := middleware.FilePanicReporter(cfg.Log.PanicFile)
+		if err != nil {
+			logging.Fatal("failed to open panic log", logging.Err(err))
+		}
+		middleware.RegisterPanicReporter(reporter)
+	}
+	slog.Info("config loaded",
+		"port", cfg.ServerPort,
+		"order_service_url", cfg.OrderServiceURL,
+		"inventory_service_url", cfg.InventoryServiceURL,
+		"payment_service_url", cfg.PaymentServiceURL,
 	)
-	log.Println("Handlers initialized")
 
-	// 3. Setup Router
-	r := router.NewRouter(h)
-	log.Println("Router setup complete")
+	// Tracing: 网关是 trace 的入口，生成的 traceparent 随代理请求传给下游
+	shutdownTracing, err := tracing.Init(context.Background(), "api-gateway", cfg.Tracing)
+	if err != nil {
+		logging.Fatal("failed to init tracing", logging.Err(err))
+	}
+	defer shutdownTracing(context.Background())
+
+	// 2. Initialize Handlers
+	h, err := handler.NewGatewayHandler(cfg.Upstreams(), cfg.Proxy, cfg.Upstream, cfg.Details)
+	if err != nil {
+		logging.Fatal("invalid upstream config", logging.Err(err))
+	}
+
+	// 后台任务 (JWKS 刷新、路由表重新加载) 一直运行到进程退出
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Auth: 校验 JWT；JWKS 在后台定期刷新
+	authn, err := auth.New(bgCtx, cfg.Auth)
+	if err != nil {
+		logging.Fatal("failed to init authentication", logging.Err(err))
+	}
+	if !cfg.Auth.Enabled {
+		slog.Warn("authentication is disabled, requests are forwarded without user identity")
+	}
+
+	// Redis: 限流和响应缓存共用一个客户端
+	var redisClient *redis.Client
+	if (cfg.RateLimit.Enabled && cfg.RateLimit.Store == "redis") || (cfg.Cache.Enabled && cfg.Cache.Store == "redis") {
+		redisClient = redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
+		defer redisClient.Close()
+	}
+
+	// Rate limit: Redis 令牌桶，多个网关实例共享配额；Redis 不可用时降级为进程内限流
+	var limiter ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		limiter = ratelimit.NewMemoryLimiter()
+		if cfg.RateLimit.Store == "redis" {
+			limiter = ratelimit.NewFallback(ratelimit.NewRedisLimiter(redisClient, "ratelimit:api-gateway:"), limiter)
+		}
+	}
+
+	// Cache: 按路由缓存 GET 响应；服务通过 MQ (cache_invalidate) 或管理接口按标签失效
+	var store cache.Store = cache.NewMemoryStore(cfg.Cache.MaxEntries)
+	if cfg.Cache.Store == "redis" && redisClient != nil {
+		store = cache.NewRedisStore(redisClient, "cache:api-gateway:")
+	}
+	// 关闭缓存时失效接口仍然注册，路由表不需要随之修改
+	responseCache := cache.New(store, cfg.Cache.MaxBodyBytes)
+	h.Register(handler.HandlerCacheInvalidate, responseCache.InvalidateHandler)
+	var routeCache *cache.Cache
+	var messageQueue async.MessageQueue
+	if cfg.Cache.Enabled {
+		routeCache = responseCache
+		messageQueue = async.NewRabbitMQOrMemory(cfg.MQ.URL())
+		defer messageQueue.Close()
+		// 失效事件必须广播：memory store 每个实例一份，工作队列只会让其中一个实例收到
+		broadcaster, ok := messageQueue.(async.Broadcaster)
+		if !ok {
+			logging.Fatal("message queue does not support broadcast, cache invalidation needs every gateway instance to receive each event")
+		}
+		err := broadcaster.SubscribeBroadcast(async.TopicCacheInvalidate, func(ctx context.Context, payload []byte) error {
+			var msg async.CacheInvalidation
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				return err
+			}
+			return responseCache.Invalidate(ctx, msg.Tags)
+		})
+		if err != nil {
+			logging.Fatal("failed to subscribe to cache invalidation events", logging.Err(err))
+		}
+	}
+
+	// Health: 下游服务和 Redis 不可用只报告 degraded，不把网关摘掉
+	checker := health.NewChecker(cfg.Health)
+	probeClient := &http.Client{}
+	for name, urls := range cfg.Upstreams() {
+		for _, url := range urls {
+			// 多个实例时分别检查，如 order-service@10.0.0.5:8080
+			check := name
+			if len(urls) > 1 {
+				check += "@" + strings.TrimPrefix(strings.TrimPrefix(url, "http://"), "https://")
+			}
+			checker.Register(check, health.HTTP(probeClient, url+"/readyz"), health.Optional())
+		}
+	}
+	if redisClient != nil {
+		checker.Register("redis", func(ctx context.Context) error { return redisClient.Ping(ctx).Err() }, health.Optional())
+	}
+	if p, ok := messageQueue.(health.Pinger); ok {
+		checker.Register("mq", health.Ping(p), health.Optional())
+	}
+	// JWKS 未加载时无法验证任何令牌，网关不就绪
+	checker.Register("jwks", authn.Ready)
+
+	// 3. Setup Router: 路由表启动时必须有效，之后文件修改自动重新加载，无效的修改被拒绝
+	table, err := routes.Load(cfg.Routes.File, h.Targets())
+	if err != nil {
+		logging.Fatal("failed to load route table", "file", cfg.Routes.File, logging.Err(err))
+	}
+	streams := middleware.NewStreams()
+	r := router.New(router.Options{
+		Handler:        h,
+		Checker:        checker,
+		Server:         cfg.Server,
+		Auth:           authn,
+		Limiter:        limiter,
+		RateLimit:      cfg.RateLimit.Limits,
+		Cache:          routeCache,
+		TrustedProxies: cfg.TrustedProxies,
+		Streams:        streams,
+	})
+	if err := r.Load(table); err != nil {
+		logging.Fatal("failed to load route table", "file", cfg.Routes.File, logging.Err(err))
+	}
+	slog.Info("route table loaded", "file", cfg.Routes.File, "version", table.Version, "routes", len(table.Routes))
+	go routes.Watch(bgCtx, cfg.Routes.File, h.Targets(), cfg.Routes.ReloadInterval, table, r.Load)
 
 	// 4. Start Server
-	addr := fmt.Sprintf(":%d", cfg.ServerPort)
-	log.Printf("API Gateway running on port %d", cfg.ServerPort)
+	srv := server.New(cfg.ServerPort, r, cfg.Server)
+	// 关闭时断开长连接 (SSE)，客户端会重连到其他实例
+	srv.RegisterOnShutdown(streams.Close)
+	serverErrors := make(chan error, 1)
+	go func() {
+		slog.Info("server started", "port", cfg.ServerPort)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErrors <- err
+		}
+	}()
+
+	// 5. Graceful shutdown: 先让 /readyz 失败等待摘流量，再停止接收请求
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErrors:
+		logging.Fatal("failed to start API Gateway", logging.Err(err))
+	case sig := <-shutdown:
+		slog.Info("start shutdown", "signal", sig.String())
+		checker.Drain()
 
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start API Gateway: %v", err)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+			slog.Error("could not stop server gracefully", logging.Err(err))
+		}
 	}
 }
@@ -0,0 +1,236 @@
+// Package auth 在网关校验 JWT (HS256 / RS256)，认证通过后由代理把可信的用户 ID 和角色传给下游
+// 验签 key 来自静态 HMAC secret 或 JWKS (文件 / URL，定期刷新以支持 key 轮换)
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+
+	// minHMACSecretLen HS256 的 secret 至少 256 bit
+	minHMACSecretLen = 32
+
+	ctxUserID  = "auth_user_id"
+	ctxRoles   = "auth_roles"
+	ctxAuthErr = "auth_error"
+)
+
+// Config 是网关的认证配置
+type Config struct {
+	// Enabled 为 false 时不校验令牌 (请求不带用户身份，下游需要身份的接口会返回 401)
+	Enabled bool
+	// Algorithms 允许的签名算法，HS256 / RS256
+	Algorithms []string
+	// HMACSecret HS256 的静态 secret (可以和 JWKS 中的 oct key 同时使用)
+	HMACSecret string
+	// JWKSFile / JWKSURL JWKS 来源，二选一；每 RefreshInterval 重新加载
+	JWKSFile        string
+	JWKSURL         string
+	RefreshInterval time.Duration
+	// Issuer / Audience 非空时校验 iss / aud
+	Issuer   string
+	Audience string
+	// Leeway 校验 exp / nbf 时允许的时钟偏差
+	Leeway time.Duration
+	// RolesClaim 角色所在的 claim，值为字符串数组或空格分隔的字符串
+	RolesClaim string
+}
+
+// Validate 检查配置
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Algorithms) == 0 {
+		return errors.New("auth: no algorithms configured")
+	}
+	for _, alg := range c.Algorithms {
+		if alg != AlgHS256 && alg != AlgRS256 {
+			return fmt.Errorf("auth: unsupported algorithm %q", alg)
+		}
+	}
+	if c.JWKSFile != "" && c.JWKSURL != "" {
+		return errors.New("auth: JWKSFile and JWKSURL are mutually exclusive")
+	}
+	if c.HMACSecret == "" && c.JWKSFile == "" && c.JWKSURL == "" {
+		return errors.New("auth: one of HMACSecret, JWKSFile or JWKSURL is required")
+	}
+	if c.HMACSecret != "" && len(c.HMACSecret) < minHMACSecretLen {
+		return fmt.Errorf("auth: HMACSecret must be at least %d bytes", minHMACSecretLen)
+	}
+	return nil
+}
+
+// Authenticator 校验 Bearer 令牌
+type Authenticator struct {
+	cfg    Config
+	keys   *keySet
+	parser *jwt.Parser
+}
+
+// New 创建 Authenticator 并首次加载 JWKS；加载失败不返回错误，由 Ready 让网关暂不接收流量，后台继续重试
+func New(ctx context.Context, cfg Config) (*Authenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	a := &Authenticator{cfg: cfg, keys: newKeySet(cfg), parser: jwt.NewParser(opts...)}
+	if cfg.Enabled && a.keys.hasJWKS() {
+		a.keys.refresh(ctx)
+		go a.keys.run(ctx)
+	}
+	return a, nil
+}
+
+// Ready 是 health check：配置了 JWKS 时，加载成功之前网关不就绪
+func (a *Authenticator) Ready(ctx context.Context) error {
+	if !a.cfg.Enabled {
+		return nil
+	}
+	return a.keys.ready()
+}
+
+// Identify 校验请求中的 Bearer 令牌 (如果有)，成功后把用户 ID (sub) 和角色放入 gin.Context，
+// 由代理转换为 X-User-ID / X-User-Roles；令牌无效时按匿名处理，由 Authenticate 拒绝
+// 注册在路由组上，使限流等中间件在 Authenticate 之前就能拿到用户
+func (a *Authenticator) Identify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.cfg.Enabled {
+			c.Next()
+			return
+		}
+		raw, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Next()
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		if _, err := a.parser.ParseWithClaims(raw, claims, a.keyFunc(c.Request.Context())); err != nil {
+			c.Set(ctxAuthErr, apperror.Unauthorized("invalid token", err))
+			c.Next()
+			return
+		}
+		sub, err := claims.GetSubject()
+		if err != nil || sub == "" {
+			c.Set(ctxAuthErr, apperror.Unauthorized("token has no subject", err))
+			c.Next()
+			return
+		}
+
+		c.Set(ctxUserID, sub)
+		c.Set(ctxRoles, rolesFromClaims(claims, a.cfg.RolesClaim))
+		c.Next()
+	}
+}
+
+// Authenticate 要求 Identify 已经认证了用户，否则返回 401
+func (a *Authenticator) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.cfg.Enabled || UserID(c) != "" {
+			c.Next()
+			return
+		}
+		err, ok := c.Value(ctxAuthErr).(*apperror.AppError)
+		if !ok {
+			err = apperror.Unauthorized("missing bearer token", nil)
+		}
+		unauthorized(c, err)
+	}
+}
+
+// RequireRole 要求已认证的用户具有 role，否则返回 403；需要注册在 Authenticate 之后
+func (a *Authenticator) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a.cfg.Enabled && !slices.Contains(Roles(c), role) {
+			response.Error(c, apperror.Forbidden(fmt.Sprintf("role %q required", role), nil))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// UserID 返回已认证用户的 ID，未认证时为空
+func UserID(c *gin.Context) string {
+	return c.GetString(ctxUserID)
+}
+
+// Roles 返回已认证用户的角色
+func Roles(c *gin.Context) []string {
+	return c.GetStringSlice(ctxRoles)
+}
+
+func (a *Authenticator) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		hmac := token.Method.Alg() == AlgHS256
+		key, ok := a.keys.lookup(kid, hmac)
+		if !ok && a.keys.refreshIfStale(ctx) {
+			// 未知 kid 可能是身份提供方刚轮换了 key
+			key, ok = a.keys.lookup(kid, hmac)
+		}
+		if !ok {
+			return nil, fmt.Errorf("no signing key for kid %q", kid)
+		}
+		return key, nil
+	}
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func rolesFromClaims(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		roles := make([]string, 0, len(v))
+		for _, r := range v {
+			if s, ok := r.(string); ok && s != "" {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	default:
+		return nil
+	}
+}
+
+func unauthorized(c *gin.Context, err *apperror.AppError) {
+	ctx := c.Request.Context()
+	logging.FromContext(ctx).DebugContext(ctx, "authentication failed", "reason", err.Message, logging.Err(err.Cause))
+	c.Header("WWW-Authenticate", `Bearer realm="vv-ecommerce"`)
+	response.Error(c, err)
+	c.Abort()
+}
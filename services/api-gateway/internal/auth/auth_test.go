@@ -0,0 +1,378 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// rsaJWK 把公钥编码为 JWKS 中的一个 key
+func rsaJWK(kid string, pub *rsa.PublicKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func jwksJSON(t *testing.T, keys ...jwk) []byte {
+	t.Helper()
+	raw, err := json.Marshal(map[string][]jwk{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func writeJWKS(t *testing.T, keys ...jwk) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksJSON(t, keys...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// claims 是一个有效令牌的 claims，overrides 中值为 nil 的 claim 被删除
+func claims(overrides jwt.MapClaims) jwt.MapClaims {
+	c := jwt.MapClaims{
+		"sub":   "42",
+		"iss":   "https://idp.example.com",
+		"aud":   "vv-ecommerce",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"admin", "support"},
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, c jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// newRouter 与网关相同：Identify 放在前面，Authenticate 保护路由；响应体是认证出的用户和角色
+func newRouter(t *testing.T, cfg Config) (*Authenticator, http.Handler) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	a, err := New(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(a.Identify())
+	r.GET("/me", a.Authenticate(), func(c *gin.Context) {
+		c.String(http.StatusOK, UserID(c)+" "+strings.Join(Roles(c), ","))
+	})
+	return a, r
+}
+
+func get(h http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func baseConfig() Config {
+	return Config{
+		Enabled:    true,
+		Algorithms: []string{AlgHS256, AlgRS256},
+		Issuer:     "https://idp.example.com",
+		Audience:   "vv-ecommerce",
+		RolesClaim: "roles",
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	rsaKey, otherKey := newRSAKey(t), newRSAKey(t)
+	pubPEM, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubPEM})
+
+	cfg := baseConfig()
+	cfg.HMACSecret = testSecret
+	cfg.JWKSFile = writeJWKS(t, rsaJWK("rsa-1", &rsaKey.PublicKey))
+	_, h := newRouter(t, cfg)
+
+	leewayCfg := cfg
+	leewayCfg.Leeway = 10 * time.Second
+	_, lenient := newRouter(t, leewayCfg)
+
+	rsOnly := cfg
+	rsOnly.Algorithms = []string{AlgRS256}
+	_, rsOnlyRouter := newRouter(t, rsOnly)
+
+	// 只有 RSA key 的 JWKS，没有 HMAC secret：用公钥当 HMAC secret 签名的令牌没有可用的 key
+	jwksOnly := baseConfig()
+	jwksOnly.JWKSFile = cfg.JWKSFile
+	_, jwksOnlyRouter := newRouter(t, jwksOnly)
+
+	now := time.Now()
+	for _, tc := range []struct {
+		name    string
+		handler http.Handler
+		token   string
+		want    int
+	}{
+		{name: "HS256", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(nil)), want: http.StatusOK},
+		{name: "RS256 with kid", token: sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(nil)), want: http.StatusOK},
+		{name: "RS256 without kid uses the only RSA key", token: sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(nil)), want: http.StatusOK},
+		{name: "no token", token: "", want: http.StatusUnauthorized},
+		{name: "garbage", token: "not.a.jwt", want: http.StatusUnauthorized},
+		{name: "HS256 with the wrong secret", token: sign(t, jwt.SigningMethodHS256, "", []byte(strings.Repeat("x", 32)), claims(nil)), want: http.StatusUnauthorized},
+		{name: "RS256 signed by another key", token: sign(t, jwt.SigningMethodRS256, "rsa-1", otherKey, claims(nil)), want: http.StatusUnauthorized},
+		{name: "unknown kid", token: sign(t, jwt.SigningMethodRS256, "rsa-2", otherKey, claims(nil)), want: http.StatusUnauthorized},
+		{name: "none algorithm", token: sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims(nil)), want: http.StatusUnauthorized},
+
+		// 算法混淆：HS256 令牌以 RSA 公钥 (PEM 或模数) 作为 HMAC secret
+		{name: "HS256 signed with the RSA public key PEM, RSA kid", token: sign(t, jwt.SigningMethodHS256, "rsa-1", pemBytes, claims(nil)), want: http.StatusUnauthorized},
+		{name: "HS256 signed with the RSA modulus, RSA kid", token: sign(t, jwt.SigningMethodHS256, "rsa-1", rsaKey.PublicKey.N.Bytes(), claims(nil)), want: http.StatusUnauthorized},
+		{name: "HS256 signed with the RSA public key PEM, JWKS only", handler: jwksOnlyRouter, token: sign(t, jwt.SigningMethodHS256, "", pemBytes, claims(nil)), want: http.StatusUnauthorized},
+		{name: "HS256 signed with the RSA public key PEM, JWKS only, RSA kid", handler: jwksOnlyRouter, token: sign(t, jwt.SigningMethodHS256, "rsa-1", pemBytes, claims(nil)), want: http.StatusUnauthorized},
+		{name: "HS256 when only RS256 is allowed", handler: rsOnlyRouter, token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(nil)), want: http.StatusUnauthorized},
+
+		{name: "expired", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"exp": now.Add(-5 * time.Second).Unix()})), want: http.StatusUnauthorized},
+		{name: "expired within leeway", handler: lenient, token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"exp": now.Add(-5 * time.Second).Unix()})), want: http.StatusOK},
+		{name: "no exp", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"exp": nil})), want: http.StatusUnauthorized},
+		{name: "not yet valid", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})), want: http.StatusUnauthorized},
+		{name: "nbf within leeway", handler: lenient, token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"nbf": now.Add(5 * time.Second).Unix()})), want: http.StatusOK},
+		{name: "wrong issuer", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"iss": "https://evil.example.com"})), want: http.StatusUnauthorized},
+		{name: "no issuer", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"iss": nil})), want: http.StatusUnauthorized},
+		{name: "wrong audience", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"aud": "another-api"})), want: http.StatusUnauthorized},
+		{name: "audience list", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"aud": []string{"another-api", "vv-ecommerce"}})), want: http.StatusOK},
+		{name: "no subject", token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"sub": nil})), want: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := tc.handler
+			if handler == nil {
+				handler = h
+			}
+			w := get(handler, tc.token)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+			if tc.want == http.StatusOK && w.Body.String() != "42 admin,support" {
+				t.Fatalf("identity = %q", w.Body.String())
+			}
+			if tc.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+// jwksServer 是身份提供方的 JWKS 端点，keys 可以在测试中替换 (轮换)
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	body    []byte
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, body []byte) *jwksServer {
+	t.Helper()
+	s := &jwksServer{body: body}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Write(s.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) rotate(body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+}
+
+// TestJWKSRotationOnUnknownKid 令牌带着 JWKS 中还没有的 kid 时按需刷新，但最多每 minRefreshInterval 一次
+func TestJWKSRotationOnUnknownKid(t *testing.T) {
+	oldKey, newKey := newRSAKey(t), newRSAKey(t)
+	srv := newJWKSServer(t, jwksJSON(t, rsaJWK("old", &oldKey.PublicKey)))
+	cfg := baseConfig()
+	cfg.JWKSURL = srv.URL
+	a, h := newRouter(t, cfg)
+
+	if err := a.Ready(context.Background()); err != nil {
+		t.Fatalf("not ready after the initial load: %v", err)
+	}
+	if w := get(h, sign(t, jwt.SigningMethodRS256, "old", oldKey, claims(nil))); w.Code != http.StatusOK {
+		t.Fatalf("old key: status %d", w.Code)
+	}
+
+	// 身份提供方轮换：新的 JWKS 同时包含新旧 key
+	srv.rotate(jwksJSON(t, rsaJWK("old", &oldKey.PublicKey), rsaJWK("new", &newKey.PublicKey)))
+	newToken := sign(t, jwt.SigningMethodRS256, "new", newKey, claims(nil))
+
+	// 刚加载过，未知 kid 不会立即触发刷新
+	if w := get(h, newToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("new key before minRefreshInterval: status %d", w.Code)
+	}
+	if n := srv.fetches.Load(); n != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", n)
+	}
+
+	// 超过 minRefreshInterval 后，未知 kid 触发一次刷新
+	a.keys.mu.Lock()
+	a.keys.lastAttempt = time.Now().Add(-minRefreshInterval)
+	a.keys.mu.Unlock()
+	if w := get(h, newToken); w.Code != http.StatusOK {
+		t.Fatalf("new key after refresh: status %d", w.Code)
+	}
+	if w := get(h, sign(t, jwt.SigningMethodRS256, "old", oldKey, claims(nil))); w.Code != http.StatusOK {
+		t.Fatalf("old key after rotation: status %d", w.Code)
+	}
+	// 伪造的 kid 不会让每个请求都去请求身份提供方
+	for i := 0; i < 5; i++ {
+		get(h, sign(t, jwt.SigningMethodRS256, "forged", newKey, claims(nil)))
+	}
+	if n := srv.fetches.Load(); n != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", n)
+	}
+}
+
+// TestJWKSPeriodicRefresh 定期刷新让旧 key 在从 JWKS 中移除后失效；刷新失败时保留上一次的 key
+func TestJWKSPeriodicRefresh(t *testing.T) {
+	oldKey, newKey := newRSAKey(t), newRSAKey(t)
+	srv := newJWKSServer(t, jwksJSON(t, rsaJWK("old", &oldKey.PublicKey)))
+	cfg := baseConfig()
+	cfg.JWKSURL = srv.URL
+	cfg.RefreshInterval = 10 * time.Millisecond
+	_, h := newRouter(t, cfg)
+
+	oldToken := sign(t, jwt.SigningMethodRS256, "old", oldKey, claims(nil))
+	newToken := sign(t, jwt.SigningMethodRS256, "new", newKey, claims(nil))
+
+	srv.rotate([]byte(`{"keys": [`))
+	waitFetches(t, srv, srv.fetches.Load()+2)
+	if w := get(h, oldToken); w.Code != http.StatusOK {
+		t.Fatalf("old key after a failed refresh: status %d", w.Code)
+	}
+
+	srv.rotate(jwksJSON(t, rsaJWK("new", &newKey.PublicKey)))
+	waitFetches(t, srv, srv.fetches.Load()+2)
+	if w := get(h, newToken); w.Code != http.StatusOK {
+		t.Fatalf("new key: status %d", w.Code)
+	}
+	if w := get(h, oldToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("removed key: status %d", w.Code)
+	}
+}
+
+func waitFetches(t *testing.T, srv *jwksServer, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.fetches.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("JWKS fetched %d times, want at least %d", srv.fetches.Load(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNotReadyUntilJWKSLoads(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	cfg := baseConfig()
+	cfg.JWKSURL = srv.URL
+	a, _ := newRouter(t, cfg)
+	if err := a.Ready(context.Background()); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("Ready = %v, want the load error", err)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	cfg := baseConfig()
+	cfg.HMACSecret = testSecret
+	a, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(a.Identify())
+	r.GET("/me", a.Authenticate(), a.RequireRole("admin"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	if w := get(r, sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(nil))); w.Code != http.StatusOK {
+		t.Fatalf("admin: status %d", w.Code)
+	}
+	// 空格分隔的角色字符串
+	if w := get(r, sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"roles": "support viewer"}))); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: status %d", w.Code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{name: "disabled", cfg: Config{}, ok: true},
+		{name: "hmac", cfg: Config{Enabled: true, Algorithms: []string{AlgHS256}, HMACSecret: testSecret}, ok: true},
+		{name: "short secret", cfg: Config{Enabled: true, Algorithms: []string{AlgHS256}, HMACSecret: "short"}},
+		{name: "no keys", cfg: Config{Enabled: true, Algorithms: []string{AlgRS256}}},
+		{name: "unsupported algorithm", cfg: Config{Enabled: true, Algorithms: []string{"none"}, HMACSecret: testSecret}},
+		{name: "file and url", cfg: Config{Enabled: true, Algorithms: []string{AlgRS256}, JWKSFile: "a", JWKSURL: "b"}},
+	} {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%s: Validate = %v", tc.name, err)
+		}
+	}
+}
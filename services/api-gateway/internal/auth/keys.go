@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"vv-ecommerce/pkg/logging"
+)
+
+const (
+	// minRefreshInterval 遇到未知 kid 时按需刷新 JWKS 的最小间隔，防止伪造 kid 的请求打爆身份提供方
+	minRefreshInterval = 30 * time.Second
+	maxJWKSBytes       = 1 << 20
+)
+
+// jwk 是 JWKS 中的一个 key (RFC 7517)，只支持 RSA 和 oct (HMAC)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// keySet 保存当前的验签 key：静态 HMAC secret + 从文件 / URL 加载的 JWKS
+// JWKS 定期重新加载，身份提供方轮换 key 时新旧 key 可以同时生效 (取决于 JWKS 中是否保留旧 key)
+type keySet struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]interface{} // kid -> []byte (HS) / *rsa.PublicKey (RS)
+	loaded      bool
+	lastErr     error
+	lastAttempt time.Time
+}
+
+func newKeySet(cfg Config) *keySet {
+	return &keySet{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   map[string]interface{}{},
+	}
+}
+
+func (s *keySet) hasJWKS() bool {
+	return s.cfg.JWKSFile != "" || s.cfg.JWKSURL != ""
+}
+
+// run 定期刷新 JWKS，直到 ctx 结束
+func (s *keySet) run(ctx context.Context) {
+	if !s.hasJWKS() || s.cfg.RefreshInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refresh(ctx)
+		}
+	}
+}
+
+// refresh 重新加载 JWKS；失败时保留旧 key 继续验签
+func (s *keySet) refresh(ctx context.Context) error {
+	s.mu.Lock()
+	s.lastAttempt = time.Now()
+	s.mu.Unlock()
+
+	keys, err := s.load(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to load JWKS, keeping previous keys", logging.Err(err))
+		return err
+	}
+	if len(keys) != len(s.keys) || !s.loaded {
+		logging.FromContext(ctx).InfoContext(ctx, "JWKS loaded", "keys", len(keys))
+	}
+	s.keys = keys
+	s.loaded = true
+	return nil
+}
+
+// refreshIfStale 在遇到未知 kid 时调用，距上次加载超过 minRefreshInterval 才真正刷新
+func (s *keySet) refreshIfStale(ctx context.Context) bool {
+	if !s.hasJWKS() {
+		return false
+	}
+	// 检查和占位在同一把锁内，并发的未知 kid 请求只触发一次加载
+	s.mu.Lock()
+	stale := time.Since(s.lastAttempt) >= minRefreshInterval
+	if stale {
+		s.lastAttempt = time.Now()
+	}
+	s.mu.Unlock()
+	return stale && s.refresh(ctx) == nil
+}
+
+func (s *keySet) load(ctx context.Context) (map[string]interface{}, error) {
+	var raw []byte
+	var err error
+	if s.cfg.JWKSFile != "" {
+		raw, err = os.ReadFile(s.cfg.JWKSFile)
+	} else {
+		raw, err = s.fetch(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(raw)
+}
+
+func (s *keySet) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+}
+
+// lookup 按 kid 查找 key，HMAC 找不到时使用静态 secret；token 没有 kid 时，只有一个候选 key 才能使用
+func (s *keySet) lookup(kid string, hmac bool) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if kid != "" {
+		if key, ok := s.keys[kid]; ok {
+			return key, true
+		}
+	}
+	if hmac && s.cfg.HMACSecret != "" {
+		return []byte(s.cfg.HMACSecret), true
+	}
+	if kid != "" {
+		return nil, false
+	}
+	var found interface{}
+	for _, key := range s.keys {
+		if _, isHMAC := key.([]byte); isHMAC != hmac {
+			continue
+		}
+		if found != nil {
+			return nil, false
+		}
+		found = key
+	}
+	return found, found != nil
+}
+
+// ready 报告 JWKS 是否已加载 (只用静态 secret 时总是就绪)
+func (s *keySet) ready() error {
+	if !s.hasJWKS() {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.loaded {
+		if s.lastErr != nil {
+			return fmt.Errorf("JWKS not loaded: %w", s.lastErr)
+		}
+		return errors.New("JWKS not loaded")
+	}
+	return nil
+}
+
+func parseJWKS(raw []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		kid := k.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i) // 没有 kid 的 key 只能被没有 kid 的 token 使用 (见 lookup)
+		}
+		switch k.Kty {
+		case "RSA":
+			pub, err := rsaPublicKey(k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RSA key %q: %w", k.Kid, err)
+			}
+			keys[kid] = pub
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("invalid oct key %q", k.Kid)
+			}
+			keys[kid] = secret
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+func rsaPublicKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("missing or invalid modulus / exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
@@ -0,0 +1,346 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheStatusHeader 标记响应来自缓存 (HIT)、上游 (MISS) 还是没有经过缓存 (BYPASS)
+const CacheStatusHeader = "X-Cache"
+
+// cachedHeaders 随响应体一起缓存的响应头
+var cachedHeaders = []string{"Content-Type", "Content-Encoding", "Last-Modified"}
+
+// Rule 是一条路由的缓存配置
+type Rule struct {
+	TTL time.Duration
+	// Tags 用于失效，{name} 替换为路径参数的值，如 product:{sku}
+	Tags []string
+}
+
+// Cache 是所有路由共用的缓存：存储，以及合并同一个 key 并发未命中的 singleflight
+type Cache struct {
+	store        Store
+	maxBodyBytes int
+	group        singleflight.Group
+}
+
+// New maxBodyBytes 以上的响应不缓存
+func New(store Store, maxBodyBytes int) *Cache {
+	return &Cache{store: store, maxBodyBytes: maxBodyBytes}
+}
+
+// Invalidate 使带这些标签的缓存条目全部失效
+func (ca *Cache) Invalidate(ctx context.Context, tags []string) error {
+	return ca.store.Bump(ctx, tags)
+}
+
+// InvalidateHandler POST {"tags": [...]}：管理接口，按标签清除缓存
+func (ca *Cache) InvalidateHandler(c *gin.Context) {
+	var req struct {
+		Tags []string `json:"tags" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, apperror.InvalidInput("tags is required", err))
+		return
+	}
+	if err := ca.Invalidate(c.Request.Context(), req.Tags); err != nil {
+		response.Error(c, apperror.ServiceUnavailable("failed to invalidate cache", err))
+		return
+	}
+	logging.FromContext(c.Request.Context()).InfoContext(c.Request.Context(), "cache invalidated", "tags", req.Tags)
+	response.Success(c, gin.H{"invalidated": req.Tags})
+}
+
+// Middleware 缓存 GET 路由的 200 响应
+//   - 请求带 Cache-Control: no-store 时不读也不写缓存，no-cache / max-age=0 时跳过缓存读取、用上游响应刷新缓存
+//   - 上游响应带 no-store / private / Set-Cookie 时不缓存，带 max-age / s-maxage 时 TTL 取较小值
+//   - 命中时 If-None-Match 与条目的 ETag 匹配返回 304；上游没有 ETag 时按响应体生成
+//   - 同一个 key 的并发未命中只有一个请求转发到上游，其他请求等待它的结果
+//
+// 缓存出错 (如 Redis 不可用) 时直接转发，不影响请求
+func (ca *Cache) Middleware(rule Rule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		route := c.FullPath()
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		reqCC := parseCacheControl(c.GetHeader("Cache-Control"))
+		if _, ok := reqCC["no-store"]; ok {
+			ca.bypass(c, route)
+			return
+		}
+
+		key, err := ca.key(ctx, c, rule.Tags)
+		if err != nil {
+			logging.FromContext(ctx).WarnContext(ctx, "cache lookup failed, forwarding request", logging.Err(err))
+			ca.bypass(c, route)
+			return
+		}
+		_, noCache := reqCC["no-cache"]
+		if maxAge, ok := reqCC["max-age"]; ok && maxAge == "0" {
+			noCache = true
+		}
+		if !noCache {
+			if e := ca.get(ctx, key); e != nil {
+				metrics.HTTPCache.WithLabelValues(route, "hit").Inc()
+				serve(c, e, "HIT")
+				return
+			}
+		}
+
+		// 未命中：同一个 key 只有第一个请求 (leader) 转发到上游，边写给客户端边记录响应
+		leader := false
+		var panicked any
+		v, _, _ := ca.group.Do(key, func() (any, error) {
+			leader = true
+			// leader 的 panic (如客户端断开时 ReverseProxy 的 http.ErrAbortHandler) 不能传给等待的请求
+			defer func() { panicked = recover() }()
+			return ca.fill(c, key, rule.TTL), nil
+		})
+		if leader {
+			if panicked != nil {
+				panic(panicked)
+			}
+			metrics.HTTPCache.WithLabelValues(route, "miss").Inc()
+			return
+		}
+		if e, _ := v.(*Entry); e != nil {
+			metrics.HTTPCache.WithLabelValues(route, "coalesced").Inc()
+			serve(c, e, "HIT")
+			return
+		}
+		// leader 的响应不可缓存 (如上游报错)，自己转发
+		ca.bypass(c, route)
+	}
+}
+
+// fill 转发请求并缓存可缓存的响应，返回缓存的条目 (不可缓存时为 nil)
+func (ca *Cache) fill(c *gin.Context, key string, ttl time.Duration) *Entry {
+	// 去掉条件请求头，上游返回完整的 200 才能缓存
+	c.Request.Header.Del("If-None-Match")
+	c.Request.Header.Del("If-Modified-Since")
+	c.Header(CacheStatusHeader, "MISS")
+
+	rec := &recorder{ResponseWriter: c.Writer, limit: ca.maxBodyBytes}
+	c.Writer = rec
+	c.Next()
+	c.Writer = rec.ResponseWriter
+
+	e := rec.entry(ttl)
+	if e == nil {
+		return nil
+	}
+	ctx := c.Request.Context()
+	raw, err := json.Marshal(e)
+	if err == nil {
+		err = ca.store.Set(ctx, key, raw, e.TTL)
+	}
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to store cache entry", logging.Err(err))
+	}
+	return e
+}
+
+func (ca *Cache) bypass(c *gin.Context, route string) {
+	metrics.HTTPCache.WithLabelValues(route, "bypass").Inc()
+	c.Header(CacheStatusHeader, "BYPASS")
+	c.Next()
+}
+
+func (ca *Cache) get(ctx context.Context, key string) *Entry {
+	raw, ok, err := ca.store.Get(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to read cache entry", logging.Err(err))
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	var e Entry
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return nil
+	}
+	return &e
+}
+
+// key 由方法、路径、排序后的查询参数和各标签的当前代数组成，标签失效后 key 随之改变
+func (ca *Cache) key(ctx context.Context, c *gin.Context, tags []string) (string, error) {
+	expanded := make([]string, len(tags))
+	for i, t := range tags {
+		expanded[i] = expandTag(t, c.Param)
+	}
+	gens, err := ca.store.Generations(ctx, expanded)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s", c.Request.Method, c.Request.URL.Path, c.Request.URL.Query().Encode())
+	for i, t := range expanded {
+		fmt.Fprintf(h, "|%s=%d", t, gens[i])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// expandTag 把 {name} 替换为路径参数的值
+func expandTag(tag string, param func(string) string) string {
+	for {
+		start := strings.IndexByte(tag, '{')
+		end := strings.IndexByte(tag, '}')
+		if start < 0 || end < start {
+			return tag
+		}
+		tag = tag[:start] + param(tag[start+1:end]) + tag[end+1:]
+	}
+}
+
+// serve 用缓存的条目响应，If-None-Match 匹配时返回 304
+func serve(c *gin.Context, e *Entry, status string) {
+	h := c.Writer.Header()
+	for k, v := range e.Header {
+		h[k] = v
+	}
+	h.Set("ETag", e.ETag)
+	h.Set("Age", strconv.Itoa(int(time.Since(e.StoredAt).Seconds())))
+	h.Set(CacheStatusHeader, status)
+
+	if etagMatch(c.GetHeader("If-None-Match"), e.ETag) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	body := e.Body
+	if e.Envelope {
+		if b, ok := response.ReplaceTraceID(body, c.GetString(middleware.TraceIDKey)); ok {
+			body = b
+		}
+	}
+	c.Data(e.Status, e.Header.Get("Content-Type"), body)
+	c.Abort()
+}
+
+// etagMatch If-None-Match 使用弱比较 (忽略 W/ 前缀)，支持逗号分隔的多个值和 *
+func etagMatch(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCacheControl 解析 Cache-Control 指令，如 {"max-age": "60", "no-cache": ""}
+func parseCacheControl(header string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// recorder 在写出响应的同时最多保留 limit 字节响应体，超过后放弃缓存
+type recorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *recorder) record(b []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(b) > w.limit {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+		return
+	}
+	w.body.Write(b)
+}
+
+// entry 返回可缓存的响应，不可缓存时返回 nil
+func (w *recorder) entry(ttl time.Duration) *Entry {
+	header := w.Header()
+	if w.Status() != http.StatusOK || w.overflow || header.Get("Set-Cookie") != "" {
+		return nil
+	}
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := cc["no-store"]; ok {
+		return nil
+	}
+	if _, ok := cc["private"]; ok {
+		return nil
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[d]; ok {
+			if secs, err := strconv.Atoi(v); err == nil {
+				ttl = min(ttl, time.Duration(secs)*time.Second)
+			}
+			break
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	e := &Entry{
+		Status:   http.StatusOK,
+		Header:   http.Header{},
+		Body:     w.body.Bytes(),
+		ETag:     header.Get("ETag"),
+		StoredAt: time.Now(),
+		TTL:      ttl,
+	}
+	for _, k := range cachedHeaders {
+		if v := header.Values(k); len(v) > 0 {
+			e.Header[k] = v
+		}
+	}
+	// 缓存的响应体不能带第一个请求的 trace ID，否则所有命中的请求都会报告同一个 trace
+	if e.Header.Get("Content-Encoding") == "" && strings.HasPrefix(e.Header.Get("Content-Type"), "application/json") {
+		if b, ok := response.ReplaceTraceID(e.Body, ""); ok {
+			e.Body, e.Envelope = b, true
+		}
+	}
+	if e.ETag == "" {
+		sum := sha256.Sum256(e.Body)
+		e.ETag = `W/"` + hex.EncodeToString(sum[:8]) + `"`
+	}
+	return e
+}
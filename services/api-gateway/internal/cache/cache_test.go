@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestHitCarriesCurrentTraceID 命中的响应带当前请求的 trace ID，而不是填充缓存的那个请求的
+func TestHitCarriesCurrentTraceID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := 0
+	r := gin.New()
+	r.Use(middleware.TraceID())
+	r.GET("/products/:sku", New(NewMemoryStore(100), 1<<20).Middleware(Rule{TTL: time.Minute, Tags: []string{"product:{sku}"}}), func(c *gin.Context) {
+		upstream++
+		response.Success(c, gin.H{"sku": c.Param("sku"), "stock": 3})
+	})
+
+	get := func(traceID string) (cacheStatus, bodyTraceID string, data json.RawMessage) {
+		req := httptest.NewRequest(http.MethodGet, "/products/sku-1", nil)
+		req.Header.Set(middleware.TraceIDHeader, traceID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		var res struct {
+			Data json.RawMessage `json:"data"`
+			Meta response.Meta   `json:"meta"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return w.Header().Get(CacheStatusHeader), res.Meta.TraceID, res.Data
+	}
+
+	status, first, data := get("trace-a")
+	if status != "MISS" || first != "trace-a" {
+		t.Fatalf("first request: X-Cache %s, trace_id %q", status, first)
+	}
+	status, second, cached := get("trace-b")
+	if status != "HIT" || upstream != 1 {
+		t.Fatalf("second request: X-Cache %s after %d upstream calls, want a hit", status, upstream)
+	}
+	if second != "trace-b" {
+		t.Fatalf("cached response trace_id = %q, want trace-b", second)
+	}
+	if string(cached) != string(data) {
+		t.Fatalf("cached data = %s, want %s", cached, data)
+	}
+}
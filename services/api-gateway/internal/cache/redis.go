@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore 所有网关实例共享缓存和标签代数，任一实例 (或 MQ 事件) 失效后所有实例生效
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore prefix 如 "cache:api-gateway:"
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := s.client.Get(ctx, s.prefix+"entry:"+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+"entry:"+key, value, ttl).Err()
+}
+
+func (s *RedisStore) Generations(ctx context.Context, tags []string) ([]int64, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	// 逐个 GET 而不是 MGET：Redis Cluster 下标签可能落在不同的 slot
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(tags))
+	for i, t := range tags {
+		cmds[i] = pipe.Get(ctx, s.prefix+"tag:"+t)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	gens := make([]int64, len(tags))
+	for i, cmd := range cmds {
+		if v, err := cmd.Int64(); err == nil {
+			gens[i] = v
+		}
+	}
+	return gens, nil
+}
+
+func (s *RedisStore) Bump(ctx context.Context, tags []string) error {
+	pipe := s.client.Pipeline()
+	for _, t := range tags {
+		pipe.Incr(ctx, s.prefix+"tag:"+t)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
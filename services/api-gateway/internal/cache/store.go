@@ -0,0 +1,102 @@
+// Package cache 是网关的 HTTP 响应缓存：按路由配置 TTL 和标签，条目存在进程内或 Redis 中
+// 失效按标签进行：每个标签有一个代数，代数计入缓存 key，使标签失效只需把代数加一，旧条目随 TTL 过期
+package cache
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry 是一个缓存的响应
+type Entry struct {
+	Status   int           `json:"status"`
+	Header   http.Header   `json:"header"`
+	Body     []byte        `json:"body"`
+	ETag     string        `json:"etag"`
+	StoredAt time.Time     `json:"stored_at"`
+	TTL      time.Duration `json:"ttl"`
+	// Envelope 为 true 时 Body 是统一响应结构，meta.trace_id 已删除，返回时填入当前请求的 trace ID
+	Envelope bool `json:"envelope,omitempty"`
+}
+
+// Store 保存缓存条目和标签代数
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Generations 返回各标签的当前代数，没有失效过的标签为 0
+	Generations(ctx context.Context, tags []string) ([]int64, error)
+	// Bump 使带这些标签的条目全部失效
+	Bump(ctx context.Context, tags []string) error
+}
+
+// MemoryStore 进程内存储，多个网关实例各自缓存、各自失效
+type MemoryStore struct {
+	maxEntries  int
+	mu          sync.Mutex
+	entries     map[string]memoryEntry
+	generations map[string]int64
+	lastSweep   time.Time
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// sweepInterval 清理过期条目的间隔
+const sweepInterval = time.Minute
+
+// NewMemoryStore 最多保存 maxEntries 个条目，满了之后新的响应不再缓存，直到旧条目过期
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{maxEntries: maxEntries, entries: map[string]memoryEntry{}, generations: map[string]int64{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.lastSweep = now
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= s.maxEntries {
+		return nil
+	}
+	s.entries[key] = memoryEntry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Generations(_ context.Context, tags []string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gens := make([]int64, len(tags))
+	for i, t := range tags {
+		gens[i] = s.generations[t]
+	}
+	return gens, nil
+}
+
+func (s *MemoryStore) Bump(_ context.Context, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tags {
+		s.generations[t]++
+	}
+	return nil
+}
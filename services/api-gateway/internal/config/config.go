@@ -1,24 +1,245 @@
 package config
 
 import (
-	"log"
+	"api-gateway/internal/auth"
+	"api-gateway/internal/handler"
+	"api-gateway/internal/upstream"
+	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/middleware"
+	"vv-ecommerce/pkg/ratelimit"
+	"vv-ecommerce/pkg/server"
+	"vv-ecommerce/pkg/tracing"
 )
 
 type Config struct {
-	ServerPort          int
+	ServerPort int
+	// 上游地址，多个实例用逗号分隔，网关在实例间轮询并剔除连续失败的实例
 	OrderServiceURL     string
 	InventoryServiceURL string
 	PaymentServiceURL   string
+	Log                 logging.Config
+	Tracing             tracing.Config
+	Health              health.Config
+	Server              server.Config
+	Auth                auth.Config
+	// TrustedProxies 网关前面的负载均衡地址 (CIDR)，只信任它们设置的 X-Forwarded-For；为空时客户端 IP 取 TCP 对端地址
+	TrustedProxies []string
+	// ErrorDetails 错误响应中是否保留 cause / origins (上游的内部错误信息)，只用于调试；关闭时它们只记录在日志中
+	ErrorDetails bool
+	Redis        RedisConfig
+	RateLimit    RateLimitConfig
+	Routes       RoutesConfig
+	// Proxy 网关到上游的连接池
+	Proxy handler.TransportConfig
+	// Upstream 上游重试 (路由表中的 retry 可以覆盖) 和实例剔除
+	Upstream upstream.Config
+	// Details 订单详情组合接口查询各上游的超时
+	Details handler.DetailsConfig
+	Cache   CacheConfig
+	MQ      MQConfig
 }
 
+// CacheConfig 响应缓存配置，各路由的 TTL 和标签在路由表中配置
+type CacheConfig struct {
+	Enabled bool
+	// Store 为 redis (默认，所有网关实例共享缓存，失效对所有实例生效) 或 memory
+	Store        string
+	MaxBodyBytes int
+	// MaxEntries 进程内存储最多保存的条目数
+	MaxEntries int
+}
+
+// MQConfig 消息队列配置，网关从 cache_invalidate 接收服务发出的缓存失效事件
+type MQConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+}
+
+// URL 返回 AMQP 连接地址
+func (m MQConfig) URL() string {
+	return fmt.Sprintf("amqp://%s:%s@%s:%s/", m.User, m.Password, m.Host, m.Port)
+}
+
+// RoutesConfig 路由表文件，修改后每 ReloadInterval 内生效
+type RoutesConfig struct {
+	File           string
+	ReloadInterval time.Duration
+}
+
+// RedisConfig Redis 配置 (RateLimit.Store 为 redis 时使用)
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// RateLimitConfig 限流配置，配额格式见 ratelimit.ParseQuota；按路由的配额在路由表中配置
+type RateLimitConfig struct {
+	Enabled bool
+	// Store 为 redis (默认，多个网关实例共享配额，不可用时降级为进程内) 或 memory
+	Store  string
+	Limits middleware.RateLimitConfig
+}
+
+// 默认配额：匿名按 IP，登录用户按用户，合作方按 API key
+const (
+	defaultIPQuota     = "300/1m"
+	defaultUserQuota   = "120/1m"
+	defaultAPIKeyQuota = "600/1m"
+)
+
 func Load() *Config {
+	srv := server.Defaults()
+	proxy := handler.DefaultTransportConfig()
+	up := upstream.DefaultConfig()
 	return &Config{
 		ServerPort:          getEnvAsInt("SERVER_PORT", 8000), // Gateway 跑在 8000 端口
 		OrderServiceURL:     getEnv("ORDER_SERVICE_URL", "http://localhost:8080"),
 		InventoryServiceURL: getEnv("INVENTORY_SERVICE_URL", "http://localhost:8081"),
 		PaymentServiceURL:   getEnv("PAYMENT_SERVICE_URL", "http://localhost:8082"),
+		// 与下游服务的 Log.* / Tracing.* 配置使用相同的环境变量名
+		Log: logging.Config{
+			Level:     getEnv("LOG_LEVEL", "info"),
+			Format:    getEnv("LOG_FORMAT", logging.FormatJSON),
+			PanicFile: getEnv("LOG_PANICFILE", ""),
+			Access: logging.AccessConfig{
+				SampleRate:    getEnvAsFloat("LOG_ACCESS_SAMPLERATE", 1),
+				Routes:        logging.DefaultAccessRoutes(),
+				DebugTraceIDs: getEnvAsSlice("LOG_ACCESS_DEBUGTRACEIDS", nil),
+				MaxBodyBytes:  getEnvAsInt("LOG_ACCESS_MAXBODYBYTES", logging.DefaultMaxBodyBytes),
+			},
+			Redact: logging.RedactConfig{
+				Fields:      getEnvAsSlice("LOG_REDACT_FIELDS", nil),
+				Headers:     getEnvAsSlice("LOG_REDACT_HEADERS", nil),
+				QueryParams: getEnvAsSlice("LOG_REDACT_QUERYPARAMS", nil),
+				Mask:        getEnv("LOG_REDACT_MASK", logging.DefaultMask),
+			},
+		},
+		Tracing: tracing.Config{
+			Exporter:    getEnv("TRACING_EXPORTER", tracing.ExporterNone),
+			Endpoint:    getEnv("TRACING_ENDPOINT", ""),
+			Insecure:    getEnvAsBool("TRACING_INSECURE", true),
+			SampleRatio: getEnvAsFloat("TRACING_SAMPLERATIO", 1),
+		},
+		// 默认开启认证，未配置 AUTH_HMACSECRET / AUTH_JWKSFILE / AUTH_JWKSURL 时网关拒绝启动
+		Auth: auth.Config{
+			Enabled:         getEnvAsBool("AUTH_ENABLED", true),
+			Algorithms:      getEnvAsSlice("AUTH_ALGORITHMS", []string{auth.AlgHS256, auth.AlgRS256}),
+			HMACSecret:      getEnv("AUTH_HMACSECRET", ""),
+			JWKSFile:        getEnv("AUTH_JWKSFILE", ""),
+			JWKSURL:         getEnv("AUTH_JWKSURL", ""),
+			RefreshInterval: getEnvAsDuration("AUTH_REFRESHINTERVAL", 5*time.Minute),
+			Issuer:          getEnv("AUTH_ISSUER", ""),
+			Audience:        getEnv("AUTH_AUDIENCE", ""),
+			Leeway:          getEnvAsDuration("AUTH_LEEWAY", 30*time.Second),
+			RolesClaim:      getEnv("AUTH_ROLESCLAIM", "roles"),
+		},
+		TrustedProxies: getEnvAsSlice("GATEWAY_TRUSTEDPROXIES", nil),
+		ErrorDetails:   getEnvAsBool("GATEWAY_ERRORDETAILS", false),
+		Redis: RedisConfig{
+			Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
+			Password: getEnv("REDIS_PASSWORD", ""),
+			DB:       getEnvAsInt("REDIS_DB", 0),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: getEnvAsBool("RATELIMIT_ENABLED", true),
+			Store:   getEnv("RATELIMIT_STORE", "redis"),
+			Limits: middleware.RateLimitConfig{
+				Default: map[string]ratelimit.Quota{
+					ratelimit.DimensionIP:     getEnvAsQuota("RATELIMIT_IP", defaultIPQuota),
+					ratelimit.DimensionUser:   getEnvAsQuota("RATELIMIT_USER", defaultUserQuota),
+					ratelimit.DimensionAPIKey: getEnvAsQuota("RATELIMIT_APIKEY", defaultAPIKeyQuota),
+				},
+			},
+		},
+		Routes: RoutesConfig{
+			File:           getEnv("ROUTES_FILE", "configs/routes.yaml"),
+			ReloadInterval: getEnvAsDuration("ROUTES_RELOADINTERVAL", 2*time.Second),
+		},
+		Proxy: handler.TransportConfig{
+			MaxIdleConns:          getEnvAsInt("PROXY_MAXIDLECONNS", proxy.MaxIdleConns),
+			MaxIdleConnsPerHost:   getEnvAsInt("PROXY_MAXIDLECONNSPERHOST", proxy.MaxIdleConnsPerHost),
+			MaxConnsPerHost:       getEnvAsInt("PROXY_MAXCONNSPERHOST", proxy.MaxConnsPerHost),
+			IdleConnTimeout:       getEnvAsDuration("PROXY_IDLECONNTIMEOUT", proxy.IdleConnTimeout),
+			DialTimeout:           getEnvAsDuration("PROXY_DIALTIMEOUT", proxy.DialTimeout),
+			ResponseHeaderTimeout: getEnvAsDuration("PROXY_RESPONSEHEADERTIMEOUT", proxy.ResponseHeaderTimeout),
+		},
+		Upstream: upstream.Config{
+			Retry: upstream.RetryConfig{
+				Attempts:            getEnvAsInt("UPSTREAM_RETRY_ATTEMPTS", up.Retry.Attempts),
+				PerTryTimeout:       getEnvAsDuration("UPSTREAM_RETRY_PERTRYTIMEOUT", up.Retry.PerTryTimeout),
+				BaseBackoff:         getEnvAsDuration("UPSTREAM_RETRY_BASEBACKOFF", up.Retry.BaseBackoff),
+				BudgetRatio:         getEnvAsFloat("UPSTREAM_RETRY_BUDGETRATIO", up.Retry.BudgetRatio),
+				MinRetriesPerSecond: getEnvAsFloat("UPSTREAM_RETRY_MINPERSECOND", up.Retry.MinRetriesPerSecond),
+			},
+			Outlier: upstream.OutlierConfig{
+				ConsecutiveFailures: getEnvAsInt("UPSTREAM_OUTLIER_CONSECUTIVEFAILURES", up.Outlier.ConsecutiveFailures),
+				BaseEjectionTime:    getEnvAsDuration("UPSTREAM_OUTLIER_BASEEJECTIONTIME", up.Outlier.BaseEjectionTime),
+				MaxEjectionTime:     getEnvAsDuration("UPSTREAM_OUTLIER_MAXEJECTIONTIME", up.Outlier.MaxEjectionTime),
+				MaxEjectionPercent:  getEnvAsInt("UPSTREAM_OUTLIER_MAXEJECTIONPERCENT", up.Outlier.MaxEjectionPercent),
+			},
+		},
+		// 订单是必需的部分，多等一会；支付和库存超时只会让对应部分缺失
+		Details: handler.DetailsConfig{
+			OrderTimeout:     getEnvAsDuration("DETAILS_ORDERTIMEOUT", 2*time.Second),
+			PaymentTimeout:   getEnvAsDuration("DETAILS_PAYMENTTIMEOUT", time.Second),
+			InventoryTimeout: getEnvAsDuration("DETAILS_INVENTORYTIMEOUT", time.Second),
+		},
+		Cache: CacheConfig{
+			Enabled:      getEnvAsBool("CACHE_ENABLED", true),
+			Store:        getEnv("CACHE_STORE", "redis"),
+			MaxBodyBytes: getEnvAsInt("CACHE_MAXBODYBYTES", 1<<20),
+			MaxEntries:   getEnvAsInt("CACHE_MAXENTRIES", 10000),
+		},
+		// 与下游服务的 MQ.* 配置使用相同的环境变量名
+		MQ: MQConfig{
+			Host:     getEnv("MQ_HOST", "localhost"),
+			Port:     getEnv("MQ_PORT", "5672"),
+			User:     getEnv("MQ_USER", "guest"),
+			Password: getEnv("MQ_PASSWORD", "guest"),
+		},
+		Health: health.Config{
+			Timeout:       getEnvAsDuration("HEALTH_TIMEOUT", 2*time.Second),
+			CacheTTL:      getEnvAsDuration("HEALTH_CACHETTL", 2*time.Second),
+			ShutdownDelay: getEnvAsDuration("HEALTH_SHUTDOWNDELAY", 5*time.Second),
+		},
+		Server: server.Config{
+			ReadHeaderTimeout: getEnvAsDuration("SERVER_READHEADERTIMEOUT", srv.ReadHeaderTimeout),
+			ReadTimeout:       getEnvAsDuration("SERVER_READTIMEOUT", srv.ReadTimeout),
+			WriteTimeout:      getEnvAsDuration("SERVER_WRITETIMEOUT", srv.WriteTimeout),
+			IdleTimeout:       getEnvAsDuration("SERVER_IDLETIMEOUT", srv.IdleTimeout),
+			ShutdownTimeout:   getEnvAsDuration("SERVER_SHUTDOWNTIMEOUT", srv.ShutdownTimeout),
+			// 按路由的 deadline 在路由表中配置 (timeout)
+			RequestTimeout: middleware.TimeoutConfig{
+				Default: getEnvAsDuration("SERVER_REQUESTTIMEOUT_DEFAULT", srv.RequestTimeout.Default),
+			},
+			MaxBodyBytes: int64(getEnvAsInt("SERVER_MAXBODYBYTES", int(srv.MaxBodyBytes))),
+			LoadShed: middleware.LoadShedConfig{
+				InitialLimit:  getEnvAsInt("SERVER_LOADSHED_INITIALLIMIT", srv.LoadShed.InitialLimit),
+				MinLimit:      getEnvAsInt("SERVER_LOADSHED_MINLIMIT", srv.LoadShed.MinLimit),
+				MaxLimit:      getEnvAsInt("SERVER_LOADSHED_MAXLIMIT", srv.LoadShed.MaxLimit),
+				LatencyTarget: getEnvAsDuration("SERVER_LOADSHED_LATENCYTARGET", srv.LoadShed.LatencyTarget),
+				RetryAfter:    getEnvAsDuration("SERVER_LOADSHED_RETRYAFTER", srv.LoadShed.RetryAfter),
+			},
+		},
+	}
+}
+
+// Upstreams 返回上游服务名到实例地址的映射
+func (c *Config) Upstreams() map[string][]string {
+	return map[string][]string{
+		handler.UpstreamOrder:     splitList(c.OrderServiceURL),
+		handler.UpstreamInventory: splitList(c.InventoryServiceURL),
+		handler.UpstreamPayment:   splitList(c.PaymentServiceURL),
 	}
 }
 
@@ -37,6 +258,69 @@ func getEnvAsInt(key string, fallback int) int {
 	if value, err := strconv.Atoi(strValue); err == nil {
 		return value
 	}
-	log.Printf("Warning: Invalid integer for env %s: %s. Using default %d", key, strValue, fallback)
+	slog.Warn("invalid integer env, using default", "key", key, "value", strValue, "default", fallback)
+	return fallback
+}
+
+func getEnvAsBool(key string, fallback bool) bool {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return fallback
+	}
+	if value, err := strconv.ParseBool(strValue); err == nil {
+		return value
+	}
+	slog.Warn("invalid bool env, using default", "key", key, "value", strValue, "default", fallback)
+	return fallback
+}
+
+func getEnvAsFloat(key string, fallback float64) float64 {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return fallback
+	}
+	if value, err := strconv.ParseFloat(strValue, 64); err == nil {
+		return value
+	}
+	slog.Warn("invalid float env, using default", "key", key, "value", strValue, "default", fallback)
 	return fallback
 }
+
+func getEnvAsDuration(key string, fallback time.Duration) time.Duration {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return fallback
+	}
+	if value, err := time.ParseDuration(strValue); err == nil {
+		return value
+	}
+	slog.Warn("invalid duration env, using default", "key", key, "value", strValue, "default", fallback.String())
+	return fallback
+}
+
+// getEnvAsSlice 读取逗号分隔的列表，忽略空项；未设置时返回 fallback
+func getEnvAsSlice(key string, fallback []string) []string {
+	if getEnv(key, "") == "" {
+		return fallback
+	}
+	return splitList(getEnv(key, ""))
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func getEnvAsQuota(key, fallback string) ratelimit.Quota {
+	q, err := ratelimit.ParseQuota(getEnv(key, fallback))
+	if err != nil {
+		slog.Warn("invalid quota env, using default", "key", key, "default", fallback, logging.Err(err))
+		q, _ = ratelimit.ParseQuota(fallback)
+	}
+	return q
+}
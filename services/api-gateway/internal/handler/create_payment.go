@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"api-gateway/internal/auth"
+	"api-gateway/internal/upstream"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePayment POST /payments：确认订单属于当前用户 (admin 除外) 之后再转发给 payment-service。
+// 支付以 order_id 为唯一键，不检查的话任何用户都能抢先为别人的订单支付，让订单的主人只能得到冲突；
+// 别人的订单与不存在的订单一样返回 404，路由需要 auth: required
+func (h *GatewayHandler) CreatePayment(c *gin.Context) {
+	if auth.UserID(c) == "" {
+		response.Error(c, apperror.Unauthorized("authentication required", nil))
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.Error(c, apperror.PayloadTooLarge("request body too large", nil))
+			return
+		}
+		response.Error(c, apperror.InvalidInput("failed to read request body", err))
+		return
+	}
+	var req struct {
+		OrderID string `json:"order_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.OrderID == "" {
+		response.Error(c, apperror.InvalidInput("order_id is required", err))
+		return
+	}
+
+	// order-service 只返回调用者自己的订单 (admin 除外)，canView 再检查一次
+	order, err := h.fetch(c.Request.Context(), identityHeader(c), UpstreamOrder, "/orders", req.OrderID, h.details.OrderTimeout)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+	if !canView(c, order) {
+		response.Error(c, apperror.NotFound("Order not found", nil))
+		return
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Request.URL.Path = "/payments"
+	c.Request.URL.RawPath = ""
+	h.proxy(c, UpstreamPayment, upstream.Policy{})
+}
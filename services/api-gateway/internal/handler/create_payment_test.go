@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"api-gateway/internal/auth"
+	"api-gateway/internal/upstream"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// fakeOrderService 按 X-User-ID 过滤订单 (与 order-service 相同)；leaked 中的订单返回给任何人，模拟上游的过滤失效
+func fakeOrderService(t *testing.T, owners map[string]string, leaked ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orderID := r.URL.Query().Get("order_id")
+		owner, ok := owners[orderID]
+		admin := slices.Contains(strings.Split(r.Header.Get(middleware.UserRolesHeader), ","), "admin")
+		if !ok || (owner != r.Header.Get(middleware.UserIDHeader) && !admin && !slices.Contains(leaked, orderID)) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"code":40400,"message":"Order not found","data":null,"meta":{},"type":"NOT_FOUND"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"code":0,"message":"success","data":{"order_id":"`+orderID+`","user_id":`+owner+`},"meta":{}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// paymentRequest 是 payment-service 收到的请求
+type paymentRequest struct {
+	path, userID, body string
+}
+
+func TestCreatePaymentChecksOrderOwner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	orders := fakeOrderService(t, map[string]string{"o-7": "7", "o-leak": "7"}, "o-leak")
+
+	var mu sync.Mutex
+	var received []paymentRequest
+	payments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, paymentRequest{r.URL.Path, r.Header.Get(middleware.UserIDHeader), string(body)})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"code":0,"message":"success","data":{"order_id":"o-7"},"meta":{}}`)
+	}))
+	t.Cleanup(payments.Close)
+
+	h, err := NewGatewayHandler(map[string][]string{UpstreamOrder: {orders.URL}, UpstreamPayment: {payments.URL}},
+		DefaultTransportConfig(), upstream.DefaultConfig(), DetailsConfig{OrderTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authn, err := auth.New(context.Background(), auth.Config{Enabled: true, Algorithms: []string{auth.AlgHS256}, HMACSecret: testSecret, RolesClaim: "roles"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(middleware.TraceID(), authn.Identify())
+	r.POST("/api/v1/payments", h.CreatePayment)
+
+	token := func(sub string, roles ...string) string {
+		raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": sub, "roles": roles, "exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(testSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	for _, tc := range []struct {
+		name, token, body string
+		want              int
+		forwarded         bool
+	}{
+		{name: "owner", token: token("7"), body: `{"order_id":"o-7","amount":100}`, want: http.StatusOK, forwarded: true},
+		{name: "another user's order", token: token("8"), body: `{"order_id":"o-7","amount":100}`, want: http.StatusNotFound},
+		{name: "another user in the body", token: token("8"), body: `{"order_id":"o-7","amount":100,"user_id":7}`, want: http.StatusNotFound},
+		{name: "admin", token: token("1", "admin"), body: `{"order_id":"o-7","amount":100}`, want: http.StatusOK, forwarded: true},
+		// order-service 没有按用户过滤时，网关仍然按订单的 user_id 拒绝
+		{name: "order returned for another user", token: token("8"), body: `{"order_id":"o-leak","amount":100}`, want: http.StatusNotFound},
+		{name: "unknown order", token: token("7"), body: `{"order_id":"o-404","amount":100}`, want: http.StatusNotFound},
+		{name: "no order_id", token: token("7"), body: `{"amount":100}`, want: http.StatusBadRequest},
+		{name: "anonymous", body: `{"order_id":"o-7","amount":100}`, want: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			received = nil
+			mu.Unlock()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/payments", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			// 客户端自带的身份头不能被转发
+			req.Header.Set(middleware.UserIDHeader, "7")
+			w := recorder{httptest.NewRecorder()}
+			r.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !tc.forwarded {
+				if len(received) != 0 {
+					t.Fatalf("payment-service was called: %+v", received)
+				}
+				return
+			}
+			if len(received) != 1 {
+				t.Fatalf("payment-service got %d requests, want 1", len(received))
+			}
+			got := received[0]
+			if got.path != "/payments" || got.body != tc.body || got.userID == "" || got.userID != jwtSubject(t, tc.token) {
+				t.Fatalf("forwarded %+v", got)
+			}
+		})
+	}
+}
+
+func jwtSubject(t *testing.T, raw string) string {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, claims); err != nil {
+		t.Fatal(err)
+	}
+	sub, _ := claims.GetSubject()
+	return sub
+}
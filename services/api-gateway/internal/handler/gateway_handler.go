@@ -1,105 +1,272 @@
 package handler
 
 import (
+	"api-gateway/internal/auth"
+	"api-gateway/internal/routes"
+	"api-gateway/internal/upstream"
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"vv-ecommerce/pkg/clients"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/common/traceid"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
+// 上游服务名，路由表中的 upstream 引用它们
+const (
+	UpstreamOrder     = "order-service"
+	UpstreamInventory = "inventory-service"
+	UpstreamPayment   = "payment-service"
+)
+
+// 内置处理器名，路由表中的 handler 引用它们
+const (
+	HandlerOrderDetails    = "order-details"
+	HandlerCreatePayment   = "create-payment"
+	HandlerCacheInvalidate = "cache-invalidate"
+)
+
 type GatewayHandler struct {
-	orderTarget     *url.URL
-	inventoryTarget *url.URL
-	paymentTarget   *url.URL
+	// upstreams 上游服务名 -> 实例选择、重试和剔除；代理和组合接口都经由它发请求，共用连接池
+	upstreams map[string]*upstream.Upstream
+	// proxies 上游服务名 -> 反向代理，启动时创建一次，所有路由共用
+	proxies  map[string]*httputil.ReverseProxy
+	handlers map[string]gin.HandlerFunc
+	details  DetailsConfig
 }
 
-func NewGatewayHandler(orderURL, inventoryURL, paymentURL string) *GatewayHandler {
-	oTarget, _ := url.Parse(orderURL)
-	iTarget, _ := url.Parse(inventoryURL)
-	pTarget, _ := url.Parse(paymentURL)
+// ginContextKey 在请求 ctx 中保存 gin.Context，供 ReverseProxy 的 ErrorHandler 写统一错误结构
+type ginContextKey struct{}
 
-	return &GatewayHandler{
-		orderTarget:     oTarget,
-		inventoryTarget: iTarget,
-		paymentTarget:   pTarget,
+// NewGatewayHandler upstreams 是上游服务名到实例地址的映射，如 order-service -> [http://order-service:8080]
+func NewGatewayHandler(upstreams map[string][]string, transport TransportConfig, resilience upstream.Config, details DetailsConfig) (*GatewayHandler, error) {
+	rt := NewTransport(transport)
+	buffers := newBufferPool()
+	h := &GatewayHandler{
+		upstreams: make(map[string]*upstream.Upstream, len(upstreams)),
+		proxies:   make(map[string]*httputil.ReverseProxy, len(upstreams)),
+		details:   details,
+	}
+	for name, urls := range upstreams {
+		up, err := upstream.New(name, urls, rt, resilience)
+		if err != nil {
+			return nil, err
+		}
+		h.upstreams[name] = up
+		h.proxies[name] = newProxy(up, buffers)
+	}
+	h.handlers = map[string]gin.HandlerFunc{
+		HandlerOrderDetails:  h.OrderDetails,
+		HandlerCreatePayment: h.CreatePayment,
 	}
+	return h, nil
 }
 
-// Proxy 是核心方法，它创建一个 ReverseProxy 并把请求转发出去
-func (h *GatewayHandler) Proxy(target *url.URL) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		proxy := httputil.NewSingleHostReverseProxy(target)
+// Register 注册其他组件提供的内置处理器 (如缓存失效接口)，需要在加载路由表之前调用
+func (h *GatewayHandler) Register(name string, fn gin.HandlerFunc) {
+	h.handlers[name] = fn
+}
+
+// Targets 返回路由表可以引用的上游服务名和内置处理器名
+func (h *GatewayHandler) Targets() routes.Targets {
+	return routes.Targets{
+		Upstreams: slices.Sorted(maps.Keys(h.proxies)),
+		Handlers:  slices.Sorted(maps.Keys(h.handlers)),
+	}
+}
 
-		// 自定义 Director 来修改请求（如果需要）
-		originalDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			originalDirector(req)
-			// 这里可以添加额外的 Header，比如把网关收到的 UserID 传下去
-			// req.Header.Set("X-User-ID", c.GetString("user_id"))
+// Route 返回路由表中一条路由的处理函数：内置处理器，或者转发给上游
+func (h *GatewayHandler) Route(route routes.Route) gin.HandlerFunc {
+	if route.Handler != "" {
+		return h.handlers[route.Handler]
+	}
+	return h.forward(route)
+}
 
-			// 重要：我们需要重写 Host Header，否则有些后端服务会拒绝请求
-			req.Host = target.Host
+// forward 按路由表中的一条路由改写路径和查询参数，再按它的重试策略转发给上游
+func (h *GatewayHandler) forward(route routes.Route) gin.HandlerFunc {
+	var policy upstream.Policy
+	if route.Retry != nil {
+		policy = upstream.Policy{Attempts: route.Retry.Attempts, PerTryTimeout: route.Retry.PerTryTimeout}
+	}
+	return func(c *gin.Context) {
+		path, query := route.UpstreamPath(c.Request.URL.Path, c.Param)
+		c.Request.URL.Path = path
+		c.Request.URL.RawPath = ""
+		if len(query) > 0 {
+			// 用 Set 而不是 Add：客户端不能再带一个同名参数
+			q := c.Request.URL.Query()
+			for k, v := range query {
+				q.Set(k, v)
+			}
+			c.Request.URL.RawQuery = q.Encode()
 		}
 
-		// 自定义 ErrorHandler
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			fmt.Printf("Proxy error: %v\n", err)
-			c.JSON(http.StatusBadGateway, gin.H{"error": "Service unavailable"})
-		}
+		h.proxy(c, route.Upstream, policy)
+	}
+}
 
-		// ModifyResponse: 统一包装成功响应为 {code: 0, msg: "success", data: ...}
-		proxy.ModifyResponse = func(resp *http.Response) error {
-			// 只处理 200 OK 且是 JSON 的响应
-			if resp.StatusCode == http.StatusOK && strings.Contains(resp.Header.Get("Content-Type"), "application/json") {
-				body, err := io.ReadAll(resp.Body)
-				if err != nil {
-					return err
-				}
-				resp.Body.Close()
-
-				// 构造统一响应结构
-				wrapper := struct {
-					Code    int             `json:"code"`
-					Message string          `json:"message"`
-					Data    json.RawMessage `json:"data"`
-				}{
-					Code:    0,
-					Message: "success",
-					Data:    json.RawMessage(body),
-				}
-
-				newBody, err := json.Marshal(wrapper)
-				if err != nil {
-					return err
-				}
-
-				// 重置 Body 和 Content-Length
-				resp.Body = io.NopCloser(bytes.NewReader(newBody))
-				resp.ContentLength = int64(len(newBody))
-				resp.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+// proxy 带上网关认证的身份，把 c.Request 按 policy 转发给上游 name
+func (h *GatewayHandler) proxy(c *gin.Context, name string, policy upstream.Policy) {
+	setIdentity(c, c.Request.Header)
+	ctx := upstream.WithPolicy(c.Request.Context(), policy)
+	c.Request = c.Request.WithContext(context.WithValue(ctx, ginContextKey{}, c))
+	h.proxies[name].ServeHTTP(c.Writer, c.Request)
+}
+
+// setIdentity 身份头只能由网关设置：先删除客户端自带的，再写入 JWT 认证得到的用户 ID 和角色，
+// 并把网关生成/收到的 TraceID 传给下游
+func setIdentity(c *gin.Context, header http.Header) {
+	header.Del(middleware.UserIDHeader)
+	header.Del(middleware.UserRolesHeader)
+	if userID := auth.UserID(c); userID != "" {
+		header.Set(middleware.UserIDHeader, userID)
+		header.Set(middleware.UserRolesHeader, strings.Join(auth.Roles(c), ","))
+	}
+	header.Set(middleware.TraceIDHeader, middleware.GetTraceID(c))
+}
+
+// identityHeader 返回组合接口调用上游时带的请求头
+func identityHeader(c *gin.Context) http.Header {
+	header := http.Header{}
+	setIdentity(c, header)
+	return header
+}
+
+// newProxy 创建转发到 up 的 ReverseProxy
+// 下游服务已经返回统一的 {code, message, data, meta} 结构，网关原样透传，响应体边读边写，不在内存中缓存；
+// text/event-stream 和长度未知 (chunked) 的响应每次写入后立即 flush
+func newProxy(up *upstream.Upstream, buffers httputil.BufferPool) *httputil.ReverseProxy {
+	target := up.URL()
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// SetURL 同时把 Host 改成上游的 Host，否则有些后端服务会拒绝请求；实例由 up 在发出时选择
+			pr.SetURL(target)
+			// 追加到客户端 (或前面的负载均衡) 带来的 X-Forwarded-For 后面
+			pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			pr.SetXForwarded()
+		},
+		Transport:  up,
+		BufferPool: buffers,
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode >= http.StatusBadRequest && !response.ErrorDetailsExposed() {
+				return stripErrorDetails(resp, up.Name())
 			}
 			return nil
-		}
-
-		proxy.ServeHTTP(c.Writer, c.Request)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			c := r.Context().Value(ginContextKey{}).(*gin.Context)
+			proxyError(c, up.Name(), err)
+		},
 	}
 }
 
-func (h *GatewayHandler) OrderProxy() gin.HandlerFunc {
-	return h.Proxy(h.orderTarget)
+// maxErrorBodyBytes 网关改写的上游错误响应体上限，统一错误结构远小于它
+const maxErrorBodyBytes = 64 << 10
+
+// stripErrorDetails 删除上游错误响应中的 cause / origins (见 response.ExposeErrorDetails)，其余字段不变
+// 超过 maxErrorBodyBytes 的响应体无法检查是否带有内部细节，换成保留上游状态码的通用错误结构
+func stripErrorDetails(resp *http.Response, name string) error {
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes+1))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if len(body) > maxErrorBodyBytes {
+		ctx := resp.Request.Context()
+		logging.FromContext(ctx).WarnContext(ctx, "upstream error response too large, replaced with a generic error",
+			"upstream", name, "status", resp.StatusCode, "limit", maxErrorBodyBytes)
+		body = genericError(ctx, resp.StatusCode, name)
+	} else if out, ok := response.StripErrorDetails(body); ok {
+		body = out
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
 }
 
-func (h *GatewayHandler) InventoryProxy() gin.HandlerFunc {
-	return h.Proxy(h.inventoryTarget)
+// genericError 返回只由状态码决定的统一错误结构，错误码沿用 "状态码 * 100" 的约定 (如 40400)
+func genericError(ctx context.Context, status int, name string) []byte {
+	errType := apperror.TypeInternal
+	switch status {
+	case http.StatusNotFound:
+		errType = apperror.TypeNotFound
+	case http.StatusConflict:
+		errType = apperror.TypeConflict
+	case http.StatusUnauthorized:
+		errType = apperror.TypeUnauthorized
+	case http.StatusForbidden:
+		errType = apperror.TypeForbidden
+	case http.StatusRequestEntityTooLarge:
+		errType = apperror.TypePayloadTooLarge
+	case http.StatusTooManyRequests:
+		errType = apperror.TypeTooManyRequests
+	case http.StatusBadGateway:
+		errType = apperror.TypeBadGateway
+	case http.StatusServiceUnavailable:
+		errType = apperror.TypeServiceUnavailable
+	case http.StatusGatewayTimeout:
+		errType = apperror.TypeTimeout
+	default:
+		if status < http.StatusInternalServerError {
+			errType = apperror.TypeInvalidInput
+		}
+	}
+	body, _ := json.Marshal(response.ErrorResponse{
+		Code:    status * 100,
+		Message: strings.ToLower(http.StatusText(status)),
+		Meta:    response.Meta{TraceID: traceid.FromContext(ctx)},
+		Type:    string(errType),
+		Service: name,
+	})
+	return body
 }
 
-func (h *GatewayHandler) PaymentProxy() gin.HandlerFunc {
-	return h.Proxy(h.paymentTarget)
+// proxyError 把转发失败 (重试之后仍然失败) 映射为统一错误结构，meta.trace_id 是网关的 TraceID
+//   - 请求 deadline 到了或实例超时：504 TIMEOUT
+//   - 请求体超过上限：413
+//   - 所有实例都被剔除：503 SERVICE_UNAVAILABLE
+//   - 连接失败、连接被重置等：502 BAD_GATEWAY (code 50200 表示错误发生在网关到上游之间)
+func proxyError(c *gin.Context, name string, err error) {
+	ctx := c.Request.Context()
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		// 客户端已经断开，响应没有人接收；499 沿用 nginx 的约定，只用于日志和指标
+		logging.FromContext(ctx).InfoContext(ctx, "client canceled request", "upstream", name)
+		c.AbortWithStatus(499)
+		return
+	}
+	logging.FromContext(ctx).ErrorContext(ctx, "proxy error", "upstream", name, logging.Err(err))
+
+	// err 里有上游地址和连接错误，上面已经记录；返回给客户端的错误不带 cause
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		response.Error(c, apperror.PayloadTooLarge("request body too large", nil))
+		return
+	}
+	if errors.Is(err, upstream.ErrNoHealthyInstance) {
+		response.Error(c, apperror.ServiceUnavailable("no healthy upstream", nil))
+		return
+	}
+	if appErr, _ := apperror.As(clients.WrapClientError(err, name+" timed out")); appErr.Type == apperror.TypeTimeout {
+		response.Error(c, apperror.Timeout(appErr.Message, nil))
+		return
+	}
+	response.Error(c, apperror.BadGateway("upstream service unreachable", nil))
 }
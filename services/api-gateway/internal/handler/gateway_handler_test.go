@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"api-gateway/internal/upstream"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProxyErrorHidesUpstreamAddress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 8083}, Err: errors.New("connect: connection refused")}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/payments", nil)
+	proxyError(c, UpstreamPayment, dialErr)
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "10.0.0.7") || strings.Contains(body, "cause") {
+		t.Fatalf("upstream details exposed: %s", body)
+	}
+	if !strings.Contains(body, `"code":50200`) {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+func TestProxyErrorStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 8083}
+	for _, tc := range []struct {
+		name     string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "connection refused",
+			err:      &net.OpError{Op: "dial", Net: "tcp", Addr: addr, Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			wantCode: http.StatusBadGateway, wantBody: `"code":50200`,
+		},
+		{
+			name:     "connection reset",
+			err:      &net.OpError{Op: "read", Net: "tcp", Addr: addr, Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+			wantCode: http.StatusBadGateway, wantBody: `"code":50200`,
+		},
+		{name: "unexpected EOF", err: errors.New("unexpected EOF"), wantCode: http.StatusBadGateway, wantBody: `"type":"BAD_GATEWAY"`},
+		{
+			name:     "no healthy instance",
+			err:      fmt.Errorf("%w: all 2 instances of payment-service are ejected", upstream.ErrNoHealthyInstance),
+			wantCode: http.StatusServiceUnavailable, wantBody: `"code":50300`,
+		},
+		{name: "request deadline", err: context.DeadlineExceeded, wantCode: http.StatusGatewayTimeout, wantBody: `"code":50400`},
+		{
+			name:     "dial timeout",
+			err:      &net.OpError{Op: "dial", Net: "tcp", Addr: addr, Err: os.ErrDeadlineExceeded},
+			wantCode: http.StatusGatewayTimeout, wantBody: `"type":"TIMEOUT"`,
+		},
+		{name: "body too large", err: &http.MaxBytesError{Limit: 10}, wantCode: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/payments", nil)
+			proxyError(c, UpstreamPayment, tc.err)
+
+			if w.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.wantBody) {
+				t.Fatalf("body = %s, want %s", w.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestProxyStripsUpstreamErrorDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 网关按 ErrorDetails 配置关闭错误细节 (生产环境)
+	response.ExposeErrorDetails(false)
+	t.Cleanup(func() { response.ExposeErrorDetails(true) })
+	large := `{"code":40400,"message":"order not found","data":null,"meta":{},"type":"NOT_FOUND","cause":"` + strings.Repeat("x", maxErrorBodyBytes) + `"}`
+	bodies := map[string]string{
+		"/orders/small": `{"code":40900,"message":"stale version","data":null,"meta":{"trace_id":"t-1"},"type":"CONFLICT","cause":"sql: version mismatch at 10.0.0.5","origins":[{"service":"db","code":1}]}`,
+		"/orders/large": large,
+	}
+	statuses := map[string]int{"/orders/small": http.StatusConflict, "/orders/large": http.StatusNotFound}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statuses[r.URL.Path])
+		io.WriteString(w, bodies[r.URL.Path])
+	}))
+	t.Cleanup(srv.Close)
+
+	h, err := NewGatewayHandler(map[string][]string{UpstreamOrder: {srv.URL}}, DefaultTransportConfig(), upstream.DefaultConfig(), DetailsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(middleware.TraceID())
+	r.GET("/orders/:name", func(c *gin.Context) { h.proxy(c, UpstreamOrder, upstream.Policy{}) })
+
+	for _, tc := range []struct {
+		path     string
+		wantCode int
+		want     response.ErrorResponse
+	}{
+		{path: "/orders/small", wantCode: http.StatusConflict, want: response.ErrorResponse{Code: 40900, Message: "stale version", Type: "CONFLICT", Meta: response.Meta{TraceID: "t-1"}}},
+		// 超过上限的错误响应换成通用错误结构，仍然是上游的状态码
+		{path: "/orders/large", wantCode: http.StatusNotFound, want: response.ErrorResponse{Code: 40400, Message: "not found", Type: "NOT_FOUND", Service: UpstreamOrder, Meta: response.Meta{TraceID: "gw-trace"}}},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set(middleware.TraceIDHeader, "gw-trace")
+		w := recorder{httptest.NewRecorder()}
+		r.ServeHTTP(w, req)
+
+		if w.Code != tc.wantCode {
+			t.Fatalf("%s: status = %d, want %d", tc.path, w.Code, tc.wantCode)
+		}
+		if strings.Contains(w.Body.String(), "cause") || strings.Contains(w.Body.String(), "origins") {
+			t.Fatalf("%s: details exposed: %.200s", tc.path, w.Body.String())
+		}
+		var got response.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: body = %+v, want %+v", tc.path, got, tc.want)
+		}
+		if cl := w.Header().Get("Content-Length"); cl != fmt.Sprint(w.Body.Len()) {
+			t.Fatalf("%s: Content-Length = %s, body has %d bytes", tc.path, cl, w.Body.Len())
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"api-gateway/internal/auth"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"vv-ecommerce/pkg/clients"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DetailsConfig 是订单详情组合接口查询各上游的超时
+type DetailsConfig struct {
+	OrderTimeout     time.Duration
+	PaymentTimeout   time.Duration
+	InventoryTimeout time.Duration
+}
+
+// adminRole 可以查看任何人的订单
+const adminRole = "admin"
+
+// OrderDetails 是订单详情组合接口返回的文档
+type OrderDetails struct {
+	Order json.RawMessage `json:"order"`
+	// Payment 为 null 表示还没有支付记录，或者查询失败 (见 Errors)
+	Payment json.RawMessage `json:"payment"`
+	// Items 是订单的库存扣减记录 (SKU、数量、是否已回滚)
+	Items json.RawMessage `json:"items"`
+	// Partial 为 true 时有部分内容缺失，Errors 按部分 (payment / items) 说明原因
+	Partial bool                    `json:"partial"`
+	Errors  map[string]SectionError `json:"errors,omitempty"`
+}
+
+// SectionError 是某一部分查询失败的原因
+type SectionError struct {
+	Upstream string `json:"upstream"`
+	Code     int    `json:"code"`
+	Type     string `json:"type"`
+	Message  string `json:"message"`
+}
+
+// OrderDetails GET /orders/:id/details：并行查询 order-service、payment-service 和 inventory-service，合并成一个文档
+// 订单查询失败时整个请求失败；支付或库存查询失败只把对应部分标记为缺失，不影响其他部分
+// 只能查看自己的订单 (admin 除外)，别人的订单返回 404，路由需要 auth: required
+func (h *GatewayHandler) OrderDetails(c *gin.Context) {
+	ctx := c.Request.Context()
+	orderID := c.Param("id")
+	header := identityHeader(c)
+
+	var (
+		wg                            sync.WaitGroup
+		order, payment, items         json.RawMessage
+		orderErr, paymentErr, itemErr error
+	)
+	wg.Go(func() {
+		order, orderErr = h.fetch(ctx, header, UpstreamOrder, "/orders", orderID, h.details.OrderTimeout)
+	})
+	wg.Go(func() {
+		payment, paymentErr = h.fetch(ctx, header, UpstreamPayment, "/payments", orderID, h.details.PaymentTimeout)
+	})
+	wg.Go(func() {
+		items, itemErr = h.fetch(ctx, header, UpstreamInventory, "/inventory/deductions", orderID, h.details.InventoryTimeout)
+	})
+	wg.Wait()
+
+	if orderErr != nil {
+		response.Error(c, orderErr)
+		return
+	}
+	if !canView(c, order) {
+		response.Error(c, apperror.NotFound("Order not found", nil))
+		return
+	}
+
+	details := OrderDetails{Order: order, Payment: payment, Items: items}
+	// 还没有支付记录不算失败
+	if appErr, ok := apperror.As(paymentErr); ok && appErr.Type == apperror.TypeNotFound {
+		paymentErr = nil
+	}
+	details.flag(ctx, "payment", UpstreamPayment, paymentErr)
+	details.flag(ctx, "items", UpstreamInventory, itemErr)
+
+	response.Success(c, details)
+}
+
+// flag 把查询失败的部分记录到 Errors
+func (d *OrderDetails) flag(ctx context.Context, section, upstream string, err error) {
+	if err == nil {
+		return
+	}
+	logging.FromContext(ctx).WarnContext(ctx, "order details section unavailable", "section", section, "upstream", upstream, logging.Err(err))
+
+	appErr, ok := apperror.As(err)
+	if !ok {
+		appErr = apperror.Internal("unexpected error", err)
+	}
+	if d.Errors == nil {
+		d.Errors = map[string]SectionError{}
+	}
+	d.Errors[section] = SectionError{Upstream: upstream, Code: appErr.Code, Type: string(appErr.Type), Message: appErr.Message}
+	d.Partial = true
+}
+
+// canView 订单属于当前用户，或者当前用户是 admin
+func canView(c *gin.Context, order json.RawMessage) bool {
+	if slices.Contains(auth.Roles(c), adminRole) {
+		return true
+	}
+	var o struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := json.Unmarshal(order, &o); err != nil {
+		return false
+	}
+	return auth.UserID(c) != "" && auth.UserID(c) == strconv.FormatInt(o.UserID, 10)
+}
+
+// fetch GET 上游的 path?order_id=...，返回统一响应结构中的 data；每个上游有自己的超时，超时内按默认策略重试
+func (h *GatewayHandler) fetch(ctx context.Context, header http.Header, upstream, path, orderID string, timeout time.Duration) (json.RawMessage, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	up := h.upstreams[upstream]
+	u := *up.URL()
+	u.Path = path
+	u.RawQuery = url.Values{"order_id": {orderID}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, clients.WrapClientError(err, "failed to create request")
+	}
+	req.Header = header.Clone()
+
+	resp, err := up.Client().Do(req)
+	if err != nil {
+		return nil, clients.WrapClientError(err, "failed to connect to "+upstream)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, clients.HandleHTTPError(resp)
+	}
+	var env struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, apperror.Internal("invalid response from "+upstream, err)
+	}
+	return env.Data, nil
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// TransportConfig 是网关到上游的连接池配置，所有上游共用一个 http.Transport
+type TransportConfig struct {
+	// MaxIdleConnsPerHost 每个上游保留的空闲 keep-alive 连接 (http.DefaultTransport 只有 2 个，
+	// 并发稍高就会不停新建连接并留下大量 TIME_WAIT)
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost 每个上游的连接上限，0 表示不限制
+	MaxConnsPerHost int
+	IdleConnTimeout time.Duration
+	DialTimeout     time.Duration
+	// ResponseHeaderTimeout 等待上游响应头的时间，0 表示只受请求 deadline 限制
+	ResponseHeaderTimeout time.Duration
+}
+
+// DefaultTransportConfig 返回默认的连接池配置
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		MaxIdleConns:        512,
+		MaxIdleConnsPerHost: 128,
+		IdleConnTimeout:     90 * time.Second,
+		DialTimeout:         5 * time.Second,
+	}
+}
+
+// NewTransport 创建到上游的 Transport：keep-alive 连接池，https 上游协商 HTTP/2，
+// 外面包一层 otelhttp，为每次转发创建 client span 并注入 traceparent
+func NewTransport(cfg TransportConfig) http.RoundTripper {
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}
+	return otelhttp.NewTransport(&http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	})
+}
+
+// copyBufferSize 与 ReverseProxy 默认的拷贝缓冲区大小相同
+const copyBufferSize = 32 * 1024
+
+// bufferPool 复用 ReverseProxy 拷贝响应体的缓冲区 (默认每个请求分配 32 KiB)
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func newBufferPool() *bufferPool {
+	return &bufferPool{pool: sync.Pool{New: func() any {
+		b := make([]byte, copyBufferSize)
+		return &b
+	}}}
+}
+
+func (p *bufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+func (p *bufferPool) Put(b []byte) {
+	if cap(b) == copyBufferSize {
+		p.pool.Put(&b)
+	}
+}
@@ -1,95 +1,155 @@
 package router
 
 import (
+	"api-gateway/internal/auth"
+	"api-gateway/internal/cache"
 	"api-gateway/internal/handler"
+	"api-gateway/internal/routes"
+	"fmt"
+	"maps"
 	"net/http"
+	"sync/atomic"
+	"time"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/metrics"
+	"vv-ecommerce/pkg/middleware"
+	"vv-ecommerce/pkg/ratelimit"
+	"vv-ecommerce/pkg/server"
 
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter(h *handler.GatewayHandler) *gin.Engine {
-	r := gin.Default() // 使用 Default，自带 Logger 和 Recovery
+// Options 是构建路由需要的依赖
+type Options struct {
+	Handler *handler.GatewayHandler
+	Checker *health.Checker
+	Server  server.Config
+	Auth    *auth.Authenticator
+	// Limiter 为 nil 时不限流；RateLimit.Routes 由路由表中的 rate_limit 生成
+	Limiter   ratelimit.Limiter
+	RateLimit middleware.RateLimitConfig
+	// Cache 为 nil 时不缓存；各路由的 TTL 和标签来自路由表中的 cache
+	Cache *cache.Cache
+	// TrustedProxies 客户端 IP (限流、日志) 只信任来自这些代理的 X-Forwarded-For
+	TrustedProxies []string
+	// Streams 管理 stream: true 的长连接路由，关闭网关时由它断开
+	Streams *middleware.Streams
+}
 
-	// Health Check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "API Gateway is healthy"})
-	})
+// Router 是网关的 http.Handler：探针和 /metrics 固定注册，/api/v1 下的路由来自路由表
+// 每次 Load 构建一个新的 gin.Engine 再原子替换，正在处理的请求继续使用旧的 engine
+type Router struct {
+	opts   Options
+	engine atomic.Pointer[gin.Engine]
 
-	// API Version 1 Group
-	v1 := r.Group("/api/v1")
-	{
-		// 1. Order Routes -> Order Service
-		// 注意：我们这里直接把所有 /orders 开头的请求都转发过去
-		// 如果后端是 GET /orders，网关也是 GET /api/v1/orders，需要 strip prefix 吗？
-		// 现在的 httputil.NewSingleHostReverseProxy 不会自动 strip path。
-		// 所以如果网关路径是 /api/v1/orders，后端收到的也是 /api/v1/orders。
-		// 但我们的 Order Service 监听的是 /orders。
-		// 所以我们需要重写 URL Path。
+	// 有状态的中间件 (如 LoadShed 的并发上限) 只创建一次，所有 engine 共用
+	global   []gin.HandlerFunc
+	loadShed gin.HandlerFunc
+}
 
-		orders := v1.Group("/orders")
-		orders.Any("/*path", func(c *gin.Context) {
-			// 重写 Path: /api/v1/orders/xxx -> /orders/xxx
-			// 实际上 Gin 的 Group 已经处理了路由匹配，我们只需要把 Path 改对
-			// 简单粗暴法：直接把请求转发给 OrderService 的根目录？不对。
+func New(opts Options) *Router {
+	return &Router{
+		opts: opts,
+		global: []gin.HandlerFunc{
+			middleware.Tracing("api-gateway"),
+			middleware.TraceID(),
+			middleware.Logger(),
+			middleware.Metrics(),
+			middleware.Recovery(),
+		},
+		loadShed: middleware.LoadShed(opts.Server.LoadShed),
+	}
+}
 
-			// 让我们换一种更简单的路由定义方式，针对具体接口定义，或者写一个 PathRewrite 中间件。
-			// 为了演示清晰，我们先针对具体接口做映射。
-		})
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.engine.Load().ServeHTTP(w, req)
+}
 
-		// 重新定义路由映射 (Explicit Mapping)
+// Load 按路由表构建新的 engine 并替换当前的；出错 (如路由冲突) 时保留当前的 engine
+func (r *Router) Load(table *routes.Table) error {
+	e, err := r.build(table)
+	if err != nil {
+		return err
+	}
+	r.engine.Store(e)
+	return nil
+}
 
-		// Order Service
-		// Public: 下单
-		v1.POST("/orders", func(c *gin.Context) {
-			c.Request.URL.Path = "/orders"
-			h.OrderProxy()(c)
-		})
-		// Public: 查单
-		v1.GET("/orders", func(c *gin.Context) {
-			c.Request.URL.Path = "/orders"
-			h.OrderProxy()(c)
-		})
+func (r *Router) build(table *routes.Table) (e *gin.Engine, err error) {
+	// gin 注册冲突的路由 (如 /products/:sku 和 /products/:id) 时直接 panic
+	defer func() {
+		if p := recover(); p != nil {
+			e, err = nil, fmt.Errorf("invalid route table: %v", p)
+		}
+	}()
 
-		// Inventory Service
-		// Public: 商品列表
-		v1.GET("/products", func(c *gin.Context) {
-			// 前端叫 /products，后端叫 /inventories
-			c.Request.URL.Path = "/inventories"
-			h.InventoryProxy()(c)
-		})
-		// Public: 商品详情
-		v1.GET("/products/:sku", func(c *gin.Context) {
-			// 前端 /products/SKU123 -> 后端 /inventory/sku?sku=SKU123
-			// 或者后端改一下路由？现在的后端是 GET /inventory/sku (Query Param)
-			// 我们来适配一下：
-			sku := c.Param("sku")
-			c.Request.URL.Path = "/inventory/sku"
-			q := c.Request.URL.Query()
-			q.Add("sku", sku)
-			c.Request.URL.RawQuery = q.Encode()
+	e = gin.New()
+	if err := e.SetTrustedProxies(r.opts.TrustedProxies); err != nil {
+		return nil, err
+	}
+	e.Use(r.global...)
+
+	// Probes: /livez 只表示进程存活，/readyz 检查依赖，关闭期间返回 503
+	e.GET("/livez", r.opts.Checker.Live)
+	e.GET("/readyz", r.opts.Checker.Ready)
+	// /health 是旧的探针地址，保留为 /readyz 的别名，兼容已有的探针和 compose healthcheck
+	e.GET("/health", r.opts.Checker.Ready)
 
-			h.InventoryProxy()(c)
-		})
+	// Prometheus metrics
+	e.GET("/metrics", gin.WrapH(metrics.Handler()))
 
-		// Payment Service
-		// Public: 消费记录
-		v1.GET("/payments", func(c *gin.Context) {
-			c.Request.URL.Path = "/payments"
-			h.PaymentProxy()(c)
-		})
-		// Public: 创建支付 (测试用)
-		v1.POST("/payments", func(c *gin.Context) {
-			c.Request.URL.Path = "/payments"
-			h.PaymentProxy()(c)
-		})
+	// /api/v1: 过载保护、请求 deadline (路由表中的 timeout 覆盖默认值)、请求体上限、识别用户 (探针和 /metrics 不受影响)
+	// 长连接路由 (stream: true) 不经过过载保护和请求 deadline，所以这两个中间件按路由挂载
+	timeouts := r.opts.Server.RequestTimeout
+	timeouts.Routes = maps.Clone(timeouts.Routes)
+	if timeouts.Routes == nil {
+		timeouts.Routes = map[string]time.Duration{}
+	}
+	for _, rt := range table.Routes {
+		if rt.Timeout != nil {
+			timeouts.Routes[rt.Method+" "+rt.FullPath()] = *rt.Timeout
+		}
+	}
+	timeout := middleware.Timeout(timeouts)
+	common := []gin.HandlerFunc{
+		middleware.BodyLimit(r.opts.Server.MaxBodyBytes),
+		r.opts.Auth.Identify(),
+	}
 
-		// Inventory Service (Additional)
-		// Internal/Admin: 创建库存
-		v1.POST("/inventory/create", func(c *gin.Context) {
-			c.Request.URL.Path = "/inventory/create"
-			h.InventoryProxy()(c)
-		})
+	// 限流：路由表中配置了 rate_limit 的路由使用独立的桶
+	if r.opts.Limiter != nil {
+		cfg := r.opts.RateLimit
+		cfg.Routes = map[string]map[string]ratelimit.Quota{}
+		for _, rt := range table.Routes {
+			if len(rt.Quotas()) > 0 {
+				cfg.Routes[rt.Method+" "+rt.FullPath()] = rt.Quotas()
+			}
+		}
+		common = append(common, middleware.RateLimit(r.opts.Limiter, cfg, auth.UserID))
 	}
 
-	return r
+	// 认证：auth: required 需要登录，roles 还要求对应角色；之后是响应缓存
+	// 所有路由转发前都会删除客户端自带的 X-User-ID / X-User-Roles (见 GatewayHandler.Proxy)
+	v1 := e.Group(routes.Prefix)
+	for _, rt := range table.Routes {
+		var chain []gin.HandlerFunc
+		if rt.Stream {
+			chain = append(chain, r.opts.Streams.Handler())
+		} else {
+			chain = append(chain, r.loadShed, timeout)
+		}
+		chain = append(chain, common...)
+		if rt.RequiresAuth() {
+			chain = append(chain, r.opts.Auth.Authenticate())
+		}
+		for _, role := range rt.Roles {
+			chain = append(chain, r.opts.Auth.RequireRole(role))
+		}
+		if rt.Cache != nil && r.opts.Cache != nil {
+			chain = append(chain, r.opts.Cache.Middleware(cache.Rule{TTL: rt.Cache.TTL, Tags: rt.Cache.Tags}))
+		}
+		chain = append(chain, r.opts.Handler.Route(rt))
+		v1.Handle(rt.Method, rt.Path, chain...)
+	}
+	return e, nil
 }
@@ -0,0 +1,308 @@
+// Package routes 是网关的声明式路由表 (configs/routes.yaml)：每条路由的方法、路径、上游、路径改写和中间件
+// 文件修改后由 Watch 重新加载，校验失败时继续使用旧的路由表
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"vv-ecommerce/pkg/ratelimit"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix 是所有路由的挂载点，路由中的 path 相对于它
+const Prefix = "/api/v1"
+
+// Auth 取值
+const (
+	AuthPublic   = "public"
+	AuthRequired = "required"
+)
+
+var methods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// Route 是一条路由
+type Route struct {
+	// Method / Path 是网关上的路由 (gin 语法，:name 和 *name 为路径参数)，Path 相对于 /api/v1
+	Method string `yaml:"method"`
+	Path   string `yaml:"path"`
+	// Upstream 上游服务名，如 order-service
+	Upstream string `yaml:"upstream"`
+	// Handler 网关内置的处理器 (如 order-details 组合多个上游)，与 upstream 二选一，改写规则不适用
+	Handler string `yaml:"handler"`
+	// StripPrefix 转发前从路径 (已去掉 /api/v1) 中删除的前缀
+	StripPrefix string `yaml:"strip_prefix"`
+	// Rewrite 非空时替换整个上游路径，其中的 :name / *name 用路径参数的值替换
+	Rewrite string `yaml:"rewrite"`
+	// QueryParams 把路径参数转成上游的查询参数：路径参数名 -> 查询参数名
+	QueryParams map[string]string `yaml:"query_params"`
+	// Auth 为 public (默认) 或 required；Roles 非空时隐含 required
+	Auth  string   `yaml:"auth"`
+	Roles []string `yaml:"roles"`
+	// RateLimit 按维度 (ip / user / apikey) 覆盖默认限流配额，如 user: 10/1m；该路由使用独立的桶
+	RateLimit map[string]string `yaml:"rate_limit"`
+	// Cache 缓存响应，只能用于公开的 GET 路由
+	Cache *CacheConfig `yaml:"cache"`
+	// Timeout 覆盖该路由的请求 deadline (SERVER_REQUESTTIMEOUT_DEFAULT)，包括所有重试；0 表示不限制 (长连接用 Stream)
+	Timeout *time.Duration `yaml:"timeout"`
+	// Retry 覆盖默认的上游重试策略，只用于转发到上游的路由
+	Retry *RetryConfig `yaml:"retry"`
+	// Stream 长连接 (如 SSE)：不经过过载保护和请求 deadline，不受 http.Server 的 WriteTimeout 限制，网关关闭时断开
+	Stream bool `yaml:"stream"`
+
+	quotas map[string]ratelimit.Quota
+}
+
+// CacheConfig 是路由的响应缓存配置
+type CacheConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+	// Tags 用于失效 (管理接口或 MQ 事件)，{name} 替换为路径参数的值，如 product:{sku}
+	Tags []string `yaml:"tags"`
+}
+
+// RetryConfig 是路由的上游重试策略，未设置的字段使用 UPSTREAM_RETRY_* 的默认值
+type RetryConfig struct {
+	// Attempts 最多尝试的次数 (含第一次)，1 表示不重试；非幂等请求只在连接失败时重试
+	Attempts int `yaml:"attempts"`
+	// PerTryTimeout 每次尝试等待响应头的时间
+	PerTryTimeout time.Duration `yaml:"per_try_timeout"`
+}
+
+// Table 是校验过的路由表
+type Table struct {
+	Routes []Route `yaml:"routes"`
+	// Version 是文件内容的摘要，用于日志和判断是否变化
+	Version string `yaml:"-"`
+}
+
+// Targets 是路由可以引用的上游服务名和内置处理器名
+type Targets struct {
+	Upstreams []string
+	Handlers  []string
+}
+
+// FullPath 返回网关上的完整路由模板，如 /api/v1/products/:sku
+func (r Route) FullPath() string {
+	return Prefix + r.Path
+}
+
+// RequiresAuth 报告路由是否需要登录
+func (r Route) RequiresAuth() bool {
+	return r.Auth == AuthRequired || len(r.Roles) > 0
+}
+
+// Quotas 返回该路由覆盖的限流配额
+func (r Route) Quotas() map[string]ratelimit.Quota {
+	return r.quotas
+}
+
+// Load 读取并校验路由表
+func Load(path string, targets Targets) (*Table, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(raw, targets)
+}
+
+// Parse 解析并校验路由表，未知字段视为错误 (拼错的字段不会被静默忽略)
+func Parse(raw []byte, targets Targets) (*Table, error) {
+	var t Table
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("invalid route table: %w", err)
+	}
+	if err := t.validate(targets); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	t.Version = fmt.Sprintf("%x", sum[:6])
+	return &t, nil
+}
+
+func (t *Table) validate(targets Targets) error {
+	if len(t.Routes) == 0 {
+		return errors.New("route table has no routes")
+	}
+	var errs []error
+	seen := map[string]bool{}
+	for i := range t.Routes {
+		r := &t.Routes[i]
+		r.Method = strings.ToUpper(r.Method)
+		if r.Auth == "" {
+			r.Auth = AuthPublic
+		}
+		if err := r.validate(targets); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s %s): %w", i, r.Method, r.Path, err))
+			continue
+		}
+		key := r.Method + " " + r.Path
+		if seen[key] {
+			errs = append(errs, fmt.Errorf("route %d: duplicate route %s", i, key))
+		}
+		seen[key] = true
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Route) validate(targets Targets) error {
+	if !slices.Contains(methods, r.Method) {
+		return fmt.Errorf("unsupported method %q", r.Method)
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		return errors.New("path must start with /")
+	}
+	switch {
+	case r.Handler != "":
+		if r.Upstream != "" || r.StripPrefix != "" || r.Rewrite != "" || len(r.QueryParams) > 0 {
+			return errors.New("handler routes cannot set upstream, strip_prefix, rewrite or query_params")
+		}
+		if !slices.Contains(targets.Handlers, r.Handler) {
+			return fmt.Errorf("unknown handler %q (available: %s)", r.Handler, strings.Join(targets.Handlers, ", "))
+		}
+	case !slices.Contains(targets.Upstreams, r.Upstream):
+		return fmt.Errorf("unknown upstream %q (configured: %s)", r.Upstream, strings.Join(targets.Upstreams, ", "))
+	}
+	if r.StripPrefix != "" && !strings.HasPrefix(r.Path, r.StripPrefix) {
+		return fmt.Errorf("strip_prefix %q is not a prefix of the path", r.StripPrefix)
+	}
+
+	params := pathParams(r.Path)
+	if r.Rewrite != "" {
+		if !strings.HasPrefix(r.Rewrite, "/") {
+			return errors.New("rewrite must start with /")
+		}
+		for _, p := range pathParams(r.Rewrite) {
+			if !slices.Contains(params, p) {
+				return fmt.Errorf("rewrite uses unknown path parameter %q", p)
+			}
+		}
+	}
+	for p, q := range r.QueryParams {
+		if !slices.Contains(params, p) {
+			return fmt.Errorf("query_params uses unknown path parameter %q", p)
+		}
+		if q == "" {
+			return fmt.Errorf("query_params: empty query name for %q", p)
+		}
+	}
+
+	if r.Auth != AuthPublic && r.Auth != AuthRequired {
+		return fmt.Errorf("auth must be %s or %s", AuthPublic, AuthRequired)
+	}
+	if r.Timeout != nil && *r.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if r.Retry != nil {
+		if r.Handler != "" {
+			return errors.New("retry only applies to upstream routes")
+		}
+		if r.Retry.Attempts < 0 || r.Retry.PerTryTimeout < 0 {
+			return errors.New("retry: attempts and per_try_timeout must not be negative")
+		}
+	}
+	if r.Stream {
+		if r.Handler != "" {
+			return errors.New("stream only applies to upstream routes")
+		}
+		if r.Cache != nil || r.Timeout != nil {
+			return errors.New("stream routes cannot set cache or timeout")
+		}
+	}
+	if r.Cache != nil {
+		if err := r.validateCache(params); err != nil {
+			return fmt.Errorf("cache: %w", err)
+		}
+	}
+	r.quotas = make(map[string]ratelimit.Quota, len(r.RateLimit))
+	for dim, spec := range r.RateLimit {
+		if dim != ratelimit.DimensionIP && dim != ratelimit.DimensionUser && dim != ratelimit.DimensionAPIKey {
+			return fmt.Errorf("rate_limit: unknown dimension %q (ip, user or apikey)", dim)
+		}
+		q, err := ratelimit.ParseQuota(spec)
+		if err != nil {
+			return fmt.Errorf("rate_limit: %w", err)
+		}
+		r.quotas[dim] = q
+	}
+	return nil
+}
+
+func (r *Route) validateCache(params []string) error {
+	if r.Method != http.MethodGet {
+		return errors.New("only GET routes can be cached")
+	}
+	// 响应按 URL 缓存，不区分用户
+	if r.RequiresAuth() {
+		return errors.New("routes that require auth cannot be cached")
+	}
+	if r.Cache.TTL <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	for _, tag := range r.Cache.Tags {
+		for rest := tag; ; {
+			start, end := strings.IndexByte(rest, '{'), strings.IndexByte(rest, '}')
+			if start < 0 && end < 0 {
+				break
+			}
+			if start < 0 || end < start {
+				return fmt.Errorf("tag %q has unbalanced braces", tag)
+			}
+			if p := rest[start+1 : end]; !slices.Contains(params, p) {
+				return fmt.Errorf("tag %q uses unknown path parameter %q", tag, p)
+			}
+			rest = rest[end+1:]
+		}
+	}
+	return nil
+}
+
+// UpstreamPath 计算转发到上游的路径和新增的查询参数；param 返回路径参数的值
+func (r Route) UpstreamPath(requestPath string, param func(string) string) (string, map[string]string) {
+	var path string
+	if r.Rewrite != "" {
+		segs := strings.Split(r.Rewrite, "/")
+		for i, s := range segs {
+			if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+				segs[i] = strings.TrimPrefix(param(s[1:]), "/")
+			}
+		}
+		path = strings.Join(segs, "/")
+	} else {
+		path = strings.TrimPrefix(requestPath, Prefix)
+		path = strings.TrimPrefix(path, r.StripPrefix)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+
+	var query map[string]string
+	if len(r.QueryParams) > 0 {
+		query = make(map[string]string, len(r.QueryParams))
+		for p, q := range r.QueryParams {
+			query[q] = param(p)
+		}
+	}
+	return path, query
+}
+
+func pathParams(path string) []string {
+	var params []string
+	for _, s := range strings.Split(path, "/") {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			params = append(params, s[1:])
+		}
+	}
+	return params
+}
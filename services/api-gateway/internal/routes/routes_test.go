@@ -0,0 +1,182 @@
+package routes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testTargets = Targets{
+	Upstreams: []string{"order-service", "inventory-service"},
+	Handlers:  []string{"order-details"},
+}
+
+// TestLoadShippedTable 仓库中的 configs/routes.yaml 必须能通过校验
+func TestLoadShippedTable(t *testing.T) {
+	table, err := Load("../../configs/routes.yaml", Targets{
+		Upstreams: []string{"order-service", "inventory-service", "payment-service"},
+		Handlers:  []string{"order-details", "create-payment", "cache-invalidate"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Routes) == 0 || table.Version == "" {
+		t.Fatalf("table = %+v", table)
+	}
+}
+
+func TestParseRejectsInvalidRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		name, route, wantErr string
+	}{
+		{name: "stream with cache", route: "{method: GET, path: /a, upstream: order-service, stream: true, cache: {ttl: 1s}}", wantErr: "stream routes cannot set cache or timeout"},
+		{name: "stream with timeout", route: "{method: GET, path: /a, upstream: order-service, stream: true, timeout: 5s}", wantErr: "stream routes cannot set cache or timeout"},
+		{name: "stream on a handler", route: "{method: GET, path: /a, handler: order-details, stream: true}", wantErr: "stream only applies to upstream routes"},
+		{name: "cache with auth required", route: "{method: GET, path: /a, upstream: order-service, auth: required, cache: {ttl: 1s}}", wantErr: "routes that require auth cannot be cached"},
+		{name: "cache with roles", route: "{method: GET, path: /a, upstream: order-service, roles: [admin], cache: {ttl: 1s}}", wantErr: "routes that require auth cannot be cached"},
+		{name: "cache on POST", route: "{method: POST, path: /a, upstream: order-service, cache: {ttl: 1s}}", wantErr: "only GET routes can be cached"},
+		{name: "cache without ttl", route: "{method: GET, path: /a, upstream: order-service, cache: {tags: [a]}}", wantErr: "ttl must be positive"},
+		{name: "cache tag with unknown param", route: `{method: GET, path: /a/:sku, upstream: order-service, cache: {ttl: 1s, tags: ["product:{id}"]}}`, wantErr: `unknown path parameter "id"`},
+		{name: "unknown upstream", route: "{method: GET, path: /a, upstream: user-service}", wantErr: `unknown upstream "user-service"`},
+		{name: "missing upstream", route: "{method: GET, path: /a}", wantErr: `unknown upstream ""`},
+		{name: "unknown handler", route: "{method: GET, path: /a, handler: magic}", wantErr: `unknown handler "magic"`},
+		{name: "handler with rewrite", route: "{method: GET, path: /a, handler: order-details, rewrite: /b}", wantErr: "handler routes cannot set"},
+		{name: "retry on a handler", route: "{method: GET, path: /a, handler: order-details, retry: {attempts: 2}}", wantErr: "retry only applies to upstream routes"},
+		{name: "unknown field", route: "{method: GET, path: /a, upstream: order-service, upstraem: x}", wantErr: "field upstraem not found"},
+		{name: "unsupported method", route: "{method: TRACE, path: /a, upstream: order-service}", wantErr: "unsupported method"},
+		{name: "relative path", route: "{method: GET, path: a, upstream: order-service}", wantErr: "path must start with /"},
+		{name: "rewrite with unknown param", route: "{method: GET, path: /a/:id, upstream: order-service, rewrite: /b/:sku}", wantErr: `rewrite uses unknown path parameter "sku"`},
+		{name: "query_params with unknown param", route: "{method: GET, path: /a/:id, upstream: order-service, query_params: {sku: sku}}", wantErr: `query_params uses unknown path parameter "sku"`},
+		{name: "strip_prefix not a prefix", route: "{method: GET, path: /a, upstream: order-service, strip_prefix: /b}", wantErr: "is not a prefix of the path"},
+		{name: "invalid auth", route: "{method: GET, path: /a, upstream: order-service, auth: maybe}", wantErr: "auth must be public or required"},
+		{name: "unknown rate limit dimension", route: "{method: GET, path: /a, upstream: order-service, rate_limit: {tenant: 1/1s}}", wantErr: `unknown dimension "tenant"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte("routes:\n  - "+tc.route+"\n"), testTargets)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+
+	if _, err := Parse([]byte("routes:\n  - {method: GET, path: /a, upstream: order-service}\n  - {method: get, path: /a, upstream: inventory-service}\n"), testTargets); err == nil || !strings.Contains(err.Error(), "duplicate route GET /a") {
+		t.Fatalf("duplicate routes: err = %v", err)
+	}
+	if _, err := Parse([]byte("routes: []\n"), testTargets); err == nil {
+		t.Fatal("empty table accepted")
+	}
+}
+
+func TestUpstreamPath(t *testing.T) {
+	for _, tc := range []struct {
+		name, route, requestPath string
+		params                   map[string]string
+		wantPath                 string
+		wantQuery                map[string]string
+	}{
+		{name: "as is", route: "{method: GET, path: /orders, upstream: order-service}", requestPath: "/api/v1/orders", wantPath: "/orders"},
+		{name: "strip_prefix", route: "{method: GET, path: /shop/orders, upstream: order-service, strip_prefix: /shop}", requestPath: "/api/v1/shop/orders", wantPath: "/orders"},
+		{
+			name:        "rewrite and query_params",
+			route:       "{method: GET, path: /products/:sku, upstream: inventory-service, rewrite: /inventory/sku, query_params: {sku: sku}}",
+			requestPath: "/api/v1/products/SKU1", params: map[string]string{"sku": "SKU1"},
+			wantPath: "/inventory/sku", wantQuery: map[string]string{"sku": "SKU1"},
+		},
+		{
+			name:        "rewrite substitutes params",
+			route:       "{method: GET, path: /orders/:id/events, upstream: order-service, rewrite: /orders/:id/stream, query_params: {id: order_id}}",
+			requestPath: "/api/v1/orders/o-1/events", params: map[string]string{"id": "o-1"},
+			wantPath: "/orders/o-1/stream", wantQuery: map[string]string{"order_id": "o-1"},
+		},
+		{
+			name:        "catch-all param",
+			route:       "{method: GET, path: /files/*rest, upstream: order-service, rewrite: /static/*rest}",
+			requestPath: "/api/v1/files/a/b.txt", params: map[string]string{"rest": "/a/b.txt"},
+			wantPath: "/static/a/b.txt",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			table, err := Parse([]byte("routes:\n  - "+tc.route+"\n"), testTargets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path, query := table.Routes[0].UpstreamPath(tc.requestPath, func(name string) string { return tc.params[name] })
+			if path != tc.wantPath || !reflect.DeepEqual(query, tc.wantQuery) {
+				t.Fatalf("UpstreamPath = %s, %v; want %s, %v", path, query, tc.wantPath, tc.wantQuery)
+			}
+		})
+	}
+}
+
+func TestWatchKeepsCurrentTableOnInvalidFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const v1 = "routes:\n  - {method: GET, path: /orders, upstream: order-service}\n"
+	const v2 = "routes:\n  - {method: GET, path: /orders, upstream: order-service}\n  - {method: GET, path: /products, upstream: inventory-service}\n"
+	write(v1)
+	current, err := Load(file, testTargets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var applied []*Table
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Watch(ctx, file, testTargets, 5*time.Millisecond, current, func(table *Table) error {
+			mu.Lock()
+			defer mu.Unlock()
+			applied = append(applied, table)
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	appliedCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(applied)
+	}
+
+	// 校验失败的文件不会替换当前路由表
+	write("routes:\n  - {method: GET, path: /orders, upstream: user-service}\n")
+	time.Sleep(50 * time.Millisecond)
+	if n := appliedCount(); n != 0 {
+		t.Fatalf("invalid table applied %d times", n)
+	}
+
+	write(v2)
+	deadline := time.Now().Add(2 * time.Second)
+	for appliedCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("valid table was not applied")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	got := applied[0]
+	mu.Unlock()
+	if len(got.Routes) != 2 || got.Version == current.Version {
+		t.Fatalf("applied %+v", got)
+	}
+
+	// 内容没有变化时不重复加载
+	time.Sleep(50 * time.Millisecond)
+	if n := appliedCount(); n != 1 {
+		t.Fatalf("table applied %d times, want 1", n)
+	}
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+	"vv-ecommerce/pkg/logging"
+)
+
+// Watch 每 interval 读取一次路由文件，内容变化时重新加载并调用 apply，直到 ctx 结束
+// 按内容判断变化而不是 mtime，ConfigMap 通过符号链接原子替换文件时同样生效；
+// 加载或 apply 失败时继续使用当前路由表，文件再次修改后重试
+func Watch(ctx context.Context, path string, targets Targets, interval time.Duration, current *Table, apply func(*Table) error) {
+	logger := logging.FromContext(ctx).With(logging.KeyComponent, "routes")
+	version := current.Version
+	failed := ""
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			logger.WarnContext(ctx, "failed to read route table", logging.Err(err))
+			continue
+		}
+		sum := sha256.Sum256(raw)
+		v := fmt.Sprintf("%x", sum[:6])
+		if v == version || v == failed {
+			continue
+		}
+
+		table, err := Parse(raw, targets)
+		if err == nil {
+			err = apply(table)
+		}
+		if err != nil {
+			failed = v // 同一份错误内容只报告一次
+			logger.ErrorContext(ctx, "route table rejected, keeping current routes", "version", version, logging.Err(err))
+			continue
+		}
+		logger.InfoContext(ctx, "route table reloaded", "version", table.Version, "previous", version, "routes", len(table.Routes))
+		version, failed = table.Version, ""
+	}
+}
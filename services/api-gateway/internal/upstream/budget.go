@@ -0,0 +1,47 @@
+package upstream
+
+import (
+	"sync"
+	"time"
+)
+
+// budget 限制重试的数量：每个请求存入 ratio 个令牌，每秒另外补充 perSecond 个，每次重试取出一个
+// 上游整体故障时重试最多让流量增加 ratio，而不是 Attempts 倍
+type budget struct {
+	mu        sync.Mutex
+	ratio     float64
+	perSecond float64
+	tokens    float64
+	max       float64
+	last      time.Time
+}
+
+func newBudget(ratio, perSecond float64) *budget {
+	// 最多积攒 10 秒的最低重试数，避免空闲之后一下放出大量重试
+	limit := max(perSecond*10, 1)
+	return &budget{ratio: ratio, perSecond: perSecond, tokens: limit, max: limit, last: time.Now()}
+}
+
+func (b *budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens = min(b.max, b.tokens+b.ratio)
+}
+
+func (b *budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *budget) refill() {
+	now := time.Now()
+	b.tokens = min(b.max, b.tokens+now.Sub(b.last).Seconds()*b.perSecond)
+	b.last = now
+}
@@ -0,0 +1,85 @@
+package upstream
+
+import (
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+	"vv-ecommerce/pkg/metrics"
+)
+
+// instance 是上游的一个实例，字段由 Upstream.mu 保护
+type instance struct {
+	url *url.URL
+	// failures 连续失败次数，成功一次清零
+	failures int
+	// ejections 被剔除的次数，决定下一次剔除多久；恢复后 MaxEjectionTime 内没有再被剔除则清零
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// pick 轮询选择一个没有被剔除的实例，优先选择这个请求还没有试过的；所有实例都被剔除时返回 nil
+func (u *Upstream) pick(tried []*instance) *instance {
+	now := time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	n := len(u.instances)
+	u.next = (u.next + 1) % n
+	var retry *instance
+	for i := range n {
+		inst := u.instances[(u.next+i)%n]
+		if now.Before(inst.ejectedUntil) {
+			continue
+		}
+		if !slices.Contains(tried, inst) {
+			return inst
+		}
+		if retry == nil {
+			retry = inst
+		}
+	}
+	// retry 为 nil 时所有实例都被剔除 (MaxEjectionPercent 保留了至少一个，只有配置变化后才会出现)
+	return retry
+}
+
+// observe 记录一次尝试的结果，连续失败达到阈值时剔除实例
+func (u *Upstream) observe(inst *instance, failed bool) {
+	oc := u.cfg.Outlier
+	if oc.ConsecutiveFailures <= 0 {
+		return
+	}
+	now := time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !failed {
+		inst.failures = 0
+		return
+	}
+	inst.failures++
+	if inst.failures < oc.ConsecutiveFailures || now.Before(inst.ejectedUntil) {
+		return
+	}
+	// 剔除数量达到上限时保持失败计数，等其他实例恢复后再剔除
+	ejected := 0
+	for _, other := range u.instances {
+		if now.Before(other.ejectedUntil) {
+			ejected++
+		}
+	}
+	if ejected+1 > min(len(u.instances)*oc.MaxEjectionPercent/100, len(u.instances)-1) {
+		return
+	}
+
+	if now.Sub(inst.ejectedUntil) > oc.MaxEjectionTime {
+		inst.ejections = 0
+	}
+	inst.ejections++
+	inst.failures = 0
+	d := min(oc.BaseEjectionTime*time.Duration(inst.ejections), oc.MaxEjectionTime)
+	inst.ejectedUntil = now.Add(d)
+
+	metrics.UpstreamEjections.WithLabelValues(u.name, inst.url.Host).Inc()
+	slog.Warn("upstream instance ejected", "upstream", u.name, "instance", inst.url.Host, "duration", d, "ejections", inst.ejections)
+}
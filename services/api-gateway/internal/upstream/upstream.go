@@ -0,0 +1,344 @@
+// Package upstream 是网关到一个上游服务的 http.RoundTripper：在多个实例间轮询，
+// 按路由的策略重试失败的请求 (受重试预算限制)，并被动剔除连续失败的实例
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
+)
+
+// IdempotencyKeyHeader 与 middleware.IdempotencyKeyHeader 一致：带这个头的 POST 由下游去重，可以安全重试
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ErrNoHealthyInstance 上游的所有实例都被剔除，请求没有发出
+var ErrNoHealthyInstance = errors.New("no healthy upstream instance")
+
+// Config 是所有上游共用的重试和剔除配置
+type Config struct {
+	Retry   RetryConfig
+	Outlier OutlierConfig
+}
+
+// RetryConfig 是默认的重试策略，路由可以覆盖 Attempts 和 PerTryTimeout
+type RetryConfig struct {
+	// Attempts 最多尝试的次数 (含第一次)，1 表示不重试
+	Attempts int
+	// PerTryTimeout 每次尝试等待响应头的时间，超时后换一个实例重试；0 表示只受请求 deadline 限制
+	PerTryTimeout time.Duration
+	// BaseBackoff 第 n 次重试前等待 BaseBackoff * 2^(n-1)，再加同样大小以内的随机抖动
+	BaseBackoff time.Duration
+	// BudgetRatio 重试次数最多占请求数的比例；MinRetriesPerSecond 保证低流量时也能重试
+	BudgetRatio         float64
+	MinRetriesPerSecond float64
+}
+
+// OutlierConfig 是被动剔除配置：实例连续失败 ConsecutiveFailures 次后暂时不再分配请求
+type OutlierConfig struct {
+	// ConsecutiveFailures 连续的连接失败、超时或 502/503/504 次数，0 表示不剔除
+	ConsecutiveFailures int
+	// 第 n 次被剔除持续 BaseEjectionTime * n，最长 MaxEjectionTime
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+	// MaxEjectionPercent 同时被剔除的实例最多占的比例，至少保留一个实例
+	MaxEjectionPercent int
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() Config {
+	return Config{
+		Retry: RetryConfig{
+			Attempts:            3,
+			BaseBackoff:         25 * time.Millisecond,
+			BudgetRatio:         0.2,
+			MinRetriesPerSecond: 5,
+		},
+		Outlier: OutlierConfig{
+			ConsecutiveFailures: 5,
+			BaseEjectionTime:    30 * time.Second,
+			MaxEjectionTime:     5 * time.Minute,
+			MaxEjectionPercent:  50,
+		},
+	}
+}
+
+// Policy 是一条路由的重试策略，零值字段使用 RetryConfig 中的默认值
+type Policy struct {
+	Attempts      int
+	PerTryTimeout time.Duration
+}
+
+type policyKey struct{}
+
+// WithPolicy 把路由的重试策略放进请求的 ctx
+func WithPolicy(ctx context.Context, p Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// Upstream 是一个上游服务的所有实例
+type Upstream struct {
+	name      string
+	instances []*instance
+	rt        http.RoundTripper
+	cfg       Config
+	budget    *budget
+	client    *http.Client
+
+	// mu 保护轮询位置和各实例的失败计数、剔除状态
+	mu   sync.Mutex
+	next int
+}
+
+// New urls 是上游的实例地址，如 http://order-service-1:8080；请求经由 rt 发出
+func New(name string, urls []string, rt http.RoundTripper, cfg Config) (*Upstream, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("upstream %s has no instances", name)
+	}
+	u := &Upstream{
+		name:   name,
+		rt:     rt,
+		cfg:    cfg,
+		budget: newBudget(cfg.Retry.BudgetRatio, cfg.Retry.MinRetriesPerSecond),
+	}
+	for _, raw := range urls {
+		target, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || target.Host == "" {
+			return nil, fmt.Errorf("invalid URL %q for upstream %s", raw, name)
+		}
+		u.instances = append(u.instances, &instance{url: target})
+	}
+	u.client = &http.Client{Transport: u}
+	return u, nil
+}
+
+// Name 返回上游服务名
+func (u *Upstream) Name() string {
+	return u.name
+}
+
+// URL 返回第一个实例的地址；请求发出时 scheme 和 host 会换成选中的实例
+func (u *Upstream) URL() *url.URL {
+	return u.instances[0].url
+}
+
+// Instances 返回所有实例的地址 (如用于健康检查)
+func (u *Upstream) Instances() []*url.URL {
+	urls := make([]*url.URL, len(u.instances))
+	for i, inst := range u.instances {
+		urls[i] = inst.url
+	}
+	return urls
+}
+
+// Client 返回经由本上游发请求的 http.Client
+func (u *Upstream) Client() *http.Client {
+	return u.client
+}
+
+// RoundTrip 把请求发给一个实例，失败时按策略换一个实例重试
+//   - 幂等请求 (GET / HEAD / OPTIONS / PUT / DELETE，或者带 Idempotency-Key) 在连接失败、超时或 502/503/504 时重试
+//   - 其他请求只在连接失败 (请求没有发出) 时重试
+//   - 重试受预算限制，上游整体故障时不会把流量放大数倍；请求的 deadline 到了或客户端断开时不再重试
+func (u *Upstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	attempts, perTry := u.policy(ctx)
+	idempotent := isIdempotent(req)
+	u.budget.deposit()
+
+	if attempts > 1 {
+		if err := bufferBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	var tried []*instance
+	for attempt := 1; ; attempt++ {
+		inst := u.pick(tried)
+		if inst == nil {
+			return nil, fmt.Errorf("%w: all %d instances of %s are ejected", ErrNoHealthyInstance, len(u.instances), u.name)
+		}
+		tried = append(tried, inst)
+
+		resp, err := u.try(req, inst, attempt, perTry)
+		reason := failureReason(ctx, resp, err)
+		u.observe(inst, reason != "")
+		if reason == "" || attempt >= attempts || (!idempotent && reason != reasonConnect) {
+			return resp, err
+		}
+		if !u.budget.withdraw() {
+			metrics.UpstreamRetries.WithLabelValues(u.name, reason, "budget_exhausted").Inc()
+			return resp, err
+		}
+		metrics.UpstreamRetries.WithLabelValues(u.name, reason, "retried").Inc()
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		backoff := u.cfg.Retry.BaseBackoff << (attempt - 1)
+		if backoff > 0 {
+			backoff += rand.N(backoff)
+		}
+		logging.FromContext(ctx).WarnContext(ctx, "upstream attempt failed, retrying",
+			"upstream", u.name,
+			"instance", inst.url.Host,
+			"attempt", attempt,
+			"reason", reason,
+			"backoff", backoff,
+			logging.Err(err),
+		)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// policy 返回路由的尝试次数和每次尝试的超时
+func (u *Upstream) policy(ctx context.Context) (int, time.Duration) {
+	p, _ := ctx.Value(policyKey{}).(Policy)
+	if p.Attempts <= 0 {
+		p.Attempts = u.cfg.Retry.Attempts
+	}
+	if p.PerTryTimeout <= 0 {
+		p.PerTryTimeout = u.cfg.Retry.PerTryTimeout
+	}
+	return max(p.Attempts, 1), p.PerTryTimeout
+}
+
+// try 把请求发给 inst；perTry 只限制等待响应头的时间，响应体 (如 SSE) 只受请求的 deadline 限制
+func (u *Upstream) try(req *http.Request, inst *instance, attempt int, perTry time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	out := req.Clone(ctx)
+	out.URL.Scheme = inst.url.Scheme
+	out.URL.Host = inst.url.Host
+	// Host 头使用选中的实例
+	out.Host = ""
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		out.Body = body
+	}
+
+	var timer *time.Timer
+	if perTry > 0 {
+		timer = time.AfterFunc(perTry, cancel)
+	}
+	resp, err := u.rt.RoundTrip(out)
+	// 定时器已经触发：即使响应头刚好到达，ctx 也已经取消，按超时处理
+	if timer != nil && !timer.Stop() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, &tryTimeoutError{instance: inst.url.Host, after: perTry}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 101 的响应体是双向连接，ReverseProxy 需要它实现 io.ReadWriteCloser，不能包装；ctx 随请求结束释放
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		context.AfterFunc(req.Context(), cancel)
+		return resp, nil
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// 失败原因 (metrics 的 reason 标签)
+const (
+	reasonConnect = "connect"
+	reasonTimeout = "timeout"
+	reasonError   = "error"
+)
+
+// failureReason 返回这次尝试失败的原因，成功或者不是实例的问题 (客户端断开、请求 deadline 到了) 时返回空串
+func failureReason(ctx context.Context, resp *http.Response, err error) string {
+	if err != nil {
+		if ctx.Err() != nil {
+			return ""
+		}
+		var timeoutErr *tryTimeoutError
+		if errors.As(err, &timeoutErr) {
+			return reasonTimeout
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return reasonConnect
+		}
+		return reasonError
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return strconv.Itoa(resp.StatusCode)
+	}
+	return ""
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// bufferBody 把请求体读到内存里以便重试时重新发送 (大小已经由 middleware.BodyLimit 限制)
+func bufferBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+// tryTimeoutError 实例在 PerTryTimeout 内没有返回响应头；实现 Timeout() 以便映射为 504
+type tryTimeoutError struct {
+	instance string
+	after    time.Duration
+}
+
+func (e *tryTimeoutError) Error() string {
+	return fmt.Sprintf("%s did not respond within %s", e.instance, e.after)
+}
+
+func (e *tryTimeoutError) Timeout() bool { return true }
+
+// cancelOnClose 响应体关闭时释放这次尝试的 ctx
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,272 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// flaky 是前 failures 个请求失败的上游实例，fail 决定失败的方式
+type flaky struct {
+	*httptest.Server
+	hits     atomic.Int32
+	failures atomic.Int32
+}
+
+func newFlaky(t *testing.T, failures int, fail func(w http.ResponseWriter, r *http.Request)) *flaky {
+	t.Helper()
+	f := &flaky{}
+	f.failures.Store(int32(failures))
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := f.hits.Add(1)
+		if n <= f.failures.Load() {
+			fail(w, r)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// 失败方式
+var (
+	unavailable = func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) }
+	// hangUp 读完请求后直接断开连接：请求已经发出，上游可能已经处理
+	hangUp = func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}
+	// stall 在请求取消之前不返回响应头 (读完请求体后服务端才能发现连接关闭)
+	stall = func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+)
+
+// refusedURL 返回一个没有监听的地址，连接会被拒绝
+func refusedURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return "http://" + addr
+}
+
+func testConfig() Config {
+	return Config{
+		Retry: RetryConfig{Attempts: 3, BudgetRatio: 1, MinRetriesPerSecond: 100},
+	}
+}
+
+// newTestUpstream 的 transport 不复用连接，每次尝试都是新连接 (避免 http.Transport 自己重试复用的连接)
+func newTestUpstream(t *testing.T, name string, cfg Config, urls ...string) *Upstream {
+	t.Helper()
+	u, err := New(name, urls, &http.Transport{DisableKeepAlives: true}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func send(t *testing.T, u *Upstream, method, body string, header http.Header) (*http.Response, error) {
+	t.Helper()
+	req := httptest.NewRequest(method, "http://upstream/orders", strings.NewReader(body))
+	req.RequestURI = ""
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := u.RoundTrip(req)
+	if resp != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func status(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+func TestRoundTripRetriesIdempotentRequestsOnly(t *testing.T) {
+	withKey := http.Header{IdempotencyKeyHeader: {"k-1"}}
+	for _, tc := range []struct {
+		name     string
+		method   string
+		header   http.Header
+		fail     func(http.ResponseWriter, *http.Request)
+		wantCode int
+		wantHits int32
+	}{
+		{name: "GET on 503", method: http.MethodGet, fail: unavailable, wantCode: http.StatusOK, wantHits: 3},
+		{name: "PUT on 503", method: http.MethodPut, fail: unavailable, wantCode: http.StatusOK, wantHits: 3},
+		{name: "POST on 503", method: http.MethodPost, fail: unavailable, wantCode: http.StatusServiceUnavailable, wantHits: 1},
+		{name: "POST with Idempotency-Key on 503", method: http.MethodPost, header: withKey, fail: unavailable, wantCode: http.StatusOK, wantHits: 3},
+		{name: "GET after the connection dropped", method: http.MethodGet, fail: hangUp, wantCode: http.StatusOK, wantHits: 3},
+		// 请求已经发出，上游可能已经创建了订单
+		{name: "POST after the connection dropped", method: http.MethodPost, fail: hangUp, wantHits: 1},
+		{name: "POST with Idempotency-Key after the connection dropped", method: http.MethodPost, header: withKey, fail: hangUp, wantCode: http.StatusOK, wantHits: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFlaky(t, 2, tc.fail)
+			u := newTestUpstream(t, "test-idempotent", testConfig(), srv.URL)
+			resp, err := send(t, u, tc.method, `{"amount":1}`, tc.header)
+			if status(resp) != tc.wantCode || (tc.wantCode == 0) != (err != nil) {
+				t.Fatalf("status = %d, err = %v; want %d", status(resp), err, tc.wantCode)
+			}
+			if n := srv.hits.Load(); n != tc.wantHits {
+				t.Fatalf("upstream got %d requests, want %d", n, tc.wantHits)
+			}
+		})
+	}
+}
+
+// TestRoundTripRetriesPOSTWhenNotSent 连接失败时请求没有发出，POST 也可以换一个实例重试
+func TestRoundTripRetriesPOSTWhenNotSent(t *testing.T) {
+	good := newFlaky(t, 0, nil)
+	u := newTestUpstream(t, "test-connect", testConfig(), refusedURL(t), good.URL)
+	for i := 0; i < 4; i++ {
+		resp, err := send(t, u, http.MethodPost, `{"amount":1}`, nil)
+		if err != nil || status(resp) != http.StatusOK {
+			t.Fatalf("request %d: status = %d, err = %v", i, status(resp), err)
+		}
+	}
+	if n := good.hits.Load(); n != 4 {
+		t.Fatalf("healthy instance got %d requests, want 4", n)
+	}
+}
+
+func TestRoundTripRetryBudget(t *testing.T) {
+	// 每个请求存入 0.5 个令牌，不按时间补充，最多 1 个令牌
+	cfg := Config{Retry: RetryConfig{Attempts: 5, BudgetRatio: 0.5}}
+	srv := newFlaky(t, 1000, unavailable)
+	u := newTestUpstream(t, "test-budget", cfg, srv.URL)
+	exhausted := metrics.UpstreamRetries.WithLabelValues("test-budget", "503", "budget_exhausted")
+	before := testutil.ToFloat64(exhausted)
+
+	for i, wantHits := range []int32{2, 1, 2} {
+		srv.hits.Store(0)
+		if resp, _ := send(t, u, http.MethodGet, "", nil); status(resp) != http.StatusServiceUnavailable {
+			t.Fatalf("request %d: status = %d", i, status(resp))
+		}
+		if n := srv.hits.Load(); n != wantHits {
+			t.Fatalf("request %d: upstream got %d attempts, want %d", i, n, wantHits)
+		}
+	}
+	if n := testutil.ToFloat64(exhausted) - before; n != 3 {
+		t.Fatalf("budget_exhausted = %v, want 3", n)
+	}
+}
+
+func TestRoundTripPerTryTimeout(t *testing.T) {
+	ctx := WithPolicy(context.Background(), Policy{PerTryTimeout: 30 * time.Millisecond})
+
+	srv := newFlaky(t, 1, stall)
+	u := newTestUpstream(t, "test-per-try", testConfig(), srv.URL)
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "http://upstream/orders", nil)
+	req.RequestURI = ""
+	start := time.Now()
+	resp, err := u.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, err = %v", status(resp), err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("took %s, want the stalled attempt cut off after the per-try timeout", elapsed)
+	}
+	if n := srv.hits.Load(); n != 2 {
+		t.Fatalf("upstream got %d attempts, want 2", n)
+	}
+
+	// 非幂等请求超时后不重试，返回可以映射为 504 的超时错误
+	srv = newFlaky(t, 1, stall)
+	u = newTestUpstream(t, "test-per-try", testConfig(), srv.URL)
+	req = httptest.NewRequestWithContext(ctx, http.MethodPost, "http://upstream/orders", strings.NewReader("{}"))
+	req.RequestURI = ""
+	_, err = u.RoundTrip(req)
+	var timeoutErr interface{ Timeout() bool }
+	if !errors.As(err, &timeoutErr) || !timeoutErr.Timeout() {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if n := srv.hits.Load(); n != 1 {
+		t.Fatalf("upstream got %d attempts, want 1", n)
+	}
+}
+
+func TestOutlierEjectionAndRecovery(t *testing.T) {
+	cfg := Config{
+		Retry: RetryConfig{Attempts: 1},
+		Outlier: OutlierConfig{
+			ConsecutiveFailures: 2,
+			BaseEjectionTime:    100 * time.Millisecond,
+			MaxEjectionTime:     time.Second,
+			MaxEjectionPercent:  50,
+		},
+	}
+	good := newFlaky(t, 0, nil)
+	bad := newFlaky(t, 1000, unavailable)
+	u := newTestUpstream(t, "test-outlier", cfg, good.URL, bad.URL)
+	ejections := metrics.UpstreamEjections.WithLabelValues("test-outlier", strings.TrimPrefix(bad.URL, "http://"))
+	before := testutil.ToFloat64(ejections)
+
+	for i := 0; i < 10; i++ {
+		send(t, u, http.MethodGet, "", nil)
+	}
+	if n := bad.hits.Load(); n != 2 {
+		t.Fatalf("failing instance got %d requests, want 2 before it was ejected", n)
+	}
+	if n := good.hits.Load(); n != 8 {
+		t.Fatalf("healthy instance got %d requests, want 8", n)
+	}
+	if n := testutil.ToFloat64(ejections) - before; n != 1 {
+		t.Fatalf("ejections = %v, want 1", n)
+	}
+
+	// 剔除时间过后实例重新接收请求
+	bad.failures.Store(0)
+	time.Sleep(150 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		if resp, err := send(t, u, http.MethodGet, "", nil); err != nil || status(resp) != http.StatusOK {
+			t.Fatalf("after recovery: status = %d, err = %v", status(resp), err)
+		}
+	}
+	if n := bad.hits.Load(); n != 4 {
+		t.Fatalf("recovered instance has %d requests in total, want 2 more", n)
+	}
+}
+
+// TestNoHealthyInstance 所有实例都被剔除时不发请求
+func TestNoHealthyInstance(t *testing.T) {
+	srv := newFlaky(t, 0, nil)
+	u := newTestUpstream(t, "test-no-healthy", testConfig(), srv.URL)
+	u.instances[0].ejectedUntil = time.Now().Add(time.Minute)
+	if _, err := send(t, u, http.MethodGet, "", nil); !errors.Is(err, ErrNoHealthyInstance) {
+		t.Fatalf("err = %v, want ErrNoHealthyInstance", err)
+	}
+	if n := srv.hits.Load(); n != 0 {
+		t.Fatalf("ejected instance got %d requests", n)
+	}
+}
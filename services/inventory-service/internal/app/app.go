@@ -3,7 +3,7 @@ package app
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,13 +12,19 @@ import (
 
 	"inventory-service/internal/config"
 	"inventory-service/internal/handler"
-	"inventory-service/internal/model"
 	"inventory-service/internal/repository"
 	"inventory-service/internal/router"
 	"inventory-service/internal/service"
+	"vv-ecommerce/pkg/async"
+	"vv-ecommerce/pkg/common/apperror"
 	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/middleware"
+	"vv-ecommerce/pkg/server"
+	"vv-ecommerce/pkg/tracing"
 
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
@@ -26,41 +32,83 @@ type App struct {
 	Cfg    *config.Config
 	Router http.Handler
 	DB     *gorm.DB
+	Health *health.Checker
 }
 
 func New(cfg *config.Config) (*App, func(), error) {
+	// 0. Error propagation: 标记错误来源服务，开发环境采集调用栈
+	apperror.SetServiceName("inventory-service")
+	apperror.EnableStackTrace(cfg.ErrorStackTrace)
+	// Panic reporter: 开发环境把 panic 额外写入本地文件，接入错误追踪系统时在这里注册
+	if cfg.Log.PanicFile != "" {
+		reporter, err := middleware.FilePanicReporter(cfg.Log.PanicFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		middleware.RegisterPanicReporter(reporter)
+	}
+
+	// Tracing: 安装 TracerProvider，HTTP / 客户端 / SQL / MQ 的 span 都挂在同一条 trace 上
+	shutdownTracing, err := tracing.Init(context.Background(), "inventory-service", cfg.Tracing)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init tracing: %w", err)
+	}
+
 	// 1. Database
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.DBName)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := openDatabase(cfg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	if err := migrateSQLite(context.Background(), db); err != nil {
+		return nil, nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	// 审计：自动填充 created_by/updated_by 并记录变更历史
+	if err := db.Use(audit.New(audit.Config{System: "inventory-service"})); err != nil {
+		return nil, nil, fmt.Errorf("failed to register audit plugin: %w", err)
+	}
 
-	// Auto Migrate
-	if err := db.AutoMigrate(&model.Inventory{}, &model.InventoryDeductionLog{}); err != nil {
-		return nil, nil, fmt.Errorf("failed to auto migrate: %w", err)
+	// 2. MQ: 库存变化时通知网关清除商品缓存
+	mqUser := cfg.MQ.User
+	if mqUser == "" {
+		mqUser = "guest"
+	}
+	mqPass := cfg.MQ.Password
+	if mqPass == "" {
+		mqPass = "guest"
 	}
+	mqURL := fmt.Sprintf("amqp://%s:%s@%s:%s/", mqUser, mqPass, cfg.MQ.Host, cfg.MQ.Port)
+	messageQueue := async.NewRabbitMQOrMemory(mqURL)
 
-	// 2. Core Logic
+	// 3. Core Logic
 	tm := database.NewTransactionManager(db)
 	inventoryRepo := repository.NewInventoryRepository(db)
-	inventoryService := service.NewInventoryService(inventoryRepo, tm)
+	inventoryService := service.NewInventoryService(inventoryRepo, tm, messageQueue)
 	inventoryHandler := handler.NewInventoryHandler(inventoryService)
 
-	// 3. Router
-	r := router.NewRouter(inventoryHandler)
+	// Health: 依赖数据库；MQ 只用于缓存失效通知，不可用时只报告 degraded
+	checker := health.NewChecker(cfg.Health)
+	checker.Register("db", health.DB(db))
+	if p, ok := messageQueue.(health.Pinger); ok {
+		checker.Register("mq", health.Ping(p), health.Optional())
+	}
+
+	// 4. Router
+	r := router.NewRouter(inventoryHandler, checker, cfg.Server)
 
 	// Cleanup function
 	cleanup := func() {
-		log.Println("Cleaning up application resources...")
-		sqlDB, err := db.DB()
-		if err != nil {
-			log.Printf("Error getting sql.DB from gorm: %v", err)
-			return
+		slog.Info("cleaning up application resources")
+		if err := messageQueue.Close(); err != nil {
+			slog.Error("failed to close message queue", logging.Err(err))
+		}
+		if err := database.Close(db); err != nil {
+			slog.Error("failed to close database connection", logging.Err(err))
 		}
-		if err := sqlDB.Close(); err != nil {
-			log.Printf("Error closing database connection: %v", err)
+		// 最后关闭 tracing，刷新上面清理过程中产生的 span
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to shut down tracing", logging.Err(err))
 		}
 	}
 
@@ -68,22 +116,19 @@ func New(cfg *config.Config) (*App, func(), error) {
 		Cfg:    cfg,
 		Router: r,
 		DB:     db,
+		Health: checker,
 	}, cleanup, nil
 }
 
 func (a *App) Run() error {
-	addr := fmt.Sprintf(":%d", a.Cfg.ServerPort)
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: a.Router,
-	}
+	srv := server.New(a.Cfg.ServerPort, a.Router, a.Cfg.Server)
 
 	// Channel to listen for errors coming from the listener.
 	serverErrors := make(chan error, 1)
 
 	// Start the server in a goroutine
 	go func() {
-		log.Printf("Inventory Service running on port %d", a.Cfg.ServerPort)
+		slog.Info("server started", "port", a.Cfg.ServerPort)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			serverErrors <- err
 		}
@@ -99,10 +144,11 @@ func (a *App) Run() error {
 		return fmt.Errorf("server error: %w", err)
 
 	case sig := <-shutdown:
-		log.Printf("Start shutdown: signal %v", sig)
+		slog.Info("start shutdown", "signal", sig.String())
+		a.Health.Drain()
 
 		// Create a context with a timeout for the shutdown
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), a.Cfg.Server.ShutdownTimeout)
 		defer cancel()
 
 		// Ask the server to shut down gracefully
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"inventory-service/internal/config"
+	"inventory-service/migrations"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/migrate"
+
+	"gorm.io/gorm"
+)
+
+// openDatabase 按 Database.Driver 打开 MySQL 或 SQLite
+func openDatabase(cfg *config.Config) (*gorm.DB, error) {
+	return database.Open(database.Config{
+		Driver:   cfg.Database.Driver,
+		User:     cfg.Database.User,
+		Password: cfg.Database.Password,
+		Host:     cfg.Database.Host,
+		Port:     cfg.Database.Port,
+		DBName:   cfg.Database.DBName,
+
+		Pool:          cfg.Database.Pool,
+		SlowThreshold: cfg.Database.SlowThreshold,
+		LogLevel:      cfg.Database.LogLevel,
+	})
+}
+
+// Migrate 执行 "migrate up|down|status|create" 子命令，按当前驱动选择 migrations/<dialect> 下的脚本
+func Migrate(cfg *config.Config, args []string) error {
+	createDirs := make([]string, 0, len(migrations.Dialects))
+	for _, dialect := range migrations.Dialects {
+		createDirs = append(createDirs, filepath.Join("migrations", dialect))
+	}
+
+	return migrate.Run(context.Background(), args, createDirs, func() (*migrate.Runner, error) {
+		db, err := openDatabase(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		return newMigrationRunner(db)
+	})
+}
+
+// newMigrationRunner 按 db 的方言加载 migrations/<dialect> 下的脚本
+func newMigrationRunner(db *gorm.DB) (*migrate.Runner, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	dialect := database.Dialect(db)
+	return migrate.New(sqlDB, dialect, migrations.FS, dialect)
+}
+
+// migrateSQLite 在 SQLite 上启动时执行 "migrate up"：内存库每次启动都是空的，
+// 文件库也不必再单独跑一遍迁移。MySQL 仍由部署流程显式执行 migrate up
+func migrateSQLite(ctx context.Context, db *gorm.DB) error {
+	if database.Dialect(db) != database.DriverSQLite {
+		return nil
+	}
+	runner, err := newMigrationRunner(db)
+	if err != nil {
+		return err
+	}
+	_, err = runner.Up(ctx)
+	return err
+}
@@ -4,16 +4,29 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/server"
+	"vv-ecommerce/pkg/tracing"
 
 	"github.com/spf13/viper"
 )
 
 type DatabaseConfig struct {
+	// Driver 为 "mysql" (默认) 或 "sqlite"；sqlite 时 DBName 是数据库文件路径，为空则使用内存库
+	Driver   string `mapstructure:"Driver"`
 	Host     string `mapstructure:"Host"`
 	Port     string `mapstructure:"Port"`
 	User     string `mapstructure:"User"`
 	Password string `mapstructure:"Password"`
 	DBName   string `mapstructure:"DBName"`
+
+	// 连接池 / 慢查询 / SQL 日志级别 (silent|error|warn|info)，如 DATABASE_POOL_MAXOPENCONNS=50
+	Pool          database.PoolConfig `mapstructure:"Pool"`
+	SlowThreshold time.Duration       `mapstructure:"SlowThreshold"`
+	LogLevel      string              `mapstructure:"LogLevel"`
 }
 
 type RedisConfig struct {
@@ -31,10 +44,15 @@ type MQConfig struct {
 }
 
 type Config struct {
-	ServerPort int            `mapstructure:"ServerPort"`
-	Database   DatabaseConfig `mapstructure:"Database"`
-	Redis      RedisConfig    `mapstructure:"Redis"`
-	MQ         MQConfig       `mapstructure:"MQ"`
+	ServerPort      int            `mapstructure:"ServerPort"`
+	ErrorStackTrace bool           `mapstructure:"ErrorStackTrace"` // 创建 AppError 时是否采集调用栈
+	Database        DatabaseConfig `mapstructure:"Database"`
+	Redis           RedisConfig    `mapstructure:"Redis"`
+	MQ              MQConfig       `mapstructure:"MQ"`
+	Log             logging.Config `mapstructure:"Log"`     // 如 LOG_LEVEL=debug LOG_FORMAT=text
+	Tracing         tracing.Config `mapstructure:"Tracing"` // OpenTelemetry，如 TRACING_EXPORTER=otlp TRACING_ENDPOINT=otel-collector:4318
+	Health          health.Config  `mapstructure:"Health"`  // 探针，如 HEALTH_SHUTDOWNDELAY=10s
+	Server          server.Config  `mapstructure:"Server"`  // HTTP 超时与过载保护，如 SERVER_WRITETIMEOUT=60s
 }
 
 func LoadConfig() (*Config, error) {
@@ -52,11 +70,50 @@ func LoadConfig() (*Config, error) {
 	}
 
 	viper.SetDefault("ServerPort", 8080)
+	viper.SetDefault("Database.Driver", "mysql")
 	viper.SetDefault("Database.Host", "localhost")
 	viper.SetDefault("Database.Port", "3306")
 	viper.SetDefault("Database.User", "root")
 	viper.SetDefault("Database.Password", "root")
 	viper.SetDefault("Database.DBName", "inventory_db")
+	viper.SetDefault("Database.Pool.MaxIdleConns", 10)
+	viper.SetDefault("Database.Pool.MaxOpenConns", 100)
+	viper.SetDefault("Database.Pool.ConnMaxLifetime", "1h")
+	viper.SetDefault("Database.Pool.ConnMaxIdleTime", "10m")
+	viper.SetDefault("Database.SlowThreshold", "200ms")
+	viper.SetDefault("Database.LogLevel", "warn")
+	viper.SetDefault("Log.Level", "info")
+	viper.SetDefault("Log.Format", logging.FormatJSON)
+	viper.SetDefault("Log.PanicFile", "")
+	// 默认全量记录访问日志，探针和 /metrics 只在出错时记录；DebugTraceIDs 为空即不记录请求体
+	viper.SetDefault("Log.Access.SampleRate", 1.0)
+	viper.SetDefault("Log.Access.Routes", logging.DefaultAccessRoutes())
+	viper.SetDefault("Log.Access.DebugTraceIDs", []string{})
+	viper.SetDefault("Log.Access.MaxBodyBytes", logging.DefaultMaxBodyBytes)
+	viper.SetDefault("Log.Redact.Fields", []string{})
+	viper.SetDefault("Log.Redact.Headers", []string{})
+	viper.SetDefault("Log.Redact.QueryParams", []string{})
+	viper.SetDefault("Log.Redact.Mask", logging.DefaultMask)
+	viper.SetDefault("Tracing.Exporter", tracing.ExporterNone)
+	viper.SetDefault("Tracing.Endpoint", "")
+	viper.SetDefault("Tracing.Insecure", true)
+	viper.SetDefault("Tracing.SampleRatio", 1.0)
+	viper.SetDefault("Health.Timeout", "2s")
+	viper.SetDefault("Health.CacheTTL", "2s")
+	viper.SetDefault("Health.ShutdownDelay", "5s")
+	srv := server.Defaults()
+	viper.SetDefault("Server.ReadHeaderTimeout", srv.ReadHeaderTimeout)
+	viper.SetDefault("Server.ReadTimeout", srv.ReadTimeout)
+	viper.SetDefault("Server.WriteTimeout", srv.WriteTimeout)
+	viper.SetDefault("Server.IdleTimeout", srv.IdleTimeout)
+	viper.SetDefault("Server.ShutdownTimeout", srv.ShutdownTimeout)
+	viper.SetDefault("Server.RequestTimeout.Default", srv.RequestTimeout.Default)
+	viper.SetDefault("Server.MaxBodyBytes", srv.MaxBodyBytes)
+	viper.SetDefault("Server.LoadShed.InitialLimit", srv.LoadShed.InitialLimit)
+	viper.SetDefault("Server.LoadShed.MinLimit", srv.LoadShed.MinLimit)
+	viper.SetDefault("Server.LoadShed.MaxLimit", srv.LoadShed.MaxLimit)
+	viper.SetDefault("Server.LoadShed.LatencyTarget", srv.LoadShed.LatencyTarget)
+	viper.SetDefault("Server.LoadShed.RetryAfter", srv.LoadShed.RetryAfter)
 
 	viper.SetDefault("Redis.Host", "localhost")
 	viper.SetDefault("Redis.Port", "6379")
@@ -80,8 +137,11 @@ func LoadConfig() (*Config, error) {
 	if cfg.ServerPort == 0 {
 		return nil, fmt.Errorf("ServerPort cannot be 0")
 	}
-	if cfg.Database.Host == "" || cfg.Database.Port == "" || cfg.Database.User == "" || cfg.Database.DBName == "" {
-		return nil, fmt.Errorf("Database configuration (Host, Port, User, DBName) cannot be empty")
+	// SQLite 只用 DBName (文件路径，为空则是内存库)，连接参数仅对 MySQL 必填
+	if cfg.Database.Driver == "" || cfg.Database.Driver == database.DriverMySQL {
+		if cfg.Database.Host == "" || cfg.Database.Port == "" || cfg.Database.User == "" || cfg.Database.DBName == "" {
+			return nil, fmt.Errorf("Database configuration (Host, Port, User, DBName) cannot be empty")
+		}
 	}
 
 	return cfg, nil
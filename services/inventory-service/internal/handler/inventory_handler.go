@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"net/http"
 	"strconv"
 
 	"inventory-service/internal/service"
@@ -42,7 +41,7 @@ func (h *InventoryHandler) GetInventoriesByProductID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, inventories)
+	response.Success(c, inventories)
 }
 
 func (h *InventoryHandler) GetInventoryBySKU(c *gin.Context) {
@@ -58,7 +57,8 @@ func (h *InventoryHandler) GetInventoryBySKU(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, inventory)
+	response.SetETag(c, inventory.Version)
+	response.Success(c, inventory)
 }
 
 func (h *InventoryHandler) DecreaseInventory(c *gin.Context) {
@@ -89,7 +89,7 @@ func (h *InventoryHandler) DecreaseInventory(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]string{"message": "Inventory decreased successfully"})
+	response.Success(c, map[string]string{"message": "Inventory decreased successfully"})
 }
 
 func (h *InventoryHandler) IncreaseInventory(c *gin.Context) {
@@ -108,7 +108,7 @@ func (h *InventoryHandler) IncreaseInventory(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]string{"message": "Inventory increased successfully"})
+	response.Success(c, map[string]string{"message": "Inventory increased successfully"})
 }
 
 func (h *InventoryHandler) RollbackInventory(c *gin.Context) {
@@ -128,7 +128,7 @@ func (h *InventoryHandler) RollbackInventory(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]string{"message": "Inventory rollback successfully"})
+	response.Success(c, map[string]string{"message": "Inventory rollback successfully"})
 }
 
 func (h *InventoryHandler) CreateInventory(c *gin.Context) {
@@ -148,7 +148,7 @@ func (h *InventoryHandler) CreateInventory(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]string{"message": "Inventory created successfully"})
+	response.Success(c, map[string]string{"message": "Inventory created successfully"})
 }
 
 func (h *InventoryHandler) UpdateInventory(c *gin.Context) {
@@ -162,10 +162,66 @@ func (h *InventoryHandler) UpdateInventory(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateInventory(c.Request.Context(), req.SKU, req.Quantity); err != nil {
+	ifMatch, err := response.IfMatch(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	inventory, err := h.service.UpdateInventory(c.Request.Context(), req.SKU, req.Quantity, ifMatch)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.SetETag(c, inventory.Version)
+	response.Success(c, inventory)
+}
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+func (h *InventoryHandler) GetInventoryHistory(c *gin.Context) {
+	sku := c.Query("sku")
+	if sku == "" {
+		response.Error(c, apperror.InvalidInput("sku is required", nil))
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			response.Error(c, apperror.InvalidInput("invalid limit", err))
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+
+	entries, err := h.service.GetInventoryHistory(c.Request.Context(), sku, limit)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, entries)
+}
+
+// GetDeductions 按订单查询库存扣减记录 (网关的订单详情用它展示订单的 SKU)，没有记录时返回空列表
+func (h *InventoryHandler) GetDeductions(c *gin.Context) {
+	orderID := c.Query("order_id")
+	if orderID == "" {
+		response.Error(c, apperror.InvalidInput("order_id is required", nil))
+		return
+	}
+
+	logs, err := h.service.GetDeductions(c.Request.Context(), orderID)
+	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]string{"message": "Inventory updated successfully"})
+	response.Success(c, logs)
 }
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+)
 
 type Inventory struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -9,6 +13,9 @@ type Inventory struct {
 	Quantity  int       `json:"quantity"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	database.Versioned // 乐观锁版本号，管理端修改库存时通过 If-Match 校验
+	audit.Fields       // created_by / updated_by，变更历史见 audit_log
 }
 
 type InventoryDeductionLog struct {
@@ -2,23 +2,34 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"inventory-service/internal/model"
+	"strconv"
 	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
 
 	"gorm.io/gorm"
 )
 
+// DecreaseInventory 条件更新未命中时区分两种原因
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrInventoryNotFound = errors.New("inventory not found")
+)
+
 type InventoryRepository interface {
 	DecreaseInventory(ctx context.Context, sku string, quantity int) error
 	IncreaseInventory(ctx context.Context, sku string, quantity int) error
 	GetInventoryBySKU(ctx context.Context, sku string) (*model.Inventory, error)
-	UpdateInventory(ctx context.Context, inventory *model.Inventory) error
+	UpdateInventory(ctx context.Context, inventory *model.Inventory, expectedVersion int64) error
 	GetInventoriesByProductID(ctx context.Context, productID uint) ([]model.Inventory, error)
 	CreateInventory(ctx context.Context, inventory *model.Inventory) error
 	RequestLogExists(ctx context.Context, reqID string) error
 	SaveDeductionLog(ctx context.Context, log *model.InventoryDeductionLog) error
 	GetDeductionLog(ctx context.Context, sku, traceID string) (*model.InventoryDeductionLog, error)
+	GetDeductionLogsByOrderID(ctx context.Context, orderID string) ([]model.InventoryDeductionLog, error)
 	UpdateDeductionLogStatus(ctx context.Context, id uint, status string) error
+	GetHistory(ctx context.Context, id uint, limit int) ([]audit.Entry, error)
 }
 
 type GORMInventoryRepository struct {
@@ -32,13 +43,23 @@ func NewInventoryRepository(db *gorm.DB) InventoryRepository {
 func (r *GORMInventoryRepository) DecreaseInventory(ctx context.Context, sku string, quantity int) error {
 	result := database.GetDB(ctx, r.db).Model(&model.Inventory{}).
 		Where("sku = ? AND quantity >= ?", sku, quantity).
-		Update("quantity", gorm.Expr("quantity - ?", quantity))
+		Updates(map[string]interface{}{
+			"quantity":             gorm.Expr("quantity - ?", quantity),
+			database.VersionColumn: database.IncrementVersion(),
+		})
 
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound // Or a custom "insufficient stock" error if you check existence first
+		var count int64
+		if err := database.GetDB(ctx, r.db).Model(&model.Inventory{}).Where("sku = ?", sku).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrInventoryNotFound
+		}
+		return ErrInsufficientStock
 	}
 	return nil
 }
@@ -46,7 +67,10 @@ func (r *GORMInventoryRepository) DecreaseInventory(ctx context.Context, sku str
 func (r *GORMInventoryRepository) IncreaseInventory(ctx context.Context, sku string, quantity int) error {
 	return database.GetDB(ctx, r.db).Model(&model.Inventory{}).
 		Where("sku = ?", sku).
-		Update("quantity", gorm.Expr("quantity + ?", quantity)).Error
+		Updates(map[string]interface{}{
+			"quantity":             gorm.Expr("quantity + ?", quantity),
+			database.VersionColumn: database.IncrementVersion(),
+		}).Error
 }
 
 func (r *GORMInventoryRepository) GetInventoryBySKU(ctx context.Context, sku string) (*model.Inventory, error) {
@@ -57,8 +81,15 @@ func (r *GORMInventoryRepository) GetInventoryBySKU(ctx context.Context, sku str
 	return &inventory, nil
 }
 
-func (r *GORMInventoryRepository) UpdateInventory(ctx context.Context, inventory *model.Inventory) error {
-	return database.GetDB(ctx, r.db).Save(inventory).Error
+// UpdateInventory 只有当前版本等于 expectedVersion 时才更新，成功后 inventory.Version 为新版本
+func (r *GORMInventoryRepository) UpdateInventory(ctx context.Context, inventory *model.Inventory, expectedVersion int64) error {
+	version, err := database.UpdateWithVersion(database.GetDB(ctx, r.db), &model.Inventory{}, expectedVersion,
+		map[string]interface{}{"quantity": inventory.Quantity}, "id = ?", inventory.ID)
+	if err != nil {
+		return err
+	}
+	inventory.Version = version
+	return nil
 }
 
 func (r *GORMInventoryRepository) GetInventoriesByProductID(ctx context.Context, productID uint) ([]model.Inventory, error) {
@@ -97,6 +128,20 @@ func (r *GORMInventoryRepository) GetDeductionLog(ctx context.Context, sku, trac
 	return &log, nil
 }
 
+// GetDeductionLogsByOrderID 返回订单的库存扣减记录 (按扣减顺序)
+func (r *GORMInventoryRepository) GetDeductionLogsByOrderID(ctx context.Context, orderID string) ([]model.InventoryDeductionLog, error) {
+	var logs []model.InventoryDeductionLog
+	if err := database.GetDB(ctx, r.db).Where("order_id = ?", orderID).Order("id").Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
 func (r *GORMInventoryRepository) UpdateDeductionLogStatus(ctx context.Context, id uint, status string) error {
 	return database.GetDB(ctx, r.db).Model(&model.InventoryDeductionLog{}).Where("id = ?", id).Update("status", status).Error
 }
+
+// GetHistory 返回库存记录的变更历史 (最新的在前)
+func (r *GORMInventoryRepository) GetHistory(ctx context.Context, id uint, limit int) ([]audit.Entry, error) {
+	return audit.History(ctx, r.db, "inventories", strconv.FormatUint(uint64(id), 10), limit)
+}
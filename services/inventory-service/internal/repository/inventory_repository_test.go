@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"inventory-service/internal/model"
+	"inventory-service/migrations"
+	"sync"
+	"testing"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/database/migrate"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB 打开内存 SQLite 并执行内嵌迁移，与服务启动时的表结构一致
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := migrate.New(sqlDB, database.DriverSQLite, migrations.FS, database.DriverSQLite)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if err := db.Use(audit.New(audit.Config{System: "inventory-service"})); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createInventory(t *testing.T, repo InventoryRepository, sku string, quantity int) *model.Inventory {
+	t.Helper()
+	inv := &model.Inventory{ProductID: 100, SKU: sku, Quantity: quantity}
+	if err := repo.CreateInventory(context.Background(), inv); err != nil {
+		t.Fatalf("create inventory: %v", err)
+	}
+	return inv
+}
+
+func TestDecreaseInventory(t *testing.T) {
+	repo := NewInventoryRepository(openTestDB(t))
+	ctx := context.Background()
+	createInventory(t, repo, "S1", 10)
+
+	if err := repo.DecreaseInventory(ctx, "S1", 3); err != nil {
+		t.Fatalf("decrease: %v", err)
+	}
+	inv, err := repo.GetInventoryBySKU(ctx, "S1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Quantity != 7 || inv.Version != 2 {
+		t.Fatalf("after decrease: quantity %d, version %d", inv.Quantity, inv.Version)
+	}
+
+	if err := repo.DecreaseInventory(ctx, "S1", 8); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("oversell: err = %v, want ErrInsufficientStock", err)
+	}
+	if err := repo.DecreaseInventory(ctx, "missing", 1); !errors.Is(err, ErrInventoryNotFound) {
+		t.Fatalf("unknown sku: err = %v, want ErrInventoryNotFound", err)
+	}
+
+	if err := repo.IncreaseInventory(ctx, "S1", 5); err != nil {
+		t.Fatalf("increase: %v", err)
+	}
+	inv, _ = repo.GetInventoryBySKU(ctx, "S1")
+	if inv.Quantity != 12 || inv.Version != 3 {
+		t.Fatalf("after increase: quantity %d, version %d", inv.Quantity, inv.Version)
+	}
+}
+
+func TestDecreaseInventoryNeverOversells(t *testing.T) {
+	repo := NewInventoryRepository(openTestDB(t))
+	ctx := context.Background()
+	createInventory(t, repo, "S1", 5)
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		sold       int
+		unexpected error
+	)
+	for range 20 {
+		wg.Go(func() {
+			err := repo.DecreaseInventory(ctx, "S1", 1)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				sold++
+			case !errors.Is(err, ErrInsufficientStock):
+				unexpected = err
+			}
+		})
+	}
+	wg.Wait()
+
+	if unexpected != nil {
+		t.Fatalf("decrease: %v", unexpected)
+	}
+	inv, _ := repo.GetInventoryBySKU(ctx, "S1")
+	if sold != 5 || inv.Quantity != 0 {
+		t.Fatalf("sold %d, remaining %d; want 5 and 0", sold, inv.Quantity)
+	}
+}
+
+func TestUpdateInventoryWithVersion(t *testing.T) {
+	repo := NewInventoryRepository(openTestDB(t))
+	ctx := context.Background()
+	inv := createInventory(t, repo, "S1", 10)
+
+	inv.Quantity = 42
+	if err := repo.UpdateInventory(ctx, inv, 1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if inv.Version != 2 {
+		t.Fatalf("version = %d, want 2", inv.Version)
+	}
+	inv.Quantity = 1
+	if err := repo.UpdateInventory(ctx, inv, 1); !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	got, _ := repo.GetInventoryBySKU(ctx, "S1")
+	if got.Quantity != 42 {
+		t.Fatalf("quantity = %d, want 42", got.Quantity)
+	}
+	byProduct, err := repo.GetInventoriesByProductID(ctx, 100)
+	if err != nil || len(byProduct) != 1 {
+		t.Fatalf("by product = %v, %v", byProduct, err)
+	}
+}
+
+func TestInventoryHistoryRecordsExprUpdates(t *testing.T) {
+	repo := NewInventoryRepository(openTestDB(t))
+	ctx := audit.WithActor(context.Background(), audit.Actor{ID: "42"})
+	inv := createInventory(t, repo, "S1", 10)
+
+	if err := repo.DecreaseInventory(ctx, "S1", 3); err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.GetHistory(ctx, inv.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Action != "update" {
+		t.Fatalf("history = %+v", history)
+	}
+
+	// gorm.Expr 的更新也要记录真实的前后数量，而不是表达式
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(history[0].Before, &before); err != nil {
+		t.Fatalf("before_json: %v", err)
+	}
+	if err := json.Unmarshal(history[0].After, &after); err != nil {
+		t.Fatalf("after_json: %v", err)
+	}
+	if before["quantity"] != float64(10) || after["quantity"] != float64(7) {
+		t.Fatalf("quantity change: before %v, after %v", before, after)
+	}
+	if history[0].Actor != "42" {
+		t.Fatalf("actor = %q", history[0].Actor)
+	}
+}
+
+func TestDeductionLogs(t *testing.T) {
+	repo := NewInventoryRepository(openTestDB(t))
+	ctx := context.Background()
+
+	first := &model.InventoryDeductionLog{OrderID: "o-1", RequestID: "r-1", SKU: "S1", TraceID: "t-1", Quantity: 2}
+	second := &model.InventoryDeductionLog{OrderID: "o-1", RequestID: "r-2", SKU: "S2", TraceID: "t-1", Quantity: 1}
+	for _, l := range []*model.InventoryDeductionLog{first, second} {
+		if err := repo.SaveDeductionLog(ctx, l); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	if err := repo.SaveDeductionLog(ctx, &model.InventoryDeductionLog{RequestID: "r-1", SKU: "S1"}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("duplicate request_id: err = %v, want gorm.ErrDuplicatedKey", err)
+	}
+
+	if err := repo.RequestLogExists(ctx, "r-1"); err != nil {
+		t.Fatalf("request log exists: %v", err)
+	}
+	if err := repo.RequestLogExists(ctx, "r-9"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("unknown request: err = %v", err)
+	}
+
+	got, err := repo.GetDeductionLog(ctx, "S1", "t-1")
+	if err != nil || got.ID != first.ID || got.Status != "DEDUCTED" {
+		t.Fatalf("by trace = %+v, %v", got, err)
+	}
+	if err := repo.UpdateDeductionLogStatus(ctx, first.ID, "ROLLED_BACK"); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := repo.GetDeductionLogsByOrderID(ctx, "o-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[0].SKU != "S1" || logs[0].Status != "ROLLED_BACK" || logs[1].SKU != "S2" {
+		t.Fatalf("logs = %+v", logs)
+	}
+}
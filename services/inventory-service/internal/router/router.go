@@ -1,34 +1,50 @@
 package router
 
 import (
-	"fmt"
 	"inventory-service/internal/handler"
-	"net/http"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/metrics"
 	"vv-ecommerce/pkg/middleware"
+	"vv-ecommerce/pkg/server"
 
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter(h *handler.InventoryHandler) *gin.Engine {
+func NewRouter(h *handler.InventoryHandler, checker *health.Checker, srv server.Config) *gin.Engine {
 	r := gin.New()
+	r.Use(middleware.Tracing("inventory-service"))
 	r.Use(middleware.TraceID())
+	r.Use(middleware.Actor())
 	r.Use(middleware.Logger())
+	r.Use(middleware.Metrics())
 	r.Use(middleware.Recovery())
 
-	// Health Check
-	r.GET("/health", func(c *gin.Context) {
-		c.String(http.StatusOK, "Inventory Service is healthy")
-		fmt.Println("Inventory Service is healthy")
-	})
+	// Probes: /livez 只表示进程存活，/readyz 检查依赖，关闭期间返回 503
+	r.GET("/livez", checker.Live)
+	r.GET("/readyz", checker.Ready)
+	// /health 是旧的探针地址，保留为 /readyz 的别名，兼容已有的探针和 compose healthcheck
+	r.GET("/health", checker.Ready)
+
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// 业务路由：过载保护、请求 deadline、请求体上限 (探针和 /metrics 不受影响)
+	api := r.Group("",
+		middleware.LoadShed(srv.LoadShed),
+		middleware.Timeout(srv.RequestTimeout),
+		middleware.BodyLimit(srv.MaxBodyBytes),
+	)
 
 	// Inventory Routes
-	r.GET("/inventories", h.GetInventoriesByProductID)
-	r.GET("/inventory/sku", h.GetInventoryBySKU)
-	r.POST("/inventory/create", h.CreateInventory)
-	// r.POST("/inventory/update", h.UpdateInventory) // 暂时移除 UpdateInventory，使用 Increase/Decrease
-	r.POST("/inventory/decrease", h.DecreaseInventory)
-	r.POST("/inventory/increase", h.IncreaseInventory)
-	r.POST("/inventory/rollback", h.RollbackInventory)
+	api.GET("/inventories", h.GetInventoriesByProductID)
+	api.GET("/inventory/sku", h.GetInventoryBySKU)
+	api.GET("/inventory/history", h.GetInventoryHistory)
+	api.GET("/inventory/deductions", h.GetDeductions)
+	api.POST("/inventory/create", h.CreateInventory)
+	api.POST("/inventory/update", h.UpdateInventory) // 直接设置数量，支持 If-Match 乐观锁
+	api.POST("/inventory/decrease", h.DecreaseInventory)
+	api.POST("/inventory/increase", h.IncreaseInventory)
+	api.POST("/inventory/rollback", h.RollbackInventory)
 
 	return r
 }
@@ -2,11 +2,16 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"inventory-service/internal/model"
 	"inventory-service/internal/repository"
+	"vv-ecommerce/pkg/async"
 	"vv-ecommerce/pkg/common/apperror"
 	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
 
 	"gorm.io/gorm"
 )
@@ -14,10 +19,35 @@ import (
 type InventoryService struct {
 	repo repository.InventoryRepository
 	tm   database.TransactionManager
+	// mq 发布缓存失效事件，为 nil 时不发布
+	mq async.MessageQueue
 }
 
-func NewInventoryService(repo repository.InventoryRepository, tm database.TransactionManager) *InventoryService {
-	return &InventoryService{repo: repo, tm: tm}
+func NewInventoryService(repo repository.InventoryRepository, tm database.TransactionManager, mq async.MessageQueue) *InventoryService {
+	return &InventoryService{repo: repo, tm: tm, mq: mq}
+}
+
+// stockChanged 通知网关丢弃商品列表和该 SKU 详情的缓存
+// 发布失败只记录日志：网关缓存最多在 TTL 之后过期
+func (s *InventoryService) stockChanged(ctx context.Context, sku string) {
+	if s.mq == nil {
+		return
+	}
+	payload, err := json.Marshal(async.CacheInvalidation{Tags: []string{"products", "product:" + sku}})
+	if err == nil {
+		err = s.broadcast(ctx, async.TopicCacheInvalidate, payload)
+	}
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to publish cache invalidation", "sku", sku, logging.Err(err))
+	}
+}
+
+// broadcast 发给每个网关实例；MQ 不支持广播时退回工作队列，只有一个实例收到
+func (s *InventoryService) broadcast(ctx context.Context, topic string, payload []byte) error {
+	if b, ok := s.mq.(async.Broadcaster); ok {
+		return b.Broadcast(ctx, topic, payload)
+	}
+	return s.mq.Publish(ctx, topic, payload)
 }
 
 func (s *InventoryService) GetInventoriesByProductID(ctx context.Context, productID uint) ([]model.Inventory, error) {
@@ -54,10 +84,12 @@ func (s *InventoryService) CreateInventory(ctx context.Context, sku string, prod
 	if err := s.repo.CreateInventory(ctx, newInventory); err != nil {
 		return apperror.Internal("failed to create inventory", err)
 	}
+	s.stockChanged(ctx, sku)
 	return nil
 }
 
 func (s *InventoryService) DecreaseInventory(ctx context.Context, reqID, sku, orderID, traceID string, quantity int) error {
+	ctx = logging.With(ctx, logging.KeyOrderID, orderID)
 	// 检查是否存在重复请求
 	if err := s.repo.RequestLogExists(ctx, reqID); err == nil {
 		return apperror.Conflict("duplicate request ID", nil)
@@ -91,14 +123,16 @@ func (s *InventoryService) DecreaseInventory(ctx context.Context, reqID, sku, or
 	})
 
 	if err != nil {
-		if err.Error() == "insufficient stock" {
+		if errors.Is(err, repository.ErrInsufficientStock) {
+			metrics.Stockouts.WithLabelValues(sku).Inc()
 			return apperror.Conflict("insufficient stock", err)
 		}
-		if err.Error() == "inventory not found" {
+		if errors.Is(err, repository.ErrInventoryNotFound) {
 			return apperror.NotFound("inventory not found", err)
 		}
 		return apperror.Internal("transaction failed", err)
 	}
+	s.stockChanged(ctx, sku)
 	return nil
 }
 
@@ -139,6 +173,7 @@ func (s *InventoryService) RollbackInventory(ctx context.Context, sku string, qu
 	if err != nil {
 		return apperror.Internal("failed to increase inventory (rollback)", err)
 	}
+	s.stockChanged(ctx, sku)
 	return nil
 }
 
@@ -150,23 +185,66 @@ func (s *InventoryService) IncreaseInventory(ctx context.Context, sku string, qu
 	if err := s.repo.IncreaseInventory(ctx, sku, quantity); err != nil {
 		return apperror.Internal("failed to increase inventory", err)
 	}
+	s.stockChanged(ctx, sku)
 	return nil
 }
 
-func (s *InventoryService) UpdateInventory(ctx context.Context, sku string, quantity int) error {
+// UpdateInventory 直接设置库存数量 (管理端)，返回更新后的库存
+// ifMatch 是客户端持有的版本号 (If-Match)，为 0 时使用读取到的版本，仍能防止读取与写入之间的并发覆盖
+func (s *InventoryService) UpdateInventory(ctx context.Context, sku string, quantity int, ifMatch int64) (*model.Inventory, error) {
 	if quantity < 0 {
-		return apperror.InvalidInput("quantity cannot be negative", nil)
+		return nil, apperror.InvalidInput("quantity cannot be negative", nil)
 	}
 	inventory, err := s.repo.GetInventoryBySKU(ctx, sku)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return apperror.NotFound("inventory not found", err)
+			return nil, apperror.NotFound("inventory not found", err)
 		}
-		return apperror.Internal("database error", err)
+		return nil, apperror.Internal("database error", err)
+	}
+
+	expected := inventory.Version
+	if ifMatch != 0 {
+		expected = ifMatch
 	}
 	inventory.Quantity = quantity
-	if err := s.repo.UpdateInventory(ctx, inventory); err != nil {
-		return apperror.Internal("failed to update inventory", err)
+	if err := s.repo.UpdateInventory(ctx, inventory, expected); err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			return nil, apperror.Conflict("inventory was modified by another request, reload and retry", err)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.NotFound("inventory not found", err)
+		}
+		return nil, apperror.Internal("failed to update inventory", err)
 	}
-	return nil
+	s.stockChanged(ctx, sku)
+
+	// 重新从主库读取，响应中的 updated_at 等字段与新版本号一致
+	updated, err := s.repo.GetInventoryBySKU(database.WithReadYourWrites(ctx), sku)
+	if err != nil {
+		return nil, apperror.Internal("database error", err)
+	}
+	return updated, nil
+}
+
+// GetDeductions 返回订单扣减了哪些 SKU、多少数量，以及是否已回滚
+func (s *InventoryService) GetDeductions(ctx context.Context, orderID string) ([]model.InventoryDeductionLog, error) {
+	logs, err := s.repo.GetDeductionLogsByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, apperror.Internal("failed to fetch deductions", err)
+	}
+	return logs, nil
+}
+
+// GetInventoryHistory 返回 SKU 对应库存记录的变更历史
+func (s *InventoryService) GetInventoryHistory(ctx context.Context, sku string, limit int) ([]audit.Entry, error) {
+	inventory, err := s.GetInventoryBySKU(ctx, sku)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.GetHistory(ctx, inventory.ID, limit)
+	if err != nil {
+		return nil, apperror.Internal("failed to fetch inventory history", err)
+	}
+	return entries, nil
 }
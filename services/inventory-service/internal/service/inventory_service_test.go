@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"inventory-service/internal/model"
+	"inventory-service/internal/repository"
+	"inventory-service/migrations"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/migrate"
+)
+
+func TestUpdateInventoryReturnsUpdatedRow(t *testing.T) {
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := migrate.New(sqlDB, database.DriverSQLite, migrations.FS, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	repo := repository.NewInventoryRepository(db)
+	stale := time.Now().Add(-time.Hour)
+	if err := repo.CreateInventory(ctx, &model.Inventory{ProductID: 1, SKU: "S1", Quantity: 5, CreatedAt: stale, UpdatedAt: stale}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	inv, err := NewInventoryService(repo, nil, nil).UpdateInventory(ctx, "S1", 9, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Quantity != 9 || inv.Version != 2 {
+		t.Fatalf("returned quantity %d, version %d", inv.Quantity, inv.Version)
+	}
+	// 响应中的 updated_at 要与新版本号一致，而不是更新前读到的值
+	if inv.UpdatedAt.Before(start) {
+		t.Fatalf("updated_at = %s, want the time of this update (after %s)", inv.UpdatedAt, start)
+	}
+	stored, err := repo.GetInventoryBySKU(ctx, "S1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.UpdatedAt.Equal(inv.UpdatedAt) {
+		t.Fatalf("updated_at = %s, stored %s", inv.UpdatedAt, stored.UpdatedAt)
+	}
+}
@@ -14,6 +14,8 @@ CREATE TABLE IF NOT EXISTS inventory_deduction_logs (
     sku VARCHAR(255),
     trace_id VARCHAR(255),
     quantity INT,
+    -- 改造前的服务用 AutoMigrate 建表时已经有 status 列，所以它留在 init 中，不能再用 ALTER 追加
+    status VARCHAR(50) DEFAULT 'DEDUCTED',
     created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
     INDEX idx_order_id (order_id),
     INDEX idx_sku (sku),
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_log;
+ALTER TABLE inventories DROP COLUMN updated_by;
+ALTER TABLE inventories DROP COLUMN created_by;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS outbox_events;
+DROP TABLE IF EXISTS inventory_deduction_logs;
+DROP TABLE IF EXISTS inventories;
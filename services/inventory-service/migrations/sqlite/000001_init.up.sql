@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS inventories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id BIGINT,
+    sku VARCHAR(255) NOT NULL UNIQUE,
+    quantity INT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS inventory_deduction_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id VARCHAR(255),
+    request_id VARCHAR(255) NOT NULL UNIQUE,
+    sku VARCHAR(255),
+    trace_id VARCHAR(255),
+    quantity INT,
+    -- 改造前的服务用 AutoMigrate 建表时已经有 status 列，所以它留在 init 中，不能再用 ALTER 追加
+    status VARCHAR(50) DEFAULT 'DEDUCTED',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_deduction_logs_order_id ON inventory_deduction_logs (order_id);
+CREATE INDEX IF NOT EXISTS idx_deduction_logs_sku ON inventory_deduction_logs (sku);
+CREATE INDEX IF NOT EXISTS idx_deduction_logs_trace_id ON inventory_deduction_logs (trace_id);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    aggregate_type VARCHAR(255) NOT NULL,
+    aggregate_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(255) NOT NULL,
+    payload JSON NOT NULL,
+    status VARCHAR(50) DEFAULT 'PENDING',
+    trace_id VARCHAR(255),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_status ON outbox_events (status);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_created_at ON outbox_events (created_at);
+
+-- Seed data
+INSERT OR IGNORE INTO inventories (product_id, sku, quantity)
+VALUES (1, 'PHONE-001', 100);
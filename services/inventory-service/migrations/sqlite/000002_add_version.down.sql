@@ -0,0 +1 @@
+ALTER TABLE inventories DROP COLUMN version;
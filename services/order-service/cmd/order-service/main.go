@@ -1,27 +1,41 @@
 package main
 
 import (
-	"log"
 	"order-service/internal/app"
 	"order-service/internal/config"
+	"os"
+	"vv-ecommerce/pkg/logging"
 )
 
 func main() {
 	// 1. Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		logging.Fatal("failed to load configuration", logging.Err(err))
+	}
+
+	// Logging: JSON 结构化日志，之后所有 log/slog 输出都带 service 字段
+	if _, err := logging.Init("order-service", cfg.Log); err != nil {
+		logging.Fatal("failed to init logging", logging.Err(err))
+	}
+
+	// Subcommand: order-service migrate up|down|status|create
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(cfg, os.Args[2:]); err != nil {
+			logging.Fatal("migration failed", logging.Err(err))
+		}
+		return
 	}
 
 	// 2. Initialize Application
 	application, cleanup, err := app.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize application: %v", err)
+		logging.Fatal("failed to initialize application", logging.Err(err))
 	}
 	defer cleanup()
 
 	// 3. Run Application
 	if err := application.Run(); err != nil {
-		log.Fatalf("Application failed to run: %v", err)
+		logging.Fatal("application failed", logging.Err(err))
 	}
 }
@@ -3,10 +3,11 @@ package app
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"order-service/internal/config"
 	"order-service/internal/handler"
+	"order-service/internal/model"
 	"order-service/internal/repository"
 	"order-service/internal/router"
 	"order-service/internal/service"
@@ -16,28 +17,61 @@ import (
 	"time"
 	"vv-ecommerce/pkg/async"
 	"vv-ecommerce/pkg/clients"
+	"vv-ecommerce/pkg/common/apperror"
 	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/idempotency"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
+	"vv-ecommerce/pkg/middleware"
+	"vv-ecommerce/pkg/server"
+	"vv-ecommerce/pkg/tracing"
+
+	"github.com/redis/go-redis/v9"
 )
 
 type App struct {
 	Cfg             *config.Config
 	Router          http.Handler
+	Health          *health.Checker
 	Compensator     *service.InventoryCompensator
 	OutboxProcessor *service.OutboxProcessor
+	OrderEvents     *service.OrderEvents
+	Streams         *middleware.Streams
 }
 
 func New(cfg *config.Config) (*App, func(), error) {
+	// 0. Error propagation: 标记错误来源服务，开发环境采集调用栈
+	apperror.SetServiceName("order-service")
+	apperror.EnableStackTrace(cfg.ErrorStackTrace)
+	// Panic reporter: 开发环境把 panic 额外写入本地文件，接入错误追踪系统时在这里注册
+	if cfg.Log.PanicFile != "" {
+		reporter, err := middleware.FilePanicReporter(cfg.Log.PanicFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		middleware.RegisterPanicReporter(reporter)
+	}
+
+	// Tracing: 安装 TracerProvider，HTTP / 客户端 / SQL / MQ 的 span 都挂在同一条 trace 上
+	shutdownTracing, err := tracing.Init(context.Background(), "order-service", cfg.Tracing)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init tracing: %w", err)
+	}
+
 	// 1. Database
-	db, err := database.NewMySQLConnection(database.Config{
-		User:     cfg.Database.User,
-		Password: cfg.Database.Password,
-		Host:     cfg.Database.Host,
-		Port:     cfg.Database.Port,
-		DBName:   cfg.Database.DBName,
-	})
+	db, err := openDatabase(cfg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	if err := migrateSQLite(context.Background(), db); err != nil {
+		return nil, nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	// 审计：自动填充 created_by/updated_by 并记录变更历史
+	if err := db.Use(audit.New(audit.Config{System: "order-service"})); err != nil {
+		return nil, nil, fmt.Errorf("failed to register audit plugin: %w", err)
+	}
 
 	// 2. Clients
 	inventoryClient := clients.NewInventoryClient(cfg.InventoryServiceURL)
@@ -56,33 +90,79 @@ func New(cfg *config.Config) (*App, func(), error) {
 	mqURL := fmt.Sprintf("amqp://%s:%s@%s:%s/", mqUser, mqPass, cfg.MQ.Host, cfg.MQ.Port)
 	messageQueue := async.NewRabbitMQOrMemory(mqURL)
 
+	// Metrics: outbox 积压与 MQ 消费积压在抓取 /metrics 时实时读取
+	metrics.MustRegister(metrics.NewOutboxCollector(db, "outbox_events", string(model.OutboxStatusPending)))
+	if lag, ok := messageQueue.(metrics.LagSource); ok {
+		metrics.MustRegister(metrics.NewConsumerLagCollector(lag))
+	}
+
 	// 4. Core Logic
 	tm := database.NewTransactionManager(db)
 	orderRepo := repository.NewOrderRepository(db)
 	compensator := service.NewInventoryCompensator(inventoryClient, messageQueue)
 	outboxProcessor := service.NewOutboxProcessor(orderRepo, messageQueue)
-	orderService := service.NewOrderService(orderRepo, inventoryClient, paymentClient, compensator, tm)
-	orderHandler := handler.NewOrderHandler(orderService)
+	orderEvents := service.NewOrderEvents(messageQueue)
+	orderService := service.NewOrderService(orderRepo, inventoryClient, paymentClient, compensator, tm, orderEvents)
+	orderHandler := handler.NewOrderHandler(orderService, orderEvents, cfg.Events)
+
+	// Idempotency: POST /orders 的 Idempotency-Key，默认存在本服务数据库
+	var idemStore idempotency.Store = idempotency.NewSQLStore(db)
+	var redisClient *redis.Client
+	if cfg.Idempotency.Store == idempotency.StoreRedis {
+		redisClient = redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
+		idemStore = idempotency.NewRedisStore(redisClient, "idempotency:order-service:")
+	}
+
+	// Health: DB / MQ / outbox 积压决定是否就绪；下游服务只报告 degraded，避免故障沿调用链扩散
+	checker := health.NewChecker(cfg.Health)
+	checker.Register("db", health.DB(db))
+	if redisClient != nil {
+		checker.Register("redis", func(ctx context.Context) error { return redisClient.Ping(ctx).Err() })
+	}
+	if p, ok := messageQueue.(health.Pinger); ok {
+		checker.Register("mq", health.Ping(p))
+	}
+	checker.Register("outbox", health.OutboxBacklog(db, "outbox_events", string(model.OutboxStatusPending), cfg.OutboxBacklogThreshold))
+	checker.Register("inventory-service", inventoryClient.HealthCheck, health.Optional())
+	checker.Register("payment-service", paymentClient.HealthCheck, health.Optional())
 
 	// 5. Router
 	// Note: router package might expose NewRouter or SetupRouter. main.go uses router.NewRouter
 	// Checking previous main.go: r := router.NewRouter(orderHandler)
-	r := router.NewRouter(orderHandler)
+	streams := middleware.NewStreams()
+	r := router.NewRouter(orderHandler, checker, cfg.Server, middleware.Idempotency(idemStore, cfg.Idempotency), streams)
 
 	// Cleanup function
 	cleanup := func() {
-		log.Println("Cleaning up application resources...")
+		slog.Info("cleaning up application resources")
+		if redisClient != nil {
+			if err := redisClient.Close(); err != nil {
+				slog.Error("failed to close redis client", logging.Err(err))
+			}
+		}
 		outboxProcessor.Stop() // Stop outbox processor
 		if err := messageQueue.Close(); err != nil {
-			log.Printf("Error closing message queue: %v", err)
+			slog.Error("failed to close message queue", logging.Err(err))
+		}
+		if err := database.Close(db); err != nil {
+			slog.Error("failed to close database connection", logging.Err(err))
+		}
+		// 最后关闭 tracing，刷新上面清理过程中产生的 span
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to shut down tracing", logging.Err(err))
 		}
 	}
 
 	return &App{
 		Cfg:             cfg,
 		Router:          r,
+		Health:          checker,
 		Compensator:     compensator,
 		OutboxProcessor: outboxProcessor,
+		OrderEvents:     orderEvents,
+		Streams:         streams,
 	}, cleanup, nil
 }
 
@@ -90,19 +170,20 @@ func (a *App) Run() error {
 	// Start background workers
 	a.Compensator.StartWorker()
 	a.OutboxProcessor.Start()
-
-	addr := fmt.Sprintf(":%d", a.Cfg.ServerPort)
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: a.Router,
+	if err := a.OrderEvents.Start(); err != nil {
+		return fmt.Errorf("failed to subscribe to order events: %w", err)
 	}
 
+	srv := server.New(a.Cfg.ServerPort, a.Router, a.Cfg.Server)
+	// 关闭时结束 SSE 连接，客户端会重连到其他实例
+	srv.RegisterOnShutdown(a.Streams.Close)
+
 	// Channel to listen for errors coming from the listener.
 	serverErrors := make(chan error, 1)
 
 	// Start the server in a goroutine
 	go func() {
-		log.Printf("Order Service running on port %d", a.Cfg.ServerPort)
+		slog.Info("server started", "port", a.Cfg.ServerPort)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			serverErrors <- err
 		}
@@ -118,10 +199,11 @@ func (a *App) Run() error {
 		return fmt.Errorf("server error: %w", err)
 
 	case sig := <-shutdown:
-		log.Printf("Start shutdown: signal %v", sig)
+		slog.Info("start shutdown", "signal", sig.String())
+		a.Health.Drain()
 
 		// Create a context with a timeout for the shutdown
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), a.Cfg.Server.ShutdownTimeout)
 		defer cancel()
 
 		// Ask the server to shut down gracefully
@@ -3,22 +3,41 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"order-service/internal/handler"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/idempotency"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/server"
+	"vv-ecommerce/pkg/tracing"
 
 	"github.com/spf13/viper"
 )
 
 type DatabaseConfig struct {
+	// Driver 为 "mysql" (默认) 或 "sqlite"；sqlite 时 DBName 是数据库文件路径，为空则使用内存库
+	Driver   string `mapstructure:"Driver"`
 	Host     string `mapstructure:"Host"`
 	Port     string `mapstructure:"Port"`
 	User     string `mapstructure:"User"`
 	Password string `mapstructure:"Password"`
 	DBName   string `mapstructure:"DBName"`
+
+	// Replicas 只读从库 DSN 列表 (环境变量 DATABASE_REPLICAS 以逗号分隔)，为空时读写都走主库
+	Replicas []string `mapstructure:"Replicas"`
+
+	// 连接池 / 慢查询 / SQL 日志级别 (silent|error|warn|info)，如 DATABASE_POOL_MAXOPENCONNS=50
+	Pool          database.PoolConfig `mapstructure:"Pool"`
+	SlowThreshold time.Duration       `mapstructure:"SlowThreshold"`
+	LogLevel      string              `mapstructure:"LogLevel"`
 }
 
-// RedisConfig Redis 配置 (占位符)
+// RedisConfig Redis 配置 (Idempotency.Store 为 redis 时使用)
 type RedisConfig struct {
 	Addr     string `mapstructure:"Addr"`
 	Password string `mapstructure:"Password"`
@@ -36,12 +55,32 @@ type MQConfig struct {
 // Config 应用程序配置
 type Config struct {
 	ServerPort          int    `mapstructure:"ServerPort"`
+	ErrorStackTrace     bool   `mapstructure:"ErrorStackTrace"` // 创建 AppError 时是否采集调用栈
 	InventoryServiceURL string `mapstructure:"inventory_service_url"`
 	PaymentServiceURL   string `mapstructure:"payment_service_url"`
 
 	Database DatabaseConfig `mapstructure:"Database"`
-	Redis    RedisConfig    `mapstructure:"Redis"` // 占位符
-	MQ       MQConfig       `mapstructure:"MQ"`    // 占位符
+	Redis    RedisConfig    `mapstructure:"Redis"`
+	MQ       MQConfig       `mapstructure:"MQ"` // 占位符
+
+	// Log 日志级别与格式，如 LOG_LEVEL=debug LOG_FORMAT=text
+	Log logging.Config `mapstructure:"Log"`
+
+	// Tracing OpenTelemetry 配置，如 TRACING_EXPORTER=otlp TRACING_ENDPOINT=otel-collector:4318
+	Tracing tracing.Config `mapstructure:"Tracing"`
+
+	// Health 就绪检查的超时、缓存与优雅关闭前的摘流量等待，如 HEALTH_SHUTDOWNDELAY=10s
+	Health health.Config `mapstructure:"Health"`
+
+	// Idempotency POST /orders 的 Idempotency-Key 存储，如 IDEMPOTENCY_STORE=redis IDEMPOTENCY_TTL=24h
+	Idempotency idempotency.Config `mapstructure:"Idempotency"`
+
+	// Server HTTP 超时、请求 deadline、请求体上限与过载保护，如 SERVER_WRITETIMEOUT=60s
+	Server server.Config `mapstructure:"Server"`
+	// Events 订单状态推送 (GET /orders/events)，如 EVENTS_HEARTBEATINTERVAL=15s
+	Events handler.EventsConfig `mapstructure:"Events"`
+	// OutboxBacklogThreshold 待发布的 outbox 事件超过该值时 /readyz 失败
+	OutboxBacklogThreshold int64 `mapstructure:"OutboxBacklogThreshold"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -60,7 +99,7 @@ func LoadConfig() (*Config, error) {
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
 			// 配置文件未找到，可以忽略或记录警告
-			fmt.Printf("Warning: Config file for environment '%s' not found, using environment variables or defaults.\n", env)
+			slog.Warn("config file not found, using environment variables or defaults", "env", env)
 		} else {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
@@ -68,11 +107,64 @@ func LoadConfig() (*Config, error) {
 
 	// 设置默认值 (如果配置文件和环境变量都没有设置)
 	viper.SetDefault("ServerPort", 8081)
+	viper.SetDefault("Database.Driver", "mysql")
 	viper.SetDefault("Database.Host", "localhost")
 	viper.SetDefault("Database.Port", "3306")
 	viper.SetDefault("Database.User", "root")
 	viper.SetDefault("Database.Password", "root")
 	viper.SetDefault("Database.DBName", "order_db")
+	viper.SetDefault("Database.Pool.MaxIdleConns", 10)
+	viper.SetDefault("Database.Pool.MaxOpenConns", 100)
+	viper.SetDefault("Database.Pool.ConnMaxLifetime", "1h")
+	viper.SetDefault("Database.Pool.ConnMaxIdleTime", "10m")
+	viper.SetDefault("Database.SlowThreshold", "200ms")
+	viper.SetDefault("Database.LogLevel", "warn")
+	viper.SetDefault("Log.Level", "info")
+	viper.SetDefault("Log.Format", logging.FormatJSON)
+	viper.SetDefault("Log.PanicFile", "")
+	// 默认全量记录访问日志，探针和 /metrics 只在出错时记录；DebugTraceIDs 为空即不记录请求体
+	viper.SetDefault("Log.Access.SampleRate", 1.0)
+	viper.SetDefault("Log.Access.Routes", logging.DefaultAccessRoutes())
+	viper.SetDefault("Log.Access.DebugTraceIDs", []string{})
+	viper.SetDefault("Log.Access.MaxBodyBytes", logging.DefaultMaxBodyBytes)
+	viper.SetDefault("Log.Redact.Fields", []string{})
+	viper.SetDefault("Log.Redact.Headers", []string{})
+	viper.SetDefault("Log.Redact.QueryParams", []string{})
+	viper.SetDefault("Log.Redact.Mask", logging.DefaultMask)
+	viper.SetDefault("Tracing.Exporter", tracing.ExporterNone)
+	viper.SetDefault("Tracing.Endpoint", "")
+	viper.SetDefault("Tracing.Insecure", true)
+	viper.SetDefault("Tracing.SampleRatio", 1.0)
+	viper.SetDefault("Health.Timeout", "2s")
+	viper.SetDefault("Health.CacheTTL", "2s")
+	viper.SetDefault("Health.ShutdownDelay", "5s")
+	srv := server.Defaults()
+	viper.SetDefault("Server.ReadHeaderTimeout", srv.ReadHeaderTimeout)
+	viper.SetDefault("Server.ReadTimeout", srv.ReadTimeout)
+	viper.SetDefault("Server.WriteTimeout", srv.WriteTimeout)
+	viper.SetDefault("Server.IdleTimeout", srv.IdleTimeout)
+	viper.SetDefault("Server.ShutdownTimeout", srv.ShutdownTimeout)
+	viper.SetDefault("Server.RequestTimeout.Default", srv.RequestTimeout.Default)
+	// 下单要串行调用库存 (含重试) 和支付 (5s 超时)，比默认 deadline 长
+	viper.SetDefault("Server.RequestTimeout.Routes", map[string]string{"POST /orders": "15s"})
+	viper.SetDefault("Server.MaxBodyBytes", srv.MaxBodyBytes)
+	viper.SetDefault("Server.LoadShed.InitialLimit", srv.LoadShed.InitialLimit)
+	viper.SetDefault("Server.LoadShed.MinLimit", srv.LoadShed.MinLimit)
+	viper.SetDefault("Server.LoadShed.MaxLimit", srv.LoadShed.MaxLimit)
+	viper.SetDefault("Server.LoadShed.LatencyTarget", srv.LoadShed.LatencyTarget)
+	viper.SetDefault("Server.LoadShed.RetryAfter", srv.LoadShed.RetryAfter)
+	viper.SetDefault("OutboxBacklogThreshold", 1000)
+	viper.SetDefault("Events.HeartbeatInterval", "15s")
+	viper.SetDefault("Events.MaxDuration", "30m")
+	viper.SetDefault("Events.RetryAfter", "3s")
+
+	viper.SetDefault("Redis.Addr", "localhost:6379")
+	viper.SetDefault("Redis.Password", "")
+	viper.SetDefault("Redis.DB", 0)
+	// LockTTL 需大于 POST /orders 的请求 deadline
+	viper.SetDefault("Idempotency.Store", idempotency.StoreSQL)
+	viper.SetDefault("Idempotency.TTL", "24h")
+	viper.SetDefault("Idempotency.LockTTL", "30s")
 
 	viper.SetDefault("MQ.Host", "localhost")
 	viper.SetDefault("MQ.Port", "5672")
@@ -83,8 +175,8 @@ func LoadConfig() (*Config, error) {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
 	// Explicitly bind service URLs
-	viper.BindEnv("InventoryServiceURL", "INVENTORY_SERVICE_URL")
-	viper.BindEnv("PaymentServiceURL", "PAYMENT_SERVICE_URL")
+	viper.BindEnv("inventory_service_url", "INVENTORY_SERVICE_URL")
+	viper.BindEnv("payment_service_url", "PAYMENT_SERVICE_URL")
 
 	// Read config from environment variables
 	viper.AutomaticEnv()
@@ -99,8 +191,17 @@ func LoadConfig() (*Config, error) {
 	if cfg.ServerPort == 0 {
 		return nil, fmt.Errorf("ServerPort cannot be 0")
 	}
-	if cfg.Database.Host == "" || cfg.Database.Port == "" || cfg.Database.User == "" || cfg.Database.Password == "" || cfg.Database.DBName == "" {
-		return nil, fmt.Errorf("Database configuration (Host, Port, User, Password, DBName) cannot be empty")
+	if err := cfg.Idempotency.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Events.HeartbeatInterval <= 0 {
+		return nil, fmt.Errorf("Events.HeartbeatInterval must be positive")
+	}
+	// SQLite 只用 DBName (文件路径，为空则是内存库)，连接参数仅对 MySQL 必填
+	if cfg.Database.Driver == "" || cfg.Database.Driver == database.DriverMySQL {
+		if cfg.Database.Host == "" || cfg.Database.Port == "" || cfg.Database.User == "" || cfg.Database.Password == "" || cfg.Database.DBName == "" {
+			return nil, fmt.Errorf("Database configuration (Host, Port, User, Password, DBName) cannot be empty")
+		}
 	}
 
 	return cfg, nil
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"vv-ecommerce/pkg/async"
+	"vv-ecommerce/pkg/common/apperror"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/metrics"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventsConfig 订单状态推送 (SSE) 配置，如 EVENTS_HEARTBEATINTERVAL=15s EVENTS_MAXDURATION=30m
+type EventsConfig struct {
+	// HeartbeatInterval 没有事件时发送注释行的间隔，防止中间的代理断开空闲连接，也能及时发现客户端已断开
+	HeartbeatInterval time.Duration `mapstructure:"HeartbeatInterval"`
+	// MaxDuration 一个连接最长保持的时间，到期后客户端自动重连 (连接重新分散到各实例)，0 表示不限制
+	MaxDuration time.Duration `mapstructure:"MaxDuration"`
+	// RetryAfter 告诉客户端断线后多久重连 (SSE 的 retry 字段)
+	RetryAfter time.Duration `mapstructure:"RetryAfter"`
+}
+
+// lastEventIDHeader EventSource 重连时带上收到的最后一个事件 id
+const lastEventIDHeader = "Last-Event-ID"
+
+// OrderEventsHandler GET /orders/events?order_id= 以 SSE 推送订单状态的变化，事件 id 是变化后的订单版本号。
+// 带 Last-Event-ID 重连时先补发之后的变化，否则先发送一次当前状态
+func (h *OrderHandler) OrderEventsHandler(c *gin.Context) {
+	orderID := c.Query("order_id")
+	if orderID == "" {
+		response.Error(c, apperror.InvalidInput("Missing order_id", nil))
+		return
+	}
+	// 非管理员只能订阅自己的订单
+	owner, err := middleware.OwnerFilter(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+	var lastVersion int64
+	if raw := c.GetHeader(lastEventIDHeader); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			response.Error(c, apperror.InvalidInput("invalid Last-Event-ID", err))
+			return
+		}
+		lastVersion = v
+	}
+
+	// 先订阅再读订单，读取期间发生的变化不会丢；重复的按版本号跳过
+	events, unsubscribe := h.events.Subscribe(orderID)
+	defer unsubscribe()
+
+	ctx := c.Request.Context()
+	order, err := h.service.GetOrder(ctx, orderID, owner)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	var backlog []async.OrderStatusChanged
+	switch {
+	case lastVersion > 0 && lastVersion < order.Version:
+		backlog, err = h.service.StatusChangesSince(ctx, order, lastVersion)
+		if err != nil {
+			response.Error(c, apperror.Internal("failed to fetch order history", err))
+			return
+		}
+	case lastVersion == 0 || lastVersion > order.Version:
+		// 第一次连接，或者 Last-Event-ID 不是这个订单的版本号
+		backlog = []async.OrderStatusChanged{{
+			OrderID: order.OrderID,
+			UserID:  order.UserID,
+			Status:  string(order.Status),
+			Version: order.Version,
+			At:      time.Now().UTC(),
+		}}
+	}
+
+	metrics.OrderEventStreams.Inc()
+	defer metrics.OrderEventStreams.Dec()
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx 等反向代理不要缓冲
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if h.eventsCfg.RetryAfter > 0 {
+		fmt.Fprintf(w, "retry: %d\n\n", h.eventsCfg.RetryAfter.Milliseconds())
+	}
+
+	sent := lastVersion
+	for _, ev := range backlog {
+		if err := writeEvent(w, ev); err != nil {
+			return
+		}
+		sent = max(sent, ev.Version)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(h.eventsCfg.HeartbeatInterval)
+	defer heartbeat.Stop()
+	var expired <-chan time.Time
+	if h.eventsCfg.MaxDuration > 0 {
+		timer := time.NewTimer(h.eventsCfg.MaxDuration)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired:
+			return
+		case ev, ok := <-events:
+			// 订阅被关闭 (读得太慢)：结束连接，客户端带 Last-Event-ID 重连补上
+			if !ok {
+				return
+			}
+			if ev.Version <= sent {
+				continue
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+			sent = ev.Version
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		w.Flush()
+	}
+}
+
+// writeEvent 写一条 status 事件，id 为订单版本号
+func writeEvent(w gin.ResponseWriter, ev async.OrderStatusChanged) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", ev.Version, data)
+	return err
+}
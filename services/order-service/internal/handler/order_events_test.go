@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"order-service/internal/model"
+	"order-service/internal/repository"
+	"order-service/internal/service"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/async"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeBroadcaster 把广播同步分发给本进程的订阅者，代替 RabbitMQ 的 fanout exchange
+type fakeBroadcaster struct {
+	mu       sync.Mutex
+	handlers map[string][]async.Handler
+}
+
+func (b *fakeBroadcaster) Publish(context.Context, string, []byte) error { return nil }
+func (b *fakeBroadcaster) Subscribe(string, async.Handler) error         { return nil }
+func (b *fakeBroadcaster) Close() error                                  { return nil }
+
+func (b *fakeBroadcaster) SubscribeBroadcast(topic string, handler async.Handler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.handlers == nil {
+		b.handlers = map[string][]async.Handler{}
+	}
+	b.handlers[topic] = append(b.handlers[topic], handler)
+	return nil
+}
+
+func (b *fakeBroadcaster) Broadcast(ctx context.Context, topic string, payload []byte) error {
+	b.mu.Lock()
+	handlers := b.handlers[topic]
+	b.mu.Unlock()
+	for _, h := range handlers {
+		if err := h(ctx, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushRecorder 在第一次 Flush (补发的事件写完，已经订阅) 时通知测试
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	once    sync.Once
+	flushed chan struct{}
+}
+
+func (w *flushRecorder) Flush() {
+	w.ResponseRecorder.Flush()
+	w.once.Do(func() { close(w.flushed) })
+}
+
+func (w *flushRecorder) CloseNotify() <-chan bool { return nil }
+
+// sseEvent 是解析出的一条 SSE 消息
+type sseEvent struct {
+	id, event string
+	data      async.OrderStatusChanged
+}
+
+// parseSSE 解析响应体中的事件，注释行 (心跳) 单独计数
+func parseSSE(t *testing.T, body string) (events []sseEvent, pings int) {
+	t.Helper()
+	for _, block := range strings.Split(body, "\n\n") {
+		var ev sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case line == ": ping":
+				pings++
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.data); err != nil {
+					t.Fatalf("invalid data %q: %v", line, err)
+				}
+			}
+		}
+		if ev.id != "" {
+			events = append(events, ev)
+		}
+	}
+	return events, pings
+}
+
+// ids 把事件简化为 "版本:状态"
+func ids(events []sseEvent) []string {
+	var out []string
+	for _, ev := range events {
+		out = append(out, ev.id+":"+ev.data.Status)
+	}
+	return out
+}
+
+type eventsFixture struct {
+	router *gin.Engine
+	events *service.OrderEvents
+}
+
+// newEventsFixture 创建 user 7 的订单 o-7 并改两次状态，audit_log 中有版本 2 (inventory_reserved) 和 3 (paid)
+func newEventsFixture(t *testing.T, cfg EventsConfig) *eventsFixture {
+	t.Helper()
+	db := openTestDB(t)
+	if err := db.Use(audit.New(audit.Config{System: "order-service"})); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewOrderRepository(db)
+	ctx := context.Background()
+	if err := repo.CreateOrder(ctx, &model.Order{OrderID: "o-7", UserID: 7, Status: model.OrderStatusCreated, TotalAmount: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := service.NewOrderEvents(&fakeBroadcaster{})
+	if err := events.Start(); err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewOrderService(repo, nil, nil, nil, database.NewTransactionManager(db), events)
+	for _, status := range []model.OrderStatus{model.OrderStatusInventoryReserved, model.OrderStatusPaid} {
+		if _, err := svc.UpdateOrderStatus(ctx, "o-7", status, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/orders/events", NewOrderHandler(svc, events, cfg).OrderEventsHandler)
+	return &eventsFixture{router: r, events: events}
+}
+
+// stream 请求 /orders/events 直到连接结束；flushed 在补发的事件写完后关闭
+func (f *eventsFixture) stream(ctx context.Context, userID, lastEventID string) (*flushRecorder, <-chan struct{}) {
+	req := httptest.NewRequest(http.MethodGet, "/orders/events?order_id=o-7", nil).WithContext(ctx)
+	req.Header.Set(middleware.UserIDHeader, userID)
+	if lastEventID != "" {
+		req.Header.Set(lastEventIDHeader, lastEventID)
+	}
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder(), flushed: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.router.ServeHTTP(w, req)
+	}()
+	return w, done
+}
+
+func TestOrderEventsBacklog(t *testing.T) {
+	f := newEventsFixture(t, EventsConfig{HeartbeatInterval: time.Hour, MaxDuration: 20 * time.Millisecond})
+	for _, tc := range []struct {
+		name, lastEventID string
+		want              []string
+	}{
+		{name: "first connection sends the current state", want: []string{"3:paid"}},
+		// 断线期间错过的变化从 audit_log 重建
+		{name: "reconnect replays missed changes", lastEventID: "1", want: []string{"2:inventory_reserved", "3:paid"}},
+		{name: "reconnect after the last change", lastEventID: "2", want: []string{"3:paid"}},
+		{name: "up to date", lastEventID: "3"},
+		{name: "unknown version sends the current state", lastEventID: "99", want: []string{"3:paid"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w, done := f.stream(context.Background(), "7", tc.lastEventID)
+			<-done
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("status = %d, Content-Type = %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+			}
+			events, _ := parseSSE(t, w.Body.String())
+			if got := ids(events); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Fatalf("events = %v, want %v", got, tc.want)
+			}
+			for _, ev := range events {
+				if ev.event != "status" || ev.data.OrderID != "o-7" || ev.data.UserID != 7 {
+					t.Fatalf("event = %+v", ev)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderEventsRejectsInvalidRequests(t *testing.T) {
+	f := newEventsFixture(t, EventsConfig{HeartbeatInterval: time.Hour, MaxDuration: time.Second})
+	for _, tc := range []struct {
+		name, userID, lastEventID string
+		want                      int
+	}{
+		{name: "another user's order", userID: "8", want: http.StatusNotFound},
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "invalid Last-Event-ID", userID: "7", lastEventID: "abc", want: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w, done := f.stream(context.Background(), tc.userID, tc.lastEventID)
+			<-done
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestOrderEventsLiveAndHeartbeat(t *testing.T) {
+	f := newEventsFixture(t, EventsConfig{HeartbeatInterval: 5 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, done := f.stream(ctx, "7", "3")
+	<-w.flushed
+	// 重复的 (版本不大于已发送的) 被跳过，其他订单的变化不会推送
+	for _, ev := range []async.OrderStatusChanged{
+		{OrderID: "o-7", UserID: 7, Status: "paid", Version: 3},
+		{OrderID: "o-8", UserID: 8, Status: "paid", Version: 4},
+		{OrderID: "o-7", UserID: 7, Status: "completed", Version: 4},
+		{OrderID: "o-7", UserID: 7, Status: "completed", Version: 4},
+	} {
+		if err := f.events.Publish(context.Background(), ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream did not end after the client went away")
+	}
+
+	events, pings := parseSSE(t, w.Body.String())
+	if got := ids(events); strings.Join(got, ",") != "4:completed" {
+		t.Fatalf("events = %v, want only the new change", got)
+	}
+	if pings == 0 {
+		t.Fatalf("no heartbeat in %q", w.Body.String())
+	}
+}
+
+func TestOrderEventsMaxDuration(t *testing.T) {
+	f := newEventsFixture(t, EventsConfig{HeartbeatInterval: time.Hour, MaxDuration: 30 * time.Millisecond, RetryAfter: 2 * time.Second})
+	start := time.Now()
+	w, done := f.stream(context.Background(), "7", "")
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream was not closed after MaxDuration")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("stream closed after %s, before MaxDuration", elapsed)
+	}
+	// 客户端按 retry 字段重连
+	if !strings.HasPrefix(w.Body.String(), "retry: 2000\n\n") {
+		t.Fatalf("body = %q, want the retry field first", w.Body.String())
+	}
+}
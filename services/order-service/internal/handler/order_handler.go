@@ -2,28 +2,39 @@ package handler
 
 import (
 	"fmt"
-	"net/http"
 	"order-service/internal/model"
 	"order-service/internal/service"
+	"strconv"
 	"vv-ecommerce/pkg/common/apperror"
 	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 type OrderHandler struct {
-	service *service.OrderService
+	service   *service.OrderService
+	events    *service.OrderEvents
+	eventsCfg EventsConfig
 }
 
-func NewOrderHandler(s *service.OrderService) *OrderHandler {
+func NewOrderHandler(s *service.OrderService, events *service.OrderEvents, eventsCfg EventsConfig) *OrderHandler {
 	return &OrderHandler{
-		service: s,
+		service:   s,
+		events:    events,
+		eventsCfg: eventsCfg,
 	}
 }
 
 func (h *OrderHandler) CreateOrderHandler(c *gin.Context) {
+	// 用户只认网关认证后注入的 X-User-ID，不信任请求体
+	userID, err := middleware.UserID(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
 	var input struct {
-		UserID   int64  `json:"user_id" binding:"required,gt=0"`
 		Quantity int64  `json:"quantity" binding:"required,gt=0"`
 		Price    int64  `json:"price" binding:"required,gt=0"`
 		SKU      string `json:"sku" binding:"required"`
@@ -34,13 +45,13 @@ func (h *OrderHandler) CreateOrderHandler(c *gin.Context) {
 		return
 	}
 
-	order, err := h.service.CreateOrder(c.Request.Context(), input.UserID, input.Quantity, input.Price, input.SKU)
+	order, err := h.service.CreateOrder(c.Request.Context(), userID, input.Quantity, input.Price, input.SKU)
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, order)
+	response.Success(c, order)
 }
 
 func (h *OrderHandler) GetOrderHandler(c *gin.Context) {
@@ -50,26 +61,70 @@ func (h *OrderHandler) GetOrderHandler(c *gin.Context) {
 		return
 	}
 
-	order, err := h.service.GetOrder(c.Request.Context(), orderID)
+	// 非管理员只能查到自己的订单
+	owner, err := middleware.OwnerFilter(c)
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
-	if order == nil {
-		response.Error(c, apperror.NotFound("Order not found", nil))
+
+	order, err := h.service.GetOrder(c.Request.Context(), orderID, owner)
+	if err != nil {
+		response.Error(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, order)
+	response.SetETag(c, order.Version)
+	response.Success(c, order)
 }
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
 func (h *OrderHandler) ListOrdersHandler(c *gin.Context) {
-	orders, err := h.service.GetOrders(c.Request.Context())
+	// 非管理员只列出自己的订单
+	owner, err := middleware.OwnerFilter(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	limit := defaultPageSize
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			response.Error(c, apperror.InvalidInput("invalid limit", err))
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	beforeID, err := response.DecodeCursor(c.Query("cursor"))
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, orders)
+
+	page, err := h.service.GetOrders(c.Request.Context(), owner, beforeID, limit)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	pagination := response.Pagination{
+		Limit:   limit,
+		HasMore: page.HasMore,
+		Total:   &page.Total,
+	}
+	if page.HasMore {
+		pagination.NextCursor = response.EncodeCursor(page.NextID)
+	}
+	response.Paginated(c, page.Orders, pagination)
 }
 
 func (h *OrderHandler) UpdateOrderStatusHandler(c *gin.Context) {
@@ -83,16 +138,50 @@ func (h *OrderHandler) UpdateOrderStatusHandler(c *gin.Context) {
 		return
 	}
 
-	rowsAffected, err := h.service.UpdateOrderStatus(c.Request.Context(), input.OrderID, input.Status)
+	ifMatch, err := response.IfMatch(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	order, err := h.service.UpdateOrderStatus(c.Request.Context(), input.OrderID, input.Status, ifMatch)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.SetETag(c, order.Version)
+	response.Success(c, map[string]string{"message": fmt.Sprintf("Order %s updated to %s", input.OrderID, input.Status)})
+}
+
+func (h *OrderHandler) GetOrderHistoryHandler(c *gin.Context) {
+	orderID := c.Query("order_id")
+	if orderID == "" {
+		response.Error(c, apperror.InvalidInput("Missing order_id", nil))
+		return
+	}
+
+	owner, err := middleware.OwnerFilter(c)
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
-	if rowsAffected == 0 {
-		response.Error(c, apperror.NotFound("No update needed or order not found", nil))
+	limit := defaultHistoryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			response.Error(c, apperror.InvalidInput("invalid limit", err))
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+
+	entries, err := h.service.GetOrderHistory(c.Request.Context(), orderID, owner, limit)
+	if err != nil {
+		response.Error(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]string{"message": fmt.Sprintf("Order %s updated to %s", input.OrderID, input.Status)})
+	response.Success(c, entries)
 }
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"order-service/internal/model"
+	"order-service/internal/repository"
+	"order-service/internal/service"
+	"order-service/migrations"
+	"testing"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/migrate"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// openTestDB 打开内存 SQLite 并执行内嵌迁移
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := migrate.New(sqlDB, database.DriverSQLite, migrations.FS, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	return db
+}
+
+// newTestRouter 在内存 SQLite 上创建 user 7 和 user 8 各一个订单，路由与 router.New 中的查询路由一致
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	db := openTestDB(t)
+	repo := repository.NewOrderRepository(db)
+	for _, o := range []*model.Order{
+		{OrderID: "o-7", UserID: 7, Status: model.OrderStatusCreated, TotalAmount: 100},
+		{OrderID: "o-8", UserID: 8, Status: model.OrderStatusCreated, TotalAmount: 200},
+	} {
+		if err := repo.CreateOrder(context.Background(), o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	svc := service.NewOrderService(repo, nil, nil, nil, database.NewTransactionManager(db), nil)
+	h := NewOrderHandler(svc, nil, EventsConfig{})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/orders", func(c *gin.Context) {
+		if c.Query("order_id") != "" {
+			h.GetOrderHandler(c)
+		} else {
+			h.ListOrdersHandler(c)
+		}
+	})
+	r.GET("/orders/history", h.GetOrderHistoryHandler)
+	return r
+}
+
+func get(r *gin.Engine, path, userID, roles string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if userID != "" {
+		req.Header.Set(middleware.UserIDHeader, userID)
+	}
+	if roles != "" {
+		req.Header.Set(middleware.UserRolesHeader, roles)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetOrderOnlyReturnsOwnOrders(t *testing.T) {
+	r := newTestRouter(t)
+
+	for _, tc := range []struct {
+		name, path, userID, roles string
+		want                      int
+	}{
+		{"owner", "/orders?order_id=o-7", "7", "", http.StatusOK},
+		{"other user", "/orders?order_id=o-8", "7", "", http.StatusNotFound},
+		{"admin", "/orders?order_id=o-8", "7", "user,admin", http.StatusOK},
+		{"anonymous", "/orders?order_id=o-7", "", "", http.StatusUnauthorized},
+		{"other user's history", "/orders/history?order_id=o-8", "7", "", http.StatusNotFound},
+		{"own history", "/orders/history?order_id=o-7", "7", "", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := get(r, tc.path, tc.userID, tc.roles); w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestListOrdersOnlyReturnsOwnOrders(t *testing.T) {
+	r := newTestRouter(t)
+
+	for _, tc := range []struct {
+		name, roles string
+		want        []string
+	}{
+		{"user", "", []string{"o-7"}},
+		{"admin", "admin", []string{"o-8", "o-7"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := get(r, "/orders", "7", tc.roles)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			var body struct {
+				Data []model.Order `json:"data"`
+				Meta struct {
+					Pagination struct {
+						Total int `json:"total"`
+					} `json:"pagination"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, o := range body.Data {
+				got = append(got, o.OrderID)
+			}
+			if len(got) != len(tc.want) || body.Meta.Pagination.Total != len(tc.want) {
+				t.Fatalf("orders = %v (total %d), want %v", got, body.Meta.Pagination.Total, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("orders = %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package model
 
+import (
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+)
+
 type Order struct {
 	ID          uint        `gorm:"primaryKey" json:"id"`                     // 数据库内部 ID (Primary Key)
 	OrderID     string      `gorm:"type:varchar(255);unique" json:"order_id"` // 业务订单 ID (Business Key)
@@ -7,6 +12,9 @@ type Order struct {
 	Status      OrderStatus `json:"status"`
 	TotalAmount int64       `json:"total_amount"`
 	TraceID     string      `gorm:"type:varchar(255);index" json:"trace_id"` // 追踪 ID
+
+	database.Versioned // 乐观锁版本号，每次状态变更 +1
+	audit.Fields       // created_by / updated_by，变更历史见 audit_log
 }
 
 type OrderStatus string
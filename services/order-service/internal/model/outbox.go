@@ -22,6 +22,7 @@ type OutboxEvent struct {
 	Payload       datatypes.JSON `gorm:"type:json;not null"`
 	Status        OutboxStatus   `gorm:"size:50;default:'PENDING';index"`
 	TraceID       string         `gorm:"size:255"`
+	TraceParent   string         `gorm:"size:64"` // W3C traceparent，投递 MQ 时恢复 trace
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
@@ -3,19 +3,25 @@ package repository
 import (
 	"context"
 	"order-service/internal/model"
+	"strconv"
 	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
 
 	"gorm.io/gorm" // 导入 GORM
 )
 
 type OrderRepository interface {
 	CreateOrder(ctx context.Context, order *model.Order) error
-	GetOrderByID(ctx context.Context, orderID string) (*model.Order, error)
-	GetOrders(ctx context.Context) ([]*model.Order, error)
+	// userID 限定订单所属的用户，为 0 时不限制 (管理员和服务内部调用)
+	GetOrderByID(ctx context.Context, orderID string, userID int64) (*model.Order, error)
+	GetOrders(ctx context.Context, userID int64, beforeID uint, limit int) ([]*model.Order, error)
+	CountOrders(ctx context.Context, userID int64) (int64, error)
 	UpdateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus) (int64, error)
+	UpdateOrderStatusWithVersion(ctx context.Context, orderID string, status model.OrderStatus, expectedVersion int64) (int64, error)
 	SaveOutboxEvent(ctx context.Context, event *model.OutboxEvent) error
 	GetPendingOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error)
 	UpdateOutboxEventStatus(ctx context.Context, id uint, status model.OutboxStatus) error
+	GetHistory(ctx context.Context, id uint, limit int) ([]audit.Entry, error)
 }
 
 type GORMOrderRepository struct {
@@ -30,39 +36,74 @@ func (r *GORMOrderRepository) CreateOrder(ctx context.Context, order *model.Orde
 	return database.GetDB(ctx, r.db).Create(order).Error // 使用 GORM 的 Create 方法
 }
 
-func (r *GORMOrderRepository) GetOrderByID(ctx context.Context, orderID string) (*model.Order, error) {
+// ownedBy 只查询 userID 的订单，userID 为 0 时不限制
+func ownedBy(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if userID == 0 {
+			return db
+		}
+		return db.Where("user_id = ?", userID)
+	}
+}
+
+func (r *GORMOrderRepository) GetOrderByID(ctx context.Context, orderID string, userID int64) (*model.Order, error) {
 	var order model.Order
-	err := database.GetDB(ctx, r.db).Where("order_id = ?", orderID).First(&order).Error // 使用 GORM 的 Where 和 First 方法
+	err := database.GetDB(ctx, r.db).Scopes(ownedBy(userID)).Where("order_id = ?", orderID).First(&order).Error // 使用 GORM 的 Where 和 First 方法
 	if err == gorm.ErrRecordNotFound {
 		return nil, nil // Order not found
 	}
 	return &order, err
 }
 
-func (r *GORMOrderRepository) GetOrders(ctx context.Context) ([]*model.Order, error) {
+// GetOrders 按 ID 倒序分页查询，beforeID 为 0 时从最新一条开始
+func (r *GORMOrderRepository) GetOrders(ctx context.Context, userID int64, beforeID uint, limit int) ([]*model.Order, error) {
 	var orders []*model.Order
-	err := database.GetDB(ctx, r.db).Order("created_at desc").Limit(20).Find(&orders).Error
-	if err != nil {
+	query := database.GetDB(ctx, r.db).Scopes(ownedBy(userID)).Order("id desc").Limit(limit)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	if err := query.Find(&orders).Error; err != nil {
 		return nil, err
 	}
 	return orders, nil
 }
 
+func (r *GORMOrderRepository) CountOrders(ctx context.Context, userID int64) (int64, error) {
+	var total int64
+	err := database.GetDB(ctx, r.db).Scopes(ownedBy(userID)).Model(&model.Order{}).Count(&total).Error
+	return total, err
+}
+
 func (r *GORMOrderRepository) UpdateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus) (int64, error) {
-	result := database.GetDB(ctx, r.db).Model(&model.Order{}).Where("order_id = ? AND status != ?", orderID, status).Update("status", status) // 使用 GORM 的 Model, Where 和 Update 方法
+	result := database.GetDB(ctx, r.db).Model(&model.Order{}).Where("order_id = ? AND status != ?", orderID, status).Updates(map[string]interface{}{
+		"status":               status,
+		database.VersionColumn: database.IncrementVersion(), // 不做版本检查，但让客户端持有的 ETag 失效
+	})
 	return result.RowsAffected, result.Error
 }
 
+// UpdateOrderStatusWithVersion 只有当前版本等于 expectedVersion 时才更新，返回新版本号
+func (r *GORMOrderRepository) UpdateOrderStatusWithVersion(ctx context.Context, orderID string, status model.OrderStatus, expectedVersion int64) (int64, error) {
+	return database.UpdateWithVersion(database.GetDB(ctx, r.db), &model.Order{}, expectedVersion,
+		map[string]interface{}{"status": status}, "order_id = ?", orderID)
+}
+
 func (r *GORMOrderRepository) SaveOutboxEvent(ctx context.Context, event *model.OutboxEvent) error {
 	return database.GetDB(ctx, r.db).Create(event).Error
 }
 
+// GetPendingOutboxEvents 从主库读：从库落后时会看到已经发布过的事件，导致重复发布
 func (r *GORMOrderRepository) GetPendingOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
 	var events []model.OutboxEvent
-	err := database.GetDB(ctx, r.db).Where("status = ?", model.OutboxStatusPending).Limit(limit).Order("created_at ASC").Find(&events).Error
+	err := database.GetDB(database.WithReadYourWrites(ctx), r.db).Where("status = ?", model.OutboxStatusPending).Limit(limit).Order("created_at ASC").Find(&events).Error
 	return events, err
 }
 
 func (r *GORMOrderRepository) UpdateOutboxEventStatus(ctx context.Context, id uint, status model.OutboxStatus) error {
 	return database.GetDB(ctx, r.db).Model(&model.OutboxEvent{}).Where("id = ?", id).Update("status", status).Error
 }
+
+// GetHistory 返回订单的变更历史 (最新的在前)
+func (r *GORMOrderRepository) GetHistory(ctx context.Context, id uint, limit int) ([]audit.Entry, error) {
+	return audit.History(ctx, r.db, "orders", strconv.FormatUint(uint64(id), 10), limit)
+}
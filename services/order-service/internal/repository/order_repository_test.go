@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"order-service/internal/model"
+	"order-service/migrations"
+	"path/filepath"
+	"testing"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/database/migrate"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// openTestDB 打开内存 SQLite 并执行内嵌迁移，与服务启动时的表结构一致
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := migrate.New(sqlDB, database.DriverSQLite, migrations.FS, database.DriverSQLite)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if err := db.Use(audit.New(audit.Config{System: "order-service"})); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createOrder(t *testing.T, repo OrderRepository, orderID string) *model.Order {
+	t.Helper()
+	order := &model.Order{OrderID: orderID, UserID: 7, Status: model.OrderStatusCreated, TotalAmount: 1999, TraceID: "trace-" + orderID}
+	if err := repo.CreateOrder(context.Background(), order); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	return order
+}
+
+func TestCreateAndGetOrder(t *testing.T) {
+	repo := NewOrderRepository(openTestDB(t))
+	ctx := context.Background()
+	created := createOrder(t, repo, "o-1")
+
+	got, err := repo.GetOrderByID(ctx, "o-1", 0)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.ID != created.ID || got.TotalAmount != 1999 || got.Status != model.OrderStatusCreated || got.Version != 1 {
+		t.Fatalf("got %+v", got)
+	}
+
+	missing, err := repo.GetOrderByID(ctx, "nope", 0)
+	if err != nil || missing != nil {
+		t.Fatalf("missing order = %v, %v; want nil, nil", missing, err)
+	}
+
+	dup := &model.Order{OrderID: "o-1"}
+	if err := repo.CreateOrder(ctx, dup); !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("duplicate order_id: err = %v, want gorm.ErrDuplicatedKey", err)
+	}
+}
+
+func TestGetOrdersPagesByID(t *testing.T) {
+	repo := NewOrderRepository(openTestDB(t))
+	ctx := context.Background()
+	for _, id := range []string{"o-1", "o-2", "o-3"} {
+		createOrder(t, repo, id)
+	}
+
+	page, err := repo.GetOrders(ctx, 0, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].OrderID != "o-3" || page[1].OrderID != "o-2" {
+		t.Fatalf("first page = %v", orderIDs(page))
+	}
+	next, err := repo.GetOrders(ctx, 0, page[1].ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next) != 1 || next[0].OrderID != "o-1" {
+		t.Fatalf("second page = %v", orderIDs(next))
+	}
+	if total, err := repo.CountOrders(ctx, 0); err != nil || total != 3 {
+		t.Fatalf("count = %d, %v", total, err)
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	repo := NewOrderRepository(openTestDB(t))
+	ctx := context.Background()
+	createOrder(t, repo, "o-1")
+
+	if n, err := repo.UpdateOrderStatus(ctx, "o-1", model.OrderStatusPaid); err != nil || n != 1 {
+		t.Fatalf("update = %d, %v", n, err)
+	}
+	// 状态未变化时不更新
+	if n, err := repo.UpdateOrderStatus(ctx, "o-1", model.OrderStatusPaid); err != nil || n != 0 {
+		t.Fatalf("repeat update = %d, %v; want 0 rows", n, err)
+	}
+
+	got, _ := repo.GetOrderByID(ctx, "o-1", 0)
+	if got.Status != model.OrderStatusPaid || got.Version != 2 {
+		t.Fatalf("after update: status %s, version %d", got.Status, got.Version)
+	}
+
+	version, err := repo.UpdateOrderStatusWithVersion(ctx, "o-1", model.OrderStatusCompleted, 2)
+	if err != nil || version != 3 {
+		t.Fatalf("versioned update = %d, %v", version, err)
+	}
+	if _, err := repo.UpdateOrderStatusWithVersion(ctx, "o-1", model.OrderStatusCancelled, 2); !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	history, err := repo.GetHistory(ctx, got.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Action != "update" || history[2].Action != "create" {
+		t.Fatalf("history = %+v", history)
+	}
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(history[0].Before, &before); err != nil {
+		t.Fatalf("before_json: %v", err)
+	}
+	if err := json.Unmarshal(history[0].After, &after); err != nil {
+		t.Fatalf("after_json: %v", err)
+	}
+	if before["status"] != string(model.OrderStatusPaid) || after["status"] != string(model.OrderStatusCompleted) {
+		t.Fatalf("latest change: before %v, after %v", before, after)
+	}
+}
+
+func TestOutboxEvents(t *testing.T) {
+	repo := NewOrderRepository(openTestDB(t))
+	ctx := context.Background()
+
+	payloads := []string{`{"sku":"S1","quantity":2}`, `{"sku":"S2","quantity":1}`, `{"sku":"S3","quantity":5}`}
+	var ids []uint
+	for _, p := range payloads {
+		event := &model.OutboxEvent{
+			AggregateType: "Order",
+			AggregateID:   "o-1",
+			EventType:     "InventoryRollback",
+			Payload:       datatypes.JSON(p),
+			Status:        model.OutboxStatusPending,
+			TraceParent:   "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		}
+		if err := repo.SaveOutboxEvent(ctx, event); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+		ids = append(ids, event.ID)
+	}
+
+	pending, err := repo.GetPendingOutboxEvents(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].ID != ids[0] || pending[1].ID != ids[1] {
+		t.Fatalf("pending = %+v", pending)
+	}
+	var payload struct {
+		SKU      string `json:"sku"`
+		Quantity int    `json:"quantity"`
+	}
+	if err := json.Unmarshal(pending[0].Payload, &payload); err != nil || payload.SKU != "S1" || payload.Quantity != 2 {
+		t.Fatalf("payload = %s (%v)", pending[0].Payload, err)
+	}
+	if pending[0].TraceParent == "" {
+		t.Fatal("trace_parent not persisted")
+	}
+
+	if err := repo.UpdateOutboxEventStatus(ctx, ids[0], model.OutboxStatusProcessed); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateOutboxEventStatus(ctx, ids[1], model.OutboxStatusFailed); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = repo.GetPendingOutboxEvents(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != ids[2] {
+		t.Fatalf("pending after relay = %+v", pending)
+	}
+}
+
+func TestOutboxSavedWithOrderInTransaction(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewOrderRepository(db)
+	tm := database.NewTransactionManager(db)
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	err := tm.Transaction(ctx, func(ctx context.Context) error {
+		if err := repo.CreateOrder(ctx, &model.Order{OrderID: "o-1", Status: model.OrderStatusCreated}); err != nil {
+			return err
+		}
+		if err := repo.SaveOutboxEvent(ctx, &model.OutboxEvent{AggregateType: "Order", AggregateID: "o-1", EventType: "OrderCreated", Payload: datatypes.JSON(`{}`)}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("err = %v", err)
+	}
+	if total, _ := repo.CountOrders(ctx, 0); total != 0 {
+		t.Fatalf("%d orders after rollback", total)
+	}
+	if pending, _ := repo.GetPendingOutboxEvents(ctx, 10); len(pending) != 0 {
+		t.Fatalf("%d outbox events after rollback", len(pending))
+	}
+}
+
+func orderIDs(orders []*model.Order) []string {
+	ids := make([]string, 0, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.OrderID)
+	}
+	return ids
+}
+
+// TestPendingOutboxEventsReadFromPrimary 从库还没有同步到已发布的状态时，轮询不能把事件再发一次
+func TestPendingOutboxEventsReadFromPrimary(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewOrderRepository(db)
+	ctx := context.Background()
+
+	event := &model.OutboxEvent{AggregateType: "Order", AggregateID: "o-1", EventType: "OrderCreated", Payload: datatypes.JSON(`{}`), Status: model.OutboxStatusPending}
+	if err := repo.SaveOutboxEvent(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	// 从库停在事件刚写入、还没有发布的时刻
+	replicaPath := filepath.Join(t.TempDir(), "replica.db")
+	replica, err := gorm.Open(sqlite.Open(replicaPath), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicaSQL, _ := replica.DB()
+	runner, err := migrate.New(replicaSQL, database.DriverSQLite, migrations.FS, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Create(&model.OutboxEvent{ID: event.ID, AggregateType: "Order", AggregateID: "o-1", EventType: "OrderCreated", Payload: datatypes.JSON(`{}`), Status: model.OutboxStatusPending}).Error; err != nil {
+		t.Fatal(err)
+	}
+	replicaSQL.Close()
+	if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: []gorm.Dialector{sqlite.Open(replicaPath)}})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.UpdateOutboxEventStatus(ctx, event.ID, model.OutboxStatusProcessed); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := repo.GetPendingOutboxEvents(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("pending = %+v, want the published event to stay published", pending)
+	}
+}
@@ -1,29 +1,43 @@
 package router
 
 import (
-	"fmt"
-	"net/http"
 	"order-service/internal/handler"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/metrics"
 	"vv-ecommerce/pkg/middleware"
+	"vv-ecommerce/pkg/server"
 
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter(h *handler.OrderHandler) *gin.Engine {
+func NewRouter(h *handler.OrderHandler, checker *health.Checker, srv server.Config, idempotent gin.HandlerFunc, streams *middleware.Streams) *gin.Engine {
 	r := gin.New()
+	r.Use(middleware.Tracing("order-service"))
 	r.Use(middleware.TraceID())
+	r.Use(middleware.Actor())
 	r.Use(middleware.Logger())
+	r.Use(middleware.Metrics())
 	r.Use(middleware.Recovery())
 
-	// Health Check
-	r.GET("/health", func(c *gin.Context) {
-		c.String(http.StatusOK, "Order Service is healthy")
-		fmt.Println("Order Service is healthy")
-	})
+	// Probes: /livez 只表示进程存活，/readyz 检查依赖，关闭期间返回 503
+	r.GET("/livez", checker.Live)
+	r.GET("/readyz", checker.Ready)
+	// /health 是旧的探针地址，保留为 /readyz 的别名，兼容已有的探针和 compose healthcheck
+	r.GET("/health", checker.Ready)
+
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// 业务路由：过载保护、请求 deadline、请求体上限 (探针和 /metrics 不受影响)
+	api := r.Group("",
+		middleware.LoadShed(srv.LoadShed),
+		middleware.Timeout(srv.RequestTimeout),
+		middleware.BodyLimit(srv.MaxBodyBytes),
+	)
 
 	// Order Routes
-	r.POST("/orders", h.CreateOrderHandler)
-	r.GET("/orders", func(c *gin.Context) {
+	api.POST("/orders", idempotent, h.CreateOrderHandler) // 支持 Idempotency-Key
+	api.GET("/orders", func(c *gin.Context) {
 		// 如果有 order_id 参数，调用 GetOrderHandler (详情)
 		// 如果没有参数，调用 ListOrdersHandler (列表)
 		if c.Query("order_id") != "" {
@@ -32,7 +46,11 @@ func NewRouter(h *handler.OrderHandler) *gin.Engine {
 			h.ListOrdersHandler(c)
 		}
 	})
-	r.PATCH("/orders", h.UpdateOrderStatusHandler)
+	api.PATCH("/orders", h.UpdateOrderStatusHandler)
+	api.GET("/orders/history", h.GetOrderHistoryHandler)
+
+	// 订单状态推送 (SSE)：长连接，不经过过载保护和请求 deadline
+	r.GET("/orders/events", streams.Handler(), h.OrderEventsHandler)
 
 	return r
 }
@@ -1,16 +1,19 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"vv-ecommerce/pkg/async"
 	"vv-ecommerce/pkg/clients"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
 )
 
 type RollbackMessage struct {
 	SKU      string `json:"sku"`
 	Quantity int64  `json:"quantity"`
 	TraceID  string `json:"trace_id"`
+	OrderID  string `json:"order_id"`
 }
 
 type InventoryCompensator struct {
@@ -29,13 +32,22 @@ func NewInventoryCompensator(client *clients.InventoryClient, mq async.MessageQu
 
 // StartWorker starts listening for async rollback tasks
 func (c *InventoryCompensator) StartWorker() error {
-	return c.mq.Subscribe(c.topic, func(payload []byte) error {
+	return c.mq.Subscribe(c.topic, func(ctx context.Context, payload []byte) error {
 		var msg RollbackMessage
 		if err := json.Unmarshal(payload, &msg); err != nil {
 			return err // Unrecoverable format error, maybe should not retry?
 		}
 
-		fmt.Printf("Processing async rollback for SKU %s, Qty %d, TraceID %s\n", msg.SKU, msg.Quantity, msg.TraceID)
-		return c.client.Rollback(msg.SKU, msg.Quantity, msg.TraceID)
+		ctx = logging.With(ctx, logging.KeyOrderID, msg.OrderID)
+		logging.FromContext(ctx).InfoContext(ctx, "processing async inventory rollback",
+			logging.KeyComponent, "compensator",
+			"sku", msg.SKU,
+			"quantity", msg.Quantity,
+		)
+		if err := c.client.Rollback(ctx, msg.SKU, msg.Quantity, msg.TraceID); err != nil {
+			return err
+		}
+		metrics.OrdersCompensated.WithLabelValues(metrics.ActionInventoryRollback).Inc()
+		return nil
 	})
 }
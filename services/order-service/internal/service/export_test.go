@@ -0,0 +1,6 @@
+package service
+
+// ProcessOutbox 立即执行一轮 outbox 投递，测试不必等待轮询间隔
+func (p *OutboxProcessor) ProcessOutbox() {
+	p.processEvents()
+}
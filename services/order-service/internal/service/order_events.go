@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"order-service/internal/model"
+	"sync"
+	"time"
+	"vv-ecommerce/pkg/async"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/logging"
+)
+
+// subscriberBuffer 每个订阅者最多缓存的事件数；一个订单一共只有几次状态变化，满了说明客户端读得太慢
+const subscriberBuffer = 16
+
+// OrderEvents 把订单状态的变化推送给订阅了该订单的连接 (SSE)。
+// 状态变化通过 MQ 广播给所有实例 (async.TopicOrderStatus)，每个实例再分发给自己的连接，
+// 所以客户端连到哪个实例都能收到；MQ 不支持广播时只分发给本实例的连接
+type OrderEvents struct {
+	mq async.Broadcaster
+
+	mu   sync.Mutex
+	subs map[string]map[chan async.OrderStatusChanged]struct{}
+}
+
+func NewOrderEvents(mq async.MessageQueue) *OrderEvents {
+	e := &OrderEvents{subs: make(map[string]map[chan async.OrderStatusChanged]struct{})}
+	if b, ok := mq.(async.Broadcaster); ok {
+		e.mq = b
+	}
+	return e
+}
+
+// Start 订阅其他实例 (包括本实例) 广播的状态变化
+func (e *OrderEvents) Start() error {
+	if e.mq == nil {
+		slog.Warn("message queue does not support broadcast, order events are only delivered on this instance", logging.KeyComponent, "order-events")
+		return nil
+	}
+	return e.mq.SubscribeBroadcast(async.TopicOrderStatus, func(ctx context.Context, payload []byte) error {
+		var ev async.OrderStatusChanged
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			return err
+		}
+		e.dispatch(ev)
+		return nil
+	})
+}
+
+// Publish 广播一次状态变化；失败时客户端重连后会从变更历史中补上
+func (e *OrderEvents) Publish(ctx context.Context, ev async.OrderStatusChanged) error {
+	if e.mq == nil {
+		e.dispatch(ev)
+		return nil
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return e.mq.Broadcast(ctx, async.TopicOrderStatus, payload)
+}
+
+// Subscribe 订阅一个订单的状态变化，调用方结束时必须调用返回的 unsubscribe。
+// 订阅者跟不上时 channel 会被关闭，调用方应结束连接，由客户端带 Last-Event-ID 重连
+func (e *OrderEvents) Subscribe(orderID string) (<-chan async.OrderStatusChanged, func()) {
+	ch := make(chan async.OrderStatusChanged, subscriberBuffer)
+	e.mu.Lock()
+	if e.subs[orderID] == nil {
+		e.subs[orderID] = make(map[chan async.OrderStatusChanged]struct{})
+	}
+	e.subs[orderID][ch] = struct{}{}
+	e.mu.Unlock()
+
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.remove(orderID, ch)
+	}
+}
+
+func (e *OrderEvents) dispatch(ev async.OrderStatusChanged) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs[ev.OrderID] {
+		select {
+		case ch <- ev:
+		default:
+			slog.Warn("order event subscriber is too slow, closing stream", logging.KeyComponent, "order-events", logging.KeyOrderID, ev.OrderID)
+			e.remove(ev.OrderID, ch)
+		}
+	}
+}
+
+// remove 需要持有 mu；已经移除的 ch 不会重复关闭
+func (e *OrderEvents) remove(orderID string, ch chan async.OrderStatusChanged) {
+	subs := e.subs[orderID]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(e.subs, orderID)
+	}
+}
+
+// publishStatus 读出订单的当前状态并广播；只记录日志不返回错误，推送失败不影响下单流程
+func (s *OrderService) publishStatus(ctx context.Context, orderID string) {
+	if s.events == nil {
+		return
+	}
+	// 刚写入，必须从主库读取
+	order, err := s.repo.GetOrderByID(database.WithReadYourWrites(context.WithoutCancel(ctx)), orderID, 0)
+	if err != nil || order == nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to load order for status event", logging.Err(err))
+		return
+	}
+	s.publish(ctx, order)
+}
+
+// publish 广播 order 的当前状态
+func (s *OrderService) publish(ctx context.Context, order *model.Order) {
+	if s.events == nil {
+		return
+	}
+	// 状态已经写入，推送不随请求一起被取消
+	ctx = context.WithoutCancel(ctx)
+	ev := async.OrderStatusChanged{
+		OrderID: order.OrderID,
+		UserID:  order.UserID,
+		Status:  string(order.Status),
+		Version: order.Version,
+		At:      time.Now().UTC(),
+	}
+	if err := s.events.Publish(ctx, ev); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to publish order status event", logging.Err(err))
+	}
+}
+
+// maxReplayedChanges 断线重连时最多从变更历史中补发的记录数
+const maxReplayedChanges = 200
+
+// StatusChangesSince 返回订单在版本 afterVersion 之后的状态变化 (按版本升序)，从变更历史 (audit_log) 中重建，
+// 用于客户端带 Last-Event-ID 重连时补发断开期间错过的事件
+func (s *OrderService) StatusChangesSince(ctx context.Context, order *model.Order, afterVersion int64) ([]async.OrderStatusChanged, error) {
+	entries, err := s.repo.GetHistory(ctx, order.ID, maxReplayedChanges)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []async.OrderStatusChanged
+	// 历史是最新的在前
+	for i := len(entries) - 1; i >= 0; i-- {
+		var after struct {
+			Status  *string `json:"status"`
+			Version *int64  `json:"version"`
+		}
+		if err := json.Unmarshal(entries[i].After, &after); err != nil {
+			return nil, err
+		}
+		if after.Status == nil || after.Version == nil || *after.Version <= afterVersion {
+			continue
+		}
+		changes = append(changes, async.OrderStatusChanged{
+			OrderID: order.OrderID,
+			UserID:  order.UserID,
+			Status:  *after.Status,
+			Version: *after.Version,
+			At:      entries[i].CreatedAt,
+		})
+	}
+	return changes, nil
+}
@@ -2,18 +2,25 @@ package service
 
 import (
 	"context"
+	"errors"
 	"order-service/internal/model"
 	"order-service/internal/repository"
 	"time"
 	"vv-ecommerce/pkg/clients"
 	"vv-ecommerce/pkg/common/apperror"
 	"vv-ecommerce/pkg/common/constants"
+	"vv-ecommerce/pkg/common/traceid"
 	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
+	"vv-ecommerce/pkg/tracing"
 
 	"encoding/json"
 
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 func mustMarshal(v interface{}) []byte {
@@ -30,15 +37,23 @@ type OrderService struct {
 	paymentClient   *clients.PaymentClient
 	compensator     *InventoryCompensator
 	tm              database.TransactionManager
+	events          *OrderEvents // 状态变化推送，为 nil 时不推送
 }
 
-func NewOrderService(repo repository.OrderRepository, inventoryClient *clients.InventoryClient, paymentClient *clients.PaymentClient, compensator *InventoryCompensator, tm database.TransactionManager) *OrderService {
-	return &OrderService{repo: repo, inventoryClient: inventoryClient, paymentClient: paymentClient, compensator: compensator, tm: tm}
+func NewOrderService(repo repository.OrderRepository, inventoryClient *clients.InventoryClient, paymentClient *clients.PaymentClient, compensator *InventoryCompensator, tm database.TransactionManager, events *OrderEvents) *OrderService {
+	return &OrderService{repo: repo, inventoryClient: inventoryClient, paymentClient: paymentClient, compensator: compensator, tm: tm, events: events}
 }
 
 func (s *OrderService) CreateOrder(ctx context.Context, userID int64, quantity int64, price int64, sku string) (*model.Order, error) {
 	orderID := uuid.New().String()
-	traceID := uuid.New().String()
+	// 复用请求的 TraceID，保证订单、库存扣减记录和日志处于同一条链路
+	traceID := traceid.FromContext(ctx)
+	if traceID == "" {
+		traceID = uuid.New().String()
+		ctx = logging.With(traceid.NewContext(ctx, traceID), logging.KeyTraceID, traceID)
+	}
+	// 之后的日志 (包括 SQL 日志) 都带上 order_id
+	ctx = logging.With(ctx, logging.KeyOrderID, orderID)
 	reqID := uuid.New().String()
 	var err error
 
@@ -56,11 +71,13 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID int64, quantity i
 	if err != nil {
 		return nil, apperror.Internal("failed to create order", err)
 	}
+	metrics.OrdersCreated.Inc()
+	s.publish(ctx, order)
 
 	// retry 3 times
 	for i := 0; i < 3; i++ {
 		// 调用库存服务减少库存
-		err = s.inventoryClient.Decrease(sku, reqID, orderID, traceID, quantity)
+		err = s.inventoryClient.Decrease(ctx, sku, reqID, orderID, traceID, quantity)
 		if err == nil {
 			break
 		}
@@ -68,30 +85,51 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID int64, quantity i
 		if !apperror.IsRetryable(err) {
 			break
 		}
-		time.Sleep(100 * time.Millisecond)
+		// 请求 deadline 已到就不再重试
+		if sleepErr := sleepCtx(ctx, 100*time.Millisecond); sleepErr != nil {
+			break
+		}
 	}
 	if err != nil {
-		s.repo.UpdateOrderStatus(ctx, orderID, model.OrderStatusFailed)
+		// 请求可能已超时，标记失败不能随请求一起被取消
+		s.repo.UpdateOrderStatus(context.WithoutCancel(ctx), orderID, model.OrderStatusFailed)
+		s.publishStatus(ctx, orderID)
+		metrics.OrdersFailed.WithLabelValues(metrics.StageInventory).Inc()
 		// Inventory client error might be retryable or not, but here we failed after retries
 		// 尽量保留原始错误类型，以便上层能区分是 4xx 还是 5xx
-		if _, ok := err.(*apperror.AppError); ok {
+		if appErr, ok := apperror.As(err); ok {
+			attrs := []any{logging.Err(appErr)}
+			if st := appErr.StackTrace(); st != "" {
+				attrs = append(attrs, logging.KeyStack, st)
+			}
+			logging.FromContext(ctx).ErrorContext(ctx, "create order failed at inventory", attrs...)
 			return nil, err
 		}
 		return nil, apperror.Internal("failed to decrease inventory after retries", err)
 	}
 	s.repo.UpdateOrderStatus(ctx, orderID, model.OrderStatusInventoryReserved)
+	s.publishStatus(ctx, orderID)
 
 	// 调用支付服务创建支付订单
-	paymentResp, err := s.paymentClient.ProcessPayment(ctx, orderID, totalAmount, traceID)
+	paymentResp, err := s.paymentClient.ProcessPayment(ctx, orderID, userID, totalAmount)
 
 	// 定义统一的补偿逻辑
-	handleFailure := func(cause error, needRefund bool) error {
+	handleFailure := func(stage string, cause error, needRefund bool) error {
+		metrics.OrdersFailed.WithLabelValues(stage).Inc()
+		// 补偿必须执行完，不受请求 deadline (middleware.Timeout) 或客户端断开的影响
+		ctx := context.WithoutCancel(ctx)
+
 		// 1. 如果需要退款 (例如支付成功但后续逻辑失败)，尝试退款
 		if needRefund {
 			// Best effort refund. If this fails, we need manual intervention or a more robust background job.
-			if refundErr := s.paymentClient.Refund(ctx, orderID, traceID); refundErr != nil {
-				// Log this critical error. In a real system, send to alert channel.
-				// fmt.Printf("CRITICAL: Failed to refund payment for order %s: %v\n", orderID, refundErr)
+			if refundErr := s.paymentClient.Refund(ctx, orderID); refundErr != nil {
+				// In a real system, send to alert channel.
+				logging.FromContext(ctx).ErrorContext(ctx, "refund failed, manual intervention required",
+					logging.Err(refundErr),
+					"amount", totalAmount,
+				)
+			} else {
+				metrics.OrdersCompensated.WithLabelValues(metrics.ActionPaymentRefund).Inc()
 			}
 		}
 
@@ -113,6 +151,7 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID int64, quantity i
 				Payload:       datatypes.JSON(mustMarshal(payload)),
 				Status:        model.OutboxStatusPending,
 				TraceID:       traceID,
+				TraceParent:   tracing.TraceParent(ctx),
 			}
 
 			return s.repo.SaveOutboxEvent(txCtx, outboxEvent)
@@ -121,6 +160,7 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID int64, quantity i
 		if txErr != nil {
 			return apperror.Internal("payment failed/compensated and persistence failed", txErr)
 		}
+		s.publishStatus(ctx, orderID)
 
 		return cause
 	}
@@ -129,29 +169,32 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID int64, quantity i
 		// 支付请求本身失败 (可能是网络错误或 500).
 		// 处于不确定状态，为了安全起见，可以尝试退款 (如果对方其实扣款成功了)
 		// 但为了简化，这里假设 error 意味着没扣款。
-		return nil, handleFailure(apperror.Internal("payment processing failed", err), false)
+		return nil, handleFailure(metrics.StagePayment, apperror.Internal("payment processing failed", err), false)
 	}
 
 	if paymentResp.Status != string(constants.PaymentStatusCompleted) {
-		return nil, handleFailure(apperror.Conflict("payment failed with status: "+paymentResp.Status, nil), false)
+		return nil, handleFailure(metrics.StagePayment, apperror.Conflict("payment failed with status: "+paymentResp.Status, nil), false)
 	}
 
 	// 支付成功，进入"危险区"
 	// 如果后续步骤失败，必须退款 + 回滚库存
 
 	if _, err := s.repo.UpdateOrderStatus(ctx, orderID, model.OrderStatusPaid); err != nil {
-		return nil, handleFailure(apperror.Internal("failed to update order status to PAID", err), true)
+		return nil, handleFailure(metrics.StagePersistence, apperror.Internal("failed to update order status to PAID", err), true)
 	}
+	s.publishStatus(ctx, orderID)
 
 	if _, err := s.repo.UpdateOrderStatus(ctx, orderID, model.OrderStatusCompleted); err != nil {
-		return nil, handleFailure(apperror.Internal("failed to update order status to COMPLETED", err), true)
+		return nil, handleFailure(metrics.StagePersistence, apperror.Internal("failed to update order status to COMPLETED", err), true)
 	}
+	s.publishStatus(ctx, orderID)
 
 	return order, nil
 }
 
-func (s *OrderService) GetOrder(ctx context.Context, orderID string) (*model.Order, error) {
-	order, err := s.repo.GetOrderByID(ctx, orderID)
+// GetOrder 查询订单；userID 非 0 时只能查到该用户自己的订单，其他用户的订单返回 NotFound
+func (s *OrderService) GetOrder(ctx context.Context, orderID string, userID int64) (*model.Order, error) {
+	order, err := s.repo.GetOrderByID(ctx, orderID, userID)
 	if err != nil {
 		return nil, apperror.Internal("database error", err)
 	}
@@ -161,18 +204,93 @@ func (s *OrderService) GetOrder(ctx context.Context, orderID string) (*model.Ord
 	return order, nil
 }
 
-func (s *OrderService) GetOrders(ctx context.Context) ([]*model.Order, error) {
-	orders, err := s.repo.GetOrders(ctx)
+// OrderPage 是 GetOrders 的分页结果
+type OrderPage struct {
+	Orders  []*model.Order
+	NextID  uint // 下一页的游标 (最后一条的 ID)，0 表示没有更多
+	HasMore bool
+	Total   int64
+}
+
+// GetOrders 分页查询订单；userID 非 0 时只返回该用户的订单
+func (s *OrderService) GetOrders(ctx context.Context, userID int64, beforeID uint, limit int) (*OrderPage, error) {
+	// 多取一条用于判断是否还有下一页
+	orders, err := s.repo.GetOrders(ctx, userID, beforeID, limit+1)
 	if err != nil {
 		return nil, apperror.Internal("failed to fetch orders", err)
 	}
+	total, err := s.repo.CountOrders(ctx, userID)
+	if err != nil {
+		return nil, apperror.Internal("failed to count orders", err)
+	}
+
+	page := &OrderPage{Orders: orders, Total: total}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		page.HasMore = true
+		page.NextID = page.Orders[limit-1].ID
+	}
 	// 如果没有订单，返回空切片而不是 nil (虽然 nil slice 序列化也是 null/[]，但显式一点更好)
-	if orders == nil {
-		orders = []*model.Order{}
+	if page.Orders == nil {
+		page.Orders = []*model.Order{}
+	}
+	return page, nil
+}
+
+// UpdateOrderStatus 更新订单状态并返回更新后的订单
+// ifMatch 为客户端持有的版本号 (If-Match)，非 0 时做乐观锁检查，版本不一致返回 Conflict
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus, ifMatch int64) (*model.Order, error) {
+	ctx = logging.With(ctx, logging.KeyOrderID, orderID)
+	if ifMatch != 0 {
+		if _, err := s.repo.UpdateOrderStatusWithVersion(ctx, orderID, status, ifMatch); err != nil {
+			if errors.Is(err, database.ErrVersionConflict) {
+				return nil, apperror.Conflict("order was modified by another request, reload and retry", err)
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, apperror.NotFound("Order not found", err)
+			}
+			return nil, apperror.Internal("failed to update order status", err)
+		}
+	} else {
+		rowsAffected, err := s.repo.UpdateOrderStatus(ctx, orderID, status)
+		if err != nil {
+			return nil, apperror.Internal("failed to update order status", err)
+		}
+		if rowsAffected == 0 {
+			return nil, apperror.NotFound("No update needed or order not found", nil)
+		}
 	}
-	return orders, nil
+
+	// 刚写入，必须从主库读取最新版本
+	order, err := s.GetOrder(database.WithReadYourWrites(ctx), orderID, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(ctx, order)
+	return order, nil
 }
 
-func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus) (int64, error) {
-	return s.repo.UpdateOrderStatus(ctx, orderID, status)
+// GetOrderHistory 返回订单的状态变更历史；userID 的含义同 GetOrder
+func (s *OrderService) GetOrderHistory(ctx context.Context, orderID string, userID int64, limit int) ([]audit.Entry, error) {
+	order, err := s.GetOrder(ctx, orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.GetHistory(ctx, order.ID, limit)
+	if err != nil {
+		return nil, apperror.Internal("failed to fetch order history", err)
+	}
+	return entries, nil
+}
+
+// sleepCtx 等待 d，ctx 结束时提前返回 ctx.Err()
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
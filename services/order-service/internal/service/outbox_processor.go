@@ -3,12 +3,15 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"order-service/internal/model"
 	"order-service/internal/repository"
 	"time"
 
 	"vv-ecommerce/pkg/async"
+	"vv-ecommerce/pkg/common/traceid"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/tracing"
 )
 
 type OutboxProcessor struct {
@@ -37,7 +40,7 @@ func (p *OutboxProcessor) Start() {
 			case <-ticker.C:
 				p.processEvents()
 			case <-p.stopChan:
-				log.Println("OutboxProcessor stopping...")
+				slog.Info("outbox processor stopping", logging.KeyComponent, "outbox")
 				return
 			}
 		}
@@ -49,12 +52,12 @@ func (p *OutboxProcessor) Stop() {
 }
 
 func (p *OutboxProcessor) processEvents() {
-	ctx := context.Background() // Should ideally have a timeout
+	ctx := logging.With(context.Background(), logging.KeyComponent, "outbox") // Should ideally have a timeout
 
 	// 1. Fetch pending events
 	events, err := p.repo.GetPendingOutboxEvents(ctx, 10) // Batch size 10
 	if err != nil {
-		log.Printf("Error fetching outbox events: %v", err)
+		logging.FromContext(ctx).Error("failed to fetch outbox events", logging.Err(err))
 		return
 	}
 
@@ -63,21 +66,27 @@ func (p *OutboxProcessor) processEvents() {
 	}
 
 	for _, event := range events {
+		// 每个事件在写入 outbox 时的 trace 中处理，投递和状态更新的 span 与原下单请求连在一起
+		ctx := eventContext(ctx, event)
+		logger := logging.FromContext(ctx).With(
+			"event_id", event.ID,
+			"event_type", event.EventType,
+		)
 		// 2. Process based on EventType
 		switch event.EventType {
 		case "InventoryRollback":
 			if err := p.publishInventoryRollback(ctx, event); err != nil {
-				log.Printf("Error processing event %d: %v", event.ID, err)
+				logger.Error("failed to process outbox event", logging.Err(err))
 				// Retry strategy? For now, leave as PENDING to be picked up again.
 				// In production, might want backoff or FAILED status after N attempts.
 			} else {
 				// 3. Mark as PROCESSED
 				if err := p.repo.UpdateOutboxEventStatus(ctx, event.ID, model.OutboxStatusProcessed); err != nil {
-					log.Printf("Error updating event status %d: %v", event.ID, err)
+					logger.Error("failed to update outbox event status", logging.Err(err))
 				}
 			}
 		default:
-			log.Printf("Unknown event type: %s", event.EventType)
+			logger.Warn("unknown outbox event type")
 			p.repo.UpdateOutboxEventStatus(ctx, event.ID, model.OutboxStatusFailed)
 		}
 	}
@@ -100,6 +109,7 @@ func (p *OutboxProcessor) publishInventoryRollback(ctx context.Context, event mo
 		"sku":      payload.SKU,
 		"quantity": payload.Quantity,
 		"trace_id": payload.TraceID,
+		"order_id": event.AggregateID,
 	}
 
 	messageBytes, err := json.Marshal(message)
@@ -108,5 +118,14 @@ func (p *OutboxProcessor) publishInventoryRollback(ctx context.Context, event mo
 	}
 
 	// Publish to RabbitMQ
-	return p.queue.Publish("inventory_rollback", messageBytes)
+	return p.queue.Publish(ctx, "inventory_rollback", messageBytes)
+}
+
+// eventContext 恢复写入 outbox 时的 trace 上下文和业务 TraceID，消费端的 span 也因此与原下单请求连在一起
+func eventContext(ctx context.Context, event model.OutboxEvent) context.Context {
+	ctx = tracing.ContextWithTraceParent(ctx, event.TraceParent)
+	if event.TraceID != "" {
+		ctx = logging.With(traceid.NewContext(ctx, event.TraceID), logging.KeyTraceID, event.TraceID)
+	}
+	return logging.With(ctx, logging.KeyOrderID, event.AggregateID)
 }
@@ -0,0 +1,248 @@
+package service_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"order-service/internal/app"
+	"order-service/internal/config"
+	"strings"
+	"testing"
+	"time"
+	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const gormScope = "gorm.io/plugin/opentelemetry"
+
+// stubService 模拟下游服务：与真实服务相同的 tracing 中间件，并通过 GORM 写 SQLite，产生 HTTP server span 和 SQL span
+// otelgin 和 GORM 插件在创建时取全局 TracerProvider，所以要在 app.New 之后再挂到 srv 上
+func stubService(t *testing.T, srv *httptest.Server, name string, routes func(r *gin.Engine)) {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	if err := db.Exec(`CREATE TABLE calls (id INTEGER PRIMARY KEY, path TEXT)`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(middleware.Tracing(name))
+	r.Use(func(c *gin.Context) {
+		db.WithContext(c.Request.Context()).Exec(`INSERT INTO calls (path) VALUES (?)`, c.Request.URL.Path)
+	})
+	routes(r)
+	srv.Config.Handler = r
+}
+
+// gateway 与 api-gateway 相同的埋点方式：otelgin server span + otelhttp Transport 转发
+func gateway(t *testing.T, orderURL string) *httptest.Server {
+	t.Helper()
+	target, _ := url.Parse(orderURL)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.URL.Path = strings.TrimPrefix(r.In.URL.Path, "/api/v1")
+			r.Out.Header.Set(middleware.UserIDHeader, "42")
+		},
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
+
+	r := gin.New()
+	r.Use(middleware.Tracing("api-gateway"))
+	r.POST("/api/v1/orders", gin.WrapH(proxy))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestCreateOrderIsOneTrace 下单 (支付失败 → outbox → MQ → 库存回滚) 经过的所有 span 属于同一条 trace，且父子关系完整
+func TestCreateOrderIsOneTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rolledBack := make(chan struct{}, 1)
+
+	inventory := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(inventory.Close)
+	payment := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(payment.Close)
+
+	t.Setenv("DATABASE_DRIVER", database.DriverSQLite)
+	t.Setenv("DATABASE_DBNAME", ":memory:")
+	t.Setenv("DATABASE_LOGLEVEL", "silent")
+	t.Setenv("INVENTORY_SERVICE_URL", inventory.URL)
+	t.Setenv("PAYMENT_SERVICE_URL", payment.URL)
+	t.Setenv("MQ_HOST", "127.0.0.1")
+	t.Setenv("MQ_PORT", "1")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, cleanup, err := app.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+	if err := a.Compensator.StartWorker(); err != nil {
+		t.Fatal(err)
+	}
+
+	stubService(t, inventory, "inventory-service", func(r *gin.Engine) {
+		r.POST("/inventory/decrease", func(c *gin.Context) { response.Success(c, nil) })
+		r.POST("/inventory/rollback", func(c *gin.Context) {
+			response.Success(c, nil)
+			rolledBack <- struct{}{}
+		})
+	})
+	stubService(t, payment, "payment-service", func(r *gin.Engine) {
+		r.POST("/payments", func(c *gin.Context) {
+			response.Success(c, gin.H{"order_id": "o-1", "status": "FAILED"})
+		})
+	})
+
+	// app.New 安装了 SDK TracerProvider，在它上面挂一个 recorder 收集所有服务的 span
+	recorder := tracetest.NewSpanRecorder()
+	otel.GetTracerProvider().(*sdktrace.TracerProvider).RegisterSpanProcessor(recorder)
+
+	order := httptest.NewServer(a.Router)
+	t.Cleanup(order.Close)
+	gw := gateway(t, order.URL)
+
+	resp, err := http.Post(gw.URL+"/api/v1/orders", "application/json", strings.NewReader(`{"sku":"S1","quantity":2,"price":100}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("status = %d, want 409 (payment failed)", resp.StatusCode)
+	}
+
+	a.OutboxProcessor.ProcessOutbox()
+	select {
+	case <-rolledBack:
+	case <-time.After(5 * time.Second):
+		t.Fatal("inventory rollback was not delivered")
+	}
+	// consumer span 在回滚请求返回后才结束
+	waitForSpan(t, recorder, "process inventory_rollback")
+
+	spans := recorder.Ended()
+	var root sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.SpanKind() == trace.SpanKindServer && !s.Parent().IsValid() {
+			if root != nil {
+				t.Fatalf("more than one root server span: %q and %q", root.Name(), s.Name())
+			}
+			root = s
+		}
+	}
+	if root == nil {
+		t.Fatal("no gateway server span recorded")
+	}
+	traceID := root.SpanContext().TraceID()
+
+	byID := map[trace.SpanID]sdktrace.ReadOnlySpan{}
+	for _, s := range spans {
+		if s.SpanContext().TraceID() == traceID {
+			byID[s.SpanContext().SpanID()] = s
+			continue
+		}
+		// 唯一允许的例外：outbox 轮询本身 (一次批量查询，不属于任何订单)
+		if s.InstrumentationScope().Name != gormScope || s.Parent().IsValid() || !strings.HasPrefix(statement(s), "SELECT * FROM `outbox_events`") {
+			t.Errorf("span %q (scope %s) is in trace %s, want %s", s.Name(), s.InstrumentationScope().Name, s.SpanContext().TraceID(), traceID)
+		}
+	}
+
+	// 父子关系完整：除根以外的每个 span 的父 span 都在同一条 trace 中被记录
+	for _, s := range byID {
+		if s == root {
+			continue
+		}
+		if _, ok := byID[s.Parent().SpanID()]; !ok {
+			t.Errorf("span %q has parent %s, which was not recorded", s.Name(), s.Parent().SpanID())
+		}
+	}
+
+	// 每一跳都出现在这条 trace 中
+	want := []struct {
+		desc string
+		ok   func(s sdktrace.ReadOnlySpan) bool
+	}{
+		{"order-service POST /orders", serverSpan("/orders")},
+		{"inventory-service POST /inventory/decrease", serverSpan("/inventory/decrease")},
+		{"payment-service POST /payments", serverSpan("/payments")},
+		{"order INSERT", sqlSpan("INSERT INTO `orders`")},
+		{"outbox INSERT", sqlSpan("INSERT INTO `outbox_events`")},
+		{"downstream SQL", sqlSpan("INSERT INTO calls")},
+		{"outbox relay status UPDATE", sqlSpan("UPDATE `outbox_events`")},
+		{"outbox relay publish", named("send inventory_rollback")},
+		{"rollback consumer", named("process inventory_rollback")},
+		{"inventory-service POST /inventory/rollback", serverSpan("/inventory/rollback")},
+	}
+	for _, w := range want {
+		found := false
+		for _, s := range byID {
+			if w.ok(s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("no %s span in trace %s", w.desc, traceID)
+		}
+	}
+	if t.Failed() {
+		for _, s := range spans {
+			t.Logf("%s %s parent=%s %q %s", s.SpanContext().TraceID(), s.SpanContext().SpanID(), s.Parent().SpanID(), s.Name(), statement(s))
+		}
+	}
+}
+
+func waitForSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, s := range recorder.Ended() {
+			if s.Name() == name {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("span %q was not ended", name)
+}
+
+func statement(s sdktrace.ReadOnlySpan) string {
+	for _, kv := range s.Attributes() {
+		if kv.Key == "db.query.text" || kv.Key == "db.statement" {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func serverSpan(route string) func(s sdktrace.ReadOnlySpan) bool {
+	return func(s sdktrace.ReadOnlySpan) bool {
+		return s.SpanKind() == trace.SpanKindServer && strings.HasSuffix(s.Name(), route)
+	}
+}
+
+func sqlSpan(prefix string) func(s sdktrace.ReadOnlySpan) bool {
+	return func(s sdktrace.ReadOnlySpan) bool {
+		return s.InstrumentationScope().Name == gormScope && strings.HasPrefix(statement(s), prefix)
+	}
+}
+
+func named(name string) func(s sdktrace.ReadOnlySpan) bool {
+	return func(s sdktrace.ReadOnlySpan) bool { return s.Name() == name }
+}
@@ -0,0 +1,11 @@
+// Package migrations 内嵌了服务的数据库迁移脚本，由 pkg/database/migrate 执行
+// 每个方言一个目录 (mysql/、sqlite/)，两边的版本号必须保持一致
+package migrations
+
+import "embed"
+
+// Dialects 是提供了迁移脚本的方言，"migrate create" 会在每个目录下生成文件
+var Dialects = []string{"mysql", "sqlite"}
+
+//go:embed mysql/*.sql sqlite/*.sql
+var FS embed.FS
@@ -0,0 +1,2 @@
+-- 写入 outbox 时的 W3C traceparent，异步投递时恢复 trace，使 MQ 消息与原请求处于同一条链路
+ALTER TABLE outbox_events ADD COLUMN trace_parent VARCHAR(64);
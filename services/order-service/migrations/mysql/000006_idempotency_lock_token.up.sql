@@ -0,0 +1,2 @@
+-- 当前持有者的 token (pkg/idempotency.SQLStore)：超过 locked_until 被接管后，原持有者不能再保存或删除这条记录
+ALTER TABLE idempotency_keys ADD COLUMN lock_token CHAR(36) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS outbox_events;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,2 @@
+-- 乐观锁版本号，每次更新 +1，对外以 ETag 暴露
+ALTER TABLE orders ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_log;
+ALTER TABLE orders DROP COLUMN updated_by;
+ALTER TABLE orders DROP COLUMN created_by;
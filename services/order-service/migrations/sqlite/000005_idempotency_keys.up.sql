@@ -0,0 +1,12 @@
+-- Idempotency-Key 对应的请求指纹与最终响应 (pkg/idempotency.SQLStore)，status_code 为 0 表示处理中
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key CHAR(64) PRIMARY KEY,
+    fingerprint CHAR(64) NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    header BLOB,
+    body BLOB,
+    locked_until DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
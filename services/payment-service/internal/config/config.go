@@ -2,23 +2,53 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/idempotency"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/server"
+	"vv-ecommerce/pkg/tracing"
 
 	"github.com/spf13/viper"
 )
 
 type DatabaseConfig struct {
+	// Driver 为 "mysql" (默认) 或 "sqlite"；sqlite 时 DBName 是数据库文件路径，为空则使用内存库
+	Driver   string `mapstructure:"Driver"`
 	Host     string `mapstructure:"Host"`
 	Port     string `mapstructure:"Port"`
 	User     string `mapstructure:"User"`
 	Password string `mapstructure:"Password"`
 	DBName   string `mapstructure:"DBName"`
+
+	// 连接池 / 慢查询 / SQL 日志级别 (silent|error|warn|info)，如 DATABASE_POOL_MAXOPENCONNS=50
+	Pool          database.PoolConfig `mapstructure:"Pool"`
+	SlowThreshold time.Duration       `mapstructure:"SlowThreshold"`
+	LogLevel      string              `mapstructure:"LogLevel"`
+}
+
+// RedisConfig Redis 配置 (Idempotency.Store 为 redis 时使用)
+type RedisConfig struct {
+	Addr     string `mapstructure:"Addr"`
+	Password string `mapstructure:"Password"`
+	DB       int    `mapstructure:"DB"`
 }
 
 type Config struct {
-	ServerPort int            `mapstructure:"ServerPort"`
-	Database   DatabaseConfig `mapstructure:"Database"`
+	ServerPort      int            `mapstructure:"ServerPort"`
+	ErrorStackTrace bool           `mapstructure:"ErrorStackTrace"` // 创建 AppError 时是否采集调用栈
+	Database        DatabaseConfig `mapstructure:"Database"`
+	Redis           RedisConfig    `mapstructure:"Redis"`
+	Log             logging.Config `mapstructure:"Log"`     // 如 LOG_LEVEL=debug LOG_FORMAT=text
+	Tracing         tracing.Config `mapstructure:"Tracing"` // OpenTelemetry，如 TRACING_EXPORTER=otlp TRACING_ENDPOINT=otel-collector:4318
+	Health          health.Config  `mapstructure:"Health"`  // 探针，如 HEALTH_SHUTDOWNDELAY=10s
+	Server          server.Config  `mapstructure:"Server"`  // HTTP 超时与过载保护，如 SERVER_WRITETIMEOUT=60s
+
+	Idempotency idempotency.Config `mapstructure:"Idempotency"` // POST /payments 的 Idempotency-Key 存储，如 IDEMPOTENCY_STORE=redis
 }
 
 func LoadConfig() (*Config, error) {
@@ -34,18 +64,63 @@ func LoadConfig() (*Config, error) {
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			fmt.Printf("Warning: Config file for environment '%s' not found.\n", env)
+			slog.Warn("config file not found", "env", env)
 		} else {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
 	}
 
 	viper.SetDefault("ServerPort", 8083)
+	viper.SetDefault("Database.Driver", "mysql")
 	viper.SetDefault("Database.Host", "localhost")
 	viper.SetDefault("Database.Port", "3306")
 	viper.SetDefault("Database.User", "root")
 	viper.SetDefault("Database.Password", "root")
 	viper.SetDefault("Database.DBName", "payment_db")
+	viper.SetDefault("Database.Pool.MaxIdleConns", 10)
+	viper.SetDefault("Database.Pool.MaxOpenConns", 100)
+	viper.SetDefault("Database.Pool.ConnMaxLifetime", "1h")
+	viper.SetDefault("Database.Pool.ConnMaxIdleTime", "10m")
+	viper.SetDefault("Database.SlowThreshold", "200ms")
+	viper.SetDefault("Database.LogLevel", "warn")
+	viper.SetDefault("Log.Level", "info")
+	viper.SetDefault("Log.Format", logging.FormatJSON)
+	viper.SetDefault("Log.PanicFile", "")
+	// 默认全量记录访问日志，探针和 /metrics 只在出错时记录；DebugTraceIDs 为空即不记录请求体
+	viper.SetDefault("Log.Access.SampleRate", 1.0)
+	viper.SetDefault("Log.Access.Routes", logging.DefaultAccessRoutes())
+	viper.SetDefault("Log.Access.DebugTraceIDs", []string{})
+	viper.SetDefault("Log.Access.MaxBodyBytes", logging.DefaultMaxBodyBytes)
+	viper.SetDefault("Log.Redact.Fields", []string{})
+	viper.SetDefault("Log.Redact.Headers", []string{})
+	viper.SetDefault("Log.Redact.QueryParams", []string{})
+	viper.SetDefault("Log.Redact.Mask", logging.DefaultMask)
+	viper.SetDefault("Tracing.Exporter", tracing.ExporterNone)
+	viper.SetDefault("Tracing.Endpoint", "")
+	viper.SetDefault("Tracing.Insecure", true)
+	viper.SetDefault("Tracing.SampleRatio", 1.0)
+	viper.SetDefault("Redis.Addr", "localhost:6379")
+	viper.SetDefault("Redis.Password", "")
+	viper.SetDefault("Redis.DB", 0)
+	viper.SetDefault("Idempotency.Store", idempotency.StoreSQL)
+	viper.SetDefault("Idempotency.TTL", "24h")
+	viper.SetDefault("Idempotency.LockTTL", "30s")
+	viper.SetDefault("Health.Timeout", "2s")
+	viper.SetDefault("Health.CacheTTL", "2s")
+	viper.SetDefault("Health.ShutdownDelay", "5s")
+	srv := server.Defaults()
+	viper.SetDefault("Server.ReadHeaderTimeout", srv.ReadHeaderTimeout)
+	viper.SetDefault("Server.ReadTimeout", srv.ReadTimeout)
+	viper.SetDefault("Server.WriteTimeout", srv.WriteTimeout)
+	viper.SetDefault("Server.IdleTimeout", srv.IdleTimeout)
+	viper.SetDefault("Server.ShutdownTimeout", srv.ShutdownTimeout)
+	viper.SetDefault("Server.RequestTimeout.Default", srv.RequestTimeout.Default)
+	viper.SetDefault("Server.MaxBodyBytes", srv.MaxBodyBytes)
+	viper.SetDefault("Server.LoadShed.InitialLimit", srv.LoadShed.InitialLimit)
+	viper.SetDefault("Server.LoadShed.MinLimit", srv.LoadShed.MinLimit)
+	viper.SetDefault("Server.LoadShed.MaxLimit", srv.LoadShed.MaxLimit)
+	viper.SetDefault("Server.LoadShed.LatencyTarget", srv.LoadShed.LatencyTarget)
+	viper.SetDefault("Server.LoadShed.RetryAfter", srv.LoadShed.RetryAfter)
 
 	// Allow environment variables to override config, replacing . with _
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
@@ -55,6 +130,9 @@ func LoadConfig() (*Config, error) {
 	if err := viper.Unmarshal(cfg); err != nil {
 		return nil, fmt.Errorf("unable to decode into struct, %v", err)
 	}
+	if err := cfg.Idempotency.Validate(); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
@@ -1,10 +1,11 @@
 package handler
 
 import (
-	"net/http"
 	"payment-service/internal/service"
+	"strconv"
 	"vv-ecommerce/pkg/common/apperror"
 	"vv-ecommerce/pkg/common/response"
+	"vv-ecommerce/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,6 +23,9 @@ func NewPaymentHandler(s *service.PaymentService) *PaymentHandler {
 type ProcessPaymentRequest struct {
 	OrderID string `json:"order_id" binding:"required"`
 	Amount  int64  `json:"amount" binding:"required,gt=0"`
+	// UserID 是下单用户，只在服务间调用 (order-service，不带 X-User-ID) 时使用；
+	// 经网关的请求以 X-User-ID 为准，网关已经确认订单属于该用户
+	UserID int64 `json:"user_id"`
 }
 
 func (h *PaymentHandler) ProcessPaymentHandler(c *gin.Context) {
@@ -31,13 +35,26 @@ func (h *PaymentHandler) ProcessPaymentHandler(c *gin.Context) {
 		return
 	}
 
-	payment, err := h.service.ProcessPayment(req.OrderID, req.Amount)
+	userID := req.UserID
+	if c.GetHeader(middleware.UserIDHeader) != "" {
+		var err error
+		if userID, err = middleware.UserID(c); err != nil {
+			response.Error(c, err)
+			return
+		}
+		if req.UserID != 0 && req.UserID != userID {
+			response.Error(c, apperror.Forbidden("cannot create a payment for another user", nil))
+			return
+		}
+	}
+
+	payment, err := h.service.ProcessPayment(c.Request.Context(), req.OrderID, userID, req.Amount)
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, payment)
+	response.Success(c, payment)
 }
 
 func (h *PaymentHandler) RefundPaymentHandler(c *gin.Context) {
@@ -49,12 +66,18 @@ func (h *PaymentHandler) RefundPaymentHandler(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.RefundPayment(req.OrderID); err != nil {
+	ifMatch, err := response.IfMatch(c)
+	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]string{"message": "Refund processed successfully"})
+	if err := h.service.RefundPayment(c.Request.Context(), req.OrderID, ifMatch); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, map[string]string{"message": "Refund processed successfully"})
 }
 
 func (h *PaymentHandler) GetPaymentHandler(c *gin.Context) {
@@ -64,11 +87,56 @@ func (h *PaymentHandler) GetPaymentHandler(c *gin.Context) {
 		return
 	}
 
-	payment, err := h.service.GetPayment(orderID)
+	// 非管理员只能查到自己的支付
+	owner, err := middleware.OwnerFilter(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	payment, err := h.service.GetPayment(c.Request.Context(), orderID, owner)
 	if err != nil {
 		response.Error(c, apperror.NotFound("Payment not found", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, payment)
+	response.SetETag(c, payment.Version)
+	response.Success(c, payment)
+}
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+func (h *PaymentHandler) GetPaymentHistoryHandler(c *gin.Context) {
+	orderID := c.Query("order_id")
+	if orderID == "" {
+		response.Error(c, apperror.InvalidInput("Missing order_id", nil))
+		return
+	}
+
+	owner, err := middleware.OwnerFilter(c)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			response.Error(c, apperror.InvalidInput("invalid limit", err))
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+
+	entries, err := h.service.GetPaymentHistory(c.Request.Context(), orderID, owner, limit)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, entries)
 }
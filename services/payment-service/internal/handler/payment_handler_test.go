@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"payment-service/internal/model"
+	"payment-service/internal/repository"
+	"payment-service/internal/service"
+	"payment-service/migrations"
+	"strings"
+	"testing"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/migrate"
+	"vv-ecommerce/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter 在内存 SQLite 上创建 user 7 和 user 8 各一笔支付
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := migrate.New(sqlDB, database.DriverSQLite, migrations.FS, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	repo := repository.NewPaymentRepository(db)
+	for _, p := range []*model.Payment{
+		{OrderID: "o-7", UserID: 7, Amount: 100, Status: "COMPLETED"},
+		{OrderID: "o-8", UserID: 8, Amount: 200, Status: "COMPLETED"},
+	} {
+		if err := repo.CreatePayment(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewPaymentHandler(service.NewPaymentService(repo))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/payments", h.ProcessPaymentHandler)
+	r.GET("/payments", h.GetPaymentHandler)
+	r.GET("/payments/history", h.GetPaymentHistoryHandler)
+	return r
+}
+
+func serve(r *gin.Engine, req *http.Request, userID, roles string) *httptest.ResponseRecorder {
+	if userID != "" {
+		req.Header.Set(middleware.UserIDHeader, userID)
+	}
+	if roles != "" {
+		req.Header.Set(middleware.UserRolesHeader, roles)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetPaymentOnlyReturnsOwnPayments(t *testing.T) {
+	r := newTestRouter(t)
+
+	for _, tc := range []struct {
+		name, path, userID, roles string
+		want                      int
+	}{
+		{"owner", "/payments?order_id=o-7", "7", "", http.StatusOK},
+		{"other user", "/payments?order_id=o-8", "7", "", http.StatusNotFound},
+		{"admin", "/payments?order_id=o-8", "7", "admin", http.StatusOK},
+		{"anonymous", "/payments?order_id=o-7", "", "", http.StatusUnauthorized},
+		{"other user's history", "/payments/history?order_id=o-8", "7", "", http.StatusNotFound},
+		{"own history", "/payments/history?order_id=o-7", "7", "", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(r, httptest.NewRequest(http.MethodGet, tc.path, nil), tc.userID, tc.roles)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestProcessPaymentOwner 经网关的请求以 X-User-ID 为准，请求体中的 user_id 只用于服务间调用
+func TestProcessPaymentOwner(t *testing.T) {
+	r := newTestRouter(t)
+
+	for _, tc := range []struct {
+		name, orderID, userID, bodyUserID string
+		status                            int
+		want                              int64
+	}{
+		{name: "gateway", orderID: "o-1", userID: "9", status: http.StatusOK, want: 9},
+		{name: "gateway, same user in body", orderID: "o-3", userID: "9", bodyUserID: "9", status: http.StatusOK, want: 9},
+		{name: "gateway, another user in body", orderID: "o-4", userID: "9", bodyUserID: "5", status: http.StatusForbidden},
+		{name: "service call", orderID: "o-2", bodyUserID: "5", status: http.StatusOK, want: 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"order_id":"` + tc.orderID + `","amount":100`
+			if tc.bodyUserID != "" {
+				body += `,"user_id":` + tc.bodyUserID
+			}
+			req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body+"}"))
+			req.Header.Set("Content-Type", "application/json")
+			w := serve(r, req, tc.userID, "")
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Data model.Payment `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Data.UserID != tc.want {
+				t.Fatalf("user_id = %d, want %d", resp.Data.UserID, tc.want)
+			}
+		})
+	}
+}
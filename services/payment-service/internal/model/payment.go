@@ -1,14 +1,22 @@
 package model
 
-import "time"
+import (
+	"time"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+)
 
 type Payment struct {
 	ID            uint      `gorm:"primaryKey" json:"id"`
 	OrderID       string    `gorm:"type:varchar(255);uniqueIndex" json:"order_id"` // 关联的订单ID
+	UserID        int64     `gorm:"index" json:"user_id"`                          // 下单用户，查询时非管理员只能看到自己的支付
 	Amount        int64     `json:"amount"`                                        // 支付金额 (单位：分，避免浮点数)
 	Status        string    `json:"status"`                                        // PENDING, COMPLETED, FAILED
 	TransactionID string    `json:"transaction_id"`                                // 模拟的交易流水号
 	TraceID       string    `gorm:"type:varchar(255);index" json:"trace_id"`       // 全链路追踪ID
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
+
+	database.Versioned // 乐观锁版本号，防止并发退款/状态更新互相覆盖
+	audit.Fields       // created_by / updated_by，变更历史见 audit_log
 }
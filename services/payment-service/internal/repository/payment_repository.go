@@ -1,15 +1,21 @@
 package repository
 
 import (
+	"context"
 	"payment-service/internal/model"
+	"strconv"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
 
 	"gorm.io/gorm"
 )
 
 type PaymentRepository interface {
-	CreatePayment(payment *model.Payment) error
-	GetPaymentByOrderID(orderID string) (*model.Payment, error)
-	UpdatePaymentStatus(paymentID uint, status string, transactionID string) error
+	CreatePayment(ctx context.Context, payment *model.Payment) error
+	// userID 限定支付所属的用户，为 0 时不限制 (管理员和服务内部调用)
+	GetPaymentByOrderID(ctx context.Context, orderID string, userID int64) (*model.Payment, error)
+	UpdatePaymentStatus(ctx context.Context, paymentID uint, expectedVersion int64, status string, transactionID string) (int64, error)
+	GetHistory(ctx context.Context, paymentID uint, limit int) ([]audit.Entry, error)
 }
 
 type GORMPaymentRepository struct {
@@ -20,21 +26,31 @@ func NewPaymentRepository(db *gorm.DB) PaymentRepository {
 	return &GORMPaymentRepository{db: db}
 }
 
-func (r *GORMPaymentRepository) CreatePayment(payment *model.Payment) error {
-	return r.db.Create(payment).Error
+func (r *GORMPaymentRepository) CreatePayment(ctx context.Context, payment *model.Payment) error {
+	return database.GetDB(ctx, r.db).Create(payment).Error
 }
 
-func (r *GORMPaymentRepository) GetPaymentByOrderID(orderID string) (*model.Payment, error) {
+func (r *GORMPaymentRepository) GetPaymentByOrderID(ctx context.Context, orderID string, userID int64) (*model.Payment, error) {
 	var payment model.Payment
-	if err := r.db.Where("order_id = ?", orderID).First(&payment).Error; err != nil {
+	query := database.GetDB(ctx, r.db).Where("order_id = ?", orderID)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.First(&payment).Error; err != nil {
 		return nil, err
 	}
 	return &payment, nil
 }
 
-func (r *GORMPaymentRepository) UpdatePaymentStatus(paymentID uint, status string, transactionID string) error {
-	return r.db.Model(&model.Payment{}).Where("id = ?", paymentID).Updates(map[string]interface{}{
+// UpdatePaymentStatus 只有当前版本等于 expectedVersion 时才更新，返回新版本号
+func (r *GORMPaymentRepository) UpdatePaymentStatus(ctx context.Context, paymentID uint, expectedVersion int64, status string, transactionID string) (int64, error) {
+	return database.UpdateWithVersion(database.GetDB(ctx, r.db), &model.Payment{}, expectedVersion, map[string]interface{}{
 		"status":         status,
 		"transaction_id": transactionID,
-	}).Error
+	}, "id = ?", paymentID)
+}
+
+// GetHistory 返回支付记录的变更历史 (最新的在前)
+func (r *GORMPaymentRepository) GetHistory(ctx context.Context, paymentID uint, limit int) ([]audit.Entry, error) {
+	return audit.History(ctx, r.db, "payments", strconv.FormatUint(uint64(paymentID), 10), limit)
 }
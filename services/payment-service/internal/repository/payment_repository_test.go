@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"payment-service/internal/model"
+	"payment-service/migrations"
+	"testing"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/database/migrate"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB 打开内存 SQLite 并执行内嵌迁移，与服务启动时的表结构一致
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, LogLevel: "silent"})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := migrate.New(sqlDB, database.DriverSQLite, migrations.FS, database.DriverSQLite)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if err := db.Use(audit.New(audit.Config{System: "payment-service"})); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCreateAndGetPayment(t *testing.T) {
+	repo := NewPaymentRepository(openTestDB(t))
+	ctx := context.Background()
+
+	payment := &model.Payment{OrderID: "o-1", Amount: 1999, Status: "PENDING", TraceID: "t-1"}
+	if err := repo.CreatePayment(ctx, payment); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	got, err := repo.GetPaymentByOrderID(ctx, "o-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != payment.ID || got.Amount != 1999 || got.Status != "PENDING" || got.Version != 1 {
+		t.Fatalf("got %+v", got)
+	}
+
+	// 每个订单只能有一笔支付
+	if err := repo.CreatePayment(ctx, &model.Payment{OrderID: "o-1", Amount: 1}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("duplicate order_id: err = %v, want gorm.ErrDuplicatedKey", err)
+	}
+	if _, err := repo.GetPaymentByOrderID(ctx, "o-2", 0); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("unknown order: err = %v", err)
+	}
+}
+
+func TestUpdatePaymentStatusWithVersion(t *testing.T) {
+	repo := NewPaymentRepository(openTestDB(t))
+	ctx := audit.WithActor(context.Background(), audit.Actor{ID: "7", TraceID: "t-1"})
+
+	payment := &model.Payment{OrderID: "o-1", Amount: 1999, Status: "PENDING"}
+	if err := repo.CreatePayment(ctx, payment); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := repo.UpdatePaymentStatus(ctx, payment.ID, 1, "COMPLETED", "tx-1")
+	if err != nil || version != 2 {
+		t.Fatalf("update = %d, %v", version, err)
+	}
+	// 并发退款持有旧版本，不能覆盖已完成的状态
+	if _, err := repo.UpdatePaymentStatus(ctx, payment.ID, 1, "REFUNDED", "tx-2"); !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	got, _ := repo.GetPaymentByOrderID(ctx, "o-1", 0)
+	if got.Status != "COMPLETED" || got.TransactionID != "tx-1" || got.UpdatedBy != "7" {
+		t.Fatalf("got %+v", got)
+	}
+
+	history, err := repo.GetHistory(ctx, payment.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Action != "update" || history[0].TraceID != "t-1" {
+		t.Fatalf("history = %+v", history)
+	}
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(history[0].Before, &before); err != nil {
+		t.Fatalf("before_json: %v", err)
+	}
+	if err := json.Unmarshal(history[0].After, &after); err != nil {
+		t.Fatalf("after_json: %v", err)
+	}
+	if before["status"] != "PENDING" || after["status"] != "COMPLETED" || after["transaction_id"] != "tx-1" {
+		t.Fatalf("change: before %v, after %v", before, after)
+	}
+}
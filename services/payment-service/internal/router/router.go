@@ -1,30 +1,45 @@
 package router
 
 import (
-	"fmt"
-	"net/http"
 	"payment-service/internal/handler"
+	"vv-ecommerce/pkg/health"
+	"vv-ecommerce/pkg/metrics"
 	"vv-ecommerce/pkg/middleware"
+	"vv-ecommerce/pkg/server"
 
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter(h *handler.PaymentHandler) *gin.Engine {
+func NewRouter(h *handler.PaymentHandler, checker *health.Checker, srv server.Config, idempotent gin.HandlerFunc) *gin.Engine {
 	r := gin.New()
+	r.Use(middleware.Tracing("payment-service"))
 	r.Use(middleware.TraceID())
+	r.Use(middleware.Actor())
 	r.Use(middleware.Logger())
+	r.Use(middleware.Metrics())
 	r.Use(middleware.Recovery())
 
-	// Health Check
-	r.GET("/health", func(c *gin.Context) {
-		c.String(http.StatusOK, "Payment Service is healthy")
-		fmt.Println("Payment Service is healthy")
-	})
+	// Probes: /livez 只表示进程存活，/readyz 检查依赖，关闭期间返回 503
+	r.GET("/livez", checker.Live)
+	r.GET("/readyz", checker.Ready)
+	// /health 是旧的探针地址，保留为 /readyz 的别名，兼容已有的探针和 compose healthcheck
+	r.GET("/health", checker.Ready)
+
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// 业务路由：过载保护、请求 deadline、请求体上限 (探针和 /metrics 不受影响)
+	api := r.Group("",
+		middleware.LoadShed(srv.LoadShed),
+		middleware.Timeout(srv.RequestTimeout),
+		middleware.BodyLimit(srv.MaxBodyBytes),
+	)
 
 	// Payment Routes
-	r.POST("/payments", h.ProcessPaymentHandler)
-	r.POST("/payments/refund", h.RefundPaymentHandler)
-	r.GET("/payments", h.GetPaymentHandler)
+	api.POST("/payments", idempotent, h.ProcessPaymentHandler) // 支持 Idempotency-Key
+	api.POST("/payments/refund", h.RefundPaymentHandler)
+	api.GET("/payments", h.GetPaymentHandler)
+	api.GET("/payments/history", h.GetPaymentHistoryHandler)
 
 	return r
 }
@@ -1,13 +1,20 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"payment-service/internal/model"
 	"payment-service/internal/repository"
 	"time"
+	"vv-ecommerce/pkg/common/apperror"
 	"vv-ecommerce/pkg/common/constants"
+	"vv-ecommerce/pkg/database"
+	"vv-ecommerce/pkg/database/audit"
+	"vv-ecommerce/pkg/logging"
+	"vv-ecommerce/pkg/metrics"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type PaymentService struct {
@@ -18,14 +25,21 @@ func NewPaymentService(repo repository.PaymentRepository) *PaymentService {
 	return &PaymentService{repo: repo}
 }
 
-func (s *PaymentService) ProcessPayment(orderID string, amount int64) (*model.Payment, error) {
+// ProcessPayment 为 userID 的订单创建并执行支付
+func (s *PaymentService) ProcessPayment(ctx context.Context, orderID string, userID int64, amount int64) (*model.Payment, error) {
+	ctx = logging.With(ctx, logging.KeyOrderID, orderID)
 	// 1. 创建初始支付记录 (PENDING)
 	payment := &model.Payment{
 		OrderID: orderID,
+		UserID:  userID,
 		Amount:  amount,
 		Status:  string(constants.PaymentStatusPending),
 	}
-	if err := s.repo.CreatePayment(payment); err != nil {
+	if err := s.repo.CreatePayment(ctx, payment); err != nil {
+		// order_id 唯一：重复支付请求返回冲突，而不是数据库错误
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, apperror.Conflict("payment already exists for this order", err)
+		}
 		return nil, err
 	}
 
@@ -59,23 +73,35 @@ func (s *PaymentService) ProcessPayment(orderID string, amount int64) (*model.Pa
 	}
 
 	// 3. 更新支付状态
-	if updateErr := s.repo.UpdatePaymentStatus(payment.ID, newStatus, transactionID); updateErr != nil {
+	version, updateErr := s.repo.UpdatePaymentStatus(ctx, payment.ID, payment.Version, newStatus, transactionID)
+	if updateErr != nil {
 		// 如果更新数据库失败，这是一个严重错误（数据不一致）
 		// 实际场景可能需要异步重试或人工介入
 		return nil, updateErr
 	}
 
 	payment.Status = newStatus
+	if newStatus == string(constants.PaymentStatusFailed) {
+		metrics.PaymentsDeclined.Inc()
+	}
 	payment.TransactionID = transactionID
+	payment.Version = version
 
 	return payment, err
 }
 
-func (s *PaymentService) RefundPayment(orderID string) error {
-	payment, err := s.repo.GetPaymentByOrderID(orderID)
+// RefundPayment 退款；ifMatch 为客户端持有的版本号 (If-Match)，为 0 时使用读取到的版本
+// 并发的重复退款只有一个能成功，其余返回 Conflict
+func (s *PaymentService) RefundPayment(ctx context.Context, orderID string, ifMatch int64) error {
+	ctx = logging.With(ctx, logging.KeyOrderID, orderID)
+	payment, err := s.repo.GetPaymentByOrderID(ctx, orderID, 0)
 	if err != nil {
 		return err
 	}
+	expected := payment.Version
+	if ifMatch != 0 {
+		expected = ifMatch
+	}
 
 	if payment.Status != string(constants.PaymentStatusCompleted) {
 		return errors.New("cannot refund payment: payment not completed")
@@ -84,12 +110,29 @@ func (s *PaymentService) RefundPayment(orderID string) error {
 	// In a real system, we would call the payment gateway's refund API here.
 	refundTransactionID := "REF-" + uuid.New().String()
 
-	if err := s.repo.UpdatePaymentStatus(payment.ID, string(constants.PaymentStatusRefunded), refundTransactionID); err != nil {
+	if _, err := s.repo.UpdatePaymentStatus(ctx, payment.ID, expected, string(constants.PaymentStatusRefunded), refundTransactionID); err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			return apperror.Conflict("payment was modified by another request, reload and retry", err)
+		}
 		return err
 	}
 	return nil
 }
 
-func (s *PaymentService) GetPayment(orderID string) (*model.Payment, error) {
-	return s.repo.GetPaymentByOrderID(orderID)
+// GetPayment 查询订单的支付记录；userID 非 0 时只能查到该用户自己的支付
+func (s *PaymentService) GetPayment(ctx context.Context, orderID string, userID int64) (*model.Payment, error) {
+	return s.repo.GetPaymentByOrderID(ctx, orderID, userID)
+}
+
+// GetPaymentHistory 返回订单对应支付记录的变更历史；userID 的含义同 GetPayment
+func (s *PaymentService) GetPaymentHistory(ctx context.Context, orderID string, userID int64, limit int) ([]audit.Entry, error) {
+	payment, err := s.repo.GetPaymentByOrderID(ctx, orderID, userID)
+	if err != nil {
+		return nil, apperror.NotFound("Payment not found", err)
+	}
+	entries, err := s.repo.GetHistory(ctx, payment.ID, limit)
+	if err != nil {
+		return nil, apperror.Internal("failed to fetch payment history", err)
+	}
+	return entries, nil
 }
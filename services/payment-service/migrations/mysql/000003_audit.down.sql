@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_log;
+ALTER TABLE payments DROP COLUMN updated_by;
+ALTER TABLE payments DROP COLUMN created_by;
@@ -0,0 +1,17 @@
+-- 操作者由 pkg/database/audit 插件自动填充
+ALTER TABLE payments ADD COLUMN created_by VARCHAR(255);
+ALTER TABLE payments ADD COLUMN updated_by VARCHAR(255);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    entity_type VARCHAR(255) NOT NULL,
+    entity_id VARCHAR(255) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor VARCHAR(255),
+    trace_id VARCHAR(255),
+    before_json JSON,
+    after_json JSON,
+    created_at DATETIME(3),
+    INDEX idx_audit_log_entity (entity_type, entity_id),
+    INDEX idx_audit_log_trace_id (trace_id)
+);
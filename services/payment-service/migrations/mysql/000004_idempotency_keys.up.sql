@@ -0,0 +1,12 @@
+-- Idempotency-Key 对应的请求指纹与最终响应 (pkg/idempotency.SQLStore)，status_code 为 0 表示处理中
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key CHAR(64) PRIMARY KEY,
+    fingerprint CHAR(64) NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    header BLOB,
+    body MEDIUMBLOB,
+    locked_until DATETIME(3) NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
+    INDEX idx_expires_at (expires_at)
+);
@@ -0,0 +1 @@
+ALTER TABLE payments DROP INDEX idx_user_id, DROP COLUMN user_id;
@@ -0,0 +1,2 @@
+-- 支付所属的用户，查询支付时非管理员只能看到自己的；已有的支付记录为 0，只有管理员可见
+ALTER TABLE payments ADD COLUMN user_id BIGINT NOT NULL DEFAULT 0, ADD INDEX idx_user_id (user_id);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS payments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id VARCHAR(255) NOT NULL UNIQUE,
+    amount BIGINT,
+    status VARCHAR(50),
+    transaction_id VARCHAR(255),
+    trace_id VARCHAR(255),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_payments_trace_id ON payments (trace_id);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    aggregate_type VARCHAR(255) NOT NULL,
+    aggregate_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(255) NOT NULL,
+    payload JSON NOT NULL,
+    status VARCHAR(50) DEFAULT 'PENDING',
+    trace_id VARCHAR(255),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_status ON outbox_events (status);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_created_at ON outbox_events (created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_payments_user_id;
+ALTER TABLE payments DROP COLUMN user_id;
@@ -0,0 +1,3 @@
+-- 支付所属的用户，查询支付时非管理员只能看到自己的；已有的支付记录为 0，只有管理员可见
+ALTER TABLE payments ADD COLUMN user_id BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_payments_user_id ON payments (user_id);